@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+)
+
+// runAdmin 命令行管理管理员账号
+// 多人审批依赖管理员之间相互制约，账号只能由服务器运维通过命令行添加、启用/禁用和重置密码，
+// 管理后台只能查看，避免单个管理员自行添加账号或重置他人密码后独自完成审批
+//
+//	ezpay admin list
+//	ezpay admin create -username alice -email alice@example.com
+//	ezpay admin disable -username alice
+//	ezpay admin enable -username alice
+//	ezpay admin reset-password -username alice
+func runAdmin(args []string) int {
+	if len(args) == 0 {
+		adminUsage()
+		return 2
+	}
+
+	cmd := args[0]
+	fs := flag.NewFlagSet("admin "+cmd, flag.ContinueOnError)
+	username := fs.String("username", "", "管理员用户名")
+	email := fs.String("email", "", "管理员邮箱(create)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if cmd == "list" {
+		return listAdmins()
+	}
+	if *username == "" {
+		adminUsage()
+		return 2
+	}
+
+	var err error
+	switch cmd {
+	case "create":
+		err = createAdmin(*username, *email)
+	case "disable":
+		err = setAdminStatus(*username, 0)
+	case "enable":
+		err = setAdminStatus(*username, 1)
+	case "reset-password":
+		err = resetAdminPassword(*username)
+	default:
+		adminUsage()
+		return 2
+	}
+	if err != nil {
+		log.Printf("操作失败: %v", err)
+		return 1
+	}
+	return 0
+}
+
+func adminUsage() {
+	fmt.Fprintln(os.Stderr, "用法: ezpay admin <list|create|disable|enable|reset-password> [-username 用户名] [-email 邮箱]")
+}
+
+// listAdmins 列出管理员
+func listAdmins() int {
+	var admins []model.Admin
+	if err := model.GetDB().Order("id ASC").Find(&admins).Error; err != nil {
+		log.Printf("查询失败: %v", err)
+		return 1
+	}
+	for _, a := range admins {
+		status := "启用"
+		if a.Status != 1 {
+			status = "禁用"
+		}
+		fmt.Printf("%d\t%s\t%s\t%s\n", a.ID, a.Username, status, a.Email)
+	}
+	return 0
+}
+
+// createAdmin 添加管理员，密码从标准输入读取，不出现在命令行参数中
+func createAdmin(username, email string) error {
+	var count int64
+	model.GetDB().Model(&model.Admin{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("用户名 %s 已存在", username)
+	}
+
+	hashedPassword, err := readPassword()
+	if err != nil {
+		return err
+	}
+	admin := model.Admin{
+		Username: username,
+		Password: hashedPassword,
+		Email:    email,
+		Status:   1,
+	}
+	if err := model.GetDB().Create(&admin).Error; err != nil {
+		return err
+	}
+	log.Printf("已添加管理员 #%d %s", admin.ID, admin.Username)
+	return nil
+}
+
+// setAdminStatus 启用或禁用管理员，禁用后已登录的 Token 立即失效
+func setAdminStatus(username string, status int8) error {
+	result := model.GetDB().Model(&model.Admin{}).Where("username = ?", username).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("管理员 %s 不存在或状态未变化", username)
+	}
+	action := "启用"
+	if status == 0 {
+		action = "禁用"
+	}
+	log.Printf("管理员 %s 已%s", username, action)
+	return nil
+}
+
+// resetAdminPassword 重置管理员密码
+func resetAdminPassword(username string) error {
+	var admin model.Admin
+	if err := model.GetDB().Where("username = ?", username).First(&admin).Error; err != nil {
+		return fmt.Errorf("管理员 %s 不存在", username)
+	}
+	hashedPassword, err := readPassword()
+	if err != nil {
+		return err
+	}
+	if err := model.GetDB().Model(&admin).Update("password", hashedPassword).Error; err != nil {
+		return err
+	}
+	log.Printf("管理员 %s 密码已重置", username)
+	return nil
+}
+
+// readPassword 从标准输入读取新密码并加密
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "请输入密码(至少6位): ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("读取密码失败: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < 6 {
+		return "", fmt.Errorf("密码至少6位")
+	}
+	return util.HashPassword(password)
+}
@@ -20,6 +20,8 @@ type Config struct {
 	Notify     NotifyConfig     `mapstructure:"notify"`
 	Order      OrderConfig      `mapstructure:"order"`
 	Log        LogConfig        `mapstructure:"log"`
+	Payout     PayoutConfig     `mapstructure:"payout"`
+	Approval   ApprovalConfig   `mapstructure:"approval"`
 }
 
 type StorageConfig struct {
@@ -83,23 +85,18 @@ type LogConfig struct {
 	APILogDays  int    `mapstructure:"api_log_days"` // API日志保留天数
 }
 
-type BlockchainConfig struct {
-	TRX       ChainConfig `mapstructure:"trx"`
-	TRC20     ChainConfig `mapstructure:"trc20"`
-	ERC20     ChainConfig `mapstructure:"erc20"`
-	BEP20     ChainConfig `mapstructure:"bep20"`
-	Polygon   ChainConfig `mapstructure:"polygon"`
-	Optimism  ChainConfig `mapstructure:"optimism"`
-	Arbitrum  ChainConfig `mapstructure:"arbitrum"`
-	Avalanche ChainConfig `mapstructure:"avalanche"`
-	Base      ChainConfig `mapstructure:"base"`
-}
+// BlockchainConfig 链配置，键为链标识(trx, trc20, erc20, linea ...)
+// 内置链只需填写节点等参数；新增链需指定 type(tron/trc20/evm/solana/ton/utxo)，可选 name、native_symbol
+type BlockchainConfig map[string]ChainConfig
 
 type ChainConfig struct {
+	Type            string `mapstructure:"type"`                // 扫描器类型: tron, trc20, evm, solana, ton, utxo（内置链可省略）
+	Name            string `mapstructure:"name"`                // 显示名称（内置链可省略）
+	NativeSymbol    string `mapstructure:"native_symbol"`       // 原生币符号，如 ETH（为空则不收原生币，内置链可省略）
 	Enabled         bool   `mapstructure:"enabled"`
 	RPC             string `mapstructure:"rpc"`
 	RPCBackups      []string `mapstructure:"rpc_backups"`       // 备用RPC节点列表
-	APIKey          string `mapstructure:"api_key"`             // 商业节点API Key（附加到RPC URL）
+	APIKey          string `mapstructure:"api_key"`             // 商业节点API Key（TON 附加到 toncenter 请求参数）
 	ContractAddress string `mapstructure:"contract_address"`
 	Confirmations   int    `mapstructure:"confirmations"`
 	ScanInterval    int    `mapstructure:"scan_interval"`
@@ -109,6 +106,29 @@ type ChainConfig struct {
 	RateLimit       float64 `mapstructure:"rate_limit"`         // 每秒最大请求数（0=使用默认值）
 }
 
+// PayoutConfig 热钱包自动打款配置
+// 审核通过的 TRC20/EVM 代币提现由热钱包签名广播，确认后自动完成打款
+type PayoutConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`        // 是否启用自动打款
+	Keystore     string   `mapstructure:"keystore"`       // 热钱包 keystore 文件(以太坊 V3 格式，EVM 与 TRON 共用私钥)
+	PasswordEnv  string   `mapstructure:"password_env"`   // keystore 密码所在的环境变量
+	Chains       []string `mapstructure:"chains"`         // 自动打款的链，如 trc20、bep20，未列出的链仍由管理员手动打款
+	Interval     int      `mapstructure:"interval"`       // 打款检查间隔(秒)
+	TronFeeLimit int64    `mapstructure:"tron_fee_limit"` // TRC20 转账最多燃烧的 TRX
+	GasPriceBump int      `mapstructure:"gas_price_bump"` // EVM gas price 在节点建议值上的加价百分比
+	BatchSize    int      `mapstructure:"batch_size"`     // 每批最多合并的提现笔数(同链同币种)，1 表示逐笔打款
+	// Disperse 合约地址，键为链(如 bep20)；配置后 EVM 链的批量打款合并为一笔 disperseToken 调用，否则按连续 nonce 逐笔发送
+	DisperseContracts map[string]string `mapstructure:"disperse_contracts"`
+}
+
+// ApprovalConfig 多人审批(双人复核)配置
+// 只能在配置文件中修改，管理后台无法降低审批要求
+type ApprovalConfig struct {
+	WithdrawThreshold float64 `mapstructure:"withdraw_threshold"` // 提现金额(USD)达到该值时需要多名管理员审批，0 表示不启用
+	WithdrawApprovals int     `mapstructure:"withdraw_approvals"` // 大额提现需要的审批人数
+	AddressApprovals  int     `mapstructure:"address_approvals"`  // 新提现地址需要的审批人数
+}
+
 type RateConfig struct {
 	AutoUpdateEnabled bool   `mapstructure:"auto_update_enabled"` // 是否启用自动更新
 	UpdateInterval    int    `mapstructure:"update_interval"`     // 自动更新间隔(分钟)
@@ -295,6 +315,49 @@ func setDefaults() {
 	viper.SetDefault("blockchain.base.confirmations", 10)
 	viper.SetDefault("blockchain.base.scan_interval", 15)
 
+	// Solana
+	viper.SetDefault("blockchain.solana.enabled", false)
+	viper.SetDefault("blockchain.solana.rpc", "https://api.mainnet-beta.solana.com")
+	viper.SetDefault("blockchain.solana.contract_address", "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB")
+	viper.SetDefault("blockchain.solana.confirmations", 32)
+	viper.SetDefault("blockchain.solana.scan_interval", 15)
+
+	// TON
+	viper.SetDefault("blockchain.ton.enabled", false)
+	viper.SetDefault("blockchain.ton.rpc", "https://toncenter.com")
+	viper.SetDefault("blockchain.ton.contract_address", "EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs")
+	viper.SetDefault("blockchain.ton.confirmations", 1)
+	viper.SetDefault("blockchain.ton.scan_interval", 15)
+	viper.SetDefault("blockchain.ton.rate_limit", 1.0)
+
+	// Bitcoin / Litecoin (Esplora API)
+	viper.SetDefault("blockchain.btc.enabled", false)
+	viper.SetDefault("blockchain.btc.rpc", "https://blockstream.info/api")
+	viper.SetDefault("blockchain.btc.confirmations", 2)
+	viper.SetDefault("blockchain.btc.scan_interval", 60)
+	viper.SetDefault("blockchain.btc.rate_limit", 2.0)
+	viper.SetDefault("blockchain.ltc.enabled", false)
+	viper.SetDefault("blockchain.ltc.rpc", "https://litecoinspace.org/api")
+	viper.SetDefault("blockchain.ltc.confirmations", 6)
+	viper.SetDefault("blockchain.ltc.scan_interval", 30)
+	viper.SetDefault("blockchain.ltc.rate_limit", 2.0)
+
+	// Payout
+	viper.SetDefault("payout.enabled", false)
+	viper.SetDefault("payout.keystore", "")
+	viper.SetDefault("payout.password_env", "EZPAY_PAYOUT_PASSWORD")
+	viper.SetDefault("payout.chains", []string{})
+	viper.SetDefault("payout.interval", 30)
+	viper.SetDefault("payout.tron_fee_limit", 30)
+	viper.SetDefault("payout.gas_price_bump", 10)
+	viper.SetDefault("payout.batch_size", 1)
+	viper.SetDefault("payout.disperse_contracts", map[string]string{})
+
+	// 多人审批
+	viper.SetDefault("approval.withdraw_threshold", 1000)
+	viper.SetDefault("approval.withdraw_approvals", 2)
+	viper.SetDefault("approval.address_approvals", 2)
+
 	// Rate
 	viper.SetDefault("rate.mode", "hybrid")
 	viper.SetDefault("rate.manual_rate", 7.2)
@@ -364,6 +427,22 @@ rate:
   cache_seconds: 300
   source: "binance"
 
+payout:
+  enabled: false
+  keystore: ""
+  password_env: "EZPAY_PAYOUT_PASSWORD"
+  chains: []
+  interval: 30
+  tron_fee_limit: 30
+  gas_price_bump: 10
+  batch_size: 1
+  disperse_contracts: {}
+
+approval:
+  withdraw_threshold: 1000
+  withdraw_approvals: 2
+  address_approvals: 2
+
 blockchain:
   trx:
     enabled: true
@@ -419,6 +498,31 @@ blockchain:
     contract_address: "0xfde4C96c8593536E31F229EA8f37b2ADa2699bb2"
     confirmations: 10
     scan_interval: 15
+  solana:
+    enabled: false
+    rpc: "https://api.mainnet-beta.solana.com"
+    contract_address: "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCe8BenwNYB"
+    confirmations: 32
+    scan_interval: 15
+  ton:
+    enabled: false
+    rpc: "https://toncenter.com"
+    contract_address: "EQCxE6mUtQJKFnGfaROTKOt1lZbDiiX1kCixRv7Nw2Id_sDs"
+    confirmations: 1
+    scan_interval: 15
+    rate_limit: 1.0
+  btc:
+    enabled: false
+    rpc: "https://blockstream.info/api"
+    confirmations: 2
+    scan_interval: 60
+    rate_limit: 2.0
+  ltc:
+    enabled: false
+    rpc: "https://litecoinspace.org/api"
+    confirmations: 6
+    scan_interval: 30
+    rate_limit: 2.0
 `, dataDir)
 
 	// 在可执行文件所在目录创建配置文件
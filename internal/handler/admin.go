@@ -6,6 +6,7 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -26,6 +27,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // 外部API调用使用的HTTP客户端（带超时）
@@ -80,6 +82,7 @@ func (h *AdminHandler) Login(c *gin.Context) {
 
 	// 生成JWT Token
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"type":     "admin",
 		"admin_id": admin.ID,
 		"username": admin.Username,
 		"exp":      time.Now().Add(24 * time.Hour).Unix(),
@@ -320,7 +323,10 @@ func (h *AdminHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 1, "data": order})
+	// 回调投递记录
+	notifications, _ := service.GetNotifyService().ListOrderAttempts(order.ID)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": order, "notifications": notifications})
 }
 
 // MarkOrderPaid 手动标记订单已支付
@@ -338,7 +344,7 @@ func (h *AdminHandler) MarkOrderPaid(c *gin.Context) {
 
 	amount, _ := decimal.NewFromString(req.Amount)
 	orderService := service.GetOrderService()
-	if err := orderService.MarkOrderPaid(tradeNo, req.TxHash, amount); err != nil {
+	if err := orderService.MarkOrderPaid(tradeNo, req.TxHash, amount, c.GetString("username")); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
@@ -356,11 +362,32 @@ func (h *AdminHandler) RetryNotify(c *gin.Context) {
 		return
 	}
 
-	go service.GetNotifyService().NotifyOrder(order.ID)
+	if err := service.GetNotifyService().ManualNotify(order.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "已触发通知"})
 }
 
+// ListOrderNotifyTasks 获取订单回调任务记录
+func (h *AdminHandler) ListOrderNotifyTasks(c *gin.Context) {
+	tradeNo := c.Param("trade_no")
+	order, err := service.GetOrderService().GetOrder(tradeNo)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	tasks, err := service.GetNotifyService().ListOrderTasks(order.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": tasks})
+}
+
 // CleanInvalidOrders 清理无效订单（超过24小时未支付的订单）
 func (h *AdminHandler) CleanInvalidOrders(c *gin.Context) {
 	// 计算24小时前的时间
@@ -391,14 +418,13 @@ func (h *AdminHandler) CleanInvalidOrders(c *gin.Context) {
 	var deletedCount int64
 	txErr := model.GetDB().Transaction(func(tx *gorm.DB) error {
 		// 退还预扣的手续费
-		for _, order := range orders {
-			if order.FeeType == model.FeeTypeBalance && order.Status == model.OrderStatusPending {
-				fee, _ := order.Fee.Float64()
-				if fee > 0 {
-					if err := service.GetWithdrawService().RefundPreChargedFee(order.MerchantID, fee); err == nil {
-						refundCount++
-					}
+		for i := range orders {
+			order := &orders[i]
+			if order.FeeType == model.FeeTypeBalance && order.Status == model.OrderStatusPending && order.Fee.IsPositive() {
+				if err := service.GetWithdrawService().RefundPreChargedFee(tx, order); err != nil {
+					return err
 				}
+				refundCount++
 			}
 		}
 
@@ -493,12 +519,14 @@ func (h *AdminHandler) UpdateMerchant(c *gin.Context) {
 		Password                string `json:"password"` // 重置密码
 		NotifyURL               string `json:"notify_url"`
 		ReturnURL               string `json:"return_url"`
+		CallbackFormat          string `json:"callback_format"` // epay / json
 		WalletLimit             *int   `json:"wallet_limit"`
 		Status                  *int8  `json:"status"`
 		IPWhitelistEnabled      *bool  `json:"ip_whitelist_enabled"`
 		IPWhitelist             string `json:"ip_whitelist"`
 		RefererWhitelistEnabled *bool  `json:"referer_whitelist_enabled"`
 		RefererWhitelist        string `json:"referer_whitelist"`
+		PaymentPolicy           *model.PaymentPolicy `json:"payment_policy"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -527,6 +555,13 @@ func (h *AdminHandler) UpdateMerchant(c *gin.Context) {
 	if req.ReturnURL != "" {
 		updates["return_url"] = req.ReturnURL
 	}
+	if req.CallbackFormat != "" {
+		if !model.IsValidCallbackFormat(req.CallbackFormat) {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "回调格式无效"})
+			return
+		}
+		updates["callback_format"] = req.CallbackFormat
+	}
 	if req.WalletLimit != nil {
 		updates["wallet_limit"] = *req.WalletLimit
 	}
@@ -542,6 +577,13 @@ func (h *AdminHandler) UpdateMerchant(c *gin.Context) {
 		updates["referer_whitelist_enabled"] = *req.RefererWhitelistEnabled
 	}
 	updates["referer_whitelist"] = req.RefererWhitelist
+	if req.PaymentPolicy != nil {
+		if err := validatePaymentPolicy(req.PaymentPolicy); err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+			return
+		}
+		updates["payment_policy"] = *req.PaymentPolicy
+	}
 
 	if err := model.GetDB().Model(&model.Merchant{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "更新失败"})
@@ -576,32 +618,99 @@ func (h *AdminHandler) AdjustMerchantBalance(c *gin.Context) {
 		return
 	}
 
-	var newBalance float64
-	switch req.Type {
-	case "add":
-		newBalance = merchant.Balance + req.Amount
-	case "subtract":
-		if merchant.Balance < req.Amount {
+	adminID := c.GetUint("admin_id")
+	username := c.GetString("username")
+	amount := decimal.NewFromFloat(req.Amount).Round(2)
+	entry := service.LedgerEntry{
+		RefType: model.LedgerRefAdmin,
+		RefID:   adminID,
+		Actor:   service.AdminActor(username),
+		Remark:  req.Remark,
+	}
+
+	var updated *model.Merchant
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		switch req.Type {
+		case "add":
+			entry.Type = model.LedgerTypeCredit
+			entry.Amount = amount
+		case "subtract":
+			entry.Type = model.LedgerTypeDebit
+			entry.Amount = amount
+		case "set":
+			// 设置余额转换为差额调账，保留完整的账本记录
+			var current model.Merchant
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, id).Error; err != nil {
+				return err
+			}
+			diff := amount.Sub(decimal.NewFromFloat(current.Balance).Round(2))
+			if diff.IsNegative() {
+				entry.Type = model.LedgerTypeDebit
+				entry.Amount = diff.Neg()
+			} else {
+				entry.Type = model.LedgerTypeCredit
+				entry.Amount = diff
+			}
+			entry.Remark = fmt.Sprintf("设置余额为 %s: %s", amount.StringFixed(2), req.Remark)
+		default:
+			return errInvalidAdjustType
+		}
+
+		var err error
+		updated, err = service.GetLedgerService().Apply(tx, merchant.ID, entry)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidAdjustType):
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "无效的调整类型"})
+		case errors.Is(err, service.ErrInsufficientBalance):
 			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "余额不足"})
-			return
+		default:
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "调整失败"})
 		}
-		newBalance = merchant.Balance - req.Amount
-	case "set":
-		newBalance = req.Amount
-	default:
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "无效的调整类型"})
 		return
 	}
 
-	if err := model.GetDB().Model(&merchant).Update("balance", newBalance).Error; err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "调整失败"})
-		return
+	// 记录日志
+	log.Printf("管理员[%s]调整商户[%d]余额: %.2f -> %.2f, 类型: %s, 备注: %s", username, id, merchant.Balance, updated.Balance, req.Type, req.Remark)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "调整成功", "data": gin.H{"balance": updated.Balance}})
+}
+
+// errInvalidAdjustType 无效的余额调整类型
+var errInvalidAdjustType = errors.New("无效的调整类型")
+
+// ListMerchantLedger 商户余额账本流水
+func (h *AdminHandler) ListMerchantLedger(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	merchantID, _ := strconv.Atoi(c.Query("merchant_id"))
+	if id := c.Param("id"); id != "" {
+		merchantID, _ = strconv.Atoi(id)
 	}
 
-	// 记录日志
-	log.Printf("管理员调整商户[%d]余额: %.2f -> %.2f, 类型: %s, 备注: %s", id, merchant.Balance, newBalance, req.Type, req.Remark)
+	entries, total, err := service.GetLedgerService().ListEntries(&service.LedgerQuery{
+		MerchantID: uint(merchantID),
+		Type:       c.Query("type"),
+		RefType:    c.Query("ref_type"),
+		RefNo:      c.Query("ref_no"),
+		StartDate:  c.Query("start_date"),
+		EndDate:    c.Query("end_date"),
+		Page:       page,
+		PageSize:   pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "调整成功", "data": gin.H{"balance": newBalance}})
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  entries,
+		"total": total,
+		"page":  page,
+	})
 }
 
 // ResetMerchantKey 重置商户密钥
@@ -697,6 +806,10 @@ func (h *AdminHandler) CreateWallet(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "请输入钱包地址"})
 			return
 		}
+		if !service.GetBlockchainService().ValidateAddress(req.Chain, req.Address) {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "钱包地址格式无效"})
+			return
+		}
 	}
 
 	// 如果指定了商户ID，验证商户是否存在
@@ -859,6 +972,203 @@ func (h *AdminHandler) DeleteWallet(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
 }
 
+// ListHDWallets HD 钱包列表(系统及全部商户)
+func (h *AdminHandler) ListHDWallets(c *gin.Context) {
+	var wallets []model.HDWallet
+	model.GetDB().Order("merchant_id ASC, id DESC").Find(&wallets)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": wallets})
+}
+
+// CreateHDWallet 登记扩展公钥
+func (h *AdminHandler) CreateHDWallet(c *gin.Context) {
+	var req struct {
+		Family     string `json:"family" binding:"required"`
+		XPub       string `json:"xpub" binding:"required"`
+		Label      string `json:"label"`
+		MerchantID uint   `json:"merchant_id"` // 商户ID，0为系统钱包
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	if req.MerchantID > 0 {
+		var merchant model.Merchant
+		if err := model.GetDB().First(&merchant, req.MerchantID).Error; err != nil {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "商户不存在"})
+			return
+		}
+	}
+
+	wallet, err := service.GetHDWalletService().Create(req.MerchantID, req.Family, req.XPub, req.Label)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "创建成功", "data": wallet})
+}
+
+// UpdateHDWallet 更新 HD 钱包
+func (h *AdminHandler) UpdateHDWallet(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		Label  string `json:"label"`
+		Status *int8  `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Label != "" {
+		updates["label"] = req.Label
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+
+	if err := model.GetDB().Model(&model.HDWallet{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "success"})
+}
+
+// DeleteHDWallet 删除 HD 钱包
+func (h *AdminHandler) DeleteHDWallet(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var wallet model.HDWallet
+	if err := model.GetDB().First(&wallet, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "钱包不存在"})
+		return
+	}
+
+	if err := service.GetHDWalletService().Delete(&wallet); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
+}
+
+// ListTokens 代币登记列表
+func (h *AdminHandler) ListTokens(c *gin.Context) {
+	var tokens []model.Token
+	model.GetDB().Order("chain ASC, id ASC").Find(&tokens)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": tokens})
+}
+
+// CreateToken 登记代币
+func (h *AdminHandler) CreateToken(c *gin.Context) {
+	var req model.Token
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	token := model.Token{
+		Chain:    req.Chain,
+		Symbol:   req.Symbol,
+		Contract: req.Contract,
+		Decimals: req.Decimals,
+		Enabled:  req.Enabled,
+	}
+	if err := service.GetTokenService().Validate(&token); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	var count int64
+	model.GetDB().Model(&model.Token{}).Where("chain = ? AND symbol = ?", token.Chain, token.Symbol).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "该链已登记同名代币"})
+		return
+	}
+
+	if err := model.GetDB().Create(&token).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "创建失败: " + err.Error()})
+		return
+	}
+	service.GetTokenService().Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "创建成功", "data": token})
+}
+
+// UpdateToken 更新代币(合约/精度/启用状态)
+func (h *AdminHandler) UpdateToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var token model.Token
+	if err := model.GetDB().First(&token, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "代币不存在"})
+		return
+	}
+
+	var req struct {
+		Contract string `json:"contract"`
+		Decimals *int   `json:"decimals"`
+		Enabled  *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	if req.Contract != "" {
+		token.Contract = req.Contract
+	}
+	if req.Decimals != nil {
+		token.Decimals = *req.Decimals
+	}
+	if req.Enabled != nil {
+		token.Enabled = *req.Enabled
+	}
+	if err := service.GetTokenService().Validate(&token); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	if err := model.GetDB().Model(&token).Select("contract", "decimals", "enabled").Updates(&token).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "更新失败"})
+		return
+	}
+	service.GetTokenService().Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "success"})
+}
+
+// DeleteToken 删除代币，已有订单使用的代币只能禁用
+func (h *AdminHandler) DeleteToken(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var token model.Token
+	if err := model.GetDB().First(&token, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "代币不存在"})
+		return
+	}
+
+	var orderCount int64
+	model.GetDB().Model(&model.Order{}).Where("chain = ? AND pay_currency = ?", token.Chain, token.Symbol).Count(&orderCount)
+	if orderCount > 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": fmt.Sprintf("该代币已有%d笔订单使用记录，无法删除，请使用禁用功能", orderCount)})
+		return
+	}
+
+	if err := model.GetDB().Delete(&token).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "删除失败"})
+		return
+	}
+	service.GetTokenService().Invalidate()
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
+}
+
 // GetConfigs 获取系统配置
 func (h *AdminHandler) GetConfigs(c *gin.Context) {
 	var configs []model.SystemConfig
@@ -1043,6 +1353,7 @@ func (h *AdminHandler) GetTransactionLogs(c *gin.Context) {
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
 	chain := c.Query("chain")
 	matched := c.Query("matched")
+	matchNote := c.Query("match_note")
 
 	db := model.GetDB().Model(&model.TransactionLog{})
 	if chain != "" {
@@ -1052,6 +1363,9 @@ func (h *AdminHandler) GetTransactionLogs(c *gin.Context) {
 		m := matched == "1" || matched == "true"
 		db = db.Where("matched = ?", m)
 	}
+	if matchNote != "" {
+		db = db.Where("match_note = ?", matchNote)
+	}
 
 	var total int64
 	db.Count(&total)
@@ -1068,6 +1382,88 @@ func (h *AdminHandler) GetTransactionLogs(c *gin.Context) {
 	})
 }
 
+// ListUnmatchedTransfers 未匹配转账队列（少付/多付/过期/多候选等待人工处理）
+func (h *AdminHandler) ListUnmatchedTransfers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	chain := c.Query("chain")
+	matchNote := c.Query("match_note")
+	address := c.Query("address")
+
+	db := model.GetDB().Model(&model.TransactionLog{}).Where("matched = ?", false)
+	if chain != "" {
+		db = db.Where("chain = ?", chain)
+	}
+	if matchNote != "" {
+		db = db.Where("match_note = ?", matchNote)
+	}
+	if address != "" {
+		db = db.Where("to_address = ?", address)
+	}
+
+	var total int64
+	db.Count(&total)
+
+	var logs []model.TransactionLog
+	offset := (page - 1) * pageSize
+	db.Order("created_at ASC").Offset(offset).Limit(pageSize).Find(&logs)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  logs,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// ListTransferCandidates 获取未匹配转账的候选订单
+func (h *AdminHandler) ListTransferCandidates(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	tolerance, _ := strconv.ParseFloat(c.DefaultQuery("tolerance", "0.1"), 64)
+	hours, _ := strconv.Atoi(c.DefaultQuery("hours", "72"))
+	if tolerance <= 0 || tolerance > 1 {
+		tolerance = 0.1
+	}
+	if hours <= 0 || hours > 24*30 {
+		hours = 72
+	}
+
+	txLog, candidates, err := service.GetBlockchainService().ListTransferCandidates(uint(id), tolerance, hours)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"data": gin.H{
+			"transaction": txLog,
+			"candidates":  candidates,
+		},
+	})
+}
+
+// AssignTransfer 将未匹配转账手动指派给订单
+func (h *AdminHandler) AssignTransfer(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		TradeNo  string `json:"trade_no" binding:"required"`
+		MarkPaid bool   `json:"mark_paid"` // 金额不足时仍按已支付处理
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	order, err := service.GetBlockchainService().AssignTransfer(uint(id), req.TradeNo, req.MarkPaid, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "指派成功", "data": order})
+}
+
 // GetAPILogs 获取API调用日志
 func (h *AdminHandler) GetAPILogs(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -1178,6 +1574,30 @@ func (h *AdminHandler) ChangePassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "修改成功"})
 }
 
+// ============ 管理员管理 ============
+
+// ListAdmins 管理员列表及当前审批要求
+// 管理员账号和审批要求只能通过命令行(ezpay admin)和配置文件修改，
+// 避免单个管理员添加账号、重置他人密码或降低审批人数后独自完成审批
+func (h *AdminHandler) ListAdmins(c *gin.Context) {
+	var admins []model.Admin
+	if err := model.GetDB().Order("id ASC").Find(&admins).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	approval := service.GetWithdrawService().ApprovalSettings()
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"data": admins,
+		"approval": gin.H{
+			"withdraw_threshold": approval.WithdrawThreshold,
+			"withdraw_approvals": approval.WithdrawApprovals,
+			"address_approvals":  approval.AddressApprovals,
+		},
+	})
+}
+
 // GetChainStatus 获取链监控状态
 func (h *AdminHandler) GetChainStatus(c *gin.Context) {
 	blockchainService := service.GetBlockchainService()
@@ -1261,10 +1681,79 @@ func (h *AdminHandler) BatchUpdateChains(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "链状态更新成功"})
 }
 
-// ExportOrders 导出订单为CSV
-func (h *AdminHandler) ExportOrders(c *gin.Context) {
-	status := c.Query("status")
-	tradeNo := c.Query("trade_no")
+// StartRescan 发起区块补扫任务
+// from/to 为区块号；TRON、TON 按时间补扫，可填 Unix 秒或 "2006-01-02 15:04:05"
+func (h *AdminHandler) StartRescan(c *gin.Context) {
+	chain := c.Param("chain")
+	var req struct {
+		From json.RawMessage `json:"from"`
+		To   json.RawMessage `json:"to"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	rescanService := service.GetRescanService()
+	from, to, err := rescanService.ParseRange(chain, strings.Trim(string(req.From), `"`), strings.Trim(string(req.To), `"`))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	job, err := rescanService.Start(chain, from, to, c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "补扫任务已开始", "data": job})
+}
+
+// ListRescanJobs 补扫任务列表
+func (h *AdminHandler) ListRescanJobs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	jobs, total, err := service.GetRescanService().ListJobs(c.Query("chain"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  jobs,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// GetRescanJob 补扫任务详情(进度)
+func (h *AdminHandler) GetRescanJob(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	job, err := service.GetRescanService().GetJob(uint(id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": job})
+}
+
+// CancelRescanJob 取消补扫任务
+func (h *AdminHandler) CancelRescanJob(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := service.GetRescanService().Cancel(uint(id)); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "已取消"})
+}
+
+// ExportOrders 导出订单为CSV
+func (h *AdminHandler) ExportOrders(c *gin.Context) {
+	status := c.Query("status")
+	tradeNo := c.Query("trade_no")
 	outTradeNo := c.Query("out_trade_no")
 	merchantID, _ := strconv.Atoi(c.Query("merchant_id"))
 	startDate := c.Query("start_date")
@@ -1316,6 +1805,16 @@ func (h *AdminHandler) ExportOrders(c *gin.Context) {
 			statusText = "已过期"
 		case model.OrderStatusCancelled:
 			statusText = "已取消"
+		case model.OrderStatusPartial:
+			statusText = "部分支付"
+		case model.OrderStatusPaidLate:
+			statusText = "过期后支付"
+		case model.OrderStatusRefunded:
+			statusText = "已退款"
+		case model.OrderStatusDetected:
+			statusText = "已检测到付款"
+		case model.OrderStatusConfirming:
+			statusText = "确认中"
 		}
 
 		merchantPID := ""
@@ -1380,11 +1879,23 @@ func (h *AdminHandler) ListWithdrawals(c *gin.Context) {
 		return
 	}
 
-	// 构建响应，包含商户信息
+	ids := make([]uint, 0, len(withdrawals))
+	for _, w := range withdrawals {
+		ids = append(ids, w.ID)
+	}
+	approvals, err := service.GetWithdrawService().ListApprovals(model.ApprovalRefWithdrawal, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	// 构建响应，包含商户信息和审批进度
 	type WithdrawalResponse struct {
 		model.Withdrawal
-		MerchantPID  string `json:"merchant_pid"`
-		MerchantName string `json:"merchant_name"`
+		MerchantPID       string           `json:"merchant_pid"`
+		MerchantName      string           `json:"merchant_name"`
+		Approvals         []model.Approval `json:"approvals"`
+		ApprovalsRequired int              `json:"approvals_required"` // 待审核提现需要的审批人数
 	}
 
 	var result []WithdrawalResponse
@@ -1393,6 +1904,10 @@ func (h *AdminHandler) ListWithdrawals(c *gin.Context) {
 			Withdrawal:   w,
 			MerchantPID:  w.Merchant.PID,
 			MerchantName: w.Merchant.Name,
+			Approvals:    approvals[w.ID],
+		}
+		if w.Status == model.WithdrawStatusPending {
+			resp.ApprovalsRequired = service.GetWithdrawService().WithdrawalApprovalsRequired(w.Amount)
 		}
 		result = append(result, resp)
 	}
@@ -1415,12 +1930,33 @@ func (h *AdminHandler) ApproveWithdrawal(c *gin.Context) {
 		req.AdminRemark = ""
 	}
 
-	if err := service.GetWithdrawService().ApproveWithdrawal(uint(id), req.AdminRemark); err != nil {
+	progress, err := service.GetWithdrawService().ApproveWithdrawal(uint(id), approverFrom(c), req.AdminRemark)
+	if err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "审核通过"})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": approvalMessage(progress), "data": progress})
+}
+
+// CreateMerchantWithdrawal 代商户申请提现，申请的管理员不能审批该提现
+func (h *AdminHandler) CreateMerchantWithdrawal(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req service.WithdrawRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+	req.CreatedBy = c.GetUint("admin_id")
+	req.Operator = c.GetString("username")
+
+	withdrawal, err := service.GetWithdrawService().CreateWithdrawal(uint(id), &req)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "提现申请已提交，需由其他管理员审核", "data": withdrawal})
 }
 
 // RejectWithdrawal 拒绝提现
@@ -1433,7 +1969,7 @@ func (h *AdminHandler) RejectWithdrawal(c *gin.Context) {
 		req.AdminRemark = ""
 	}
 
-	if err := service.GetWithdrawService().RejectWithdrawal(uint(id), req.AdminRemark); err != nil {
+	if err := service.GetWithdrawService().RejectWithdrawal(uint(id), req.AdminRemark, c.GetString("username")); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
@@ -1451,7 +1987,7 @@ func (h *AdminHandler) CompleteWithdrawal(c *gin.Context) {
 		req.AdminRemark = ""
 	}
 
-	if err := service.GetWithdrawService().CompleteWithdrawal(uint(id), req.AdminRemark); err != nil {
+	if err := service.GetWithdrawService().CompleteWithdrawal(uint(id), req.AdminRemark, c.GetString("username")); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
@@ -1459,6 +1995,288 @@ func (h *AdminHandler) CompleteWithdrawal(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "打款完成"})
 }
 
+// RetryWithdrawalPayout 自动打款失败的提现重新打款
+func (h *AdminHandler) RetryWithdrawalPayout(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		AdminRemark string `json:"admin_remark"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.AdminRemark = ""
+	}
+
+	if err := service.GetWithdrawService().RetryPayout(uint(id), req.AdminRemark); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "已重新进入待打款"})
+}
+
+// ListPayoutBatches 批量打款记录
+func (h *AdminHandler) ListPayoutBatches(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	batches, total, err := service.GetPayoutService().ListBatches(c.Query("chain"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  batches,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// GetPayoutBatch 批量打款详情(每笔提现的交易和结果)
+func (h *AdminHandler) GetPayoutBatch(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	batch, items, err := service.GetPayoutService().GetBatch(uint(id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": gin.H{"batch": batch, "items": items}})
+}
+
+// ============ 提现规则 ============
+
+// ListWithdrawPolicies 提现规则列表，merchant_id 参数筛选商户(0 为系统默认规则)
+func (h *AdminHandler) ListWithdrawPolicies(c *gin.Context) {
+	var merchantID *uint
+	if idStr := c.Query("merchant_id"); idStr != "" {
+		id, _ := strconv.Atoi(idStr)
+		mid := uint(id)
+		merchantID = &mid
+	}
+
+	policies, err := service.GetWithdrawService().ListPolicies(merchantID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": policies})
+}
+
+// CreateWithdrawPolicy 创建提现规则
+func (h *AdminHandler) CreateWithdrawPolicy(c *gin.Context) {
+	var policy model.WithdrawPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+	policy.ID = 0
+
+	if err := service.GetWithdrawService().SavePolicy(&policy); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "创建成功", "data": policy})
+}
+
+// UpdateWithdrawPolicy 更新提现规则(适用的商户和链不可修改)
+func (h *AdminHandler) UpdateWithdrawPolicy(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var policy model.WithdrawPolicy
+	if err := model.GetDB().First(&policy, id).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "提现规则不存在"})
+		return
+	}
+
+	var req model.WithdrawPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+	policy.MinAmount = req.MinAmount
+	policy.MaxAmount = req.MaxAmount
+	policy.FeeFixed = req.FeeFixed
+	policy.FeePercent = req.FeePercent
+	policy.DailyLimit = req.DailyLimit
+	policy.WeeklyLimit = req.WeeklyLimit
+	policy.DailyCount = req.DailyCount
+	policy.Remark = req.Remark
+
+	if err := service.GetWithdrawService().SavePolicy(&policy); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "更新成功", "data": policy})
+}
+
+// DeleteWithdrawPolicy 删除提现规则
+func (h *AdminHandler) DeleteWithdrawPolicy(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := service.GetWithdrawService().DeletePolicy(uint(id)); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
+}
+
+// ============ 订单退款 ============
+
+// RefundOrder 管理员发起订单退款
+func (h *AdminHandler) RefundOrder(c *gin.Context) {
+	tradeNo := c.Param("trade_no")
+	var req struct {
+		Amount float64 `json:"amount"` // 为 0 时全额退款
+		Reason string  `json:"reason"`
+		Payout bool    `json:"payout"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	var order model.Order
+	if err := model.GetDB().Where("trade_no = ?", tradeNo).First(&order).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "订单不存在"})
+		return
+	}
+
+	refund, err := service.GetRefundService().CreateRefund(&service.CreateRefundRequest{
+		MerchantID: order.MerchantID,
+		TradeNo:    order.TradeNo,
+		Amount:     decimal.NewFromFloat(req.Amount),
+		Reason:     req.Reason,
+		Payout:     req.Payout,
+		Actor:      service.AdminActor(c.GetString("username")),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "退款成功", "data": refund})
+}
+
+// ListRefunds 退款记录列表
+func (h *AdminHandler) ListRefunds(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	merchantID, _ := strconv.Atoi(c.Query("merchant_id"))
+	payoutStatusStr := c.Query("payout_status")
+
+	var payoutStatus *model.RefundPayoutStatus
+	if payoutStatusStr != "" {
+		s, _ := strconv.Atoi(payoutStatusStr)
+		st := model.RefundPayoutStatus(s)
+		payoutStatus = &st
+	}
+
+	refunds, total, err := service.GetRefundService().ListRefunds(uint(merchantID), c.Query("trade_no"), payoutStatus, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  refunds,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// CompleteRefundPayout 确认退款已原路打款
+func (h *AdminHandler) CompleteRefundPayout(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		TxHash string `json:"tx_hash" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "请填写打款交易哈希"})
+		return
+	}
+
+	if err := service.GetRefundService().CompleteRefundPayout(uint(id), req.TxHash, c.GetString("username")); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "打款完成"})
+}
+
+// ============ 余额对账 ============
+
+// ListReconciliations 对账差异列表
+func (h *AdminHandler) ListReconciliations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	merchantID, _ := strconv.Atoi(c.Query("merchant_id"))
+	statusStr := c.Query("status")
+
+	var status *model.ReconcileStatus
+	if statusStr != "" {
+		s, _ := strconv.Atoi(statusStr)
+		st := model.ReconcileStatus(s)
+		status = &st
+	}
+
+	records, total, err := service.GetReconcileService().ListReconciliations(uint(merchantID), status, c.Query("run_id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	type ReconciliationResponse struct {
+		model.BalanceReconciliation
+		MerchantPID  string `json:"merchant_pid"`
+		MerchantName string `json:"merchant_name"`
+	}
+
+	result := make([]ReconciliationResponse, 0, len(records))
+	for _, r := range records {
+		result = append(result, ReconciliationResponse{
+			BalanceReconciliation: r,
+			MerchantPID:           r.Merchant.PID,
+			MerchantName:          r.Merchant.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  result,
+		"total": total,
+		"page":  page,
+	})
+}
+
+// RunReconciliation 立即执行一次余额对账
+func (h *AdminHandler) RunReconciliation(c *gin.Context) {
+	summary, err := service.GetReconcileService().RunReconciliation()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "对账完成", "data": summary})
+}
+
+// ResolveReconciliation 标记对账差异已处理
+func (h *AdminHandler) ResolveReconciliation(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		Remark string `json:"remark"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		req.Remark = ""
+	}
+
+	if err := service.GetReconcileService().ResolveReconciliation(uint(id), c.GetString("username"), req.Remark); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "已处理"})
+}
+
 // ============ IP黑名单管理 ============
 
 // ListIPBlacklist 获取IP黑名单列表
@@ -1668,22 +2486,40 @@ func (h *AdminHandler) ListWithdrawAddresses(c *gin.Context) {
 	offset := (page - 1) * pageSize
 	db.Order("status ASC, created_at DESC").Offset(offset).Limit(pageSize).Find(&addresses)
 
-	// 构建响应，包含商户信息
+	ids := make([]uint, 0, len(addresses))
+	for _, addr := range addresses {
+		ids = append(ids, addr.ID)
+	}
+	approvals, err := service.GetWithdrawService().ListApprovals(model.ApprovalRefWithdrawAddress, ids)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	required := service.GetWithdrawService().AddressApprovalsRequired()
+
+	// 构建响应，包含商户信息和审批进度
 	type AddressResponse struct {
 		model.WithdrawAddress
-		MerchantPID  string `json:"merchant_pid"`
-		MerchantName string `json:"merchant_name"`
+		MerchantPID       string           `json:"merchant_pid"`
+		MerchantName      string           `json:"merchant_name"`
+		Approvals         []model.Approval `json:"approvals"`
+		ApprovalsRequired int              `json:"approvals_required"` // 待审核地址需要的审批人数
 	}
 
 	var result []AddressResponse
 	for _, addr := range addresses {
 		var merchant model.Merchant
 		model.GetDB().First(&merchant, addr.MerchantID)
-		result = append(result, AddressResponse{
+		resp := AddressResponse{
 			WithdrawAddress: addr,
 			MerchantPID:     merchant.PID,
 			MerchantName:    merchant.Name,
-		})
+			Approvals:       approvals[addr.ID],
+		}
+		if addr.Status == model.WithdrawAddressPending {
+			resp.ApprovalsRequired = required
+		}
+		result = append(result, resp)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -1698,38 +2534,54 @@ func (h *AdminHandler) ListWithdrawAddresses(c *gin.Context) {
 func (h *AdminHandler) ApproveWithdrawAddress(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 
-	var address model.WithdrawAddress
-	if err := model.GetDB().First(&address, id).Error; err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "地址不存在"})
-		return
+	var req struct {
+		AdminRemark string `json:"admin_remark"`
 	}
+	c.ShouldBindJSON(&req)
 
-	if address.Status != model.WithdrawAddressPending {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "该地址已审核过"})
+	progress, err := service.GetWithdrawService().ApproveWithdrawAddress(uint(id), approverFrom(c), req.AdminRemark)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": approvalMessage(progress), "data": progress})
+}
+
+// CreateMerchantWithdrawAddress 代商户添加提现地址，添加的管理员不能审批该地址
+func (h *AdminHandler) CreateMerchantWithdrawAddress(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
 	var req struct {
-		AdminRemark string `json:"admin_remark"`
+		Chain   string `json:"chain" binding:"required"`
+		Address string `json:"address" binding:"required"`
+		Label   string `json:"label"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
 	}
-	c.ShouldBindJSON(&req)
-
-	// 更新状态
-	model.GetDB().Model(&address).Updates(map[string]interface{}{
-		"status":       model.WithdrawAddressApproved,
-		"admin_remark": req.AdminRemark,
-	})
 
-	// 如果是该商户第一个审核通过的地址，设为默认
-	var approvedCount int64
-	model.GetDB().Model(&model.WithdrawAddress{}).
-		Where("merchant_id = ? AND status = ? AND id != ?", address.MerchantID, model.WithdrawAddressApproved, address.ID).
-		Count(&approvedCount)
-	if approvedCount == 0 {
-		model.GetDB().Model(&address).Update("is_default", true)
+	address, err := service.GetWithdrawService().CreateWithdrawAddress(uint(id), req.Chain, req.Address, req.Label, c.GetUint("admin_id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "审核通过"})
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "提现地址已添加，需由其他管理员审核", "data": address})
+}
+
+// approverFrom 当前登录的审批管理员
+func approverFrom(c *gin.Context) service.Approver {
+	return service.Approver{ID: c.GetUint("admin_id"), Username: c.GetString("username")}
+}
+
+// approvalMessage 审批结果提示
+func approvalMessage(progress *service.ApprovalProgress) string {
+	if progress.Done() {
+		return "审核通过"
+	}
+	return fmt.Sprintf("已记录审批 (%d/%d)，需要其他管理员继续审批", progress.Approvals, progress.Required)
 }
 
 // RejectWithdrawAddress 拒绝提现地址
@@ -2013,3 +2865,17 @@ func (h *AdminHandler) DownloadApp(c *gin.Context) {
 	// 重定向到文件
 	c.Redirect(http.StatusFound, version.FilePath)
 }
+
+// validatePaymentPolicy 校验收款容差策略
+func validatePaymentPolicy(p *model.PaymentPolicy) error {
+	if p.UnderpayTolerance < 0 || p.UnderpayTolerance > model.MaxUnderpayTolerance {
+		return fmt.Errorf("少付容差需在 0 - %g 之间", model.MaxUnderpayTolerance)
+	}
+	if p.OverpayTolerance < 0 || p.OverpayTolerance > 10 {
+		return errors.New("多付容差需在 0 - 10 之间")
+	}
+	if p.LateWindowMinutes < 0 || p.LateWindowMinutes > 7*24*60 {
+		return errors.New("过期到账窗口需在 0 - 10080 分钟之间")
+	}
+	return nil
+}
@@ -33,7 +33,7 @@ func (h *CashierHandler) ShowCashier(c *gin.Context) {
 	}
 
 	// 检查订单状态
-	if order.Status == model.OrderStatusPaid {
+	if order.Status.IsPaid() {
 		// 已支付，跳转到成功页面或返回URL
 		if order.ReturnURL != "" {
 			var merchant model.Merchant
@@ -78,6 +78,10 @@ func (h *CashierHandler) ShowCashier(c *gin.Context) {
 		"order":         order,
 		"expireMinutes": expireMinutes,
 		"expiredAt":     order.ExpiredAt.UnixMilli(),
+		"paymentURI":    service.GetBlockchainService().PaymentURI(order),
+		// 付款必须附带备注的链(TON)展示备注
+		"referenceRequired": order.Channel == "local" && order.PayReference != "" &&
+			service.GetBlockchainService().ReferenceRequired(order.Chain),
 	})
 }
 
@@ -96,20 +100,25 @@ func (h *CashierHandler) GetOrderInfo(c *gin.Context) {
 	}
 
 	result := gin.H{
-		"code":          1,
-		"trade_no":      order.TradeNo,
-		"status":        order.Status,
-		"money":         order.Money.String(),
-		"pay_amount":    order.PayAmount.String(),    // 展示金额（无偏移）
-		"unique_amount": order.UniqueAmount.String(), // 唯一标识金额（含偏移，实际支付）
-		"usdt_amount":   order.UniqueAmount.String(), // 兼容旧字段
-		"address":       order.ToAddress,
-		"chain":         order.Chain,
-		"expired_at":    order.ExpiredAt,
+		"code":                   1,
+		"trade_no":               order.TradeNo,
+		"status":                 order.Status,
+		"money":                  order.Money.String(),
+		"pay_amount":             order.PayAmount.String(),    // 展示金额（无偏移）
+		"unique_amount":          order.UniqueAmount.String(), // 唯一标识金额（含偏移，实际支付）
+		"usdt_amount":            order.UniqueAmount.String(), // 兼容旧字段
+		"address":                order.ToAddress,
+		"payment_uri":            service.GetBlockchainService().PaymentURI(order), // 付款链接(Solana Pay/TON)，为空时使用地址
+		"pay_reference":          order.PayReference,                               // 付款引用(TON 为必填的转账备注)
+		"chain":                  order.Chain,
+		"expired_at":             order.ExpiredAt,
+		"actual_amount":          order.ActualAmount.String(), // 已收金额（部分支付时累计）
+		"confirmations":          order.Confirmations,         // 当前确认数（检测到付款后）
+		"required_confirmations": order.RequiredConfirmations, // 入账所需确认数
 	}
 
 	// 如果已支付，返回返回URL
-	if order.Status == model.OrderStatusPaid && order.ReturnURL != "" {
+	if order.Status.IsPaid() && order.ReturnURL != "" {
 		var merchant model.Merchant
 		model.GetDB().First(&merchant, order.MerchantID)
 		result["return_url"] = service.GetNotifyService().BuildReturnURL(order, &merchant)
@@ -11,6 +11,7 @@ import (
 	"ezpay/internal/util"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 )
 
 // EpayHandler 彩虹易支付兼容接口处理器
@@ -344,6 +345,10 @@ func (h *EpayHandler) queryOrder(c *gin.Context) {
 	tradeStatus := "WAIT_BUYER_PAY"
 	if order.Status == model.OrderStatusPaid {
 		tradeStatus = "TRADE_SUCCESS"
+	} else if order.Status == model.OrderStatusPaidLate {
+		tradeStatus = "TRADE_PAID_LATE"
+	} else if order.Status == model.OrderStatusRefunded {
+		tradeStatus = "TRADE_REFUND"
 	} else if order.Status == model.OrderStatusExpired {
 		tradeStatus = "TRADE_CLOSED"
 	} else if order.Status == model.OrderStatusCancelled {
@@ -360,9 +365,119 @@ func (h *EpayHandler) queryOrder(c *gin.Context) {
 		"name":         order.Name,
 		"money":        order.Money.String(),
 		"usdt_amount":  order.USDTAmount.String(),
+		"refund_money": order.RefundedAmount.StringFixed(2),
 		"trade_status": tradeStatus,
 		"addtime":      order.CreatedAt.Unix(),
 		"endtime":      order.ExpiredAt.Unix(),
+		// 检测到付款但未达到确认数时仍为 WAIT_BUYER_PAY，可据此展示确认进度
+		"confirmations":          order.Confirmations,
+		"required_confirmations": order.RequiredConfirmations,
+	})
+}
+
+// Refund 订单退款
+// POST /api/refund
+// 参数: pid, trade_no/out_trade_no, money(退款金额USD，为空则全额), out_refund_no, reason, payout(1=原路打款), sign
+func (h *EpayHandler) Refund(c *gin.Context) {
+	pid := c.DefaultQuery("pid", c.PostForm("pid"))
+	tradeNo := c.DefaultQuery("trade_no", c.PostForm("trade_no"))
+	outTradeNo := c.DefaultQuery("out_trade_no", c.PostForm("out_trade_no"))
+	money := c.DefaultQuery("money", c.PostForm("money"))
+	outRefundNo := c.DefaultQuery("out_refund_no", c.PostForm("out_refund_no"))
+	reason := c.DefaultQuery("reason", c.PostForm("reason"))
+	payout := c.DefaultQuery("payout", c.PostForm("payout"))
+	sign := c.DefaultQuery("sign", c.PostForm("sign"))
+
+	if pid == "" || (tradeNo == "" && outTradeNo == "") || sign == "" {
+		middleware.SetAPILogContext(c, -1, "参数不完整", tradeNo, 0, pid)
+		c.JSON(http.StatusOK, gin.H{
+			"code": -1,
+			"msg":  "参数不完整",
+		})
+		return
+	}
+
+	var merchant model.Merchant
+	if err := model.GetDB().Where("p_id = ? AND status = 1", pid).First(&merchant).Error; err != nil {
+		middleware.SetAPILogContext(c, -1, "商户不存在或已禁用", tradeNo, 0, pid)
+		c.JSON(http.StatusOK, gin.H{
+			"code": -1,
+			"msg":  "商户不存在或已禁用",
+		})
+		return
+	}
+
+	// 检查IP白名单 (仅当启用时检查)
+	if merchant.IPWhitelistEnabled && !middleware.CheckIPWhitelist(c.ClientIP(), merchant.IPWhitelist) {
+		middleware.SetAPILogContext(c, -1, "IP不在白名单内", tradeNo, merchant.ID, pid)
+		c.JSON(http.StatusOK, gin.H{
+			"code": -1,
+			"msg":  "IP不在白名单内",
+		})
+		return
+	}
+
+	params := map[string]string{
+		"pid":           pid,
+		"trade_no":      tradeNo,
+		"out_trade_no":  outTradeNo,
+		"money":         money,
+		"out_refund_no": outRefundNo,
+		"reason":        reason,
+		"payout":        payout,
+	}
+	if !util.VerifySign(params, merchant.Key, sign) {
+		middleware.SetAPILogContext(c, -1, "签名验证失败", tradeNo, merchant.ID, pid)
+		c.JSON(http.StatusOK, gin.H{
+			"code": -1,
+			"msg":  "签名验证失败",
+		})
+		return
+	}
+
+	amount := decimal.Zero
+	if money != "" {
+		var err error
+		if amount, err = decimal.NewFromString(money); err != nil || !amount.IsPositive() {
+			middleware.SetAPILogContext(c, -1, "退款金额无效", tradeNo, merchant.ID, pid)
+			c.JSON(http.StatusOK, gin.H{
+				"code": -1,
+				"msg":  "退款金额无效",
+			})
+			return
+		}
+	}
+
+	refund, err := service.GetRefundService().CreateRefund(&service.CreateRefundRequest{
+		MerchantID:  merchant.ID,
+		TradeNo:     tradeNo,
+		OutTradeNo:  outTradeNo,
+		OutRefundNo: outRefundNo,
+		Amount:      amount,
+		Reason:      reason,
+		Payout:      payout == "1",
+		Actor:       service.MerchantActor(merchant.PID),
+	})
+	if err != nil {
+		middleware.SetAPILogContext(c, -1, err.Error(), tradeNo, merchant.ID, pid)
+		c.JSON(http.StatusOK, gin.H{
+			"code": -1,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	middleware.SetAPILogContext(c, 1, "success", refund.TradeNo, merchant.ID, pid)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":          1,
+		"msg":           "success",
+		"refund_no":     refund.RefundNo,
+		"out_refund_no": refund.OutRefundNo,
+		"trade_no":      refund.TradeNo,
+		"out_trade_no":  refund.OutTradeNo,
+		"money":         refund.Amount.StringFixed(2),
+		"payout_status": refund.PayoutStatus,
 	})
 }
 
@@ -389,9 +504,11 @@ func (h *EpayHandler) CheckOrder(c *gin.Context) {
 	}
 
 	result := gin.H{
-		"code":   1,
-		"status": order.Status,
-		"paid":   paid,
+		"code":                   1,
+		"status":                 order.Status,
+		"paid":                   paid,
+		"confirmations":          order.Confirmations,
+		"required_confirmations": order.RequiredConfirmations,
 	}
 
 	if paid && order.ReturnURL != "" {
@@ -426,6 +543,7 @@ type PaymentTypeInfo struct {
 	Type    string `json:"type"`    // 支付类型代码
 	Name    string `json:"name"`    // 显示名称
 	Chain   string `json:"chain"`   // 链名称
+	Token   string `json:"token"`   // 代币符号
 	Icon    string `json:"icon"`    // 图标 (CSS类名或URL)
 	Logo    string `json:"logo"`    // Logo URL
 	Enabled bool   `json:"enabled"` // 是否启用
@@ -433,19 +551,86 @@ type PaymentTypeInfo struct {
 
 // 定义所有支付类型
 var allPaymentTypes = []PaymentTypeInfo{
-	{Type: "usdt_trc20", Name: "USDT (TRC20)", Chain: "trc20", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/trc20.svg"},
-	{Type: "usdt_bep20", Name: "USDT (BEP20)", Chain: "bep20", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/bep20.svg"},
-	{Type: "usdt_erc20", Name: "USDT (ERC20)", Chain: "erc20", Icon: "fab fa-ethereum", Logo: "/static/img/chains/erc20.svg"},
-	{Type: "usdt_polygon", Name: "USDT (Polygon)", Chain: "polygon", Icon: "fas fa-gem", Logo: "/static/img/chains/polygon.svg"},
-	{Type: "usdt_arbitrum", Name: "USDT (Arbitrum)", Chain: "arbitrum", Icon: "fas fa-layer-group", Logo: "/static/img/chains/arbitrum.svg"},
-	{Type: "usdt_optimism", Name: "USDT (Optimism)", Chain: "optimism", Icon: "fas fa-rocket", Logo: "/static/img/chains/optimism.svg"},
-	{Type: "usdt_base", Name: "USDT (Base)", Chain: "base", Icon: "fas fa-cube", Logo: "/static/img/chains/base.svg"},
-	{Type: "usdt_avalanche", Name: "USDT (Avalanche)", Chain: "avalanche", Icon: "fas fa-mountain", Logo: "/static/img/chains/avalanche.svg"},
-	{Type: "trx", Name: "TRX", Chain: "trx", Icon: "fas fa-coins", Logo: "/static/img/chains/trx.svg"},
+	{Type: "usdt_trc20", Name: "USDT (TRC20)", Chain: "trc20", Token: "USDT", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/trc20.svg"},
+	{Type: "usdt_bep20", Name: "USDT (BEP20)", Chain: "bep20", Token: "USDT", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/bep20.svg"},
+	{Type: "usdt_erc20", Name: "USDT (ERC20)", Chain: "erc20", Token: "USDT", Icon: "fab fa-ethereum", Logo: "/static/img/chains/erc20.svg"},
+	{Type: "usdt_polygon", Name: "USDT (Polygon)", Chain: "polygon", Token: "USDT", Icon: "fas fa-gem", Logo: "/static/img/chains/polygon.svg"},
+	{Type: "usdt_arbitrum", Name: "USDT (Arbitrum)", Chain: "arbitrum", Token: "USDT", Icon: "fas fa-layer-group", Logo: "/static/img/chains/arbitrum.svg"},
+	{Type: "usdt_optimism", Name: "USDT (Optimism)", Chain: "optimism", Token: "USDT", Icon: "fas fa-rocket", Logo: "/static/img/chains/optimism.svg"},
+	{Type: "usdt_base", Name: "USDT (Base)", Chain: "base", Token: "USDT", Icon: "fas fa-cube", Logo: "/static/img/chains/base.svg"},
+	{Type: "usdt_avalanche", Name: "USDT (Avalanche)", Chain: "avalanche", Token: "USDT", Icon: "fas fa-mountain", Logo: "/static/img/chains/avalanche.svg"},
+	{Type: "usdt_solana", Name: "USDT (Solana)", Chain: "solana", Token: "USDT", Icon: "fas fa-sun", Logo: "/static/img/chains/solana.svg"},
+	{Type: "usdt_ton", Name: "USDT (TON)", Chain: "ton", Token: "USDT", Icon: "fas fa-gem", Logo: "/static/img/chains/ton.svg"},
+	{Type: "trx", Name: "TRX", Chain: "trx", Token: "TRX", Icon: "fas fa-coins", Logo: "/static/img/chains/trx.svg"},
+	{Type: "eth_erc20", Name: "ETH (Ethereum)", Chain: "erc20", Token: "ETH", Icon: "fab fa-ethereum", Logo: "/static/img/chains/erc20.svg"},
+	{Type: "bnb_bep20", Name: "BNB (BSC)", Chain: "bep20", Token: "BNB", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/bep20.svg"},
+	{Type: "pol_polygon", Name: "POL (Polygon)", Chain: "polygon", Token: "POL", Icon: "fas fa-gem", Logo: "/static/img/chains/polygon.svg"},
+	{Type: "eth_arbitrum", Name: "ETH (Arbitrum)", Chain: "arbitrum", Token: "ETH", Icon: "fas fa-layer-group", Logo: "/static/img/chains/arbitrum.svg"},
+	{Type: "eth_optimism", Name: "ETH (Optimism)", Chain: "optimism", Token: "ETH", Icon: "fas fa-rocket", Logo: "/static/img/chains/optimism.svg"},
+	{Type: "eth_base", Name: "ETH (Base)", Chain: "base", Token: "ETH", Icon: "fas fa-cube", Logo: "/static/img/chains/base.svg"},
+	{Type: "avax_avalanche", Name: "AVAX (Avalanche)", Chain: "avalanche", Token: "AVAX", Icon: "fas fa-mountain", Logo: "/static/img/chains/avalanche.svg"},
+	{Type: "btc", Name: "BTC (Bitcoin)", Chain: "btc", Token: "BTC", Icon: "fab fa-bitcoin", Logo: "/static/img/chains/btc.svg"},
+	{Type: "ltc", Name: "LTC (Litecoin)", Chain: "ltc", Token: "LTC", Icon: "fas fa-litecoin-sign", Logo: "/static/img/chains/ltc.svg"},
 	{Type: "wechat", Name: "微信支付", Chain: "wechat", Icon: "fab fa-weixin", Logo: "/static/img/chains/wechat.svg"},
 	{Type: "alipay", Name: "支付宝", Chain: "alipay", Icon: "fab fa-alipay", Logo: "/static/img/chains/alipay.svg"},
 }
 
+// paymentTypes 全部支付类型：内置类型 + 代币登记表中启用的其他稳定币(如 usdc_base) + 配置文件新增链的原生币
+func paymentTypes() []PaymentTypeInfo {
+	types := make([]PaymentTypeInfo, 0, len(allPaymentTypes))
+	types = append(types, allPaymentTypes...)
+
+	// 按链和币种去重(如内置的 btc 类型即 BTC/btc，不再生成 btc_btc)
+	known := map[string]bool{}
+	chainNames := map[string]string{}
+	icons := map[string]PaymentTypeInfo{}
+	for _, pt := range allPaymentTypes {
+		known[pt.Chain+"/"+pt.Token] = true
+		if pt.Token == "USDT" {
+			chainNames[pt.Chain] = strings.TrimSuffix(strings.TrimPrefix(pt.Name, "USDT ("), ")")
+			icons[pt.Chain] = pt
+		}
+	}
+	chainName := func(chain string) string {
+		if name, ok := chainNames[chain]; ok {
+			return name
+		}
+		info, _ := util.GetChain(chain)
+		return info.Name
+	}
+	icon := func(chain string) PaymentTypeInfo {
+		if pt, ok := icons[chain]; ok {
+			return pt
+		}
+		return PaymentTypeInfo{Icon: "fas fa-link"}
+	}
+	add := func(chain, symbol string) {
+		if known[chain+"/"+symbol] {
+			return
+		}
+		known[chain+"/"+symbol] = true
+		payType := strings.ToLower(symbol) + "_" + chain
+		types = append(types, PaymentTypeInfo{
+			Type:  payType,
+			Name:  symbol + " (" + chainName(chain) + ")",
+			Chain: chain,
+			Token: symbol,
+			Icon:  icon(chain).Icon,
+			Logo:  icon(chain).Logo,
+		})
+	}
+
+	for _, token := range service.GetTokenService().AllEnabled() {
+		add(token.Chain, token.Symbol)
+	}
+	for _, info := range util.Chains() {
+		if info.NativeSymbol != "" && info.Type != util.ChainTypeTron {
+			add(info.ID, info.NativeSymbol)
+		}
+	}
+	return types
+}
+
 // GetPaymentTypes 获取支持的支付类型列表
 // GET /api/payment-types?pid=xxx
 func (h *EpayHandler) GetPaymentTypes(c *gin.Context) {
@@ -506,12 +691,22 @@ func (h *EpayHandler) GetPaymentTypes(c *gin.Context) {
 	for _, w := range wallets {
 		availableChains[w.Chain] = true
 	}
+	// 已登记 HD 钱包的链族下的链同样可用(订单使用派生地址)
+	hdFamilies := service.GetHDWalletService().Families(&merchant)
+	for _, info := range util.Chains() {
+		if hdFamilies[model.ChainHDFamily(info.ID)] {
+			availableChains[info.ID] = true
+		}
+	}
 
 	// 过滤出商户可用的支付类型
 	var enabledTypes []PaymentTypeInfo
-	for _, pt := range allPaymentTypes {
-		// 必须同时满足：区块链服务启用 + 商户有对应钱包
+	for _, pt := range paymentTypes() {
+		// 必须同时满足：区块链服务启用 + 商户有对应钱包 + 代币已启用(原生币无需登记)
 		pt.Enabled = isChainEnabled(pt.Chain) && availableChains[pt.Chain]
+		if pt.Enabled && pt.Token != "" && !model.IsNativeToken(pt.Chain, pt.Token) {
+			_, pt.Enabled = service.GetTokenService().GetToken(pt.Chain, pt.Token)
+		}
 		enabledTypes = append(enabledTypes, pt)
 	}
 
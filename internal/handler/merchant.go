@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"ezpay/config"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/shopspring/decimal"
 )
 
 // MerchantHandler 商户处理器
@@ -120,6 +122,7 @@ func (h *MerchantHandler) GetProfile(c *gin.Context) {
 			"email":            merchant.Email,
 			"notify_url":       merchant.NotifyURL,
 			"return_url":       merchant.ReturnURL,
+			"callback_format":  merchant.CallbackFormat,
 			"balance":          merchant.Balance,
 			"status":           merchant.Status,
 			"telegram_chat_id": merchant.TelegramChatID,
@@ -136,8 +139,9 @@ func (h *MerchantHandler) UpdateProfile(c *gin.Context) {
 	var req struct {
 		Name      string `json:"name"`
 		Email     string `json:"email"`
-		NotifyURL string `json:"notify_url"`
-		ReturnURL string `json:"return_url"`
+		NotifyURL      string `json:"notify_url"`
+		ReturnURL      string `json:"return_url"`
+		CallbackFormat string `json:"callback_format"` // epay / json
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -158,6 +162,13 @@ func (h *MerchantHandler) UpdateProfile(c *gin.Context) {
 	if req.ReturnURL != "" {
 		updates["return_url"] = req.ReturnURL
 	}
+	if req.CallbackFormat != "" {
+		if !model.IsValidCallbackFormat(req.CallbackFormat) {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "回调格式无效"})
+			return
+		}
+		updates["callback_format"] = req.CallbackFormat
+	}
 
 	if len(updates) > 0 {
 		model.DB.Model(merchant).Updates(updates)
@@ -433,6 +444,73 @@ func (h *MerchantHandler) GetOrder(c *gin.Context) {
 	})
 }
 
+// ListOrderNotifyTasks 获取订单回调任务记录
+func (h *MerchantHandler) ListOrderNotifyTasks(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	tradeNo := c.Param("trade_no")
+
+	var order model.Order
+	if err := model.DB.Where("merchant_id = ? AND trade_no = ?", merchantID, tradeNo).First(&order).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "订单不存在"})
+		return
+	}
+
+	tasks, err := service.GetNotifyService().ListOrderTasks(order.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": tasks})
+}
+
+// ListOrderNotifications 获取订单回调投递记录
+func (h *MerchantHandler) ListOrderNotifications(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	tradeNo := c.Param("trade_no")
+
+	var order model.Order
+	if err := model.DB.Where("merchant_id = ? AND trade_no = ?", merchantID, tradeNo).First(&order).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "订单不存在"})
+		return
+	}
+
+	attempts, err := service.GetNotifyService().ListOrderAttempts(order.ID)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"data": gin.H{
+			"notify_url":    order.NotifyURL,
+			"notify_status": order.NotifyStatus,
+			"notify_count":  order.NotifyCount,
+			"attempts":      attempts,
+		},
+	})
+}
+
+// ResendNotify 立即重发订单回调
+func (h *MerchantHandler) ResendNotify(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	tradeNo := c.Param("trade_no")
+
+	var order model.Order
+	if err := model.DB.Where("merchant_id = ? AND trade_no = ?", merchantID, tradeNo).First(&order).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "订单不存在"})
+		return
+	}
+
+	if err := service.GetNotifyService().ManualNotify(order.ID); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "订单未支付，无法发送回调"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "已触发通知"})
+}
+
 // ConfirmPayment 商户手动确认收款
 func (h *MerchantHandler) ConfirmPayment(c *gin.Context) {
 	merchantID := c.MustGet("merchant_id").(uint)
@@ -567,8 +645,8 @@ func (h *MerchantHandler) CancelOrder(c *gin.Context) {
 		return
 	}
 
-	// 标记订单已过期/取消
-	if err := model.DB.Model(&order).Update("status", model.OrderStatusExpired).Error; err != nil {
+	// 取消订单并退还预冻结手续费
+	if err := service.GetOrderService().CancelOrder(order.TradeNo); err != nil {
 		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "取消失败: " + err.Error()})
 		return
 	}
@@ -651,6 +729,10 @@ func (h *MerchantHandler) CreateWallet(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "请输入钱包地址"})
 			return
 		}
+		if !service.GetBlockchainService().ValidateAddress(req.Chain, req.Address) {
+			c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "钱包地址格式无效"})
+			return
+		}
 	}
 
 	// 检查钱包数量限制
@@ -775,6 +857,93 @@ func (h *MerchantHandler) DeleteWallet(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
 }
 
+// ListHDWallets HD 钱包列表
+func (h *MerchantHandler) ListHDWallets(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+
+	var wallets []model.HDWallet
+	model.DB.Where("merchant_id = ?", merchantID).Order("id DESC").Find(&wallets)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": wallets})
+}
+
+// CreateHDWallet 登记扩展公钥，订单将使用派生的独立收款地址
+func (h *MerchantHandler) CreateHDWallet(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+
+	var req struct {
+		Family string `json:"family" binding:"required"`
+		XPub   string `json:"xpub" binding:"required"`
+		Label  string `json:"label"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	wallet, err := service.GetHDWalletService().Create(merchantID, req.Family, req.XPub, req.Label)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "创建成功", "data": wallet})
+}
+
+// UpdateHDWallet 更新 HD 钱包
+func (h *MerchantHandler) UpdateHDWallet(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var wallet model.HDWallet
+	if err := model.DB.Where("id = ? AND merchant_id = ?", id, merchantID).First(&wallet).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "钱包不存在"})
+		return
+	}
+
+	var req struct {
+		Label  string `json:"label"`
+		Status *int8  `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Label != "" {
+		updates["label"] = req.Label
+	}
+	if req.Status != nil {
+		updates["status"] = *req.Status
+	}
+
+	if len(updates) > 0 {
+		model.DB.Model(&wallet).Updates(updates)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "更新成功"})
+}
+
+// DeleteHDWallet 删除 HD 钱包
+func (h *MerchantHandler) DeleteHDWallet(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var wallet model.HDWallet
+	if err := model.DB.Where("id = ? AND merchant_id = ?", id, merchantID).First(&wallet).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "钱包不存在"})
+		return
+	}
+
+	if err := service.GetHDWalletService().Delete(&wallet); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "删除成功"})
+}
+
 // UploadQRCode 上传收款码
 func (h *MerchantHandler) UploadQRCode(c *gin.Context) {
 	file, err := c.FormFile("file")
@@ -840,18 +1009,21 @@ func (h *MerchantHandler) GetChainStatus(c *gin.Context) {
 	chainStatus := service.GetBlockchainService().GetChainStatus()
 
 	// 转换为列表格式，商户只能查看状态
-	chains := []gin.H{
-		{"chain": "trc20", "name": "TRC20 (Tron)", "enabled": chainStatus["trc20"]},
-		{"chain": "erc20", "name": "ERC20 (Ethereum)", "enabled": chainStatus["erc20"]},
-		{"chain": "bep20", "name": "BEP20 (BSC)", "enabled": chainStatus["bep20"]},
-		{"chain": "polygon", "name": "Polygon", "enabled": chainStatus["polygon"]},
-		{"chain": "optimism", "name": "Optimism", "enabled": chainStatus["optimism"]},
-		{"chain": "arbitrum", "name": "Arbitrum", "enabled": chainStatus["arbitrum"]},
-		{"chain": "avalanche", "name": "Avalanche", "enabled": chainStatus["avalanche"]},
-		{"chain": "base", "name": "Base", "enabled": chainStatus["base"]},
-		{"chain": "wechat", "name": "微信支付", "enabled": true},
-		{"chain": "alipay", "name": "支付宝", "enabled": true},
+	var chains []gin.H
+	for _, info := range util.Chains() {
+		if info.Type == util.ChainTypeTron {
+			continue
+		}
+		enabled, ok := chainStatus[info.ID]
+		if !ok {
+			continue // 配置文件中未配置的链
+		}
+		chains = append(chains, gin.H{"chain": info.ID, "name": info.Name, "enabled": enabled})
 	}
+	chains = append(chains,
+		gin.H{"chain": "wechat", "name": "微信支付", "enabled": true},
+		gin.H{"chain": "alipay", "name": "支付宝", "enabled": true},
+	)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 1,
@@ -881,6 +1053,84 @@ func (h *MerchantHandler) GetBalance(c *gin.Context) {
 	})
 }
 
+// ListBalanceLedger 余额账本流水
+func (h *MerchantHandler) ListBalanceLedger(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	entries, total, err := service.GetLedgerService().ListEntries(&service.LedgerQuery{
+		MerchantID: merchantID,
+		Type:       c.Query("type"),
+		RefType:    c.Query("ref_type"),
+		RefNo:      c.Query("ref_no"),
+		StartDate:  c.Query("start_date"),
+		EndDate:    c.Query("end_date"),
+		Page:       page,
+		PageSize:   pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  entries,
+		"total": total,
+	})
+}
+
+// RefundOrder 商户发起订单退款
+func (h *MerchantHandler) RefundOrder(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*model.Merchant)
+	var req struct {
+		Amount      float64 `json:"amount"` // 为 0 时全额退款
+		OutRefundNo string  `json:"out_refund_no"`
+		Reason      string  `json:"reason"`
+		Payout      bool    `json:"payout"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	refund, err := service.GetRefundService().CreateRefund(&service.CreateRefundRequest{
+		MerchantID:  merchant.ID,
+		TradeNo:     c.Param("trade_no"),
+		OutRefundNo: req.OutRefundNo,
+		Amount:      decimal.NewFromFloat(req.Amount),
+		Reason:      req.Reason,
+		Payout:      req.Payout,
+		Actor:       service.MerchantActor(merchant.PID),
+	})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "退款成功", "data": refund})
+}
+
+// ListRefunds 退款记录
+func (h *MerchantHandler) ListRefunds(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	refunds, total, err := service.GetRefundService().ListRefunds(merchantID, c.Query("trade_no"), nil, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  refunds,
+		"total": total,
+	})
+}
+
 // GetRechargeAddresses 获取充值地址（系统钱包）
 func (h *MerchantHandler) GetRechargeAddresses(c *gin.Context) {
 	// 获取系统钱包作为充值地址（merchant_id = 0 的钱包）
@@ -953,6 +1203,36 @@ func (h *MerchantHandler) CreateWithdrawal(c *gin.Context) {
 	})
 }
 
+// GetWithdrawQuota 提现规则及已用额度，chain 为选择的提现地址所在链
+func (h *MerchantHandler) GetWithdrawQuota(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+
+	quota, err := service.GetWithdrawService().GetWithdrawQuota(merchantID, c.Query("chain"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": quota})
+}
+
+// GetWithdrawQuote 提现报价: 手续费、到账金额及按当前卖出汇率折算的打款金额
+func (h *MerchantHandler) GetWithdrawQuote(c *gin.Context) {
+	merchantID := c.GetUint("merchant_id")
+	addressID, _ := strconv.Atoi(c.Query("address_id"))
+	amount, _ := strconv.ParseFloat(c.Query("amount"), 64)
+	if amount <= 0 {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "提现金额无效"})
+		return
+	}
+
+	quote, err := service.GetWithdrawService().QuoteWithdrawal(merchantID, uint(addressID), amount, c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": quote})
+}
+
 // ListWithdrawals 提现记录列表
 func (h *MerchantHandler) ListWithdrawals(c *gin.Context) {
 	merchantID := c.GetUint("merchant_id")
@@ -1078,40 +1358,12 @@ func (h *MerchantHandler) CreateWithdrawAddress(c *gin.Context) {
 		return
 	}
 
-	// 验证链类型，支持 bep20, trc20, polygon, optimism
-	validChains := map[string]bool{"bep20": true, "trc20": true, "polygon": true, "optimism": true}
-	if !validChains[req.Chain] {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "不支持的链类型，仅支持 BEP20、TRC20、Polygon、Optimism"})
-		return
-	}
-
-	// 检查地址是否已存在
-	var count int64
-	model.DB.Model(&model.WithdrawAddress{}).
-		Where("merchant_id = ? AND chain = ? AND address = ?", merchantID, req.Chain, req.Address).
-		Count(&count)
-	if count > 0 {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "该地址已存在"})
-		return
-	}
-
-	address := model.WithdrawAddress{
-		MerchantID: merchantID,
-		Chain:      req.Chain,
-		Address:    req.Address,
-		Label:      req.Label,
-		IsDefault:  false,
-		Status:     model.WithdrawAddressPending, // 待审核
-	}
-
-	if err := model.DB.Create(&address).Error; err != nil {
-		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "创建失败"})
+	address, err := service.GetWithdrawService().CreateWithdrawAddress(merchantID, req.Chain, req.Address, req.Label, 0)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
 		return
 	}
 
-	// 发送通知给管理员
-	go service.GetTelegramService().NotifyWithdrawAddressAdded(&address)
-
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "提现地址已提交，等待管理员审核", "data": address})
 }
 
@@ -1246,6 +1498,112 @@ func (h *MerchantHandler) UpdateNotifySettings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "保存成功"})
 }
 
+// GetPaymentPolicy 获取收款容差策略
+func (h *MerchantHandler) GetPaymentPolicy(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*model.Merchant)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"data": merchant.PaymentPolicy,
+	})
+}
+
+// UpdatePaymentPolicy 更新收款容差策略
+func (h *MerchantHandler) UpdatePaymentPolicy(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*model.Merchant)
+
+	var req model.PaymentPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	// 少付容差由管理员设置，商户不能修改
+	req.UnderpayTolerance = merchant.PaymentPolicy.UnderpayTolerance
+	if req.UnderpayTolerance > model.MaxUnderpayTolerance {
+		req.UnderpayTolerance = model.MaxUnderpayTolerance
+	}
+	if err := validatePaymentPolicy(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	if err := model.GetDB().Model(merchant).Update("payment_policy", req).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "保存失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "保存成功"})
+}
+
+// GetWebhookSettings 获取 Webhook 事件订阅设置
+func (h *MerchantHandler) GetWebhookSettings(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*model.Merchant)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"data": gin.H{
+			"settings":    merchant.WebhookSettings,
+			"notify_url":  merchant.NotifyURL,
+			"event_types": model.WebhookEventTypes,
+		},
+	})
+}
+
+// UpdateWebhookSettings 更新 Webhook 事件订阅设置
+func (h *MerchantHandler) UpdateWebhookSettings(c *gin.Context) {
+	merchant := c.MustGet("merchant").(*model.Merchant)
+
+	var req model.WebhookSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "参数错误"})
+		return
+	}
+
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL != "" && !strings.HasPrefix(req.URL, "http://") && !strings.HasPrefix(req.URL, "https://") {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "推送地址必须以 http:// 或 https:// 开头"})
+		return
+	}
+	if req.Enabled && req.URL == "" && merchant.NotifyURL == "" {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "请填写推送地址或先设置异步通知URL"})
+		return
+	}
+
+	if err := model.GetDB().Model(merchant).Update("webhook_settings", req).Error; err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": "保存失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "msg": "保存成功"})
+}
+
+// ListWebhookEvents 获取 Webhook 事件推送记录
+func (h *MerchantHandler) ListWebhookEvents(c *gin.Context) {
+	merchantID := c.MustGet("merchant_id").(uint)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tasks, total, err := service.GetNotifyService().ListEvents(merchantID, c.Query("type"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": -1, "msg": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":  1,
+		"data":  tasks,
+		"total": total,
+		"page":  page,
+	})
+}
+
 // ============ 监控客户端配置 ============
 
 // GetMonitorConfig 获取监控客户端配置信息和二维码
@@ -330,7 +330,7 @@ func (h *VmqHandler) GetState(c *gin.Context) {
 	// 状态映射: 0未支付 1已支付 2已过期
 	state := 0
 	switch order.Status {
-	case model.OrderStatusPaid:
+	case model.OrderStatusPaid, model.OrderStatusPaidLate:
 		state = 1
 	case model.OrderStatusExpired, model.OrderStatusCancelled:
 		state = 2
@@ -230,15 +230,36 @@ func AdminAuth(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		// 提取Claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			adminID := uint(claims["admin_id"].(float64))
-			username := claims["username"].(string)
+		// 提取Claims，商户Token不能访问管理接口(旧版管理员Token没有 type)
+		claims, ok := token.Claims.(jwt.MapClaims)
+		var adminID float64
+		if ok {
+			adminID, ok = claims["admin_id"].(float64)
+		}
+		if tokenType, _ := claims["type"].(string); !ok || (tokenType != "" && tokenType != "admin") {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code": -1,
+				"msg":  "非管理员Token",
+			})
+			c.Abort()
+			return
+		}
 
-			c.Set("admin_id", adminID)
-			c.Set("username", username)
+		// 验证管理员状态，多管理员审批依赖可靠的管理员身份
+		var admin model.Admin
+		if err := model.DB.Where("id = ? AND status = 1", uint(adminID)).First(&admin).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"code": -1,
+				"msg":  "管理员不存在或已禁用",
+			})
+			c.Abort()
+			return
 		}
 
+		c.Set("admin_id", admin.ID)
+		c.Set("username", admin.Username)
+		c.Set("admin", &admin)
+
 		c.Next()
 	}
 }
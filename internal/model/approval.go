@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 审批对象类型
+const (
+	ApprovalRefWithdrawal      = "withdrawal"       // 提现申请
+	ApprovalRefWithdrawAddress = "withdraw_address" // 提现地址
+)
+
+// Approval 管理员审批记录(双人复核)
+// 同一对象需要不同管理员分别审批，达到要求的人数后才生效；
+// 同一管理员对同一对象只能审批一次，代商户创建的管理员不能审批自己创建的对象
+type Approval struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RefType   string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_approval_admin" json:"ref_type"`
+	RefID     uint      `gorm:"not null;uniqueIndex:idx_approval_admin" json:"ref_id"`
+	AdminID   uint      `gorm:"not null;uniqueIndex:idx_approval_admin" json:"admin_id"`
+	Username  string    `gorm:"type:varchar(50)" json:"username"`
+	Remark    string    `gorm:"type:varchar(500)" json:"remark"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Approval) TableName() string {
+	return "approvals"
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// LedgerType 账本流水类型
+type LedgerType string
+
+const (
+	LedgerTypeCredit   LedgerType = "credit"   // 入账: 余额增加
+	LedgerTypeDebit    LedgerType = "debit"    // 出账: 余额减少
+	LedgerTypeFreeze   LedgerType = "freeze"   // 冻结: 冻结余额增加
+	LedgerTypeUnfreeze LedgerType = "unfreeze" // 解冻: 冻结余额减少
+)
+
+// LedgerRefType 账本流水关联对象类型
+type LedgerRefType string
+
+const (
+	LedgerRefOrder      LedgerRefType = "order"      // 订单
+	LedgerRefWithdrawal LedgerRefType = "withdrawal" // 提现
+	LedgerRefAdmin      LedgerRefType = "admin"      // 管理员调账
+	LedgerRefRefund     LedgerRefType = "refund"     // 订单退款
+)
+
+// LedgerActorSystem 系统自动操作
+const LedgerActorSystem = "system"
+
+// ErrLedgerImmutable 账本流水不可修改
+var ErrLedgerImmutable = errors.New("账本流水不可修改或删除")
+
+// BalanceLedger 商户余额账本流水
+// 每一次余额/冻结余额变动都对应一条不可变记录，与余额更新在同一事务中写入
+type BalanceLedger struct {
+	ID            uint            `gorm:"primaryKey" json:"id"`
+	MerchantID    uint            `gorm:"index;not null" json:"merchant_id"`
+	Type          LedgerType      `gorm:"type:varchar(20);index;not null" json:"type"`           // credit, debit, freeze, unfreeze
+	Amount        decimal.Decimal `gorm:"type:decimal(18,2);not null" json:"amount"`             // 变动金额（USD，恒为正数）
+	BalanceBefore decimal.Decimal `gorm:"type:decimal(18,2)" json:"balance_before"`              // 变动前余额
+	BalanceAfter  decimal.Decimal `gorm:"type:decimal(18,2)" json:"balance_after"`               // 变动后余额
+	FrozenBefore  decimal.Decimal `gorm:"type:decimal(18,2)" json:"frozen_before"`               // 变动前冻结余额
+	FrozenAfter   decimal.Decimal `gorm:"type:decimal(18,2)" json:"frozen_after"`                // 变动后冻结余额
+	RefType       LedgerRefType   `gorm:"type:varchar(20);index:idx_ledger_ref" json:"ref_type"` // 关联类型: order, withdrawal, admin
+	RefID         uint            `gorm:"index:idx_ledger_ref" json:"ref_id"`                    // 关联ID
+	RefNo         string          `gorm:"type:varchar(64)" json:"ref_no"`                        // 关联单号(如订单号)
+	Actor         string          `gorm:"type:varchar(64)" json:"actor"`                         // 操作者: system, admin:xxx, merchant:xxx
+	Remark        string          `gorm:"type:varchar(500)" json:"remark"`                       // 备注
+	CreatedAt     time.Time       `gorm:"index" json:"created_at"`
+}
+
+func (BalanceLedger) TableName() string {
+	return "balance_ledger"
+}
+
+// BeforeUpdate 禁止修改账本流水
+func (BalanceLedger) BeforeUpdate(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
+
+// BeforeDelete 禁止删除账本流水
+func (BalanceLedger) BeforeDelete(tx *gorm.DB) error {
+	return ErrLedgerImmutable
+}
@@ -26,7 +26,7 @@ const (
 	ConfigKeyRateSellFloat       = "rate_sell_float"        // 卖出汇率浮动（商户提现时），如-0.02表示-2%
 	ConfigKeyRateAutoUpdate      = "rate_auto_update"       // 汇率自动更新开关: 1启用 0禁用
 	ConfigKeyOrderExpire         = "order_expire"           // 订单过期时间(分钟)
-	ConfigKeyNotifyRetry         = "notify_retry"           // 通知重试次数
+	ConfigKeyNotifyRetry         = "notify_retry"           // 回调最大尝试次数
 	ConfigKeySiteName            = "site_name"              // 网站名称
 	ConfigKeyAdminEmail          = "admin_email"            // 管理员邮箱
 	ConfigKeyWechatEnabled       = "wechat_enabled"         // 微信支付启用状态
@@ -39,6 +39,8 @@ const (
 	ConfigKeyTelegramMode          = "telegram_mode"            // Telegram接收模式: polling轮询 webhook推送
 	ConfigKeyTelegramWebhookURL    = "telegram_webhook_url"     // Telegram Webhook地址
 	ConfigKeyTelegramWebhookSecret = "telegram_webhook_secret"  // Telegram Webhook验证密钥
+	ConfigKeyReconcileHour         = "reconcile_hour"           // 每日余额对账时间(0-23点)
+	ConfigKeyWithdrawQuoteTTL      = "withdraw_quote_ttl"       // 提现报价锁定时间(分钟)，超时审核时按当前卖出汇率重新报价
 )
 
 // BlockScanProgress 区块扫描进度表（持久化每条链的扫描位置）
@@ -53,6 +55,21 @@ func (BlockScanProgress) TableName() string {
 	return "block_scan_progress"
 }
 
+// ChainBlock 已扫描区块的哈希窗口（用于区块重组检测）
+// 每条链保留最近若干区块的哈希和父哈希，父哈希不连续或同高度哈希变化即发生重组
+type ChainBlock struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Chain      string    `gorm:"type:varchar(20);uniqueIndex:idx_chain_block;not null" json:"chain"`
+	Number     uint64    `gorm:"type:bigint unsigned;uniqueIndex:idx_chain_block;not null" json:"number"`
+	Hash       string    `gorm:"type:varchar(100);not null" json:"hash"`
+	ParentHash string    `gorm:"type:varchar(100)" json:"parent_hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (ChainBlock) TableName() string {
+	return "chain_blocks"
+}
+
 // TransactionLog 交易日志表
 type TransactionLog struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -61,8 +78,13 @@ type TransactionLog struct {
 	FromAddress string    `gorm:"type:varchar(100);index" json:"from_address"`
 	ToAddress   string    `gorm:"type:varchar(100);index" json:"to_address"`
 	Amount      string    `gorm:"type:varchar(50)" json:"amount"`
+	Token       string    `gorm:"type:varchar(20)" json:"token"` // 代币符号: USDT, USDC, TRX
 	BlockNumber uint64    `gorm:"index" json:"block_number"`
+	BlockHash   string    `gorm:"type:varchar(100)" json:"block_hash"` // 所在区块哈希(EVM)，区块重组时据此判断交易是否被孤立
 	Matched     bool      `gorm:"default:false" json:"matched"` // 是否已匹配订单
+	MatchNote   string     `gorm:"type:varchar(50)" json:"match_note"`  // 匹配结果说明: paid, partial, paid_late, no_order, ambiguous, underpaid, expired, manual, failed, no_reference
+	AssignedBy  string     `gorm:"type:varchar(50)" json:"assigned_by"` // 手动指派的管理员
+	AssignedAt  *time.Time `json:"assigned_at"`                         // 手动指派时间
 	OrderID     *uint     `json:"order_id"`
 	CreatedAt   time.Time `json:"created_at"`
 }
@@ -71,6 +93,20 @@ func (TransactionLog) TableName() string {
 	return "transaction_logs"
 }
 
+// 交易匹配结果说明
+const (
+	MatchNotePaid        = "paid"         // 足额支付(含容差)
+	MatchNotePartial     = "partial"      // 部分支付
+	MatchNotePaidLate    = "paid_late"    // 过期后支付
+	MatchNoteNoOrder     = "no_order"     // 无对应订单
+	MatchNoteAmbiguous   = "ambiguous"    // 匹配到多个候选订单
+	MatchNoteUnderpaid   = "underpaid"    // 金额不足且不允许部分支付
+	MatchNoteExpired     = "expired"      // 订单已过期且不接受过期到账
+	MatchNoteManual      = "manual"       // 管理员手动指派
+	MatchNoteFailed      = "failed"       // 结算失败(如订单已被并发处理)，待人工处理
+	MatchNoteNoReference = "no_reference" // 付款备注必填的链(TON)转账未带有效备注
+)
+
 // Admin 管理员表
 type Admin struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
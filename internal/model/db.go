@@ -37,7 +37,8 @@ func InitDB(dsn string) error {
 func InitDBWithConfig(dsn string, cfg DBConfig) error {
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Warn), // 生产环境使用 Warn 级别
+		Logger:         logger.Default.LogMode(logger.Warn), // 生产环境使用 Warn 级别
+		TranslateError: true,                                // 唯一索引冲突返回 gorm.ErrDuplicatedKey
 	})
 	if err != nil {
 		return fmt.Errorf("failed to connect database: %w", err)
@@ -124,6 +125,21 @@ func autoMigrate() error {
 		&ExchangeRate{},
 		&ExchangeRateHistory{},
 		&BlockScanProgress{},
+		&ChainBlock{},
+		&BalanceLedger{},
+		&BalanceReconciliation{},
+		&Refund{},
+		&NotifyTask{},
+		&NotifyAttempt{},
+		&OutboxEvent{},
+		&PendingTransfer{},
+		&HDWallet{},
+		&Token{},
+		&RescanJob{},
+		&PayoutBatch{},
+		&PayoutBatchItem{},
+		&WithdrawPolicy{},
+		&Approval{},
 	)
 }
 
@@ -196,11 +212,13 @@ func initDefaultData() error {
 		{Key: ConfigKeyManualRate, Value: "7.2", Description: "手动设置的汇率"},
 		{Key: ConfigKeyFloatPercent, Value: "0", Description: "汇率浮动百分比"},
 		{Key: ConfigKeyOrderExpire, Value: "30", Description: "订单过期时间(分钟)"},
-		{Key: ConfigKeyNotifyRetry, Value: "5", Description: "通知重试次数"},
+		{Key: ConfigKeyNotifyRetry, Value: "10", Description: "回调最大尝试次数"},
 		{Key: ConfigKeySiteName, Value: "EzPay", Description: "网站名称"},
 		{Key: ConfigKeySystemWalletFeeRate, Value: "0.02", Description: "系统收款码手续费率 (如0.02表示2%)"},
 		{Key: ConfigKeyPersonalWalletFeeRate, Value: "0.01", Description: "个人收款码手续费率 (如0.01表示1%)"},
 		{Key: ConfigKeyRateAutoUpdate, Value: "1", Description: "汇率自动更新: 1启用 0禁用"},
+		{Key: ConfigKeyReconcileHour, Value: "3", Description: "每日余额对账时间(0-23点)"},
+		{Key: ConfigKeyWithdrawQuoteTTL, Value: "30", Description: "提现报价锁定时间(分钟)，超时审核时按当前卖出汇率重新报价"},
 	}
 
 	for _, cfg := range defaultConfigs {
@@ -211,9 +229,32 @@ func initDefaultData() error {
 		}
 	}
 
+	// 初始化预置代币
+	for _, token := range defaultTokens {
+		var count int64
+		DB.Model(&Token{}).Where("chain = ? AND symbol = ?", token.Chain, token.Symbol).Count(&count)
+		if count == 0 {
+			DB.Create(&token)
+		}
+	}
+
+	// 旧订单/交易未记录币种，按链的默认币种补齐
+	backfillDefaultToken(&Order{}, "pay_currency")
+	backfillDefaultToken(&TransactionLog{}, "token")
+
 	return nil
 }
 
+// backfillDefaultToken 按链的默认币种(DefaultToken)补齐未记录币种的记录
+func backfillDefaultToken(value interface{}, column string) {
+	empty := column + " = '' OR " + column + " IS NULL"
+	var chains []string
+	DB.Model(value).Where(empty).Distinct().Pluck("chain", &chains)
+	for _, chain := range chains {
+		DB.Model(value).Where("chain = ?", chain).Where(empty).Update(column, DefaultToken(chain))
+	}
+}
+
 // GetDB 获取数据库实例
 func GetDB() *gorm.DB {
 	return DB
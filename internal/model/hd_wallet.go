@@ -0,0 +1,58 @@
+package model
+
+import (
+	"time"
+
+	"ezpay/internal/util"
+)
+
+// HD 钱包链族，同一链族的链共用地址格式和派生路径
+const (
+	HDFamilyEVM  = "evm"  // ERC20/BEP20/Polygon 等 EVM 链，派生路径 m/44'/60'/0'/0/i
+	HDFamilyTron = "tron" // TRX/TRC20，派生路径 m/44'/195'/0'/0/i
+	HDFamilyBTC  = "btc"  // Bitcoin，派生路径 m/84'/0'/0'/0/i(zpub)、m/49'(ypub) 或 m/44'(xpub)
+	HDFamilyLTC  = "ltc"  // Litecoin，派生路径 m/84'/2'/0'/0/i(zpub)、m/49'(Mtub) 或 m/44'(Ltub/xpub)
+)
+
+// HDWallet HD 钱包(扩展公钥)
+// 商户(或系统)按链族登记账户层级的扩展公钥，创建订单时为每个订单派生独立收款地址，按地址匹配付款
+// 只保存公钥，私钥由商户自行保管
+type HDWallet struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MerchantID uint      `gorm:"default:0;uniqueIndex:uk_hd_merchant_family" json:"merchant_id"`            // 0=系统, >0=商户
+	Family     string    `gorm:"type:varchar(10);not null;uniqueIndex:uk_hd_merchant_family" json:"family"` // evm, tron, btc, ltc
+	XPub       string    `gorm:"type:varchar(200);not null;uniqueIndex" json:"xpub"`                        // 扩展公钥(账户层级 m/44'/coin'/0' 或外部链层级 m/44'/coin'/0'/0)
+	Label      string    `gorm:"type:varchar(50)" json:"label"`
+	NextIndex  uint32    `gorm:"default:0" json:"next_index"` // 下一个派生序号
+	Status     int8      `gorm:"default:1" json:"status"`     // 1:启用 0:禁用
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (HDWallet) TableName() string {
+	return "hd_wallets"
+}
+
+// ChainHDFamily 链所属的 HD 钱包链族，法币等不支持派生地址的链返回空
+func ChainHDFamily(chain string) string {
+	info, _ := util.GetChain(chain)
+	switch info.Type {
+	case util.ChainTypeTron, util.ChainTypeTRC20:
+		return HDFamilyTron
+	case util.ChainTypeEVM:
+		return HDFamilyEVM
+	case util.ChainTypeUTXO:
+		switch info.NativeSymbol {
+		case "BTC":
+			return HDFamilyBTC
+		case "LTC":
+			return HDFamilyLTC
+		}
+	}
+	return ""
+}
+
+// IsValidHDFamily 是否为支持的 HD 钱包链族
+func IsValidHDFamily(family string) bool {
+	return family == HDFamilyEVM || family == HDFamilyTron || family == HDFamilyBTC || family == HDFamilyLTC
+}
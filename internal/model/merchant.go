@@ -57,6 +57,55 @@ func (n NotifySettings) Value() (driver.Value, error) {
 	return json.Marshal(n)
 }
 
+// PaymentPolicy 加密货币收款容差策略
+type PaymentPolicy struct {
+	UnderpayTolerance float64 `json:"underpay_tolerance"`  // 少付容差比例(如0.005表示0.5%)，在此范围内视为足额支付
+	OverpayTolerance  float64 `json:"overpay_tolerance"`   // 多付匹配比例上限(如0.1表示10%)，在此范围内多付视为已支付
+	AllowPartial      bool    `json:"allow_partial"`       // 允许部分支付，累计同一付款地址的多笔转账
+	AllowLate         bool    `json:"allow_late"`          // 允许订单过期后到账(标记为过期后支付)
+	LateWindowMinutes int     `json:"late_window_minutes"` // 过期后仍接受到账的时间窗口(分钟)
+}
+
+// MaxUnderpayTolerance 少付容差上限，只能由管理员设置
+const MaxUnderpayTolerance = 0.02
+
+// DefaultPaymentPolicy 默认收款策略（精确匹配，与旧版行为一致）
+func DefaultPaymentPolicy() PaymentPolicy {
+	return PaymentPolicy{
+		UnderpayTolerance: 0,
+		OverpayTolerance:  0,
+		AllowPartial:      false,
+		AllowLate:         false,
+		LateWindowMinutes: 60,
+	}
+}
+
+// Scan 实现 sql.Scanner 接口
+func (p *PaymentPolicy) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok || len(bytes) == 0 {
+		*p = DefaultPaymentPolicy()
+		return nil
+	}
+	return json.Unmarshal(bytes, p)
+}
+
+// Value 实现 driver.Valuer 接口
+func (p PaymentPolicy) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+// 商户回调格式
+const (
+	CallbackFormatEpay = "epay" // 彩虹易支付兼容: GET 请求 + MD5 签名
+	CallbackFormatJSON = "json" // POST JSON + HMAC-SHA256 签名头
+)
+
+// IsValidCallbackFormat 校验回调格式
+func IsValidCallbackFormat(format string) bool {
+	return format == CallbackFormatEpay || format == CallbackFormatJSON
+}
+
 // Merchant 商户表
 type Merchant struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
@@ -81,6 +130,9 @@ type Merchant struct {
 	TelegramStatus string         `gorm:"type:varchar(20);default:'unbound'" json:"telegram_status"` // Telegram状态: normal正常, blocked被封禁, unbound未绑定
 	NotifySettings NotifySettings `gorm:"type:json" json:"notify_settings"`                   // 通知设置详情
 	WalletMode     int8           `gorm:"default:3" json:"wallet_mode"`                       // 钱包模式: 1=仅系统钱包 2=仅个人钱包 3=两者同时(优先个人)
+	PaymentPolicy  PaymentPolicy  `gorm:"type:json" json:"payment_policy"`                    // 收款容差策略(少付/多付/部分支付/过期到账)
+	CallbackFormat string         `gorm:"type:varchar(10);default:'epay'" json:"callback_format"` // 回调格式: epay=GET+MD5(默认) json=POST JSON+HMAC-SHA256
+	WebhookSettings WebhookSettings `gorm:"type:json" json:"webhook_settings"`            // Webhook 事件订阅设置
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
@@ -107,8 +159,18 @@ const (
 	WithdrawStatusApproved WithdrawStatus = 1 // 已通过
 	WithdrawStatusRejected WithdrawStatus = 2 // 已拒绝
 	WithdrawStatusPaid     WithdrawStatus = 3 // 已打款
+	WithdrawStatusPaying   WithdrawStatus = 4 // 打款中(热钱包已签名广播，等待确认)
+	WithdrawStatusFailed   WithdrawStatus = 5 // 打款失败(资金仍冻结，可重新打款或拒绝)
 )
 
+// FrozenWithdrawStatuses 提现金额仍冻结在商户余额中的状态(尚未打款或拒绝)
+var FrozenWithdrawStatuses = []WithdrawStatus{
+	WithdrawStatusPending,
+	WithdrawStatusApproved,
+	WithdrawStatusPaying,
+	WithdrawStatusFailed,
+}
+
 // Withdrawal 提现记录
 type Withdrawal struct {
 	ID              uint           `gorm:"primaryKey" json:"id"`
@@ -120,6 +182,7 @@ type Withdrawal struct {
 	PayoutAmount    float64        `gorm:"type:decimal(18,6);default:0" json:"payout_amount"`  // 实际打款金额（USDT/TRX等）
 	PayoutCurrency  string         `gorm:"type:varchar(10)" json:"payout_currency"`            // 打款货币: USDT, TRX等
 	PayoutRate      float64        `gorm:"type:decimal(10,4);default:0" json:"payout_rate"`    // 打款汇率（卖出汇率）
+	QuotedAt        *time.Time     `json:"quoted_at"`                                          // 打款报价时间，锁定期内审核按该报价打款
 	PayMethod       string         `gorm:"type:varchar(20)" json:"pay_method"`                 // 打款方式: trc20, erc20, bep20等
 	Account         string         `gorm:"type:varchar(200)" json:"account"`                   // 收款账号
 	AccountName     string         `gorm:"type:varchar(100)" json:"account_name"`              // 收款人姓名
@@ -128,6 +191,14 @@ type Withdrawal struct {
 	Remark          string         `gorm:"type:varchar(500)" json:"remark"`                    // 备注
 	AdminRemark     string         `gorm:"type:varchar(500)" json:"admin_remark"`              // 管理员备注
 	ProcessedAt     *time.Time     `json:"processed_at"`                                       // 处理时间
+	PayoutTxHash    string         `gorm:"type:varchar(100);index" json:"payout_tx_hash"`      // 打款交易哈希(热钱包自动打款)
+	PayoutRawTx     string         `gorm:"type:text" json:"-"`                                 // 已签名交易，未上链时重复广播
+	PayoutNonce     uint64         `gorm:"default:0" json:"payout_nonce"`                      // 打款交易 nonce(EVM)
+	PayoutSentAt    *time.Time     `json:"payout_sent_at"`                                     // 打款交易签名时间
+	PayoutError     string         `gorm:"type:varchar(500)" json:"payout_error"`              // 最近一次打款错误
+	PayoutBatchID   uint           `gorm:"index;default:0" json:"payout_batch_id"`             // 所属批量打款
+	PayoutAttempts  int            `gorm:"default:0" json:"payout_attempts"`                   // 已发出的打款交易次数
+	CreatedBy       uint           `gorm:"default:0" json:"created_by"`                        // 代商户申请的管理员ID，0 为商户自行申请
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 }
@@ -155,6 +226,7 @@ type WithdrawAddress struct {
 	IsDefault   bool                  `gorm:"default:false" json:"is_default"`           // 是否默认地址
 	Status      WithdrawAddressStatus `gorm:"default:0" json:"status"`                   // 审核状态: 0待审核 1已通过 2已拒绝
 	AdminRemark string                `gorm:"type:varchar(500)" json:"admin_remark"`     // 管理员备注
+	CreatedBy   uint                  `gorm:"default:0" json:"created_by"`               // 代商户添加的管理员ID，0 为商户自行添加
 	CreatedAt   time.Time             `json:"created_at"`
 	UpdatedAt   time.Time             `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt        `gorm:"index" json:"-"`
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+)
+
+// NotifyTaskStatus 回调任务状态
+type NotifyTaskStatus int8
+
+const (
+	NotifyTaskPending NotifyTaskStatus = 0 // 待投递(含重试中)
+	NotifyTaskSuccess NotifyTaskStatus = 1 // 投递成功
+	NotifyTaskDead    NotifyTaskStatus = 2 // 已放弃(达到最大尝试次数)
+)
+
+// NotifyTaskKind 回调任务类型
+type NotifyTaskKind string
+
+const (
+	NotifyTaskKindOrder  NotifyTaskKind = "order"  // 支付结果回调
+	NotifyTaskKindRefund NotifyTaskKind = "refund" // 退款结果回调
+	NotifyTaskKindEvent  NotifyTaskKind = "event"  // Webhook 事件推送
+)
+
+// NotifyTask 商户回调投递任务
+// 任务持久化在数据库中，由工作池按 next_attempt_at 取出投递，服务重启后继续重试
+type NotifyTask struct {
+	ID             uint             `gorm:"primaryKey" json:"id"`
+	MerchantID     uint             `gorm:"index;not null" json:"merchant_id"`
+	OrderID        uint             `gorm:"index;not null" json:"order_id"` // 关联订单ID(提现、余额事件为0)
+	RefID          uint             `gorm:"default:0" json:"ref_id"`        // 关联记录ID(退款回调为退款ID)
+	Kind           NotifyTaskKind   `gorm:"type:varchar(20);not null" json:"kind"`
+	EventID        string           `gorm:"type:varchar(40);uniqueIndex;default:null" json:"event_id"` // Webhook 事件ID(商户据此去重)，其他任务为 NULL
+	EventType      WebhookEventType `gorm:"type:varchar(40)" json:"event_type"`                        // Webhook 事件类型
+	NotifyURL      string           `gorm:"type:varchar(500)" json:"notify_url"`
+	Payload        string           `gorm:"type:text" json:"payload"` // 回调参数(JSON，不含签名，投递时按商户当前密钥签名)；事件推送为完整请求体
+	Status         NotifyTaskStatus `gorm:"default:0;index:idx_status_next" json:"status"`
+	Attempt        int              `gorm:"default:0" json:"attempt"`                     // 已尝试次数
+	MaxAttempts    int              `gorm:"default:0" json:"max_attempts"`                // 最大尝试次数
+	NextAttemptAt  time.Time        `gorm:"index:idx_status_next" json:"next_attempt_at"` // 下次投递时间
+	LastHTTPStatus int              `gorm:"default:0" json:"last_http_status"`            // 最近一次响应状态码
+	LastBody       string           `gorm:"type:varchar(500)" json:"last_body"`           // 最近一次响应内容(截断)
+	LastError      string           `gorm:"type:varchar(500)" json:"last_error"`          // 最近一次错误
+	LastAttemptAt  *time.Time       `json:"last_attempt_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+func (NotifyTask) TableName() string {
+	return "notify_tasks"
+}
+
+// NotifyAttempt 回调投递记录，每次 HTTP 请求一条
+type NotifyAttempt struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	TaskID     uint           `gorm:"index;not null" json:"task_id"`
+	OrderID    uint           `gorm:"index;not null" json:"order_id"`
+	MerchantID uint           `gorm:"index;not null" json:"merchant_id"`
+	Kind       NotifyTaskKind `gorm:"type:varchar(20)" json:"kind"`
+	Attempt    int            `json:"attempt"`                           // 第几次尝试
+	URL        string         `gorm:"type:varchar(1000)" json:"url"`     // 请求地址(签名已遮蔽)
+	HTTPStatus int            `gorm:"default:0" json:"http_status"`      // 响应状态码，0表示未收到响应
+	Response   string         `gorm:"type:varchar(500)" json:"response"` // 响应内容(截断)
+	LatencyMs  int64          `json:"latency_ms"`                        // 耗时(毫秒)
+	Error      string         `gorm:"type:varchar(500)" json:"error"`
+	Success    bool           `json:"success"`
+	CreatedAt  time.Time      `gorm:"index" json:"created_at"`
+}
+
+func (NotifyAttempt) TableName() string {
+	return "notify_attempts"
+}
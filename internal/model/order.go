@@ -15,8 +15,29 @@ const (
 	OrderStatusPaid      OrderStatus = 1 // 已支付
 	OrderStatusExpired   OrderStatus = 2 // 已过期
 	OrderStatusCancelled OrderStatus = 3 // 已取消
+	OrderStatusPartial   OrderStatus = 4 // 部分支付(等待补足)
+	OrderStatusPaidLate  OrderStatus = 5 // 过期后支付
+	OrderStatusRefunded  OrderStatus = 6 // 已全额退款
+	OrderStatusDetected   OrderStatus = 7 // 已检测到付款(交易尚无确认)
+	OrderStatusConfirming OrderStatus = 8 // 付款确认中(确认数未达到要求)
 )
 
+// ConfirmingOrderStatuses 等待链上确认的订单状态，确认完成后结算，交易消失时回退到检测前状态
+var ConfirmingOrderStatuses = []OrderStatus{OrderStatusDetected, OrderStatusConfirming}
+
+// IsConfirming 订单是否正在等待链上确认
+func (s OrderStatus) IsConfirming() bool {
+	return s == OrderStatusDetected || s == OrderStatusConfirming
+}
+
+// PaidOrderStatuses 视为已支付(已入账)的订单状态
+var PaidOrderStatuses = []OrderStatus{OrderStatusPaid, OrderStatusPaidLate}
+
+// IsPaid 订单是否已支付(含过期后支付)
+func (s OrderStatus) IsPaid() bool {
+	return s == OrderStatusPaid || s == OrderStatusPaidLate
+}
+
 // NotifyStatus 通知状态
 type NotifyStatus int8
 
@@ -50,14 +71,21 @@ type Order struct {
 	PayCurrency      string          `gorm:"type:varchar(10)" json:"pay_currency"`             // 支付货币: USDT, TRX, CNY
 	USDTAmount       decimal.Decimal `gorm:"type:decimal(18,6)" json:"usdt_amount"`            // USDT金额(兼容旧字段)
 	SettlementAmount decimal.Decimal `gorm:"type:decimal(18,6)" json:"settlement_amount"`      // 结算金额（USD，计入商户余额）
-	ActualAmount     decimal.Decimal `gorm:"type:decimal(18,6)" json:"actual_amount"`         // 实际收到金额
+	ActualAmount     decimal.Decimal `gorm:"type:decimal(18,6)" json:"actual_amount"`         // 实际收到金额(多笔转账累计)
+	TransferCount    int             `gorm:"default:0" json:"transfer_count"`                 // 已匹配的转账笔数
+	RefundedAmount   decimal.Decimal `gorm:"type:decimal(18,2);default:0" json:"refunded_amount"` // 累计退款金额（USD）
 	Rate             decimal.Decimal `gorm:"type:decimal(10,4)" json:"rate"`                  // 汇率（买入汇率，用户支付时）
 	Chain          string          `gorm:"type:varchar(20)" json:"chain"`                 // trc20, erc20, bep20, polygon
 	ToAddress      string          `gorm:"type:varchar(100)" json:"to_address"`           // 收款地址
 	FromAddress    string          `gorm:"type:varchar(100)" json:"from_address"`         // 付款地址
 	TxHash         string          `gorm:"type:varchar(100)" json:"tx_hash"`              // 交易哈希
+	Confirmations         int      `gorm:"default:0" json:"confirmations"`          // 当前确认数(确认中订单实时更新)
+	RequiredConfirmations int      `gorm:"default:0" json:"required_confirmations"` // 要求确认数
 	QRCode         string          `gorm:"type:varchar(500)" json:"qrcode"`               // 收款二维码(微信/支付宝)
 	WalletID       uint            `gorm:"default:0" json:"wallet_id"`                    // 使用的钱包ID
+	HDWalletID     uint            `gorm:"default:0;index" json:"hd_wallet_id"`           // HD 钱包ID(>0 表示收款地址为订单独立派生地址)
+	DerivationIndex uint32         `gorm:"default:0" json:"derivation_index"`             // HD 派生序号
+	PayReference   string          `gorm:"type:varchar(64);index" json:"pay_reference"`   // 付款引用(Solana Pay reference)，付款交易带引用时按引用匹配订单
 	Fee            decimal.Decimal `gorm:"type:decimal(18,6);default:0" json:"fee"`       // 手续费
 	FeeRate        decimal.Decimal `gorm:"type:decimal(5,4);default:0" json:"fee_rate"`   // 手续费率
 	FeeType        FeeType         `gorm:"default:2" json:"fee_type"`                     // 1=余额扣除 2=收款扣除
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// OutboxStatus 事务外发消息状态
+type OutboxStatus int8
+
+const (
+	OutboxPending OutboxStatus = 0 // 待处理
+	OutboxDone    OutboxStatus = 1 // 已处理
+	OutboxFailed  OutboxStatus = 2 // 处理失败(达到最大尝试次数)
+)
+
+// OutboxEvent 事务外发消息
+// 与业务数据在同一事务中写入，提交后由后台协程执行副作用(Telegram 通知等)，
+// 保证副作用只在事务提交后发生，且进程崩溃后不会丢失
+type OutboxEvent struct {
+	ID            uint         `gorm:"primaryKey" json:"id"`
+	Topic         string       `gorm:"type:varchar(50);not null" json:"topic"`
+	Payload       string       `gorm:"type:text" json:"payload"` // JSON
+	Status        OutboxStatus `gorm:"default:0;index:idx_outbox_status_next" json:"status"`
+	Attempts      int          `gorm:"default:0" json:"attempts"`
+	NextAttemptAt time.Time    `gorm:"index:idx_outbox_status_next" json:"next_attempt_at"`
+	LastError     string       `gorm:"type:varchar(500)" json:"last_error"`
+	ProcessedAt   *time.Time   `json:"processed_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox_events"
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PayoutBatchStatus 批量打款状态
+type PayoutBatchStatus int8
+
+const (
+	PayoutBatchSending PayoutBatchStatus = 0 // 打款中
+	PayoutBatchDone    PayoutBatchStatus = 1 // 全部完成
+	PayoutBatchPartial PayoutBatchStatus = 2 // 部分失败(失败的提现已退回待打款)
+	PayoutBatchFailed  PayoutBatchStatus = 3 // 全部失败
+)
+
+// 批量打款方式
+const (
+	PayoutModeDisperse = "disperse" // 一笔 disperse 合约调用(EVM)
+	PayoutModeSequence = "sequence" // 每笔提现一笔交易，EVM 使用连续 nonce
+)
+
+// PayoutBatch 热钱包批量打款
+// 同一条链、同一币种的待打款提现合并为一批发送，每笔提现的交易和结果记录在 PayoutBatchItem
+type PayoutBatch struct {
+	ID          uint              `gorm:"primaryKey" json:"id"`
+	Chain       string            `gorm:"type:varchar(20);not null;index" json:"chain"`
+	Token       string            `gorm:"type:varchar(20)" json:"token"`          // 打款币种: USDT, USDC
+	Mode        string            `gorm:"type:varchar(10)" json:"mode"`           // disperse / sequence
+	Count       int               `gorm:"default:0" json:"count"`                 // 提现笔数
+	TotalAmount decimal.Decimal   `gorm:"type:decimal(20,6)" json:"total_amount"` // 打款总额(币)
+	Paid        int               `gorm:"default:0" json:"paid"`                  // 已完成笔数
+	Failed      int               `gorm:"default:0" json:"failed"`                // 失败(已退回)笔数
+	Status      PayoutBatchStatus `gorm:"default:0;index" json:"status"`
+	FinishedAt  *time.Time        `json:"finished_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func (PayoutBatch) TableName() string {
+	return "payout_batches"
+}
+
+// PayoutItemStatus 批量打款明细状态
+type PayoutItemStatus int8
+
+const (
+	PayoutItemSending PayoutItemStatus = 0 // 打款中
+	PayoutItemPaid    PayoutItemStatus = 1 // 已完成
+	PayoutItemFailed  PayoutItemStatus = 2 // 失败，提现已退回待打款(或多次失败后标记打款失败)
+)
+
+// PayoutBatchItem 批量打款明细，提现失败退回后重新打款时属于新的批次
+type PayoutBatchItem struct {
+	ID           uint             `gorm:"primaryKey" json:"id"`
+	BatchID      uint             `gorm:"not null;index" json:"batch_id"`
+	WithdrawalID uint             `gorm:"not null;index" json:"withdrawal_id"`
+	Amount       decimal.Decimal  `gorm:"type:decimal(20,6)" json:"amount"`       // 打款金额(币)
+	Account      string           `gorm:"type:varchar(200)" json:"account"`       // 收款地址
+	TxHash       string           `gorm:"type:varchar(100);index" json:"tx_hash"` // disperse 模式同一批次共用交易
+	Status       PayoutItemStatus `gorm:"default:0" json:"status"`
+	Error        string           `gorm:"type:varchar(500)" json:"error"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+func (PayoutBatchItem) TableName() string {
+	return "payout_batch_items"
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PendingTransferStatus 未确认转账跟踪状态
+type PendingTransferStatus int8
+
+const (
+	PendingTransferTracking  PendingTransferStatus = 0 // 跟踪中
+	PendingTransferConfirmed PendingTransferStatus = 1 // 已确认并结算
+	PendingTransferDropped   PendingTransferStatus = 2 // 交易消失或失败，订单已回退
+)
+
+// PendingTransfer 未确认转账
+// 扫描到尚未达到确认数的转账时，先按收款策略匹配订单并将订单置为确认中，
+// 记录匹配结果；确认数达到后按记录的匹配结果结算，交易消失时将订单回退到 PrevStatus
+type PendingTransfer struct {
+	ID                    uint                  `gorm:"primaryKey" json:"id"`
+	Chain                 string                `gorm:"type:varchar(20);not null;index:idx_pending_chain_status" json:"chain"`
+	TxHash                string                `gorm:"type:varchar(100);uniqueIndex;not null" json:"tx_hash"`
+	FromAddress           string                `gorm:"type:varchar(100)" json:"from_address"`
+	ToAddress             string                `gorm:"type:varchar(100)" json:"to_address"`
+	Amount                decimal.Decimal       `gorm:"type:decimal(36,18)" json:"amount"`
+	Token                 string                `gorm:"type:varchar(20)" json:"token"` // 代币符号
+	BlockNumber           uint64                `json:"block_number"`
+	OrderID               uint                  `gorm:"index;not null" json:"order_id"`
+	PrevStatus            OrderStatus           `json:"prev_status"`                             // 检测前订单状态
+	NewStatus             OrderStatus           `json:"new_status"`                              // 确认后订单状态
+	Total                 decimal.Decimal       `gorm:"type:decimal(18,6)" json:"total"`         // 确认后订单累计收款
+	MatchNote             string                `gorm:"type:varchar(50)" json:"match_note"`      // 匹配结果说明
+	Confirmations         int                   `gorm:"default:0" json:"confirmations"`          // 当前确认数
+	RequiredConfirmations int                   `gorm:"default:0" json:"required_confirmations"` // 要求确认数
+	Status                PendingTransferStatus `gorm:"default:0;index:idx_pending_chain_status" json:"status"`
+	MissingSince          *time.Time            `json:"missing_since"` // 链上查不到该交易的起始时间
+	CreatedAt             time.Time             `json:"created_at"`
+	UpdatedAt             time.Time             `json:"updated_at"`
+}
+
+func (PendingTransfer) TableName() string {
+	return "pending_transfers"
+}
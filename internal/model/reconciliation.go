@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReconcileStatus 对账差异处理状态
+type ReconcileStatus int8
+
+const (
+	ReconcileStatusOpen     ReconcileStatus = 0 // 待处理
+	ReconcileStatusResolved ReconcileStatus = 1 // 已处理
+)
+
+// BalanceReconciliation 商户余额对账差异记录
+// 仅记录核对不一致的商户，每次对账任务对每个差异商户写入一条
+type BalanceReconciliation struct {
+	ID                    uint            `gorm:"primaryKey" json:"id"`
+	RunID                 string          `gorm:"type:varchar(32);index" json:"run_id"` // 对账批次号
+	MerchantID            uint            `gorm:"index;not null" json:"merchant_id"`
+	Merchant              Merchant        `gorm:"foreignKey:MerchantID" json:"-"`
+	ExpectedBalance       decimal.Decimal `gorm:"type:decimal(18,2)" json:"expected_balance"`        // 按订单/提现/调账推算的余额
+	ActualBalance         decimal.Decimal `gorm:"type:decimal(18,2)" json:"actual_balance"`          // merchants.balance
+	BalanceDiff           decimal.Decimal `gorm:"type:decimal(18,2)" json:"balance_diff"`            // 实际 - 推算
+	ExpectedFrozen        decimal.Decimal `gorm:"type:decimal(18,2)" json:"expected_frozen"`         // 按待处理提现/预冻结手续费推算的冻结余额
+	ActualFrozen          decimal.Decimal `gorm:"type:decimal(18,2)" json:"actual_frozen"`           // merchants.frozen_balance
+	FrozenDiff            decimal.Decimal `gorm:"type:decimal(18,2)" json:"frozen_diff"`             // 实际 - 推算
+	LedgerBalance         decimal.Decimal `gorm:"type:decimal(18,2)" json:"ledger_balance"`          // 最后一条账本流水的余额
+	LedgerFrozen          decimal.Decimal `gorm:"type:decimal(18,2)" json:"ledger_frozen"`           // 最后一条账本流水的冻结余额
+	PaidOrderAmount       decimal.Decimal `gorm:"type:decimal(18,2)" json:"paid_order_amount"`       // 已支付订单入账合计(结算金额-手续费)
+	AdjustAmount          decimal.Decimal `gorm:"type:decimal(18,2)" json:"adjust_amount"`           // 管理员调账净额
+	WithdrawnAmount       decimal.Decimal `gorm:"type:decimal(18,2)" json:"withdrawn_amount"`        // 已打款提现合计
+	RefundAmount          decimal.Decimal `gorm:"type:decimal(18,2)" json:"refund_amount"`           // 订单退款合计
+	PendingWithdrawAmount decimal.Decimal `gorm:"type:decimal(18,2)" json:"pending_withdraw_amount"` // 待审核/已审核提现合计
+	PendingFeeAmount      decimal.Decimal `gorm:"type:decimal(18,2)" json:"pending_fee_amount"`      // 待支付订单预冻结手续费合计
+	Status                ReconcileStatus `gorm:"default:0;index" json:"status"`
+	ResolvedBy            string          `gorm:"type:varchar(50)" json:"resolved_by"` // 处理人
+	ResolvedAt            *time.Time      `json:"resolved_at"`
+	Remark                string          `gorm:"type:varchar(500)" json:"remark"`
+	CreatedAt             time.Time       `gorm:"index" json:"created_at"`
+}
+
+func (BalanceReconciliation) TableName() string {
+	return "balance_reconciliations"
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// RefundPayoutStatus 退款链上打款状态
+type RefundPayoutStatus int8
+
+const (
+	RefundPayoutNone    RefundPayoutStatus = 0 // 无需打款(商户线下处理)
+	RefundPayoutPending RefundPayoutStatus = 1 // 待打款
+	RefundPayoutPaid    RefundPayoutStatus = 2 // 已打款
+)
+
+// Refund 订单退款记录
+// 退款金额以结算货币(USD)计，创建时即从商户余额扣除
+type Refund struct {
+	ID             uint               `gorm:"primaryKey" json:"id"`
+	RefundNo       string             `gorm:"type:varchar(64);uniqueIndex;not null" json:"refund_no"`                    // 平台退款单号
+	OutRefundNo    string             `gorm:"type:varchar(64);uniqueIndex:idx_merchant_out_refund" json:"out_refund_no"` // 商户退款单号(幂等)，未提供时同平台退款单号
+	MerchantID     uint               `gorm:"not null;uniqueIndex:idx_merchant_out_refund" json:"merchant_id"`
+	OrderID        uint               `gorm:"index;not null" json:"order_id"`
+	TradeNo        string             `gorm:"type:varchar(64);index" json:"trade_no"`
+	OutTradeNo     string             `gorm:"type:varchar(64)" json:"out_trade_no"`
+	Amount         decimal.Decimal    `gorm:"type:decimal(18,2);not null" json:"amount"` // 退款金额（USD）
+	Reason         string             `gorm:"type:varchar(255)" json:"reason"`
+	PayoutStatus   RefundPayoutStatus `gorm:"default:0;index" json:"payout_status"`
+	PayoutChain    string             `gorm:"type:varchar(20)" json:"payout_chain"`
+	PayoutAddress  string             `gorm:"type:varchar(100)" json:"payout_address"` // 原付款地址
+	PayoutAmount   decimal.Decimal    `gorm:"type:decimal(18,6)" json:"payout_amount"` // 按原支付比例折算的币数量
+	PayoutCurrency string             `gorm:"type:varchar(10)" json:"payout_currency"` // USDT, TRX 等
+	PayoutTxHash   string             `gorm:"type:varchar(100)" json:"payout_tx_hash"` // 打款交易哈希
+	PaidOutAt      *time.Time         `json:"paid_out_at"`
+	Actor          string             `gorm:"type:varchar(64)" json:"actor"` // 发起人: merchant:xxx / admin:xxx
+	NotifyCount    int                `gorm:"default:0" json:"notify_count"`
+	NotifyStatus   NotifyStatus       `gorm:"default:0" json:"notify_status"`
+	CreatedAt      time.Time          `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+func (Refund) TableName() string {
+	return "refunds"
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// RescanJobStatus 补扫任务状态
+type RescanJobStatus int8
+
+const (
+	RescanJobRunning   RescanJobStatus = 0 // 执行中
+	RescanJobDone      RescanJobStatus = 1 // 已完成
+	RescanJobFailed    RescanJobStatus = 2 // 失败或服务重启中断
+	RescanJobCancelled RescanJobStatus = 3 // 已取消
+)
+
+// RescanJob 区块补扫任务
+// 节点故障导致漏扫时，按区块号(TronGrid/toncenter 按时间)范围重新查询链上转账，
+// Position 为已扫描到的位置，任务失败后可从 Position+1 重新发起
+type RescanJob struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	Chain      string          `gorm:"type:varchar(20);not null;index" json:"chain"`
+	Unit       string          `gorm:"type:varchar(10)" json:"unit"` // block: 区块号(Solana 为 slot)，time: Unix 秒
+	FromPos    uint64          `json:"from_pos"`
+	ToPos      uint64          `json:"to_pos"`
+	Position   uint64          `json:"position"`                      // 已扫描到的位置，0 表示尚未完成任何一段
+	Found      int             `gorm:"default:0" json:"found"`        // 新发现的转账数
+	Matched    int             `gorm:"default:0" json:"matched"`      // 其中匹配到订单的转账数
+	Status     RescanJobStatus `gorm:"default:0;index" json:"status"` // 状态
+	Error      string          `gorm:"type:varchar(500)" json:"error"`
+	Operator   string          `gorm:"type:varchar(50)" json:"operator"` // 发起人(管理员用户名，命令行为 cli)
+	FinishedAt *time.Time      `json:"finished_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+func (RescanJob) TableName() string {
+	return "rescan_jobs"
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"ezpay/internal/util"
+)
+
+// Token 链上代币登记表
+// 同一条链可登记多个 USD 稳定币(USDT/USDC/DAI/FDUSD 等)，按 1:1 USD 计价
+// 扫描器按登记的合约监听转账，金额精度以登记的 Decimals 为准
+type Token struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Chain     string    `gorm:"type:varchar(20);not null;uniqueIndex:uk_token_chain_symbol" json:"chain"`  // trc20, erc20, bep20 ...
+	Symbol    string    `gorm:"type:varchar(20);not null;uniqueIndex:uk_token_chain_symbol" json:"symbol"` // 大写代币符号: USDT, USDC
+	Contract  string    `gorm:"type:varchar(100);not null" json:"contract"`                                // 合约地址(Solana 为 Mint 地址)
+	Decimals  int       `gorm:"not null" json:"decimals"`                                                  // 链上精度
+	Enabled   bool      `gorm:"default:false" json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Token) TableName() string {
+	return "tokens"
+}
+
+// DefaultToken 链的默认收款币种，未记录币种的旧订单/交易按此处理
+func DefaultToken(chain string) string {
+	if util.IsFiatChain(chain) {
+		return "CNY"
+	}
+	if info, ok := util.GetChain(chain); ok && info.Type == util.ChainTypeTron {
+		return info.NativeSymbol
+	}
+	return "USDT"
+}
+
+// NativeToken 链的原生币符号，原生币按实时价格计价(TRX/ETH/BNB 等)
+// 原生币不需要登记合约，链上精度: TRX 6位，EVM 链 18位
+func NativeToken(chain string) string {
+	info, _ := util.GetChain(chain)
+	return info.NativeSymbol
+}
+
+// IsNativeToken 是否为链的原生币
+func IsNativeToken(chain, symbol string) bool {
+	native := NativeToken(chain)
+	return native != "" && strings.EqualFold(native, symbol)
+}
+
+// defaultTokens 预置的常用稳定币(主网合约，默认禁用，由管理员按需启用)
+// USDT 合约来自配置文件 blockchain.<chain>.contract_address，启动时登记
+var defaultTokens = []Token{
+	{Chain: "erc20", Symbol: "USDC", Contract: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Decimals: 6},
+	{Chain: "erc20", Symbol: "DAI", Contract: "0x6B175474E89094C44Da98b954EedeAC495271d0F", Decimals: 18},
+	{Chain: "bep20", Symbol: "USDC", Contract: "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d", Decimals: 18},
+	{Chain: "bep20", Symbol: "FDUSD", Contract: "0xc5f0f7b66764F6ec8C8Dff7BA683102295E16409", Decimals: 18},
+	{Chain: "polygon", Symbol: "USDC", Contract: "0x3c499c542cEF5E3811e1192ce70d8cC03d5c3359", Decimals: 6},
+	{Chain: "optimism", Symbol: "USDC", Contract: "0x0b2C639c533813f4Aa9D7837CAf62653d097Ff85", Decimals: 6},
+	{Chain: "arbitrum", Symbol: "USDC", Contract: "0xaf88d065e77c8cC2239327C5EDb3A432268e5831", Decimals: 6},
+	{Chain: "avalanche", Symbol: "USDC", Contract: "0xB97EF9Ef8734C71904D8002F8b6Bc66Dd9c48a6E", Decimals: 6},
+	{Chain: "base", Symbol: "USDC", Contract: "0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913", Decimals: 6},
+	{Chain: "solana", Symbol: "USDC", Contract: "EPjFWdd5AufqSSqeM2qN1xyybapC8G4wEGGkZwyTDt1v", Decimals: 6},
+}
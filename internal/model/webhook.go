@@ -0,0 +1,94 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// WebhookEventType 商户 Webhook 事件类型
+type WebhookEventType string
+
+const (
+	WebhookEventOrderCreated     WebhookEventType = "order.created"      // 订单创建
+	WebhookEventOrderDetected    WebhookEventType = "order.detected"     // 检测到链上付款(未完成支付，如部分支付)
+	WebhookEventOrderPaid        WebhookEventType = "order.paid"         // 订单支付成功(含过期后到账)
+	WebhookEventOrderExpired     WebhookEventType = "order.expired"      // 订单过期
+	WebhookEventOrderCancelled   WebhookEventType = "order.cancelled"    // 订单取消
+	WebhookEventOrderRefunded    WebhookEventType = "order.refunded"     // 订单退款
+	WebhookEventWithdrawalStatus WebhookEventType = "withdrawal.updated" // 提现状态变更(申请/通过/拒绝/打款)
+	WebhookEventBalanceChanged   WebhookEventType = "balance.changed"    // 余额变动
+)
+
+// WebhookEventTypes 全部事件类型
+var WebhookEventTypes = []WebhookEventType{
+	WebhookEventOrderCreated,
+	WebhookEventOrderDetected,
+	WebhookEventOrderPaid,
+	WebhookEventOrderExpired,
+	WebhookEventOrderCancelled,
+	WebhookEventOrderRefunded,
+	WebhookEventWithdrawalStatus,
+	WebhookEventBalanceChanged,
+}
+
+// WebhookSettings 商户 Webhook 订阅设置
+// 与 NotifySettings(Telegram) 对应，按事件类型订阅 HTTP 推送
+// Webhook 独立于易支付 notify_url 回调，始终以 POST JSON + HMAC-SHA256 签名头推送
+type WebhookSettings struct {
+	Enabled          bool   `json:"enabled"`            // 是否启用
+	URL              string `json:"url"`                // 推送地址，为空时使用商户默认 notify_url
+	OrderCreated     bool   `json:"order_created"`      // 订单创建
+	OrderDetected    bool   `json:"order_detected"`     // 检测到付款
+	OrderPaid        bool   `json:"order_paid"`         // 支付成功
+	OrderExpired     bool   `json:"order_expired"`      // 订单过期
+	OrderCancelled   bool   `json:"order_cancelled"`    // 订单取消
+	OrderRefunded    bool   `json:"order_refunded"`     // 订单退款
+	WithdrawalStatus bool   `json:"withdrawal_updated"` // 提现状态变更
+	BalanceChanged   bool   `json:"balance_changed"`    // 余额变动
+}
+
+// DefaultWebhookSettings 默认 Webhook 设置（未启用）
+func DefaultWebhookSettings() WebhookSettings {
+	return WebhookSettings{}
+}
+
+// Subscribed 是否订阅了指定事件
+func (w WebhookSettings) Subscribed(event WebhookEventType) bool {
+	if !w.Enabled {
+		return false
+	}
+	switch event {
+	case WebhookEventOrderCreated:
+		return w.OrderCreated
+	case WebhookEventOrderDetected:
+		return w.OrderDetected
+	case WebhookEventOrderPaid:
+		return w.OrderPaid
+	case WebhookEventOrderExpired:
+		return w.OrderExpired
+	case WebhookEventOrderCancelled:
+		return w.OrderCancelled
+	case WebhookEventOrderRefunded:
+		return w.OrderRefunded
+	case WebhookEventWithdrawalStatus:
+		return w.WithdrawalStatus
+	case WebhookEventBalanceChanged:
+		return w.BalanceChanged
+	}
+	return false
+}
+
+// Scan 实现 sql.Scanner 接口
+func (w *WebhookSettings) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok || len(bytes) == 0 {
+		*w = DefaultWebhookSettings()
+		return nil
+	}
+	return json.Unmarshal(bytes, w)
+}
+
+// Value 实现 driver.Valuer 接口
+func (w WebhookSettings) Value() (driver.Value, error) {
+	return json.Marshal(w)
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// WithdrawPolicy 提现规则(金额均为 USD)
+// MerchantID 为 0 时为系统默认规则，Chain 为空时适用于所有打款链。
+// 生效规则取最具体的一条: 商户+链 > 商户 > 系统+链 > 系统，整条生效，不逐字段合并
+type WithdrawPolicy struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	MerchantID  uint      `gorm:"uniqueIndex:idx_withdraw_policy_scope;default:0" json:"merchant_id"`             // 0 = 系统默认
+	Chain       string    `gorm:"type:varchar(20);uniqueIndex:idx_withdraw_policy_scope;default:''" json:"chain"` // 空 = 所有链
+	MinAmount   float64   `gorm:"type:decimal(18,2);default:0" json:"min_amount"`                                 // 单笔最低提现金额
+	MaxAmount   float64   `gorm:"type:decimal(18,2);default:0" json:"max_amount"`                                 // 单笔最高提现金额，0 不限
+	FeeFixed    float64   `gorm:"type:decimal(18,2);default:0" json:"fee_fixed"`                                  // 每笔固定手续费
+	FeePercent  float64   `gorm:"type:decimal(6,3);default:0" json:"fee_percent"`                                 // 按提现金额收取的手续费(%)
+	DailyLimit  float64   `gorm:"type:decimal(18,2);default:0" json:"daily_limit"`                                // 每日累计提现上限，0 不限
+	WeeklyLimit float64   `gorm:"type:decimal(18,2);default:0" json:"weekly_limit"`                               // 每周(周一起)累计提现上限，0 不限
+	DailyCount  int       `gorm:"default:0" json:"daily_count"`                                                   // 每日提现笔数上限，0 不限
+	Remark      string    `gorm:"type:varchar(200)" json:"remark"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (WithdrawPolicy) TableName() string {
+	return "withdraw_policies"
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"ezpay/config"
+	"ezpay/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Approver 执行审批的管理员
+type Approver struct {
+	ID       uint
+	Username string
+}
+
+// ApprovalProgress 审批进度
+type ApprovalProgress struct {
+	Approvals int64 `json:"approvals"` // 已审批人数
+	Required  int   `json:"required"`  // 需要的审批人数
+}
+
+// Done 审批人数已达到要求
+func (p *ApprovalProgress) Done() bool {
+	return p.Approvals >= int64(p.Required)
+}
+
+// defaultApprovals 未配置审批人数时的默认值
+const defaultApprovals = 2
+
+// WithdrawalApprovalsRequired 提现需要的审批人数: 金额达到阈值时按配置人数，否则一人审批即可
+// 审批要求只读取配置文件，管理后台无法修改
+func (s *WithdrawService) WithdrawalApprovalsRequired(amount float64) int {
+	return withdrawalApprovals(approvalConfig(), amount)
+}
+
+// withdrawalApprovals 按审批配置计算提现需要的审批人数
+func withdrawalApprovals(cfg config.ApprovalConfig, amount float64) int {
+	if cfg.WithdrawThreshold <= 0 || amount < cfg.WithdrawThreshold {
+		return 1
+	}
+	return approvalsOrDefault(cfg.WithdrawApprovals)
+}
+
+// AddressApprovalsRequired 新提现地址需要的审批人数
+func (s *WithdrawService) AddressApprovalsRequired() int {
+	return approvalsOrDefault(approvalConfig().AddressApprovals)
+}
+
+// ApprovalSettings 当前审批要求，管理后台只读展示
+func (s *WithdrawService) ApprovalSettings() config.ApprovalConfig {
+	cfg := approvalConfig()
+	cfg.WithdrawApprovals = approvalsOrDefault(cfg.WithdrawApprovals)
+	cfg.AddressApprovals = approvalsOrDefault(cfg.AddressApprovals)
+	return cfg
+}
+
+// approvalConfig 配置文件中的审批要求，未加载配置时按默认人数
+func approvalConfig() config.ApprovalConfig {
+	if cfg := config.Get(); cfg != nil {
+		return cfg.Approval
+	}
+	return config.ApprovalConfig{WithdrawApprovals: defaultApprovals, AddressApprovals: defaultApprovals}
+}
+
+// approvalsOrDefault 未配置(0)时使用默认审批人数
+func approvalsOrDefault(n int) int {
+	if n < 1 {
+		return defaultApprovals
+	}
+	return n
+}
+
+// ApproveWithdrawAddress 审核通过提现地址
+// 审批人数未达到要求时只记录审批，地址保持待审核
+func (s *WithdrawService) ApproveWithdrawAddress(id uint, approver Approver, adminRemark string) (*ApprovalProgress, error) {
+	var progress *ApprovalProgress
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 锁定地址记录，串行处理同一地址的并发审批
+		var address model.WithdrawAddress
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&address, id).Error; err != nil {
+			return errors.New("地址不存在")
+		}
+		if address.Status != model.WithdrawAddressPending {
+			return errors.New("该地址已审核过")
+		}
+
+		var err error
+		progress, err = s.approve(tx, model.ApprovalRefWithdrawAddress, address.ID, address.CreatedBy, approver, adminRemark, s.AddressApprovalsRequired())
+		if err != nil || !progress.Done() {
+			return err
+		}
+
+		if err := tx.Model(&address).Updates(map[string]interface{}{
+			"status":       model.WithdrawAddressApproved,
+			"admin_remark": adminRemark,
+		}).Error; err != nil {
+			return err
+		}
+
+		// 如果是该商户第一个审核通过的地址，设为默认
+		var approvedCount int64
+		tx.Model(&model.WithdrawAddress{}).
+			Where("merchant_id = ? AND status = ? AND id != ?", address.MerchantID, model.WithdrawAddressApproved, address.ID).
+			Count(&approvedCount)
+		if approvedCount == 0 {
+			return tx.Model(&address).Update("is_default", true).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// approve 在锁定审批对象的事务中记录一名管理员的审批，返回审批进度
+// 同一管理员只能审批一次，代商户创建的管理员不能审批自己创建的对象
+func (s *WithdrawService) approve(tx *gorm.DB, refType string, refID, createdBy uint, approver Approver, remark string, required int) (*ApprovalProgress, error) {
+	if approver.ID == 0 {
+		return nil, errors.New("无法识别审批管理员")
+	}
+	if createdBy != 0 && createdBy == approver.ID {
+		return nil, errors.New("不能审批自己代商户提交的申请，请由其他管理员审批")
+	}
+
+	var count int64
+	tx.Model(&model.Approval{}).
+		Where("ref_type = ? AND ref_id = ? AND admin_id = ?", refType, refID, approver.ID).
+		Count(&count)
+	if count > 0 {
+		return nil, errors.New("您已审批过，需要其他管理员继续审批")
+	}
+
+	// 可审批的管理员不足时无法达到要求的人数，提前提示而不是记录一条永远无法完成的审批
+	if required > 1 {
+		var admins int64
+		query := tx.Model(&model.Admin{}).Where("status = 1")
+		if createdBy != 0 {
+			query = query.Where("id <> ?", createdBy)
+		}
+		query.Count(&admins)
+		if admins < int64(required) {
+			return nil, fmt.Errorf("需要 %d 名管理员审批，可审批的管理员只有 %d 名，请先添加管理员或调整审批设置", required, admins)
+		}
+	}
+
+	if err := tx.Create(&model.Approval{
+		RefType:  refType,
+		RefID:    refID,
+		AdminID:  approver.ID,
+		Username: approver.Username,
+		Remark:   remark,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	progress := &ApprovalProgress{Required: required}
+	if err := tx.Model(&model.Approval{}).
+		Where("ref_type = ? AND ref_id = ?", refType, refID).
+		Count(&progress.Approvals).Error; err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// ListApprovals 批量查询审批记录，按对象ID分组
+func (s *WithdrawService) ListApprovals(refType string, refIDs []uint) (map[uint][]model.Approval, error) {
+	result := make(map[uint][]model.Approval)
+	if len(refIDs) == 0 {
+		return result, nil
+	}
+	var approvals []model.Approval
+	if err := model.GetDB().Where("ref_type = ? AND ref_id IN ?", refType, refIDs).
+		Order("id ASC").Find(&approvals).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range approvals {
+		result[a.RefID] = append(result[a.RefID], a)
+	}
+	return result, nil
+}
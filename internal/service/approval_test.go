@@ -0,0 +1,146 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/config"
+	"ezpay/internal/model"
+)
+
+func TestWithdrawalApprovals(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config.ApprovalConfig
+		amount float64
+		want   int
+	}{
+		{name: "threshold disabled", cfg: config.ApprovalConfig{WithdrawApprovals: 3}, amount: 1e6, want: 1},
+		{name: "below threshold", cfg: config.ApprovalConfig{WithdrawThreshold: 1000, WithdrawApprovals: 3}, amount: 999.99, want: 1},
+		{name: "at threshold", cfg: config.ApprovalConfig{WithdrawThreshold: 1000, WithdrawApprovals: 3}, amount: 1000, want: 3},
+		{name: "approvals unset", cfg: config.ApprovalConfig{WithdrawThreshold: 1000}, amount: 5000, want: defaultApprovals},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withdrawalApprovals(tt.cfg, tt.amount); got != tt.want {
+				t.Errorf("withdrawalApprovals(%.2f) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+// seedAdmins 创建 n 名启用的管理员
+func seedAdmins(t *testing.T, n int) []model.Admin {
+	t.Helper()
+	admins := make([]model.Admin, n)
+	for i := range admins {
+		admins[i] = model.Admin{Username: "admin" + string(rune('a'+i)), Password: "x", Status: 1}
+		if err := model.GetDB().Create(&admins[i]).Error; err != nil {
+			t.Fatalf("create admin: %v", err)
+		}
+	}
+	return admins
+}
+
+func approverOf(admin model.Admin) Approver {
+	return Approver{ID: admin.ID, Username: admin.Username}
+}
+
+func TestApproveWithdrawAddress(t *testing.T) {
+	db := setupTestDB(t)
+	admins := seedAdmins(t, 3)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+	// 由第一名管理员代商户添加
+	address := model.WithdrawAddress{MerchantID: merchant.ID, Chain: "trc20", Address: "TAddress", CreatedBy: admins[0].ID}
+	db.Create(&address)
+
+	s := GetWithdrawService()
+	if _, err := s.ApproveWithdrawAddress(address.ID, approverOf(admins[0]), ""); err == nil || !strings.Contains(err.Error(), "不能审批自己") {
+		t.Fatalf("creator approval error = %v, want self-approval rejected", err)
+	}
+
+	progress, err := s.ApproveWithdrawAddress(address.ID, approverOf(admins[1]), "")
+	if err != nil {
+		t.Fatalf("first approval: %v", err)
+	}
+	if progress.Approvals != 1 || progress.Required != defaultApprovals || progress.Done() {
+		t.Fatalf("progress = %+v, want 1 of %d", progress, defaultApprovals)
+	}
+	if _, err := s.ApproveWithdrawAddress(address.ID, approverOf(admins[1]), ""); err == nil || !strings.Contains(err.Error(), "已审批过") {
+		t.Fatalf("duplicate approval error = %v, want rejected", err)
+	}
+	db.First(&address, address.ID)
+	if address.Status != model.WithdrawAddressPending {
+		t.Fatalf("address status = %d after one approval, want pending", address.Status)
+	}
+
+	progress, err = s.ApproveWithdrawAddress(address.ID, approverOf(admins[2]), "ok")
+	if err != nil {
+		t.Fatalf("second approval: %v", err)
+	}
+	if !progress.Done() || progress.Approvals != 2 {
+		t.Fatalf("progress = %+v, want done with 2 approvals", progress)
+	}
+	db.First(&address, address.ID)
+	if address.Status != model.WithdrawAddressApproved || !address.IsDefault {
+		t.Errorf("address status=%d default=%v, want approved default address", address.Status, address.IsDefault)
+	}
+}
+
+func TestApproveWithdrawAddressInsufficientAdmins(t *testing.T) {
+	db := setupTestDB(t)
+	// 除创建者外只有一名管理员，无法凑齐两人审批
+	admins := seedAdmins(t, 2)
+	disabled := model.Admin{Username: "disabled", Password: "x", Status: 1}
+	db.Create(&disabled)
+	db.Model(&disabled).Update("status", 0)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+	address := model.WithdrawAddress{MerchantID: merchant.ID, Chain: "trc20", Address: "TAddress", CreatedBy: admins[0].ID}
+	db.Create(&address)
+
+	_, err := GetWithdrawService().ApproveWithdrawAddress(address.ID, approverOf(admins[1]), "")
+	if err == nil || !strings.Contains(err.Error(), "可审批的管理员只有 1 名") {
+		t.Fatalf("approval error = %v, want insufficient admins", err)
+	}
+	var count int64
+	db.Model(&model.Approval{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d approval(s) recorded, want none", count)
+	}
+}
+
+func TestApproveWithdrawal(t *testing.T) {
+	db := setupTestDB(t)
+	admins := seedAdmins(t, 2)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: 100, FrozenBalance: 10}
+	db.Create(&merchant)
+	now := time.Now()
+	withdrawal := model.Withdrawal{MerchantID: merchant.ID, Amount: 10, RealAmount: 10, PayoutAmount: 10, PayoutCurrency: "USDT",
+		PayMethod: "trc20", Account: "TAddress", Status: model.WithdrawStatusPending, QuotedAt: &now, CreatedBy: admins[0].ID}
+	db.Create(&withdrawal)
+
+	s := GetWithdrawService()
+	if _, err := s.ApproveWithdrawal(withdrawal.ID, approverOf(admins[0]), ""); err == nil || !strings.Contains(err.Error(), "不能审批自己") {
+		t.Fatalf("creator approval error = %v, want self-approval rejected", err)
+	}
+
+	// 未加载配置时不启用大额阈值，一名管理员审批即可
+	progress, err := s.ApproveWithdrawal(withdrawal.ID, approverOf(admins[1]), "ok")
+	if err != nil {
+		t.Fatalf("approval: %v", err)
+	}
+	if !progress.Done() || progress.Required != 1 {
+		t.Fatalf("progress = %+v, want done with 1 required", progress)
+	}
+	got := loadWithdrawal(t, db, withdrawal.ID)
+	if got.Status != model.WithdrawStatusApproved || got.AdminRemark != "ok" {
+		t.Errorf("withdrawal status=%d remark=%q, want approved", got.Status, got.AdminRemark)
+	}
+
+	if _, err := s.ApproveWithdrawal(withdrawal.ID, approverOf(admins[1]), ""); err == nil {
+		t.Error("approved withdrawal approved again")
+	}
+}
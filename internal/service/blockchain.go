@@ -15,6 +15,7 @@ import (
 
 	"ezpay/config"
 	"ezpay/internal/model"
+	"ezpay/internal/util"
 
 	"github.com/shopspring/decimal"
 )
@@ -48,6 +49,7 @@ type BlockchainService struct {
 type WalletCache struct {
 	mu          sync.RWMutex
 	cache       map[string]map[string]bool // chain -> addresses
+	original    map[string][]string        // chain -> 原始大小写地址(Solana 等 Base58 地址区分大小写)
 	lastUpdate  time.Time
 	ttl         time.Duration
 }
@@ -83,6 +85,19 @@ func (c *WalletCache) GetAddresses(chain string) map[string]bool {
 	return result
 }
 
+// GetOriginalAddresses 获取指定链保持原始大小写的钱包地址（带缓存）
+func (c *WalletCache) GetOriginalAddresses(chain string) []string {
+	c.mu.RLock()
+	if time.Since(c.lastUpdate) > c.ttl {
+		c.mu.RUnlock()
+		c.refresh()
+		c.mu.RLock()
+	}
+	result := append([]string(nil), c.original[chain]...)
+	c.mu.RUnlock()
+	return result
+}
+
 // refresh 刷新缓存
 func (c *WalletCache) refresh() {
 	c.mu.Lock()
@@ -98,13 +113,29 @@ func (c *WalletCache) refresh() {
 	model.GetDB().Where("status = 1").Find(&wallets)
 
 	newCache := make(map[string]map[string]bool)
+	newOriginal := make(map[string][]string)
+	add := func(chain, address string) {
+		if newCache[chain] == nil {
+			newCache[chain] = make(map[string]bool)
+		}
+		key := strings.ToLower(address)
+		if !newCache[chain][key] {
+			newOriginal[chain] = append(newOriginal[chain], address)
+		}
+		newCache[chain][key] = true
+	}
 	for _, w := range wallets {
-		if newCache[w.Chain] == nil {
-			newCache[w.Chain] = make(map[string]bool)
+		add(w.Chain, w.Address)
+	}
+
+	// HD 钱包为订单派生的独立收款地址
+	for chain, addresses := range GetHDWalletService().WatchedAddresses() {
+		for _, address := range addresses {
+			add(chain, address)
 		}
-		newCache[w.Chain][strings.ToLower(w.Address)] = true
 	}
 	c.cache = newCache
+	c.original = newOriginal
 	c.lastUpdate = time.Now()
 }
 
@@ -118,15 +149,17 @@ func (c *WalletCache) Invalidate() {
 // ChainListener 链监听器
 type ChainListener struct {
 	chain           string
+	chainType       string             // 扫描器类型: tron, trc20, evm, solana, ton
+	scanner         ChainScanner
 	rpc             string
 	rpcBackups      []string           // RPC 备用节点
+	apiKey          string             // 节点 API Key（TON toncenter 使用）
 	contractAddress string
 	confirmations   int
 	scanInterval    int
 	baseScanInterval int               // 基础扫描间隔
 	lastBlock       uint64
-	reorgDepth      int                // 重组检测深度
-	blockHistory    []uint64           // 区块历史（用于重组检测）
+	reorgDepth      int                // 重组检测深度（确认数之外额外保留的区块哈希数）
 	running         bool
 	enabled         bool
 	stopCh          chan struct{}
@@ -144,8 +177,13 @@ type Transfer struct {
 	From        string
 	To          string
 	Amount      decimal.Decimal
+	Token       string // 代币符号: USDT, USDC, TRX
 	BlockNumber uint64
+	BlockHash   string // 所在区块哈希(EVM)
 	Chain       string
+	Unconfirmed   bool // 尚未达到确认数，只跟踪不结算
+	Confirmations int  // 当前确认数(未确认转账；确认跟踪流程结算时为结算时的确认数)
+	References    []string // 付款引用候选(Solana Pay reference 账户、memo)，可按引用匹配订单
 }
 
 var blockchainService *BlockchainService
@@ -191,19 +229,37 @@ func (s *BlockchainService) Init(cfg *config.Config) {
 	defer s.mu.Unlock()
 
 	// 初始化所有链监听器 (包括禁用的，方便后续动态启用)
-	chainConfigs := map[string]config.ChainConfig{
-		"trx":       cfg.Blockchain.TRX,
-		"trc20":     cfg.Blockchain.TRC20,
-		"erc20":     cfg.Blockchain.ERC20,
-		"bep20":     cfg.Blockchain.BEP20,
-		"polygon":   cfg.Blockchain.Polygon,
-		"optimism":  cfg.Blockchain.Optimism,
-		"arbitrum":  cfg.Blockchain.Arbitrum,
-		"avalanche": cfg.Blockchain.Avalanche,
-		"base":      cfg.Blockchain.Base,
-	}
-
-	for chain, chainCfg := range chainConfigs {
+	for chain, chainCfg := range cfg.Blockchain {
+		// 内置链使用默认元数据，配置文件可覆盖；新增链必须指定扫描器类型
+		info, builtin := util.GetChain(chain)
+		info.ID = chain
+		if chainCfg.Type != "" {
+			info.Type = chainCfg.Type
+		}
+		if chainCfg.Name != "" {
+			info.Name = chainCfg.Name
+		}
+		if chainCfg.NativeSymbol != "" {
+			info.NativeSymbol = strings.ToUpper(chainCfg.NativeSymbol)
+		}
+		if info.Name == "" {
+			info.Name = strings.ToUpper(chain)
+		}
+		scanner := s.newChainScanner(info)
+		if scanner == nil {
+			log.Printf("[%s] Unknown chain type %q, skipped", chain, info.Type)
+			continue
+		}
+		util.RegisterChain(info)
+
+		// 配置文件新增的链没有默认值
+		if !builtin && chainCfg.ScanInterval <= 0 {
+			chainCfg.ScanInterval = 15
+		}
+		if !builtin && chainCfg.Confirmations <= 0 {
+			chainCfg.Confirmations = 12
+		}
+
 		// 创建 RPC 客户端（支持多节点故障转移）
 		rpcEndpoints := []string{chainCfg.RPC}
 		if len(chainCfg.RPCBackups) > 0 {
@@ -216,16 +272,23 @@ func (s *BlockchainService) Init(cfg *config.Config) {
 		}
 		s.rpcClients[chain] = rpcClient
 
+		// 配置文件中的合约为该链 USDT，登记到代币表
+		if info.Type != util.ChainTypeTron {
+			GetTokenService().EnsureConfigToken(chain, chainCfg.ContractAddress)
+		}
+
 		s.listeners[chain] = &ChainListener{
 			chain:            chain,
+			chainType:        info.Type,
+			scanner:          scanner,
 			rpc:              chainCfg.RPC,
 			rpcBackups:       chainCfg.RPCBackups,
+			apiKey:           chainCfg.APIKey,
 			contractAddress:  chainCfg.ContractAddress,
 			confirmations:    chainCfg.Confirmations,
 			scanInterval:     chainCfg.ScanInterval,
 			baseScanInterval: chainCfg.ScanInterval,
-			reorgDepth:       10,
-			blockHistory:     make([]uint64, 0, 20),
+			reorgDepth:       64,
 			enabled:          chainCfg.Enabled,
 			stopCh:           make(chan struct{}),
 			maxBlockRange:    chainCfg.MaxBlockRange,
@@ -297,7 +360,9 @@ func (s *BlockchainService) runListener(chain string, listener *ChainListener) {
 		// 查询该链上是否有待支付订单
 		var count int64
 		err := model.GetDB().Model(&model.Order{}).
-			Where("status = ? AND chain = ?", model.OrderStatusPending, chain).
+			Where("status IN ? AND chain = ?", []model.OrderStatus{
+				model.OrderStatusPending, model.OrderStatusPartial, model.OrderStatusDetected, model.OrderStatusConfirming,
+			}, chain).
 			Count(&count).Error
 
 		if err == nil {
@@ -360,18 +425,7 @@ func (s *BlockchainService) scanChain(listener *ChainListener) {
 		return
 	}
 
-	var transfers []Transfer
-	var err error
-
-	switch listener.chain {
-	case "trx":
-		transfers, err = s.scanTRXImproved(listener, addresses)
-	case "trc20":
-		transfers, err = s.scanTRC20Improved(listener, addresses)
-	case "erc20", "bep20", "polygon", "optimism", "arbitrum", "avalanche", "base":
-		transfers, err = s.scanEVMImproved(listener, addresses)
-	}
-
+	transfers, err := listener.scanner.ScanRange(listener, addresses)
 	if err != nil {
 		log.Printf("[%s] Scan error: %v", listener.chain, err)
 		s.metrics.RecordScanFailure(listener.chain, err)
@@ -400,11 +454,18 @@ func (s *BlockchainService) scanChain(listener *ChainListener) {
 		s.metrics.RecordTransfer(listener.chain, len(transfers))
 	}
 
-	// 处理转账
+	// 处理转账，未确认转账只跟踪确认数
 	for _, transfer := range transfers {
+		if transfer.Unconfirmed {
+			s.trackUnconfirmed(transfer)
+			continue
+		}
 		s.processTransfer(transfer)
 	}
 
+	// 刷新未确认转账的确认数
+	s.refreshPendingTransfers(listener)
+
 	// 动态调整扫描间隔
 	s.adjustScanInterval(listener, len(transfers))
 }
@@ -720,92 +781,58 @@ func (s *BlockchainService) processTransfer(transfer Transfer) {
 		return
 	}
 
-	// 记录交易日志
 	txLog := model.TransactionLog{
 		Chain:       transfer.Chain,
 		TxHash:      transfer.TxHash,
 		FromAddress: transfer.From,
 		ToAddress:   transfer.To,
 		Amount:      transfer.Amount.String(),
+		Token:       transferToken(transfer),
 		BlockNumber: transfer.BlockNumber,
+		BlockHash:   transfer.BlockHash,
 		Matched:     false,
 	}
 
-	if err := model.GetDB().Create(&txLog).Error; err != nil {
-		log.Printf("Failed to create transaction log: %v", err)
-		return
+	// 已跟踪的未确认转账按检测时的匹配结果结算，否则按商户收款策略匹配订单
+	match := s.trackedMatch(transfer.TxHash)
+	if match == nil {
+		match = s.matchTransfer(transfer)
+	} else if transfer.Confirmations > match.tracked.Confirmations {
+		match.tracked.Confirmations = transfer.Confirmations
 	}
-
-	// 查找匹配的订单
-	order := s.matchOrder(transfer)
-	if order != nil {
-		// 再次检查订单状态，防止并发重复处理
-		if order.Status != model.OrderStatusPending {
-			log.Printf("Order %s already processed, status: %d", order.TradeNo, order.Status)
+	if match.order == nil {
+		// 未匹配的转账进入待处理队列，由管理员手动指派
+		txLog.MatchNote = match.note
+		if err := model.GetDB().Create(&txLog).Error; err != nil {
+			log.Printf("Failed to create transaction log: %v", err)
 			return
 		}
+		log.Printf("Unmatched transfer %s on %s, amount: %s, reason: %s", transfer.TxHash, transfer.Chain, transfer.Amount, match.note)
+		return
+	}
 
-		// 更新订单状态（使用乐观锁）
-		now := time.Now()
-
-		// 实际支付金额也需要截断到标准精度（与unique_amount一致）
-		var actualAmount decimal.Decimal
-		if transfer.Chain == "wechat" || transfer.Chain == "alipay" {
-			actualAmount = transfer.Amount.Round(2) // 法币2位
-		} else {
-			actualAmount = transfer.Amount.Round(6) // 加密货币6位
-		}
-
-		updates := map[string]interface{}{
-			"status":        model.OrderStatusPaid,
-			"tx_hash":       transfer.TxHash,
-			"from_address":  transfer.From,
-			"actual_amount": actualAmount,
-			"paid_at":       &now,
-		}
-
-		// 使用 WHERE 条件确保只更新待支付的订单
-		result := model.GetDB().Model(order).
-			Where("status = ?", model.OrderStatusPending).
-			Updates(updates)
-
-		if result.Error != nil {
-			log.Printf("Failed to update order: %v", result.Error)
-			return
+	// 交易日志与订单结算在同一事务中写入
+	if err := s.applyTransferMatch(&txLog, match, model.LedgerActorSystem); err != nil {
+		log.Printf("Failed to settle order %s with tx %s: %v", match.order.TradeNo, transfer.TxHash, err)
+
+		// 结算事务已回滚，单独记录交易日志进入待处理队列，避免转账丢失
+		failedLog := model.TransactionLog{
+			Chain:       transfer.Chain,
+			TxHash:      transfer.TxHash,
+			FromAddress: transfer.From,
+			ToAddress:   transfer.To,
+			Amount:      transfer.Amount.String(),
+			Token:       transferToken(transfer),
+			BlockNumber: transfer.BlockNumber,
+			BlockHash:   transfer.BlockHash,
+			MatchNote:   model.MatchNoteFailed,
 		}
-
-		// 如果没有更新任何行，说明订单已被其他进程处理
-		if result.RowsAffected == 0 {
-			log.Printf("Order %s already processed by another process", order.TradeNo)
-			return
+		if err := model.GetDB().Create(&failedLog).Error; err != nil {
+			log.Printf("Failed to create transaction log: %v", err)
 		}
-
-		// 使订单缓存失效
-		GetOrderService().InvalidateOrderCache(order.TradeNo)
-
-		// 更新交易日志
-		model.GetDB().Model(&txLog).Updates(map[string]interface{}{
-			"matched":  true,
-			"order_id": order.ID,
-		})
-
-		log.Printf("Order %s matched with tx %s, amount: %s", order.TradeNo, transfer.TxHash, transfer.Amount)
-
-		// 记录订单匹配
-		s.metrics.RecordOrderMatch(transfer.Chain)
-
-		// 增加商户余额（使用 USD 结算金额）
-		settlementAmount, _ := order.SettlementAmount.Float64()
-		fee, _ := order.Fee.Float64()
-		if err := GetWithdrawService().AddMerchantBalance(order.MerchantID, settlementAmount, fee, order.FeeType); err != nil {
-			log.Printf("Failed to add merchant balance for order %s: %v", order.TradeNo, err)
+		if match.tracked != nil {
+			s.dropPendingTransfer(match.tracked, "settlement failed")
 		}
-
-		// 触发回调通知
-		go GetNotifyService().NotifyOrder(order.ID)
-
-		// 发送Telegram通知 - 订单支付成功
-		go GetTelegramService().NotifyOrderPaid(order)
 	}
 }
 
@@ -814,9 +841,7 @@ func (s *BlockchainService) matchOrder(transfer Transfer) *model.Order {
 	var order model.Order
 
 	// 确定链的标准精度并截断金额
-	// TRC20/ERC20等: 6位小数
-	// BEP20: 虽然链上是18位，但我们统一按6位处理
-	// TRX: 6位小数
+	// 加密货币: 链上精度由代币登记表决定，订单金额统一按6位小数
 	// 法币: 2位小数
 	var normalizedAmount decimal.Decimal
 	if transfer.Chain == "wechat" || transfer.Chain == "alipay" {
@@ -834,8 +859,9 @@ func (s *BlockchainService) matchOrder(transfer Transfer) *model.Order {
 	// 法币: 100.01 CNY
 	// 条件：待支付状态 且 (未过期 或 过期时间在1分钟以内)
 	err := model.GetDB().
-		Where("chain = ? AND to_address = ? AND unique_amount = ? AND status = ? AND expired_at > ?",
+		Where("chain = ? AND pay_currency = ? AND to_address = ? AND unique_amount = ? AND status = ? AND expired_at > ?",
 			transfer.Chain,
+			transferToken(transfer),
 			strings.ToLower(transfer.To),
 			normalizedAmount,
 			model.OrderStatusPending,
@@ -846,8 +872,9 @@ func (s *BlockchainService) matchOrder(transfer Transfer) *model.Order {
 	if err != nil {
 		// 兼容旧订单：尝试匹配 usdt_amount (旧字段)
 		err = model.GetDB().
-			Where("chain = ? AND to_address = ? AND usdt_amount = ? AND status = ? AND expired_at > ?",
+			Where("chain = ? AND pay_currency = ? AND to_address = ? AND usdt_amount = ? AND status = ? AND expired_at > ?",
 				transfer.Chain,
+				transferToken(transfer),
 				strings.ToLower(transfer.To),
 				normalizedAmount,
 				model.OrderStatusPending,
@@ -886,7 +913,11 @@ func (s *BlockchainService) GetListenerStatus() map[string]interface{} {
 	status := make(map[string]interface{})
 	for chain, listener := range s.listeners {
 		listener.mu.Lock()
+		info, _ := util.GetChain(chain)
 		status[chain] = map[string]interface{}{
+			"name":         info.Name,
+			"type":         listener.chainType,
+			"native":       info.NativeSymbol,
 			"enabled":      listener.enabled,
 			"running":      listener.running,
 			"wallet_count": walletCounts[chain],
@@ -1052,6 +1083,18 @@ func (s *BlockchainService) IsChainEnabled(chain string) bool {
 	return listener.enabled
 }
 
+// GetConfirmations 获取链的确认数要求
+func (s *BlockchainService) GetConfirmations(chain string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	listener, ok := s.listeners[chain]
+	if !ok {
+		return 0
+	}
+	return listener.confirmations
+}
+
 // GetEnabledChains 获取所有已启用的链
 func (s *BlockchainService) GetEnabledChains() []string {
 	s.mu.RLock()
@@ -1138,11 +1181,8 @@ func (s *BlockchainService) monitorGasPrices() {
 
 // updateGasPrices 更新 Gas 价格
 func (s *BlockchainService) updateGasPrices() {
-	evmChains := []string{"erc20", "bep20", "polygon", "optimism", "arbitrum", "avalanche", "base"}
-
-	for _, chain := range evmChains {
-		listener := s.listeners[chain]
-		if listener == nil || !listener.enabled {
+	for chain, listener := range s.listeners {
+		if listener.chainType != util.ChainTypeEVM || !listener.enabled {
 			continue
 		}
 
@@ -1221,41 +1261,3 @@ func (s *BlockchainService) GetChainMetrics(chain string) map[string]interface{}
 	}
 	return s.metrics.GetChainMetrics(chain)
 }
-
-// detectReorg 检测区块重组
-func (s *BlockchainService) detectReorg(listener *ChainListener, currentBlock uint64) bool {
-	listener.mu.Lock()
-	defer listener.mu.Unlock()
-
-	// 如果没有历史记录，添加当前区块
-	if len(listener.blockHistory) == 0 {
-		listener.blockHistory = append(listener.blockHistory, currentBlock)
-		return false
-	}
-
-	lastBlock := listener.blockHistory[len(listener.blockHistory)-1]
-
-	// 如果当前区块小于或等于最后记录的区块，可能发生重组
-	if currentBlock <= lastBlock {
-		log.Printf("[%s] Potential reorg detected: current=%d, last=%d", 
-			listener.chain, currentBlock, lastBlock)
-		
-		// 清空历史，重新扫描
-		listener.blockHistory = []uint64{currentBlock}
-		listener.lastBlock = currentBlock - uint64(listener.reorgDepth)
-		if listener.lastBlock < 0 {
-			listener.lastBlock = 0
-		}
-		return true
-	}
-
-	// 添加到历史
-	listener.blockHistory = append(listener.blockHistory, currentBlock)
-
-	// 只保留最近的 20 个区块
-	if len(listener.blockHistory) > 20 {
-		listener.blockHistory = listener.blockHistory[len(listener.blockHistory)-20:]
-	}
-
-	return false
-}
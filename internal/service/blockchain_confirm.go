@@ -0,0 +1,376 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// pendingTransferDropAfter 链上持续查不到未确认交易超过该时长后视为交易已消失(被替换或重组丢弃)
+const pendingTransferDropAfter = 10 * time.Minute
+
+// trackUnconfirmed 跟踪尚未达到确认数的转账
+// 首次发现时按收款策略匹配订单，将订单置为已检测/确认中并记录匹配结果
+func (s *BlockchainService) trackUnconfirmed(transfer Transfer) {
+	// 已跟踪的转账由 refreshPendingTransfers 统一刷新确认数
+	var pending model.PendingTransfer
+	if err := model.GetDB().Where("tx_hash = ?", transfer.TxHash).First(&pending).Error; err == nil {
+		return
+	}
+
+	// 已结算或已进入待处理队列的交易不再跟踪
+	var count int64
+	model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", transfer.TxHash).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	// 未匹配的转账等确认后再进入待处理队列
+	match := s.matchTransfer(transfer)
+	if match.order == nil {
+		return
+	}
+	order := match.order
+	required := s.GetConfirmations(transfer.Chain)
+	status := model.OrderStatusConfirming
+	if transfer.Confirmations <= 0 {
+		status = model.OrderStatusDetected
+	}
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&model.Order{}).Where("id = ? AND status = ?", order.ID, order.Status)
+		if order.Status == model.OrderStatusPartial {
+			query = query.Where("actual_amount = ?", order.ActualAmount)
+		}
+		result := query.Updates(map[string]interface{}{
+			"status":                 status,
+			"confirmations":          transfer.Confirmations,
+			"required_confirmations": required,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderAlreadyProcessed
+		}
+
+		pending = model.PendingTransfer{
+			Chain:                 transfer.Chain,
+			TxHash:                transfer.TxHash,
+			FromAddress:           transfer.From,
+			ToAddress:             transfer.To,
+			Amount:                transfer.Amount,
+			Token:                 transferToken(transfer),
+			BlockNumber:           transfer.BlockNumber,
+			OrderID:               order.ID,
+			PrevStatus:            order.Status,
+			NewStatus:             match.newStatus,
+			Total:                 match.total,
+			MatchNote:             match.note,
+			Confirmations:         transfer.Confirmations,
+			RequiredConfirmations: required,
+			Status:                model.PendingTransferTracking,
+		}
+		if err := tx.Create(&pending).Error; err != nil {
+			return err
+		}
+
+		// Webhook 事件 - 检测到付款
+		snapshot := *order
+		snapshot.Status = status
+		snapshot.Confirmations = transfer.Confirmations
+		snapshot.RequiredConfirmations = required
+		GetNotifyService().EmitOrderEvent(tx, &snapshot, model.WebhookEventOrderDetected, WebhookOrderData{
+			Transfer: &WebhookTransfer{
+				TxHash:      transfer.TxHash,
+				FromAddress: transfer.From,
+				Amount:      transfer.Amount,
+				Received:    match.total,
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errOrderAlreadyProcessed) {
+			log.Printf("Failed to track unconfirmed tx %s for order %s: %v", transfer.TxHash, order.TradeNo, err)
+		}
+		return
+	}
+
+	GetOrderService().InvalidateOrderCache(order.TradeNo)
+	log.Printf("Order %s detected unconfirmed tx %s, amount: %s, confirmations: %d/%d",
+		order.TradeNo, transfer.TxHash, transfer.Amount, transfer.Confirmations, required)
+}
+
+// updatePendingConfirmations 更新未确认转账及其订单的确认数
+func (s *BlockchainService) updatePendingConfirmations(pending *model.PendingTransfer, confirmations int, blockNumber uint64) {
+	if confirmations == pending.Confirmations && pending.MissingSince == nil && (blockNumber == 0 || blockNumber == pending.BlockNumber) {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"confirmations": confirmations,
+		"missing_since": nil,
+	}
+	if blockNumber > 0 {
+		updates["block_number"] = blockNumber
+	}
+	model.GetDB().Model(pending).Updates(updates)
+
+	status := model.OrderStatusConfirming
+	if confirmations <= 0 {
+		status = model.OrderStatusDetected
+	}
+	result := model.GetDB().Model(&model.Order{}).
+		Where("id = ? AND status IN ?", pending.OrderID, model.ConfirmingOrderStatuses).
+		Updates(map[string]interface{}{
+			"status":        status,
+			"confirmations": confirmations,
+		})
+	if result.RowsAffected > 0 {
+		var order model.Order
+		if err := model.GetDB().Select("trade_no").First(&order, pending.OrderID).Error; err == nil {
+			GetOrderService().InvalidateOrderCache(order.TradeNo)
+		}
+	}
+}
+
+// trackedMatch 确认数达到后，按检测时记录的匹配结果构建结算信息
+// 返回 nil 表示该交易未被跟踪
+func (s *BlockchainService) trackedMatch(txHash string) *paymentMatch {
+	var pending model.PendingTransfer
+	if err := model.GetDB().Where("tx_hash = ? AND status = ?", txHash, model.PendingTransferTracking).First(&pending).Error; err != nil {
+		return nil
+	}
+
+	var order model.Order
+	if err := model.GetDB().First(&order, pending.OrderID).Error; err != nil || !order.Status.IsConfirming() {
+		// 订单已不在确认中(如已被人工处理)，按普通转账处理
+		model.GetDB().Model(&pending).Update("status", model.PendingTransferDropped)
+		return nil
+	}
+
+	// 结算时按检测前状态判断手续费冻结情况
+	order.Status = pending.PrevStatus
+	return &paymentMatch{
+		order:     &order,
+		newStatus: pending.NewStatus,
+		total:     pending.Total,
+		note:      pending.MatchNote,
+		tracked:   &pending,
+	}
+}
+
+// dropPendingTransfer 交易消失或失败，订单回退到检测前状态
+func (s *BlockchainService) dropPendingTransfer(pending *model.PendingTransfer, reason string) {
+	var tradeNo string
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(pending).Where("status = ?", model.PendingTransferTracking).
+			Update("status", model.PendingTransferDropped)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		var order model.Order
+		if err := tx.Select("id", "trade_no").First(&order, pending.OrderID).Error; err != nil {
+			return nil
+		}
+		tradeNo = order.TradeNo
+		return tx.Model(&model.Order{}).
+			Where("id = ? AND status IN ?", pending.OrderID, model.ConfirmingOrderStatuses).
+			Updates(map[string]interface{}{
+				"status":                 pending.PrevStatus,
+				"confirmations":          0,
+				"required_confirmations": 0,
+			}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to drop pending tx %s: %v", pending.TxHash, err)
+		return
+	}
+	if tradeNo != "" {
+		GetOrderService().InvalidateOrderCache(tradeNo)
+	}
+	log.Printf("[%s] Pending tx %s dropped (%s), order %s reverted to status %d",
+		pending.Chain, pending.TxHash, reason, tradeNo, pending.PrevStatus)
+}
+
+// txConfirmation 链上交易确认情况
+type txConfirmation struct {
+	found         bool   // 是否已上链
+	failed        bool   // 交易执行失败
+	blockNumber   uint64 // 所在区块
+	blockHash     string // 所在区块哈希(EVM)
+	confirmations int    // 所在区块之后的区块数
+}
+
+// refreshPendingTransfers 刷新该链所有未确认转账的确认数
+// 确认数达到要求时直接结算(不依赖扫描窗口)，交易失败或持续查不到时回退订单
+func (s *BlockchainService) refreshPendingTransfers(listener *ChainListener) {
+	var pendings []model.PendingTransfer
+	if err := model.GetDB().Where("chain = ? AND status = ?", listener.chain, model.PendingTransferTracking).
+		Find(&pendings).Error; err != nil || len(pendings) == 0 {
+		return
+	}
+
+	if s.rpcClients[listener.chain] == nil {
+		return
+	}
+
+	currentBlock, err := listener.scanner.LatestHeight(listener)
+	if err != nil || currentBlock == 0 {
+		log.Printf("[%s] Failed to get block number for pending transfers: %v", listener.chain, err)
+		return
+	}
+
+	for i := range pendings {
+		pending := &pendings[i]
+
+		conf, err := listener.scanner.TxConfirmation(listener, pending.TxHash, currentBlock)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case conf.failed:
+			s.dropPendingTransfer(pending, "transaction failed")
+		case !conf.found:
+			now := time.Now()
+			if pending.MissingSince == nil {
+				model.GetDB().Model(pending).Update("missing_since", &now)
+			} else if now.Sub(*pending.MissingSince) > pendingTransferDropAfter {
+				s.dropPendingTransfer(pending, "transaction not found")
+			}
+		case conf.confirmations >= listener.confirmations:
+			// 确认数已达到，按已确认转账结算
+			s.processTransfer(Transfer{
+				TxHash:        pending.TxHash,
+				From:          pending.FromAddress,
+				To:            pending.ToAddress,
+				Amount:        pending.Amount,
+				Token:         pending.Token,
+				BlockNumber:   conf.blockNumber,
+				BlockHash:     conf.blockHash,
+				Chain:         pending.Chain,
+				Confirmations: conf.confirmations,
+			})
+		default:
+			s.updatePendingConfirmations(pending, conf.confirmations, conf.blockNumber)
+		}
+	}
+}
+
+// getEVMTxConfirmation 通过交易回执查询 EVM 交易确认情况
+func (s *BlockchainService) getEVMTxConfirmation(rpcClient *RPCClient, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	body, err := rpcClient.PostJSON("", map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "eth_getTransactionReceipt",
+		"params":  []interface{}{txHash},
+		"id":      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Result *struct {
+			BlockNumber string `json:"blockNumber"`
+			BlockHash   string `json:"blockHash"`
+			Status      string `json:"status"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("rpc error: %s", result.Error.Message)
+	}
+	if result.Result == nil || result.Result.BlockNumber == "" {
+		return &txConfirmation{}, nil
+	}
+
+	conf := &txConfirmation{
+		found:       true,
+		failed:      result.Result.Status == "0x0",
+		blockNumber: parseHexUint64(result.Result.BlockNumber),
+		blockHash:   result.Result.BlockHash,
+	}
+	if currentBlock > conf.blockNumber {
+		conf.confirmations = int(currentBlock - conf.blockNumber)
+	}
+	return conf, nil
+}
+
+// getTronBlockNumber 获取 TRON 最新区块号
+func (s *BlockchainService) getTronBlockNumber(rpcClient *RPCClient) (uint64, error) {
+	body, err := rpcClient.PostJSON("/wallet/getnowblock", map[string]interface{}{})
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		BlockHeader struct {
+			RawData struct {
+				Number uint64 `json:"number"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, err
+	}
+	return result.BlockHeader.RawData.Number, nil
+}
+
+// getTronTxConfirmation 通过交易信息查询 TRON 交易确认情况
+func (s *BlockchainService) getTronTxConfirmation(rpcClient *RPCClient, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	body, err := rpcClient.PostJSON("/wallet/gettransactioninfobyid", map[string]interface{}{
+		"value": txHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		ID          string `json:"id"`
+		BlockNumber uint64 `json:"blockNumber"`
+		Result      string `json:"result"`
+		Receipt     struct {
+			Result string `json:"result"`
+		} `json:"receipt"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.ID == "" || result.BlockNumber == 0 {
+		return &txConfirmation{}, nil
+	}
+
+	conf := &txConfirmation{
+		found:       true,
+		failed:      strings.EqualFold(result.Result, "FAILED") || (result.Receipt.Result != "" && result.Receipt.Result != "SUCCESS"),
+		blockNumber: result.BlockNumber,
+	}
+	if currentBlock > conf.blockNumber {
+		conf.confirmations = int(currentBlock - conf.blockNumber)
+	}
+	return conf, nil
+}
+
+// hasConfirmingCandidates 该链是否有可能收到付款的订单(待支付/部分支付)，没有时跳过未确认交易查询
+func (s *BlockchainService) hasConfirmingCandidates(chain string) bool {
+	var count int64
+	model.GetDB().Model(&model.Order{}).
+		Where("chain = ? AND status IN ?", chain, []model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial}).
+		Count(&count)
+	return count > 0
+}
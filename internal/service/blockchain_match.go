@@ -0,0 +1,284 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+)
+
+// maxLateWindow 过期到账最大查找范围，超过该时间的过期订单不再参与匹配
+const maxLateWindow = 7 * 24 * time.Hour
+
+// paymentMatch 转账匹配结果
+type paymentMatch struct {
+	order     *model.Order           // 匹配到的订单，nil 表示未匹配
+	newStatus model.OrderStatus      // 匹配后订单状态
+	total     decimal.Decimal        // 订单累计收款金额
+	note      string                 // 匹配结果说明(model.MatchNoteXxx)
+	tracked   *model.PendingTransfer // 确认中订单的未确认转账记录，非空时按检测时的匹配结果结算
+}
+
+// normalizeTransferAmount 将转账金额截断到订单金额的标准精度
+// 加密货币: 链上精度(6/18位等)由代币登记表决定，订单金额统一按6位小数
+// 法币: 2位小数
+func normalizeTransferAmount(transfer Transfer) decimal.Decimal {
+	if util.IsFiatChain(transfer.Chain) {
+		return transfer.Amount.Round(2)
+	}
+	return transfer.Amount.Round(6)
+}
+
+// transferToken 转账的代币符号，扫描器未标记时按链的默认币种处理
+func transferToken(transfer Transfer) string {
+	if transfer.Token != "" {
+		return transfer.Token
+	}
+	return model.DefaultToken(transfer.Chain)
+}
+
+// txLogToken 交易日志的代币符号，未记录币种的旧日志按链的默认币种处理
+func txLogToken(txLog *model.TransactionLog) string {
+	if txLog.Token != "" {
+		return txLog.Token
+	}
+	return model.DefaultToken(txLog.Chain)
+}
+
+// orderRequiredAmount 订单应收金额(含唯一标识偏移)
+func orderRequiredAmount(order *model.Order) decimal.Decimal {
+	if order.UniqueAmount.IsPositive() {
+		return order.UniqueAmount
+	}
+	return order.USDTAmount
+}
+
+// orderPaymentPolicy 获取订单所属商户的收款策略
+func orderPaymentPolicy(order *model.Order) model.PaymentPolicy {
+	policy := model.DefaultPaymentPolicy()
+	if order.Merchant != nil {
+		policy = order.Merchant.PaymentPolicy
+	}
+	if policy.LateWindowMinutes <= 0 {
+		policy.LateWindowMinutes = model.DefaultPaymentPolicy().LateWindowMinutes
+	}
+	// 上限调整前保存的策略按上限处理
+	if policy.UnderpayTolerance > model.MaxUnderpayTolerance {
+		policy.UnderpayTolerance = model.MaxUnderpayTolerance
+	}
+	return policy
+}
+
+// withinTolerance 金额是否在策略允许的少付/多付范围内
+func withinTolerance(amount, required decimal.Decimal, policy model.PaymentPolicy) bool {
+	lower := required.Mul(decimal.NewFromFloat(1 - policy.UnderpayTolerance))
+	upper := required.Mul(decimal.NewFromFloat(1 + policy.OverpayTolerance))
+	return amount.GreaterThanOrEqual(lower) && amount.LessThanOrEqual(upper)
+}
+
+// reachedRequired 累计金额是否已达到应收金额(扣除少付容差)
+func reachedRequired(total, required decimal.Decimal, policy model.PaymentPolicy) bool {
+	lower := required.Mul(decimal.NewFromFloat(1 - policy.UnderpayTolerance))
+	return total.GreaterThanOrEqual(lower)
+}
+
+// matchTransfer 按商户收款策略匹配转账
+// 匹配顺序：
+// 0. HD 派生地址只按地址匹配(每个订单独立地址)，带付款引用的转账按引用匹配
+// 1. 精确匹配唯一标识金额(旧逻辑)
+// 2. 同一付款地址对部分支付订单的补款，累计达到应收金额后标记为已支付
+// 3. 容差匹配待支付订单(少付/多付在容差内视为已支付，唯一候选时才自动匹配)
+// 4. 唯一待支付订单且商户允许部分支付时，标记为部分支付
+// 5. 商户允许过期到账时，匹配过期窗口内的订单并标记为过期后支付
+func (s *BlockchainService) matchTransfer(transfer Transfer) *paymentMatch {
+	amount := normalizeTransferAmount(transfer)
+
+	// 0. HD 派生地址
+	if match := s.matchDerivedAddress(transfer, amount); match != nil {
+		return match
+	}
+	if match := s.matchReference(transfer, amount); match != nil {
+		return match
+	}
+	// 付款必须附带备注的链(TON)不按金额匹配，未带有效备注的转账交由管理员处理
+	if s.ReferenceRequired(transfer.Chain) {
+		return &paymentMatch{note: model.MatchNoteNoReference}
+	}
+
+	// 1. 精确匹配
+	if order := s.matchOrder(transfer); order != nil {
+		return &paymentMatch{order: order, newStatus: model.OrderStatusPaid, total: amount, note: model.MatchNotePaid}
+	}
+
+	// 法币收款由监控APP回调处理，不做容差匹配
+	if util.IsFiatChain(transfer.Chain) {
+		return &paymentMatch{note: model.MatchNoteNoOrder}
+	}
+
+	now := time.Now()
+	expiredTolerance := now.Add(-1 * time.Minute)
+	toAddress := strings.ToLower(transfer.To)
+	token := transferToken(transfer)
+
+	// 2. 部分支付订单补款（同一付款地址）
+	if transfer.From != "" {
+		var partial model.Order
+		if err := model.GetDB().Preload("Merchant").
+			Where("chain = ? AND pay_currency = ? AND to_address = ? AND status = ? AND from_address = ? AND expired_at > ?",
+				transfer.Chain, token, toAddress, model.OrderStatusPartial, transfer.From, expiredTolerance).
+			Order("created_at ASC").
+			First(&partial).Error; err == nil {
+			policy := orderPaymentPolicy(&partial)
+			total := partial.ActualAmount.Add(amount)
+			status := model.OrderStatusPartial
+			note := model.MatchNotePartial
+			if reachedRequired(total, orderRequiredAmount(&partial), policy) {
+				status = model.OrderStatusPaid
+				note = model.MatchNotePaid
+			}
+			return &paymentMatch{order: &partial, newStatus: status, total: total, note: note}
+		}
+	}
+
+	// 3. 容差匹配待支付订单
+	var pendings []model.Order
+	model.GetDB().Preload("Merchant").
+		Where("chain = ? AND pay_currency = ? AND to_address = ? AND status = ? AND expired_at > ?",
+			transfer.Chain, token, toAddress, model.OrderStatusPending, expiredTolerance).
+		Order("created_at ASC").
+		Find(&pendings)
+
+	var tolerant []*model.Order
+	for i := range pendings {
+		if withinTolerance(amount, orderRequiredAmount(&pendings[i]), orderPaymentPolicy(&pendings[i])) {
+			tolerant = append(tolerant, &pendings[i])
+		}
+	}
+	if len(tolerant) == 1 {
+		return &paymentMatch{order: tolerant[0], newStatus: model.OrderStatusPaid, total: amount, note: model.MatchNotePaid}
+	}
+	if len(tolerant) > 1 {
+		// 多个候选订单，无法确定归属，交由管理员处理
+		return &paymentMatch{note: model.MatchNoteAmbiguous}
+	}
+
+	// 4. 部分支付：仅当该地址只有一个待支付订单时才能确定归属
+	if len(pendings) == 1 {
+		order := &pendings[0]
+		if amount.LessThan(orderRequiredAmount(order)) {
+			if orderPaymentPolicy(order).AllowPartial {
+				return &paymentMatch{order: order, newStatus: model.OrderStatusPartial, total: amount, note: model.MatchNotePartial}
+			}
+			return &paymentMatch{note: model.MatchNoteUnderpaid}
+		}
+	}
+
+	// 5. 过期后到账
+	var lates []model.Order
+	model.GetDB().Preload("Merchant").
+		Where("chain = ? AND pay_currency = ? AND to_address = ? AND status IN ? AND expired_at <= ? AND expired_at > ?",
+			transfer.Chain, token, toAddress,
+			[]model.OrderStatus{model.OrderStatusPending, model.OrderStatusExpired},
+			expiredTolerance, now.Add(-maxLateWindow)).
+		Order("expired_at DESC").
+		Find(&lates)
+
+	var lateCandidates []*model.Order
+	foundExpired := false
+	for i := range lates {
+		order := &lates[i]
+		policy := orderPaymentPolicy(order)
+		if !withinTolerance(amount, orderRequiredAmount(order), policy) {
+			continue
+		}
+		foundExpired = true
+		if !policy.AllowLate || now.After(order.ExpiredAt.Add(time.Duration(policy.LateWindowMinutes)*time.Minute)) {
+			continue
+		}
+		lateCandidates = append(lateCandidates, order)
+	}
+	if len(lateCandidates) == 1 {
+		return &paymentMatch{order: lateCandidates[0], newStatus: model.OrderStatusPaidLate, total: amount, note: model.MatchNotePaidLate}
+	}
+	if len(lateCandidates) > 1 {
+		return &paymentMatch{note: model.MatchNoteAmbiguous}
+	}
+	if foundExpired {
+		return &paymentMatch{note: model.MatchNoteExpired}
+	}
+	for i := range pendings {
+		if amount.LessThan(orderRequiredAmount(&pendings[i])) {
+			return &paymentMatch{note: model.MatchNoteUnderpaid}
+		}
+	}
+
+	return &paymentMatch{note: model.MatchNoteNoOrder}
+}
+
+// matchDerivedAddress 按 HD 派生地址匹配订单，收款地址不是派生地址时返回 nil
+func (s *BlockchainService) matchDerivedAddress(transfer Transfer, amount decimal.Decimal) *paymentMatch {
+	if util.IsFiatChain(transfer.Chain) {
+		return nil
+	}
+
+	var order model.Order
+	if err := model.GetDB().Preload("Merchant").
+		Where("chain = ? AND pay_currency = ? AND to_address = ? AND hd_wallet_id > 0", transfer.Chain, transferToken(transfer), strings.ToLower(transfer.To)).
+		Order("id DESC").
+		First(&order).Error; err != nil {
+		return nil
+	}
+	return s.matchDedicatedOrder(&order, amount)
+}
+
+// matchReference 按付款引用匹配订单(Solana Pay reference 账户，memo/TON 备注中的引用或订单号)，转账未带引用时返回 nil
+func (s *BlockchainService) matchReference(transfer Transfer, amount decimal.Decimal) *paymentMatch {
+	if len(transfer.References) == 0 {
+		return nil
+	}
+
+	var order model.Order
+	if err := model.GetDB().Preload("Merchant").
+		Where("chain = ? AND pay_currency = ? AND to_address = ?", transfer.Chain, transferToken(transfer), strings.ToLower(transfer.To)).
+		Where("(pay_reference IN ? OR trade_no IN ?)", transfer.References, transfer.References).
+		Order("id DESC").
+		First(&order).Error; err != nil {
+		return nil
+	}
+	return s.matchDedicatedOrder(&order, amount)
+}
+
+// matchDedicatedOrder 转账已确定归属的订单(派生地址/付款引用)
+// 不需要唯一标识金额：累计达到应收金额即支付成功，多付同样视为支付成功
+func (s *BlockchainService) matchDedicatedOrder(order *model.Order, amount decimal.Decimal) *paymentMatch {
+	now := time.Now()
+	policy := orderPaymentPolicy(order)
+	total := order.ActualAmount.Add(amount)
+	reached := reachedRequired(total, orderRequiredAmount(order), policy)
+
+	switch order.Status {
+	case model.OrderStatusPending, model.OrderStatusPartial:
+		if order.ExpiredAt.After(now.Add(-1 * time.Minute)) {
+			if reached {
+				return &paymentMatch{order: order, newStatus: model.OrderStatusPaid, total: total, note: model.MatchNotePaid}
+			}
+			if policy.AllowPartial {
+				return &paymentMatch{order: order, newStatus: model.OrderStatusPartial, total: total, note: model.MatchNotePartial}
+			}
+			return &paymentMatch{note: model.MatchNoteUnderpaid}
+		}
+	case model.OrderStatusExpired:
+	default:
+		// 已支付/已取消/确认中的订单再次收到转账，交由管理员处理
+		return &paymentMatch{note: model.MatchNoteNoOrder}
+	}
+
+	// 过期后到账
+	if !reached || !policy.AllowLate || now.After(order.ExpiredAt.Add(time.Duration(policy.LateWindowMinutes)*time.Minute)) {
+		return &paymentMatch{note: model.MatchNoteExpired}
+	}
+	return &paymentMatch{order: order, newStatus: model.OrderStatusPaidLate, total: total, note: model.MatchNotePaidLate}
+}
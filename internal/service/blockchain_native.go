@@ -0,0 +1,133 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+)
+
+// nativeMaxBlockRange 原生币扫描单次最多查询的区块数
+// 原生币转账没有事件日志，需要逐块拉取完整交易，查询范围比日志扫描小得多
+const nativeMaxBlockRange = 100
+
+// nativeDecimals EVM 链原生币精度
+const nativeDecimals = 18
+
+// hasNativeCandidates 链上是否有等待原生币付款的订单(含过期到账窗口内的订单)
+// 没有原生币订单时不逐块扫描，避免无谓的 RPC 消耗
+func (s *BlockchainService) hasNativeCandidates(chain string) bool {
+	native := model.NativeToken(chain)
+	if native == "" {
+		return false
+	}
+	var count int64
+	model.GetDB().Model(&model.Order{}).
+		Where("chain = ? AND pay_currency = ?", chain, native).
+		Where("(status IN ? OR (status = ? AND expired_at > ?))",
+			[]model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial},
+			model.OrderStatusExpired, time.Now().Add(-maxLateWindow)).
+		Count(&count)
+	return count > 0
+}
+
+// scanEVMNative 逐块扫描发往收款地址的原生币转账
+// fromBlock~toBlock 为本次查询范围，高于 queryToBlock 的区块尚未达到确认数，只跟踪不结算
+func (s *BlockchainService) scanEVMNative(listener *ChainListener, rpcClient *RPCClient, addresses map[string]bool,
+	fromBlock, toBlock, queryToBlock, currentBlock uint64, batchSize int, delay time.Duration) ([]Transfer, error) {
+	native := model.NativeToken(listener.chain)
+
+	numbers := make([]uint64, 0, toBlock-fromBlock+1)
+	for n := fromBlock; n <= toBlock; n++ {
+		numbers = append(numbers, n)
+	}
+
+	type nativeTx struct {
+		Hash        string `json:"hash"`
+		From        string `json:"from"`
+		To          string `json:"to"`
+		Value       string `json:"value"`
+		BlockNumber string `json:"blockNumber"`
+		BlockHash   string `json:"blockHash"`
+	}
+
+	var candidates []nativeTx
+	fetched := make(map[uint64]bool, len(numbers))
+	err := s.fetchEVMBlocks(rpcClient, numbers, true, batchSize, delay, func(raw json.RawMessage) {
+		var block *struct {
+			Number       string     `json:"number"`
+			Transactions []nativeTx `json:"transactions"`
+		}
+		if err := json.Unmarshal(raw, &block); err != nil || block == nil {
+			return
+		}
+		fetched[parseHexUint64(block.Number)] = true
+		for _, tx := range block.Transactions {
+			// 合约创建交易没有 to，零值交易不是原生币转账
+			if tx.To == "" || !addresses[strings.ToLower(tx.To)] {
+				continue
+			}
+			if strings.TrimLeft(strings.TrimPrefix(tx.Value, "0x"), "0") == "" {
+				continue
+			}
+			candidates = append(candidates, tx)
+		}
+	})
+	if err != nil {
+		s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, fmt.Errorf("failed to fetch blocks: %w", err)
+	}
+	s.metrics.RecordRPCCall(listener.chain, true, 0)
+
+	// 节点未返回的区块(尚未同步等)不能跳过，下一轮重新查询
+	for _, n := range numbers {
+		if !fetched[n] {
+			return nil, fmt.Errorf("block %d not available", n)
+		}
+	}
+
+	var transfers []Transfer
+	for _, tx := range candidates {
+		// 检查是否已处理
+		var count int64
+		model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.Hash).Count(&count)
+		if count > 0 {
+			s.metrics.RecordDuplicateTx(listener.chain)
+			continue
+		}
+
+		// 交易执行失败(如收款地址为合约且拒收)时原生币未到账
+		conf, err := s.getEVMTxConfirmation(rpcClient, tx.Hash, currentBlock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get receipt %s: %w", tx.Hash, err)
+		}
+		if !conf.found {
+			return nil, fmt.Errorf("receipt %s not available", tx.Hash)
+		}
+		if conf.failed {
+			log.Printf("[%s] Skip failed native transfer %s", listener.chain, tx.Hash)
+			continue
+		}
+
+		blockNum := parseHexUint64(tx.BlockNumber)
+		transfer := Transfer{
+			TxHash:      tx.Hash,
+			From:        strings.ToLower(tx.From),
+			To:          strings.ToLower(tx.To),
+			Amount:      parseHexAmount(tx.Value, nativeDecimals),
+			Token:       native,
+			BlockNumber: blockNum,
+			BlockHash:   tx.BlockHash,
+			Chain:       listener.chain,
+		}
+		if blockNum > queryToBlock {
+			transfer.Unconfirmed = true
+			transfer.Confirmations = int(currentBlock - blockNum)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blockHeader 区块头（重组检测只需要哈希和父哈希）
+type blockHeader struct {
+	Number     uint64
+	Hash       string
+	ParentHash string
+}
+
+// detectReorg 基于区块哈希检测区块重组
+// 每次扫描比对已保存的最高区块哈希(同高度重组)和新区块的父哈希(父哈希不连续)，
+// 发现重组后向前查找分叉点，回滚分叉点之后已处理的转账并将扫描位置回退到分叉点之前
+// 仅用于 EVM 链；TRON 只结算已固化(solidified)的交易，不会被重组
+func (s *BlockchainService) detectReorg(listener *ChainListener, rpcClient *RPCClient, currentBlock uint64, batchSize int) bool {
+	// 保留确认数之外 reorgDepth 个区块的哈希，更深的重组无法检测
+	window := uint64(listener.confirmations + listener.reorgDepth)
+	var lowest uint64
+	if currentBlock > window {
+		lowest = currentBlock - window
+	}
+
+	// 从已保存的最高区块开始获取，包含最高区块本身用于同高度比对
+	from := lowest
+	var tip model.ChainBlock
+	if err := model.GetDB().Where("chain = ?", listener.chain).Order("number DESC").First(&tip).Error; err == nil && tip.Number > lowest {
+		from = tip.Number
+		if from > currentBlock {
+			from = currentBlock
+		}
+	}
+
+	numbers := make([]uint64, 0, currentBlock-from+1)
+	for n := from; n <= currentBlock; n++ {
+		numbers = append(numbers, n)
+	}
+	headers, err := s.fetchEVMHeaders(rpcClient, numbers, batchSize)
+	if err != nil {
+		log.Printf("[%s] Failed to fetch block headers for reorg detection: %v", listener.chain, err)
+		return false
+	}
+
+	var stored []model.ChainBlock
+	model.GetDB().Where("chain = ? AND number >= ?", listener.chain, from-1).Order("number ASC").Find(&stored)
+
+	// 找出最低的被孤立区块
+	var orphaned uint64
+	found := false
+	for _, block := range stored {
+		if block.Number == from-1 {
+			// 新区块的父哈希必须等于已保存的上一区块哈希
+			if header, ok := headers[from]; ok && header.ParentHash != block.Hash {
+				orphaned, found = block.Number, true
+				break
+			}
+			continue
+		}
+		if header, ok := headers[block.Number]; ok && header.Hash != block.Hash {
+			orphaned, found = block.Number, true
+			break
+		}
+	}
+
+	forkBlock := uint64(0)
+	if found {
+		forkBlock = s.findForkBlock(listener, rpcClient, orphaned, headers, batchSize)
+		s.handleReorg(listener, rpcClient, forkBlock)
+	}
+
+	// 保存当前链上的区块哈希，清理窗口之外的记录
+	blocks := make([]model.ChainBlock, 0, len(headers))
+	for _, header := range headers {
+		if found && header.Number < forkBlock {
+			continue
+		}
+		blocks = append(blocks, model.ChainBlock{
+			Chain:      listener.chain,
+			Number:     header.Number,
+			Hash:       header.Hash,
+			ParentHash: header.ParentHash,
+		})
+	}
+	if len(blocks) > 0 {
+		model.GetDB().Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain"}, {Name: "number"}},
+			DoUpdates: clause.AssignmentColumns([]string{"hash", "parent_hash"}),
+		}).CreateInBatches(blocks, 100)
+	}
+	model.GetDB().Where("chain = ? AND number < ?", listener.chain, lowest).Delete(&model.ChainBlock{})
+
+	return found
+}
+
+// findForkBlock 从最低的被孤立区块向前比对已保存的区块哈希，返回分叉点(第一个被孤立的区块)
+// 向前获取的链上区块头写入 headers，供调用方保存
+func (s *BlockchainService) findForkBlock(listener *ChainListener, rpcClient *RPCClient, orphaned uint64, headers map[uint64]blockHeader, batchSize int) uint64 {
+	forkBlock := orphaned
+	for {
+		var stored []model.ChainBlock
+		model.GetDB().Where("chain = ? AND number < ?", listener.chain, forkBlock).
+			Order("number DESC").Limit(20).Find(&stored)
+		if len(stored) == 0 {
+			return forkBlock
+		}
+
+		numbers := make([]uint64, 0, len(stored))
+		for _, block := range stored {
+			numbers = append(numbers, block.Number)
+		}
+		canonical, err := s.fetchEVMHeaders(rpcClient, numbers, batchSize)
+		if err != nil {
+			log.Printf("[%s] Failed to fetch block headers for fork search: %v", listener.chain, err)
+			return forkBlock
+		}
+
+		for _, block := range stored {
+			header, ok := canonical[block.Number]
+			if !ok {
+				return forkBlock
+			}
+			headers[header.Number] = header
+			if header.Hash == block.Hash {
+				return block.Number + 1
+			}
+			forkBlock = block.Number
+		}
+	}
+}
+
+// handleReorg 处理区块重组：删除被孤立的区块哈希，回滚孤立区块上的转账，回退扫描位置
+func (s *BlockchainService) handleReorg(listener *ChainListener, rpcClient *RPCClient, forkBlock uint64) {
+	log.Printf("[%s] Reorg detected at block %d", listener.chain, forkBlock)
+
+	model.GetDB().Where("chain = ? AND number >= ?", listener.chain, forkBlock).Delete(&model.ChainBlock{})
+
+	listener.mu.Lock()
+	if listener.lastBlock >= forkBlock {
+		listener.lastBlock = forkBlock - 1
+	}
+	listener.mu.Unlock()
+
+	var logs []model.TransactionLog
+	model.GetDB().Where("chain = ? AND block_number >= ?", listener.chain, forkBlock).Find(&logs)
+
+	var reports []string
+	for i := range logs {
+		txLog := &logs[i]
+		conf, err := s.getEVMTxConfirmation(rpcClient, txLog.TxHash, 0)
+		if err != nil {
+			log.Printf("[%s] Failed to check tx %s after reorg: %v", listener.chain, txLog.TxHash, err)
+			reports = append(reports, fmt.Sprintf("%s 状态查询失败，请人工核对", txLog.TxHash))
+			continue
+		}
+
+		// 交易被重新打包进新区块，更新所在区块即可
+		if conf.found && !conf.failed {
+			if conf.blockHash != txLog.BlockHash {
+				model.GetDB().Model(txLog).Updates(map[string]interface{}{
+					"block_number": conf.blockNumber,
+					"block_hash":   conf.blockHash,
+				})
+			}
+			continue
+		}
+
+		report, err := s.rollbackOrphanedTransfer(txLog)
+		if err != nil {
+			log.Printf("[%s] Failed to roll back orphaned tx %s: %v", listener.chain, txLog.TxHash, err)
+			reports = append(reports, fmt.Sprintf("%s 回滚失败: %v", txLog.TxHash, err))
+			continue
+		}
+		log.Printf("[%s] Orphaned tx %s rolled back: %s", listener.chain, txLog.TxHash, report)
+		reports = append(reports, report)
+	}
+
+	// 只有影响到已处理的转账时才告警，浅层重组很常见
+	if len(reports) > 0 {
+		GetBotService().NotifySystemEvent(fmt.Sprintf(
+			"⚠️ 区块重组 [%s]\n分叉区块: %d\n受影响交易 %d 笔:\n%s",
+			strings.ToUpper(listener.chain), forkBlock, len(reports), strings.Join(reports, "\n"),
+		))
+	}
+}
+
+// rollbackOrphanedTransfer 回滚被孤立区块上的转账
+// 订单扣除该笔到账金额并回退状态，已入账的订单冲正商户余额，交易日志删除(重新打包后可再次匹配)
+func (s *BlockchainService) rollbackOrphanedTransfer(txLog *model.TransactionLog) (string, error) {
+	var order model.Order
+	var report string
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PendingTransfer{}).Where("tx_hash = ?", txLog.TxHash).
+			Update("status", model.PendingTransferDropped).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.TransactionLog{}, txLog.ID).Error; err != nil {
+			return err
+		}
+
+		// 未匹配订单的转账只需删除日志
+		if !txLog.Matched || txLog.OrderID == nil {
+			report = fmt.Sprintf("%s 未匹配订单，已移出待处理队列", txLog.TxHash)
+			return nil
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, *txLog.OrderID).Error; err != nil {
+			return fmt.Errorf("order %d not found", *txLog.OrderID)
+		}
+
+		amount, _ := decimal.NewFromString(txLog.Amount)
+		remaining := order.ActualAmount.Sub(amount)
+		if remaining.IsNegative() {
+			remaining = decimal.Zero
+		}
+		status := model.OrderStatusPending
+		switch {
+		case remaining.IsPositive():
+			status = model.OrderStatusPartial
+		case order.ExpiredAt.Before(time.Now()):
+			status = model.OrderStatusExpired
+		}
+
+		updates := map[string]interface{}{
+			"status":                 status,
+			"actual_amount":          remaining,
+			"confirmations":          0,
+			"required_confirmations": 0,
+		}
+		if order.TxHash == txLog.TxHash {
+			updates["tx_hash"] = ""
+			updates["from_address"] = ""
+		}
+
+		settled := order.Status.IsPaid() || order.Status == model.OrderStatusRefunded
+		if settled {
+			updates["paid_at"] = nil
+			if err := s.reverseOrderSettlement(tx, &order, status, txLog.TxHash); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&model.Order{}).Where("id = ?", order.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		report = fmt.Sprintf("%s 订单 %s 金额 %s 已回滚", txLog.TxHash, order.TradeNo, txLog.Amount)
+		if settled {
+			report += fmt.Sprintf("，冲正入账 USD %s，退还手续费 USD %s",
+				unrefundedSettlement(&order).StringFixed(2), order.Fee.StringFixed(2))
+		}
+		if order.RefundedAmount.IsPositive() {
+			report += fmt.Sprintf("，订单已退款 USD %s 需人工处理", order.RefundedAmount.StringFixed(2))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if order.ID > 0 {
+		GetOrderService().InvalidateOrderCache(order.TradeNo)
+	}
+	return report, nil
+}
+
+// reverseOrderSettlement 冲正订单结算入账（SettleOrderBalance 的反向操作）
+// 商户余额可能已提现，冲正允许余额为负；订单回到待支付/部分支付时重新冻结预扣手续费
+// 已退款部分在退款时已从余额扣除，只冲正未退款的部分，退款本身需人工处理
+func (s *BlockchainService) reverseOrderSettlement(tx *gorm.DB, order *model.Order, newStatus model.OrderStatus, txHash string) error {
+	entries := []LedgerEntry{
+		{
+			Type:      model.LedgerTypeDebit,
+			Amount:    unrefundedSettlement(order),
+			RefType:   model.LedgerRefOrder,
+			RefID:     order.ID,
+			RefNo:     order.TradeNo,
+			Remark:    fmt.Sprintf("区块重组撤销订单入账 (%s)", txHash),
+			Overdraft: true,
+		},
+		{
+			Type:    model.LedgerTypeCredit,
+			Amount:  order.Fee,
+			RefType: model.LedgerRefOrder,
+			RefID:   order.ID,
+			RefNo:   order.TradeNo,
+			Remark:  "区块重组退还订单手续费",
+		},
+	}
+
+	if order.FeeType == model.FeeTypeBalance && feeFrozen(newStatus) {
+		entries = append(entries, LedgerEntry{
+			Type:      model.LedgerTypeFreeze,
+			Amount:    order.Fee,
+			RefType:   model.LedgerRefOrder,
+			RefID:     order.ID,
+			RefNo:     order.TradeNo,
+			Remark:    "区块重组重新冻结预扣手续费",
+			Overdraft: true,
+		})
+	}
+
+	_, err := GetLedgerService().Apply(tx, order.MerchantID, entries...)
+	return err
+}
+
+// unrefundedSettlement 订单结算金额中尚未退款的部分
+func unrefundedSettlement(order *model.Order) decimal.Decimal {
+	amount := order.SettlementAmount.Sub(order.RefundedAmount)
+	if amount.IsNegative() {
+		return decimal.Zero
+	}
+	return amount
+}
+
+// fetchEVMHeaders 批量获取区块头，节点尚未同步到的区块不返回
+// batchSize 为 1 时逐个请求(节点不支持批量请求)
+func (s *BlockchainService) fetchEVMHeaders(rpcClient *RPCClient, numbers []uint64, batchSize int) (map[uint64]blockHeader, error) {
+	headers := make(map[uint64]blockHeader, len(numbers))
+
+	err := s.fetchEVMBlocks(rpcClient, numbers, false, batchSize, 0, func(raw json.RawMessage) {
+		var block *struct {
+			Number     string `json:"number"`
+			Hash       string `json:"hash"`
+			ParentHash string `json:"parentHash"`
+		}
+		if err := json.Unmarshal(raw, &block); err != nil || block == nil || block.Hash == "" {
+			return
+		}
+		number := parseHexUint64(block.Number)
+		headers[number] = blockHeader{
+			Number:     number,
+			Hash:       strings.ToLower(block.Hash),
+			ParentHash: strings.ToLower(block.ParentHash),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// fetchEVMBlocks 批量调用 eth_getBlockByNumber，fullTx 为 true 时返回完整交易
+// batchSize <= 1 时逐个请求(部分公共节点不支持批量)，每个区块的结果交给 parse 处理
+func (s *BlockchainService) fetchEVMBlocks(rpcClient *RPCClient, numbers []uint64, fullTx bool, batchSize int, delay time.Duration, parse func(json.RawMessage)) error {
+	requests := make([]BatchRequest, 0, len(numbers))
+	for i, number := range numbers {
+		requests = append(requests, BatchRequest{
+			JSONRPC: "2.0",
+			Method:  "eth_getBlockByNumber",
+			Params:  []interface{}{fmt.Sprintf("0x%x", number), fullTx},
+			ID:      i + 1,
+		})
+	}
+
+	if batchSize <= 1 {
+		for i, req := range requests {
+			body, err := rpcClient.PostJSON("", req)
+			if err != nil {
+				return err
+			}
+			var resp BatchResponse
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return err
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("rpc error: %s", resp.Error.Message)
+			}
+			parse(resp.Result)
+			if delay > 0 && i < len(requests)-1 {
+				time.Sleep(delay)
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < len(requests); i += batchSize {
+		end := i + batchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+		responses, err := rpcClient.BatchPostJSON("", requests[i:end])
+		if err != nil {
+			return err
+		}
+		for _, resp := range responses {
+			if resp.Error != nil {
+				return fmt.Errorf("rpc error: %s", resp.Error.Message)
+			}
+			parse(resp.Result)
+		}
+		if delay > 0 && end < len(requests) {
+			time.Sleep(delay)
+		}
+	}
+	return nil
+}
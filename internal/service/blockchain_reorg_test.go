@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestRollbackOrphanedTransferRefundedOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    model.OrderStatus
+		refunded  int64
+		wantDebit string
+	}{
+		{name: "paid order", status: model.OrderStatusPaid, wantDebit: "100"},
+		{name: "partially refunded order", status: model.OrderStatusPaid, refunded: 30, wantDebit: "70"},
+		{name: "fully refunded order", status: model.OrderStatusRefunded, refunded: 100, wantDebit: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			// 结算 100 扣手续费 2，退款已从余额扣除
+			merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: float64(98 - tt.refunded)}
+			db.Create(&merchant)
+			order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+				Money: decimal.NewFromInt(100), SettlementAmount: decimal.NewFromInt(100), Fee: decimal.NewFromInt(2),
+				FeeType: model.FeeTypeBalance, RefundedAmount: decimal.NewFromInt(tt.refunded), ActualAmount: decimal.NewFromInt(100),
+				TxHash: "0xabc", Status: tt.status, ExpiredAt: time.Now().Add(-time.Hour)}
+			if err := db.Create(&order).Error; err != nil {
+				t.Fatalf("create order: %v", err)
+			}
+			txLog := model.TransactionLog{Chain: "trc20", TxHash: "0xabc", Amount: "100", Matched: true, OrderID: &order.ID}
+			db.Create(&txLog)
+
+			if _, err := (&BlockchainService{}).rollbackOrphanedTransfer(&txLog); err != nil {
+				t.Fatalf("rollbackOrphanedTransfer: %v", err)
+			}
+
+			// 冲正后余额回到结算前，已退款部分不重复扣除
+			var got model.Merchant
+			db.First(&got, merchant.ID)
+			if got.Balance != 0 {
+				t.Errorf("merchant balance = %.2f, want 0", got.Balance)
+			}
+			var debit model.BalanceLedger
+			err := db.Where("merchant_id = ? AND type = ?", merchant.ID, model.LedgerTypeDebit).First(&debit).Error
+			if tt.wantDebit == "0" {
+				if err == nil {
+					t.Errorf("unexpected reversal debit of %s", debit.Amount)
+				}
+			} else if err != nil || !debit.Amount.Equal(decimal.RequireFromString(tt.wantDebit)) {
+				t.Errorf("reversal debit = %s (%v), want %s", debit.Amount, err, tt.wantDebit)
+			}
+			var reverted model.Order
+			db.First(&reverted, order.ID)
+			if reverted.Status != model.OrderStatusExpired || reverted.PaidAt != nil {
+				t.Errorf("order status = %d paid_at = %v, want expired and unpaid", reverted.Status, reverted.PaidAt)
+			}
+		})
+	}
+}
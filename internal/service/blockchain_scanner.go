@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,193 +20,226 @@ func (s *BlockchainService) scanTRXImproved(listener *ChainListener, addresses m
 	var transfers []Transfer
 	rpcClient := s.rpcClients[listener.chain]
 
-	for addr := range addresses {
-		// 标准化地址（确保是 base58 格式）
-		addr = normalizeAddress(addr, listener.chain)
+	for _, unconfirmed := range s.tronScanModes(listener.chain) {
+		for addr := range addresses {
+			// 标准化地址（确保是 base58 格式）
+			addr = normalizeAddress(addr, listener.chain)
 
-		path := fmt.Sprintf("/v1/accounts/%s/transactions?only_confirmed=true&limit=50", addr)
+			path := fmt.Sprintf("/v1/accounts/%s/transactions?%s&limit=50", addr, tronConfirmFilter(unconfirmed))
 
-		// 使用支持重试的 RPC 客户端
-		resp, err := rpcClient.Get(path)
-		if err != nil {
-			log.Printf("[trx] Failed to get transactions for %s: %v", addr, err)
-			s.metrics.RecordRPCCall("trx", false, 0)
-			continue
+			// 使用支持重试的 RPC 客户端
+			resp, err := rpcClient.Get(path)
+			if err != nil {
+				log.Printf("[%s] Failed to get transactions for %s: %v", listener.chain, addr, err)
+				s.metrics.RecordRPCCall(listener.chain, false, 0)
+				continue
+			}
+
+			s.metrics.RecordRPCCall(listener.chain, true, 0)
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				log.Printf("[%s] Failed to read response for %s: %v", listener.chain, addr, err)
+				continue
+			}
+
+			parsed, err := listener.scanner.ParseTransfers(listener, body, ScanWindow{Addresses: addresses, Unconfirmed: unconfirmed})
+			if err != nil {
+				log.Printf("[%s] Failed to unmarshal response for %s: %v", listener.chain, addr, err)
+				continue
+			}
+			transfers = append(transfers, parsed...)
 		}
+	}
+
+	return transfers, nil
+}
 
-		s.metrics.RecordRPCCall("trx", true, 0)
+// ParseTransfers 解析 TronGrid 账户交易列表中的 TRX 转账
+func (t *tronScanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var result struct {
+		Data []struct {
+			TxID        string `json:"txID"`
+			BlockNumber int64  `json:"blockNumber"`
+			RawData     struct {
+				Contract []struct {
+					Type      string `json:"type"`
+					Parameter struct {
+						Value struct {
+							Amount       int64  `json:"amount"`
+							OwnerAddress string `json:"owner_address"`
+							ToAddress    string `json:"to_address"`
+						} `json:"value"`
+					} `json:"parameter"`
+				} `json:"contract"`
+			} `json:"raw_data"`
+			Ret []struct {
+				ContractRet string `json:"contractRet"`
+			} `json:"ret"`
+		} `json:"data"`
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			log.Printf("[trx] Failed to read response for %s: %v", addr, err)
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+
+	var transfers []Transfer
+	for _, tx := range result.Data {
+		// 检查交易是否成功
+		if len(tx.Ret) == 0 || tx.Ret[0].ContractRet != "SUCCESS" {
 			continue
 		}
 
-		var result struct {
-			Data []struct {
-				TxID        string `json:"txID"`
-				BlockNumber int64  `json:"blockNumber"`
-				RawData     struct {
-					Contract []struct {
-						Type      string `json:"type"`
-						Parameter struct {
-							Value struct {
-								Amount       int64  `json:"amount"`
-								OwnerAddress string `json:"owner_address"`
-								ToAddress    string `json:"to_address"`
-							} `json:"value"`
-						} `json:"parameter"`
-					} `json:"contract"`
-				} `json:"raw_data"`
-				Ret []struct {
-					ContractRet string `json:"contractRet"`
-				} `json:"ret"`
-			} `json:"data"`
+		// 检查是否是TRX转账
+		if len(tx.RawData.Contract) == 0 {
+			continue
 		}
 
-		if err := json.Unmarshal(body, &result); err != nil {
-			log.Printf("[trx] Failed to unmarshal response for %s: %v", addr, err)
+		contract := tx.RawData.Contract[0]
+		if contract.Type != "TransferContract" {
 			continue
 		}
 
-		for _, tx := range result.Data {
-			// 检查交易是否成功
-			if len(tx.Ret) == 0 || tx.Ret[0].ContractRet != "SUCCESS" {
-				continue
-			}
-
-			// 检查是否是TRX转账
-			if len(tx.RawData.Contract) == 0 {
-				continue
-			}
-
-			contract := tx.RawData.Contract[0]
-			if contract.Type != "TransferContract" {
-				continue
-			}
-
-			// 转换地址格式（使用改进的 hexToBase58）
-			toAddr := contract.Parameter.Value.ToAddress
-			if strings.HasPrefix(toAddr, "41") {
-				toAddr = hexToBase58(toAddr)
-			}
-			toAddr = strings.ToLower(toAddr)
+		// 转换地址格式（使用改进的 hexToBase58）
+		toAddr := contract.Parameter.Value.ToAddress
+		if strings.HasPrefix(toAddr, "41") {
+			toAddr = hexToBase58(toAddr)
+		}
+		toAddr = strings.ToLower(toAddr)
 
-			// 检查是否是转入交易
-			if !addresses[toAddr] {
-				continue
-			}
+		// 检查是否是转入交易
+		if !window.Addresses[toAddr] {
+			continue
+		}
 
-			// 检查是否已处理（记录重复）
-			var count int64
-			model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.TxID).Count(&count)
-			if count > 0 {
-				s.metrics.RecordDuplicateTx("trx")
-				continue
-			}
+		// 检查是否已处理（记录重复）
+		var count int64
+		model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.TxID).Count(&count)
+		if count > 0 {
+			t.s.metrics.RecordDuplicateTx(listener.chain)
+			continue
+		}
 
-			// TRX精度是6位 (1 TRX = 1,000,000 sun)
-			amount := decimal.NewFromInt(contract.Parameter.Value.Amount).Div(decimal.NewFromInt(1000000))
+		// TRX精度是6位 (1 TRX = 1,000,000 sun)
+		amount := decimal.NewFromInt(contract.Parameter.Value.Amount).Div(decimal.NewFromInt(1000000))
 
-			fromAddr := contract.Parameter.Value.OwnerAddress
-			if strings.HasPrefix(fromAddr, "41") {
-				fromAddr = hexToBase58(fromAddr)
-			}
-			fromAddr = strings.ToLower(fromAddr)
-
-			transfers = append(transfers, Transfer{
-				TxHash:      tx.TxID,
-				From:        fromAddr,
-				To:          toAddr,
-				Amount:      amount,
-				BlockNumber: uint64(tx.BlockNumber),
-				Chain:       "trx",
-			})
+		fromAddr := contract.Parameter.Value.OwnerAddress
+		if strings.HasPrefix(fromAddr, "41") {
+			fromAddr = hexToBase58(fromAddr)
 		}
+		fromAddr = strings.ToLower(fromAddr)
+
+		transfers = append(transfers, Transfer{
+			TxHash:      tx.TxID,
+			From:        fromAddr,
+			To:          toAddr,
+			Amount:      amount,
+			Token:       model.NativeToken(listener.chain),
+			BlockNumber: uint64(tx.BlockNumber),
+			Chain:       listener.chain,
+			Unconfirmed: window.Unconfirmed,
+		})
 	}
-
 	return transfers, nil
 }
 
 // scanTRC20Improved 改进的 TRC20 扫描
+// 按代币登记表中启用的合约逐个查询，金额精度以登记的 Decimals 为准
 func (s *BlockchainService) scanTRC20Improved(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
 	var transfers []Transfer
 	rpcClient := s.rpcClients[listener.chain]
 
-	for addr := range addresses {
-		addr = normalizeAddress(addr, listener.chain)
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		for _, unconfirmed := range s.tronScanModes(listener.chain) {
+			for addr := range addresses {
+				addr = normalizeAddress(addr, listener.chain)
 
-		path := fmt.Sprintf("/v1/accounts/%s/transactions/trc20?only_confirmed=true&limit=50&contract_address=%s",
-			addr, listener.contractAddress)
+				path := fmt.Sprintf("/v1/accounts/%s/transactions/trc20?%s&limit=50&contract_address=%s",
+					addr, tronConfirmFilter(unconfirmed), token.Contract)
 
-		resp, err := rpcClient.Get(path)
-		if err != nil {
-			log.Printf("[trc20] Failed to get transactions for %s: %v", addr, err)
-			s.metrics.RecordRPCCall("trc20", false, 0)
-			continue
-		}
+				resp, err := rpcClient.Get(path)
+				if err != nil {
+					log.Printf("[%s] Failed to get %s transactions for %s: %v", listener.chain, token.Symbol, addr, err)
+					s.metrics.RecordRPCCall(listener.chain, false, 0)
+					continue
+				}
 
-		s.metrics.RecordRPCCall("trc20", true, 0)
+				s.metrics.RecordRPCCall(listener.chain, true, 0)
 
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			log.Printf("[trc20] Failed to read response for %s: %v", addr, err)
-			continue
-		}
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					log.Printf("[%s] Failed to read response for %s: %v", listener.chain, addr, err)
+					continue
+				}
 
-		var result struct {
-			Data []struct {
-				TransactionID  string `json:"transaction_id"`
-				From           string `json:"from"`
-				To             string `json:"to"`
-				Value          string `json:"value"`
-				BlockTimestamp int64  `json:"block_timestamp"`
-			} `json:"data"`
+				parsed, err := listener.scanner.ParseTransfers(listener, body,
+					ScanWindow{Addresses: addresses, Token: &token, Unconfirmed: unconfirmed})
+				if err != nil {
+					log.Printf("[%s] Failed to unmarshal response for %s: %v", listener.chain, addr, err)
+					continue
+				}
+				transfers = append(transfers, parsed...)
+			}
 		}
+	}
 
-		if err := json.Unmarshal(body, &result); err != nil {
-			log.Printf("[trc20] Failed to unmarshal response for %s: %v", addr, err)
-			continue
-		}
+	return transfers, nil
+}
 
-		for _, tx := range result.Data {
-			// 标准化地址
-			toAddr := strings.ToLower(tx.To)
+// ParseTransfers 解析 TronGrid TRC20 转账列表，金额精度以查询的代币为准
+func (t *trc20Scanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var result struct {
+		Data []struct {
+			TransactionID  string `json:"transaction_id"`
+			From           string `json:"from"`
+			To             string `json:"to"`
+			Value          string `json:"value"`
+			BlockTimestamp int64  `json:"block_timestamp"`
+		} `json:"data"`
+	}
 
-			// 检查是否是转入交易
-			if !addresses[toAddr] {
-				continue
-			}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if window.Token == nil {
+		return nil, fmt.Errorf("token is required")
+	}
 
-			// 检查是否已处理
-			var count int64
-			model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.TransactionID).Count(&count)
-			if count > 0 {
-				s.metrics.RecordDuplicateTx("trc20")
-				continue
-			}
+	var transfers []Transfer
+	for _, tx := range result.Data {
+		// 标准化地址
+		toAddr := strings.ToLower(tx.To)
 
-			// USDT TRC20 精度是6位
-			amount := parseTokenAmount(tx.Value, 6)
+		// 检查是否是转入交易
+		if !window.Addresses[toAddr] {
+			continue
+		}
 
-			transfers = append(transfers, Transfer{
-				TxHash: tx.TransactionID,
-				From:   tx.From,
-				To:     toAddr,
-				Amount: amount,
-				Chain:  "trc20",
-			})
+		// 检查是否已处理
+		var count int64
+		model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.TransactionID).Count(&count)
+		if count > 0 {
+			t.s.metrics.RecordDuplicateTx(listener.chain)
+			continue
 		}
-	}
 
+		transfers = append(transfers, Transfer{
+			TxHash:      tx.TransactionID,
+			From:        tx.From,
+			To:          toAddr,
+			Amount:      parseTokenAmount(tx.Value, window.Token.Decimals),
+			Token:       window.Token.Symbol,
+			Chain:       listener.chain,
+			Unconfirmed: window.Unconfirmed,
+		})
+	}
 	return transfers, nil
 }
 
 // scanEVMImproved 改进的 EVM 扫描（支持重组检测）
 func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
-	var transfers []Transfer
 	rpcClient := s.rpcClients[listener.chain]
 
 	// 获取最新区块号
@@ -213,9 +248,11 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 		return nil, fmt.Errorf("failed to get block number: %w", err)
 	}
 
+	maxBlockRange, maxBatchSize, batchDelay := evmScanParams(listener)
+
 	// 检测区块重组
-	if s.detectReorg(listener, currentBlock) {
-		log.Printf("[%s] Reorg detected, rescanning from block %d", listener.chain, listener.lastBlock)
+	if s.detectReorg(listener, rpcClient, currentBlock, maxBatchSize) {
+		log.Printf("[%s] Reorg detected, rescanning from block %d", listener.chain, listener.lastBlock+1)
 	}
 
 	// 更新区块高度指标
@@ -227,11 +264,64 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 		listener.lastBlock = safeBlock - 100 // 首次启动，扫描最近100个区块
 	}
 
+	// 有原生币订单时需要逐块查询交易，缩小单次查询范围
+	scanNative := s.hasNativeCandidates(listener.chain)
+	if scanNative && maxBlockRange > nativeMaxBlockRange {
+		maxBlockRange = nativeMaxBlockRange
+	}
+
+	// 有待支付订单时同时查询尚未达到确认数的区块，用于跟踪确认进度
+	trackUnconfirmed := s.hasConfirmingCandidates(listener.chain)
+	if listener.lastBlock >= safeBlock && !trackUnconfirmed {
+		return nil, nil
+	}
+
+	queryToBlock := safeBlock
 	if listener.lastBlock >= safeBlock {
+		queryToBlock = listener.lastBlock
+	} else if queryToBlock-listener.lastBlock > maxBlockRange {
+		queryToBlock = listener.lastBlock + maxBlockRange
+		log.Printf("[%s] 区块范围过大，限制本次查询: %d -> %d (剩余 %d 块待追赶)",
+			listener.chain, listener.lastBlock+1, queryToBlock, safeBlock-queryToBlock)
+	}
+
+	// 已追上安全区块时查询到最新区块，安全区块之后的转账只跟踪不结算
+	logsToBlock := queryToBlock
+	if trackUnconfirmed && queryToBlock == safeBlock {
+		logsToBlock = currentBlock
+	}
+	if logsToBlock <= listener.lastBlock {
 		return nil, nil
 	}
 
-	// 从配置读取查询参数，未配置则使用链类型默认值
+	window := ScanWindow{Addresses: addresses, ConfirmedTo: queryToBlock, CurrentBlock: currentBlock}
+	transfers, err := s.fetchEVMTransferLogs(listener, rpcClient, listener.lastBlock+1, logsToBlock, window, maxBatchSize, batchDelay)
+	if err != nil {
+		return nil, err
+	}
+
+	// 原生币转账
+	if scanNative {
+		// 未确认区块较多时(如 Polygon 需 128 确认)只跟踪最近的一段，其余区块确认后再扫描
+		nativeToBlock := logsToBlock
+		if nativeToBlock-listener.lastBlock > nativeMaxBlockRange {
+			nativeToBlock = listener.lastBlock + nativeMaxBlockRange
+		}
+		nativeTransfers, err := s.scanEVMNative(listener, rpcClient, addresses,
+			listener.lastBlock+1, nativeToBlock, queryToBlock, currentBlock, maxBatchSize, batchDelay)
+		if err != nil {
+			log.Printf("[%s] Native scan failed: %v", listener.chain, err)
+			return nil, err
+		}
+		transfers = append(transfers, nativeTransfers...)
+	}
+
+	listener.lastBlock = queryToBlock
+	return transfers, nil
+}
+
+// evmScanParams 从配置读取查询参数，未配置则使用链类型默认值
+func evmScanParams(listener *ChainListener) (uint64, int, time.Duration) {
 	var defaultBlockRange, defaultBatchSize, defaultDelayMs int
 	switch listener.chain {
 	case "polygon":
@@ -256,22 +346,32 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 	if listener.batchDelayMs > 0 {
 		batchDelay = time.Duration(listener.batchDelayMs) * time.Millisecond
 	}
+	return maxBlockRange, maxBatchSize, batchDelay
+}
 
-	queryToBlock := safeBlock
-	if queryToBlock-listener.lastBlock > maxBlockRange {
-		queryToBlock = listener.lastBlock + maxBlockRange
-		log.Printf("[%s] 区块范围过大，限制本次查询: %d -> %d (剩余 %d 块待追赶)",
-			listener.chain, listener.lastBlock+1, queryToBlock, safeBlock-queryToBlock)
-	}
+// fetchEVMTransferLogs 查询 fromBlock~toBlock 内发往收款地址的代币 Transfer 日志
+func (s *BlockchainService) fetchEVMTransferLogs(listener *ChainListener, rpcClient *RPCClient,
+	fromBlock, toBlock uint64, window ScanWindow, maxBatchSize int, batchDelay time.Duration) ([]Transfer, error) {
+	var transfers []Transfer
 
 	// Transfer事件签名
 	transferTopic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
 
+	// 一次查询所有启用代币合约的转账日志，按日志的合约地址区分代币
+	tokens := GetTokenService().EnabledTokens(listener.chain)
+	contracts := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		contracts = append(contracts, token.Contract)
+	}
+
 	// 批量查询优化：收集所有地址的查询
 	var batchRequests []BatchRequest
 	requestID := 1
 
-	for addr := range addresses {
+	for addr := range window.Addresses {
+		if len(contracts) == 0 {
+			break
+		}
 		// 填充地址到32字节
 		paddedAddr := fmt.Sprintf("0x%064s", strings.TrimPrefix(strings.ToLower(addr), "0x"))
 		paddedAddr = strings.Replace(paddedAddr, " ", "0", -1)
@@ -281,9 +381,9 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 			Method:  "eth_getLogs",
 			Params: []interface{}{
 				map[string]interface{}{
-					"fromBlock": fmt.Sprintf("0x%x", listener.lastBlock+1),
-					"toBlock":   fmt.Sprintf("0x%x", queryToBlock),
-					"address":   listener.contractAddress,
+					"fromBlock": fmt.Sprintf("0x%x", fromBlock),
+					"toBlock":   fmt.Sprintf("0x%x", toBlock),
+					"address":   contracts,
 					"topics": []interface{}{
 						transferTopic,
 						nil,
@@ -298,47 +398,12 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 
 	// 解析日志响应的公共函数
 	parseLogResults := func(resultData json.RawMessage) {
-		var logs []struct {
-			TransactionHash string   `json:"transactionHash"`
-			Topics          []string `json:"topics"`
-			Data            string   `json:"data"`
-			BlockNumber     string   `json:"blockNumber"`
-		}
-
-		if err := json.Unmarshal(resultData, &logs); err != nil {
+		parsed, err := listener.scanner.ParseTransfers(listener, resultData, window)
+		if err != nil {
 			log.Printf("[%s] Failed to unmarshal logs: %v", listener.chain, err)
 			return
 		}
-
-		for _, logEntry := range logs {
-			// 解析from地址
-			from := "0x" + logEntry.Topics[1][26:]
-
-			// 解析to地址
-			to := "0x" + logEntry.Topics[2][26:]
-
-			// 解析金额
-			amount := parseHexAmount(logEntry.Data, 6) // USDT精度是6位
-
-			// 检查是否已处理
-			var count int64
-			model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", logEntry.TransactionHash).Count(&count)
-			if count > 0 {
-				s.metrics.RecordDuplicateTx(listener.chain)
-				continue
-			}
-
-			blockNum := parseHexUint64(logEntry.BlockNumber)
-
-			transfers = append(transfers, Transfer{
-				TxHash:      logEntry.TransactionHash,
-				From:        from,
-				To:          to,
-				Amount:      amount,
-				BlockNumber: blockNum,
-				Chain:       listener.chain,
-			})
-		}
+		transfers = append(transfers, parsed...)
 	}
 
 	// 发送请求
@@ -408,7 +473,72 @@ func (s *BlockchainService) scanEVMImproved(listener *ChainListener, addresses m
 		}
 	}
 
-	listener.lastBlock = queryToBlock
+	return transfers, nil
+}
+
+// ParseTransfers 解析 eth_getLogs 返回的 ERC20 Transfer 日志，按日志的合约地址确定代币
+func (e *evmScanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var logs []struct {
+		Address         string   `json:"address"`
+		TransactionHash string   `json:"transactionHash"`
+		Topics          []string `json:"topics"`
+		Data            string   `json:"data"`
+		BlockNumber     string   `json:"blockNumber"`
+		BlockHash       string   `json:"blockHash"`
+	}
+
+	if err := json.Unmarshal(raw, &logs); err != nil {
+		return nil, err
+	}
+
+	var transfers []Transfer
+	for _, logEntry := range logs {
+		if len(logEntry.Topics) < 3 {
+			continue
+		}
+
+		// 解析from地址
+		from := "0x" + logEntry.Topics[1][26:]
+
+		// 解析to地址
+		to := "0x" + logEntry.Topics[2][26:]
+		if !window.Addresses[strings.ToLower(to)] {
+			continue
+		}
+
+		// 按合约确定代币及精度
+		token, ok := GetTokenService().GetTokenByContract(listener.chain, logEntry.Address)
+		if !ok {
+			continue
+		}
+		amount := parseHexAmount(logEntry.Data, token.Decimals)
+
+		// 检查是否已处理
+		var count int64
+		model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", logEntry.TransactionHash).Count(&count)
+		if count > 0 {
+			e.s.metrics.RecordDuplicateTx(listener.chain)
+			continue
+		}
+
+		blockNum := parseHexUint64(logEntry.BlockNumber)
+
+		transfer := Transfer{
+			TxHash:      logEntry.TransactionHash,
+			From:        from,
+			To:          to,
+			Amount:      amount,
+			Token:       token.Symbol,
+			BlockNumber: blockNum,
+			BlockHash:   logEntry.BlockHash,
+			Chain:       listener.chain,
+		}
+		if blockNum > window.ConfirmedTo {
+			transfer.Unconfirmed = true
+			transfer.Confirmations = int(window.CurrentBlock - blockNum)
+		}
+		transfers = append(transfers, transfer)
+	}
 	return transfers, nil
 }
 
@@ -436,3 +566,144 @@ func (s *BlockchainService) getEVMBlockNumberWithRetry(rpcClient *RPCClient) (ui
 
 	return parseHexUint64(result.Result), nil
 }
+
+// tronScanModes TRON 扫描轮次：已确认交易，有待支付订单时再查询未确认交易
+func (s *BlockchainService) tronScanModes(chain string) []bool {
+	if s.hasConfirmingCandidates(chain) {
+		return []bool{false, true}
+	}
+	return []bool{false}
+}
+
+// tronConfirmFilter TronGrid 确认状态过滤参数
+func tronConfirmFilter(unconfirmed bool) string {
+	if unconfirmed {
+		return "only_unconfirmed=true"
+	}
+	return "only_confirmed=true"
+}
+
+const (
+	// tronRescanWindow TRON 补扫每段的时间跨度(秒)
+	tronRescanWindow = 6 * 3600
+	// tronRescanPageSize TronGrid 补扫每页数量(接口上限 200)
+	tronRescanPageSize = 200
+	// tronRescanMaxPages 补扫单个地址每段最多翻页数
+	tronRescanMaxPages = 50
+)
+
+func (t *tronScanner) RescanUnit() string {
+	return RescanUnitTime
+}
+
+// RescanChunk 按时间补扫一段 TRX 转账
+func (t *tronScanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	end := min(to, from+tronRescanWindow-1)
+	transfers, err := t.s.rescanTron(listener, addresses, nil, from, end)
+	if err != nil {
+		return nil, 0, err
+	}
+	return transfers, end, nil
+}
+
+// RescanChunk 按时间补扫一段 TRC20 转账，按代币登记表中启用的合约逐个查询
+func (t *trc20Scanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	end := min(to, from+tronRescanWindow-1)
+	var transfers []Transfer
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		parsed, err := t.s.rescanTron(listener, addresses, &token, from, end)
+		if err != nil {
+			return nil, 0, err
+		}
+		transfers = append(transfers, parsed...)
+	}
+	return transfers, end, nil
+}
+
+// rescanTron 查询收款地址在 from~to(Unix 秒)内的已确认转入交易，token 为空时查询 TRX 转账
+// TronGrid 按 fingerprint 翻页；地址使用登记时的格式(Base58 区分大小写)
+func (s *BlockchainService) rescanTron(listener *ChainListener, addresses map[string]bool, token *model.Token, from, to uint64) ([]Transfer, error) {
+	rpcClient := s.rpcClients[listener.chain]
+
+	var transfers []Transfer
+	for _, addr := range s.walletCache.GetOriginalAddresses(listener.chain) {
+		path := "/v1/accounts/" + url.PathEscape(strings.TrimSpace(addr)) + "/transactions"
+		query := url.Values{}
+		query.Set("only_confirmed", "true")
+		query.Set("only_to", "true")
+		query.Set("order_by", "block_timestamp,asc")
+		query.Set("min_timestamp", strconv.FormatUint(from*1000, 10))
+		query.Set("max_timestamp", strconv.FormatUint(to*1000+999, 10))
+		query.Set("limit", strconv.Itoa(tronRescanPageSize))
+		if token != nil {
+			path += "/trc20"
+			query.Set("contract_address", token.Contract)
+		}
+
+		for page := 0; ; page++ {
+			if page == tronRescanMaxPages {
+				return nil, fmt.Errorf("too many transactions for %s, narrow the time range", addr)
+			}
+
+			resp, err := rpcClient.Get(path + "?" + query.Encode())
+			if err != nil {
+				s.metrics.RecordRPCCall(listener.chain, false, 0)
+				return nil, fmt.Errorf("failed to get transactions for %s: %w", addr, err)
+			}
+			s.metrics.RecordRPCCall(listener.chain, true, 0)
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read response for %s: %w", addr, err)
+			}
+
+			parsed, err := listener.scanner.ParseTransfers(listener, body, ScanWindow{Addresses: addresses, Token: token})
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse transactions for %s: %w", addr, err)
+			}
+			transfers = append(transfers, parsed...)
+
+			var meta struct {
+				Meta struct {
+					Fingerprint string `json:"fingerprint"`
+				} `json:"meta"`
+			}
+			if json.Unmarshal(body, &meta) != nil || meta.Meta.Fingerprint == "" {
+				break
+			}
+			query.Set("fingerprint", meta.Meta.Fingerprint)
+		}
+	}
+	return transfers, nil
+}
+
+func (e *evmScanner) RescanUnit() string {
+	return RescanUnitBlock
+}
+
+// RescanChunk 补扫一段区块的代币 Transfer 日志，有原生币订单时同时逐块扫描原生币转账
+// 补扫范围不超过已达到确认数的区块，转账都按已确认处理
+func (e *evmScanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	rpcClient := e.s.rpcClients[listener.chain]
+	maxBlockRange, maxBatchSize, batchDelay := evmScanParams(listener)
+	scanNative := e.s.hasNativeCandidates(listener.chain)
+	if scanNative && maxBlockRange > nativeMaxBlockRange {
+		maxBlockRange = nativeMaxBlockRange
+	}
+	end := min(to, from+maxBlockRange-1)
+
+	window := ScanWindow{Addresses: addresses, ConfirmedTo: end, CurrentBlock: end}
+	transfers, err := e.s.fetchEVMTransferLogs(listener, rpcClient, from, end, window, maxBatchSize, batchDelay)
+	if err != nil {
+		return nil, 0, err
+	}
+	if scanNative {
+		nativeTransfers, err := e.s.scanEVMNative(listener, rpcClient, addresses, from, end, end, end, maxBatchSize, batchDelay)
+		if err != nil {
+			return nil, 0, err
+		}
+		transfers = append(transfers, nativeTransfers...)
+	}
+	return transfers, end, nil
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// errOrderAlreadyProcessed 订单已被其他进程处理
+var errOrderAlreadyProcessed = errors.New("订单已被处理")
+
+// errTransferAlreadyMatched 交易日志已被其他请求指派
+var errTransferAlreadyMatched = errors.New("该交易已匹配订单")
+
+// applyTransferMatch 将转账结算到匹配的订单
+// 交易日志写入/关联、订单状态更新、商户入账(含预冻结手续费解冻)、回调任务与通知消息写入在同一事务中完成，
+// 事务提交后才由投递协程发送回调和 Telegram 通知；任一步失败整体回滚
+// txLog.ID 为 0 时在事务中创建交易日志(自动匹配)，否则更新已有日志(手动指派)
+// match.tracked 非空时订单处于确认中，order.Status 为检测前状态
+// actor: 操作者，自动匹配为 system，手动指派为 admin:xxx
+func (s *BlockchainService) applyTransferMatch(txLog *model.TransactionLog, match *paymentMatch, actor string) error {
+	order := match.order
+	prevStatus := order.Status
+	now := time.Now()
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"status":         match.newStatus,
+			"tx_hash":        txLog.TxHash,
+			"from_address":   txLog.FromAddress,
+			"actual_amount":  match.total,
+			"transfer_count": gorm.Expr("transfer_count + 1"),
+		}
+		if match.newStatus.IsPaid() {
+			updates["paid_at"] = &now
+		}
+
+		// 结算时确认数已达到要求，确认中订单记录跟踪到的实际确认数
+		required := s.GetConfirmations(order.Chain)
+		confirmations := required
+		if match.tracked != nil && match.tracked.Confirmations > confirmations {
+			confirmations = match.tracked.Confirmations
+		}
+		updates["confirmations"] = confirmations
+		updates["required_confirmations"] = required
+
+		// 使用 WHERE 条件确保只更新未被其他进程处理的订单（乐观锁）
+		// 确认中订单由检测时锁定，只能由对应的未确认转账结算
+		query := tx.Model(order)
+		if match.tracked != nil {
+			query = query.Where("status IN ?", model.ConfirmingOrderStatuses)
+		} else {
+			query = query.Where("status = ?", prevStatus)
+			if prevStatus == model.OrderStatusPartial {
+				query = query.Where("actual_amount = ?", order.ActualAmount)
+			}
+		}
+		result := query.Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderAlreadyProcessed
+		}
+		if match.tracked != nil {
+			if err := tx.Model(match.tracked).Updates(map[string]interface{}{
+				"status":        model.PendingTransferConfirmed,
+				"confirmations": confirmations,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		// 写入/关联交易日志
+		orderID := order.ID
+		txLog.Matched = true
+		txLog.OrderID = &orderID
+		txLog.MatchNote = match.note
+		if actor != model.LedgerActorSystem {
+			txLog.AssignedBy = actor
+			txLog.AssignedAt = &now
+		}
+		if txLog.ID == 0 {
+			if err := tx.Create(txLog).Error; err != nil {
+				return err
+			}
+		} else {
+			logUpdates := map[string]interface{}{
+				"matched":    true,
+				"order_id":   order.ID,
+				"match_note": match.note,
+			}
+			if actor != model.LedgerActorSystem {
+				logUpdates["assigned_by"] = actor
+				logUpdates["assigned_at"] = &now
+			}
+			// 只更新仍未匹配的日志，避免同一笔转账被并发指派给多个订单
+			result := tx.Model(txLog).Where("matched = ?", false).Updates(logUpdates)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errTransferAlreadyMatched
+			}
+		}
+
+		// Webhook 事件 - 检测到付款
+		snapshot := *order
+		snapshot.Status = match.newStatus
+		snapshot.TxHash = txLog.TxHash
+		snapshot.FromAddress = txLog.FromAddress
+		snapshot.ActualAmount = match.total
+		if match.newStatus.IsPaid() {
+			snapshot.PaidAt = &now
+		}
+		amount, _ := decimal.NewFromString(txLog.Amount)
+		GetNotifyService().EmitOrderEvent(tx, &snapshot, model.WebhookEventOrderDetected, WebhookOrderData{
+			Transfer: &WebhookTransfer{
+				TxHash:      txLog.TxHash,
+				FromAddress: txLog.FromAddress,
+				Amount:      amount,
+				Received:    match.total,
+			},
+		})
+
+		if !match.newStatus.IsPaid() {
+			// 部分支付，等待后续补款
+			return nil
+		}
+
+		// 增加商户余额（使用 USD 结算金额，少付时按实收比例折算）
+		order.ActualAmount = match.total
+		merchant, err := GetWithdrawService().SettleOrderBalance(tx, order, prevStatus, actor)
+		if err != nil {
+			return err
+		}
+		snapshot.SettlementAmount = order.SettlementAmount
+
+		// 商户回调任务与支付成功事件
+		if err := GetNotifyService().EnqueueOrderPaid(tx, &snapshot); err != nil {
+			return err
+		}
+
+		// 支付成功与余额变动通知，提交后由外发协程发送
+		outbox := GetOutboxService()
+		if err := outbox.Publish(tx, OutboxTopicOrderPaid, outboxOrderPayload{OrderID: order.ID}); err != nil {
+			return err
+		}
+		return outbox.Publish(tx, OutboxTopicOrderSettled, outboxSettledPayload{
+			OrderID: order.ID,
+			Balance: decimal.NewFromFloat(merchant.Balance),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	// 使订单缓存失效
+	GetOrderService().InvalidateOrderCache(order.TradeNo)
+
+	log.Printf("Order %s matched with tx %s, amount: %s, result: %s, by: %s", order.TradeNo, txLog.TxHash, txLog.Amount, match.note, actor)
+
+	// 记录订单匹配
+	if s.metrics != nil {
+		s.metrics.RecordOrderMatch(txLog.Chain)
+	}
+
+	// 唤醒回调投递与外发消息协程
+	GetNotifyService().signal()
+	GetOutboxService().Signal()
+
+	return nil
+}
+
+// TransferCandidate 未匹配转账的候选订单
+type TransferCandidate struct {
+	model.Order
+	RequiredAmount decimal.Decimal `json:"required_amount"` // 订单应收金额
+	Diff           decimal.Decimal `json:"diff"`            // 转账金额 - 应收金额
+	DiffPercent    float64         `json:"diff_percent"`    // 差额占应收金额百分比
+}
+
+// ListTransferCandidates 查找未匹配转账的候选订单
+// 条件：同链同收款地址、待支付/部分支付/已过期、转账前 hours 小时内创建、金额差在 tolerance 比例内
+func (s *BlockchainService) ListTransferCandidates(txLogID uint, tolerance float64, hours int) (*model.TransactionLog, []TransferCandidate, error) {
+	var txLog model.TransactionLog
+	if err := model.GetDB().First(&txLog, txLogID).Error; err != nil {
+		return nil, nil, errors.New("交易记录不存在")
+	}
+
+	amount, err := decimal.NewFromString(txLog.Amount)
+	if err != nil {
+		return nil, nil, errors.New("交易金额无效")
+	}
+
+	var orders []model.Order
+	model.GetDB().
+		Where("chain = ? AND pay_currency = ? AND to_address = ? AND status IN ? AND created_at > ? AND created_at < ?",
+			txLog.Chain, txLogToken(&txLog), strings.ToLower(txLog.ToAddress),
+			[]model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial, model.OrderStatusExpired},
+			txLog.CreatedAt.Add(-time.Duration(hours)*time.Hour), txLog.CreatedAt.Add(time.Minute)).
+		Order("created_at DESC").
+		Limit(200).
+		Find(&orders)
+
+	candidates := make([]TransferCandidate, 0)
+	for _, order := range orders {
+		required := orderRequiredAmount(&order)
+		if order.Status == model.OrderStatusPartial {
+			required = required.Sub(order.ActualAmount)
+		}
+		if !required.IsPositive() {
+			continue
+		}
+		diff := amount.Sub(required)
+		percent, _ := diff.Div(required).Float64()
+		if percent < -tolerance || percent > tolerance {
+			continue
+		}
+		candidates = append(candidates, TransferCandidate{
+			Order:          order,
+			RequiredAmount: required,
+			Diff:           diff,
+			DiffPercent:    percent * 100,
+		})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Diff.Abs().LessThan(candidates[j].Diff.Abs())
+	})
+	if len(candidates) > 20 {
+		candidates = candidates[:20]
+	}
+
+	return &txLog, candidates, nil
+}
+
+// AssignTransfer 管理员将未匹配的转账指派给订单，走与自动匹配相同的结算流程
+// markPaid: 为 true 时无论金额是否足额都视为已支付，否则金额不足时记为部分支付
+func (s *BlockchainService) AssignTransfer(txLogID uint, tradeNo string, markPaid bool, operator string) (*model.Order, error) {
+	var txLog model.TransactionLog
+	if err := model.GetDB().First(&txLog, txLogID).Error; err != nil {
+		return nil, errors.New("交易记录不存在")
+	}
+	if txLog.Matched {
+		return nil, errTransferAlreadyMatched
+	}
+
+	var order model.Order
+	if err := model.GetDB().Preload("Merchant").Where("trade_no = ?", tradeNo).First(&order).Error; err != nil {
+		return nil, errors.New("订单不存在")
+	}
+	if order.Status != model.OrderStatusPending && order.Status != model.OrderStatusPartial && order.Status != model.OrderStatusExpired {
+		return nil, errors.New("订单状态不正确，只能指派给待支付、部分支付或已过期订单")
+	}
+	if order.Chain != txLog.Chain {
+		return nil, errors.New("交易与订单不在同一条链")
+	}
+	if order.PayCurrency != txLogToken(&txLog) {
+		return nil, errors.New("交易币种与订单支付币种不一致")
+	}
+
+	amount, err := decimal.NewFromString(txLog.Amount)
+	if err != nil {
+		return nil, errors.New("交易金额无效")
+	}
+	amount = normalizeTransferAmount(Transfer{Chain: txLog.Chain, Amount: amount})
+
+	total := amount
+	if order.Status == model.OrderStatusPartial {
+		total = order.ActualAmount.Add(amount)
+	}
+
+	match := &paymentMatch{order: &order, total: total, note: model.MatchNoteManual}
+	switch {
+	case !markPaid && !reachedRequired(total, orderRequiredAmount(&order), orderPaymentPolicy(&order)):
+		if order.Status == model.OrderStatusExpired {
+			return nil, errors.New("金额不足，已过期订单需确认按已支付处理")
+		}
+		match.newStatus = model.OrderStatusPartial
+	case order.Status == model.OrderStatusExpired || time.Now().After(order.ExpiredAt):
+		match.newStatus = model.OrderStatusPaidLate
+	default:
+		match.newStatus = model.OrderStatusPaid
+	}
+
+	if err := s.applyTransferMatch(&txLog, match, AdminActor(operator)); err != nil {
+		if errors.Is(err, errOrderAlreadyProcessed) {
+			return nil, errors.New("订单状态已变化，请刷新后重试")
+		}
+		return nil, err
+	}
+
+	log.Printf("管理员[%s]将交易 %s 指派给订单 %s", operator, txLog.TxHash, order.TradeNo)
+
+	order.Status = match.newStatus
+	return &order, nil
+}
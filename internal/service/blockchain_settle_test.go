@@ -0,0 +1,123 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func TestTransferCandidatesLegacyToken(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+	expiredAt := time.Now().Add(-time.Hour)
+	for _, o := range []model.Order{
+		{TradeNo: "USDT1", PayCurrency: "USDT"},
+		{TradeNo: "USDC1", PayCurrency: "USDC"},
+	} {
+		o.OutTradeNo, o.MerchantID, o.Type, o.Chain, o.ToAddress = o.TradeNo, merchant.ID, "usdt_trc20", "trc20", "twallet"
+		o.Money, o.USDTAmount, o.Status, o.ExpiredAt = decimal.NewFromInt(10), decimal.NewFromInt(10), model.OrderStatusExpired, expiredAt
+		if err := db.Create(&o).Error; err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+	}
+	// 币种登记前写入的交易日志没有记录代币
+	txLog := model.TransactionLog{Chain: "trc20", TxHash: "0xabc", ToAddress: "TWallet", Amount: "10"}
+	db.Create(&txLog)
+
+	s := &BlockchainService{}
+	_, candidates, err := s.ListTransferCandidates(txLog.ID, 0.05, 24)
+	if err != nil {
+		t.Fatalf("ListTransferCandidates: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Order.TradeNo != "USDT1" {
+		t.Fatalf("candidates = %+v, want only the USDT order", candidates)
+	}
+
+	if _, err := s.AssignTransfer(txLog.ID, "USDC1", true, "root"); err == nil {
+		t.Error("legacy USDT transfer assigned to a USDC order")
+	}
+}
+
+func TestUnderpaidOrderSettlesReceivedShare(t *testing.T) {
+	tests := []struct {
+		name        string
+		tolerance   float64 // 商户保存的少付容差
+		paid        string
+		wantStatus  model.OrderStatus
+		wantBalance float64
+	}{
+		{name: "full payment", tolerance: 0.02, paid: "100", wantStatus: model.OrderStatusPaid, wantBalance: 98},
+		{name: "underpaid within tolerance", tolerance: 0.02, paid: "98.5", wantStatus: model.OrderStatusPaid, wantBalance: 96.5},
+		{name: "legacy tolerance capped", tolerance: 0.5, paid: "60", wantStatus: model.OrderStatusPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			policy := model.DefaultPaymentPolicy()
+			policy.UnderpayTolerance = tt.tolerance
+			merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, PaymentPolicy: policy}
+			db.Create(&merchant)
+			order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+				PayCurrency: "USDT", ToAddress: "twallet", Money: decimal.NewFromInt(100), USDTAmount: decimal.NewFromInt(100),
+				SettlementAmount: decimal.NewFromInt(100), Fee: decimal.NewFromInt(2), FeeType: model.FeeTypeDeduction,
+				Status: model.OrderStatusPending, ExpiredAt: time.Now().Add(time.Hour)}
+			db.Create(&order)
+
+			s := &BlockchainService{listeners: map[string]*ChainListener{"trc20": {chain: "trc20", confirmations: 19}}}
+			s.processTransfer(Transfer{TxHash: "0xabc", From: "TPayer", To: "TWallet", Amount: decimal.RequireFromString(tt.paid),
+				Token: "USDT", Chain: "trc20"})
+
+			var got model.Order
+			db.First(&got, order.ID)
+			if got.Status != tt.wantStatus {
+				t.Fatalf("order status = %d, want %d", got.Status, tt.wantStatus)
+			}
+			db.First(&merchant, merchant.ID)
+			if merchant.Balance != tt.wantBalance {
+				t.Errorf("merchant balance = %.2f, want %.2f", merchant.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestAssignTransferConcurrentAssignment(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+	order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+		PayCurrency: "USDT", ToAddress: "twallet", Money: decimal.NewFromInt(10), USDTAmount: decimal.NewFromInt(10),
+		SettlementAmount: decimal.NewFromInt(10), FeeType: model.FeeTypeDeduction, Status: model.OrderStatusPending,
+		ExpiredAt: time.Now().Add(time.Hour)}
+	db.Create(&order)
+	txLog := model.TransactionLog{Chain: "trc20", TxHash: "0xabc", ToAddress: "TWallet", Amount: "10", Token: "USDT"}
+	db.Create(&txLog)
+
+	// 读取日志后、写入前，另一位管理员已将该转账指派给其他订单
+	raced := false
+	db.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "transaction_logs" {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE transaction_logs SET matched = ?, order_id = ? WHERE id = ?", true, 999, txLog.ID)
+	})
+
+	s := &BlockchainService{listeners: map[string]*ChainListener{"trc20": {chain: "trc20", confirmations: 19}}}
+	if _, err := s.AssignTransfer(txLog.ID, "T1", true, "root"); err == nil {
+		t.Fatal("transfer already assigned elsewhere was assigned again")
+	}
+	var got model.Order
+	db.First(&got, order.ID)
+	if got.Status != model.OrderStatusPending {
+		t.Errorf("order status = %d, want pending after the rolled back assignment", got.Status)
+	}
+	db.First(&merchant, merchant.ID)
+	if merchant.Balance != 0 {
+		t.Errorf("merchant credited %.2f for a transfer assigned elsewhere", merchant.Balance)
+	}
+}
@@ -0,0 +1,614 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"sync"
+
+	"ezpay/internal/model"
+)
+
+// solanaAssociatedTokenProgram 关联代币账户程序地址
+const solanaAssociatedTokenProgram = "ATokenGPvbdGVxr1b2hvZbsiqW5xWH25efTNsLJA8knL"
+
+const (
+	// solanaSignaturePageSize getSignaturesForAddress 单页数量
+	solanaSignaturePageSize = 100
+	// solanaMaxSignaturePages 单个代币账户每轮最多翻页数
+	solanaMaxSignaturePages = 5
+	// solanaInitialSlots 首次启动时回溯的 slot 数(约 10 分钟)
+	solanaInitialSlots = 1500
+	// solanaRescanMaxPages 补扫单个代币账户最多翻页数
+	solanaRescanMaxPages = 100
+)
+
+// solanaScanner Solana SPL 代币扫描器(JSON-RPC)
+// 收款地址为钱包地址，按登记的 Mint 推导关联代币账户(ATA)，通过 getSignaturesForAddress + getTransaction 查询转入记录
+// 金额取交易前后代币余额差，listener.lastBlock 记录已最终确认(finalized)的 slot
+type solanaScanner struct {
+	s        *BlockchainService
+	mu       sync.Mutex
+	programs map[string]string // Mint -> 所属代币程序(Token / Token-2022)
+	accounts map[string]string // 钱包地址|Mint -> 关联代币账户
+}
+
+func newSolanaScanner(s *BlockchainService) *solanaScanner {
+	return &solanaScanner{
+		s:        s,
+		programs: make(map[string]string),
+		accounts: make(map[string]string),
+	}
+}
+
+// solanaSignature getSignaturesForAddress 返回的签名信息
+type solanaSignature struct {
+	Signature          string      `json:"signature"`
+	Slot               uint64      `json:"slot"`
+	Err                interface{} `json:"err"`
+	ConfirmationStatus string      `json:"confirmationStatus"`
+}
+
+// solanaTokenBalance 交易前后的代币余额
+type solanaTokenBalance struct {
+	AccountIndex  int    `json:"accountIndex"`
+	Mint          string `json:"mint"`
+	Owner         string `json:"owner"`
+	UITokenAmount struct {
+		Amount string `json:"amount"`
+	} `json:"uiTokenAmount"`
+}
+
+// solanaCall 调用 Solana JSON-RPC 并解析 result
+func solanaCall(rpcClient *RPCClient, method string, params []interface{}, result interface{}) error {
+	body, err := rpcClient.PostJSON("", map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("rpc error: %s", resp.Error.Message)
+	}
+	if len(resp.Result) == 0 {
+		return errors.New("empty result")
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+func (sc *solanaScanner) LatestHeight(listener *ChainListener) (uint64, error) {
+	var slot uint64
+	err := solanaCall(sc.s.rpcClients[listener.chain], "getSlot",
+		[]interface{}{map[string]string{"commitment": "confirmed"}}, &slot)
+	return slot, err
+}
+
+func (sc *solanaScanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	rpcClient := sc.s.rpcClients[listener.chain]
+
+	currentSlot, err := sc.LatestHeight(listener)
+	if err != nil {
+		sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, fmt.Errorf("failed to get slot: %w", err)
+	}
+	var finalizedSlot uint64
+	if err := solanaCall(rpcClient, "getSlot", []interface{}{map[string]string{"commitment": "finalized"}}, &finalizedSlot); err != nil {
+		sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, fmt.Errorf("failed to get finalized slot: %w", err)
+	}
+	sc.s.metrics.RecordRPCCall(listener.chain, true, 0)
+	sc.s.metrics.UpdateBlockHeight(listener.chain, currentSlot, listener.lastBlock)
+
+	if listener.lastBlock == 0 && finalizedSlot > solanaInitialSlots {
+		listener.lastBlock = finalizedSlot - solanaInitialSlots // 首次启动，只扫描最近的交易
+	}
+
+	// 本轮扫描后的进度为已最终确认的 slot，未最终确认的交易下一轮重新查询
+	nextBlock := finalizedSlot
+	owners := sc.s.walletCache.GetOriginalAddresses(listener.chain)
+
+	var transfers []Transfer
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		program, err := sc.tokenProgram(rpcClient, token.Contract)
+		if err != nil {
+			sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+			return nil, fmt.Errorf("failed to get %s mint: %w", token.Symbol, err)
+		}
+
+		for _, owner := range owners {
+			account, err := sc.associatedTokenAccount(owner, token.Contract, program)
+			if err != nil {
+				log.Printf("[%s] Invalid wallet address %s: %v", listener.chain, owner, err)
+				continue
+			}
+
+			sigs, err := sc.signatures(listener, rpcClient, account, listener.lastBlock, solanaMaxSignaturePages)
+			if err != nil {
+				return nil, err
+			}
+
+			// 按时间顺序处理(接口返回新到旧)
+			for i := len(sigs) - 1; i >= 0; i-- {
+				sig := sigs[i]
+				finalized := sig.ConfirmationStatus == "finalized"
+				if !finalized && sig.Slot <= nextBlock {
+					nextBlock = sig.Slot - 1
+				}
+				// 执行失败的交易没有到账
+				if sig.Err != nil {
+					continue
+				}
+
+				parsed, err := sc.transaction(listener, rpcClient, sig.Signature, ScanWindow{
+					Addresses:    addresses,
+					Token:        &token,
+					Unconfirmed:  !finalized,
+					CurrentBlock: currentSlot,
+				})
+				if err != nil {
+					return nil, err
+				}
+				transfers = append(transfers, parsed...)
+			}
+		}
+	}
+
+	if nextBlock > listener.lastBlock {
+		listener.lastBlock = nextBlock
+	}
+	return transfers, nil
+}
+
+// transaction 查询并解析一笔交易中转入收款地址的代币转账
+func (sc *solanaScanner) transaction(listener *ChainListener, rpcClient *RPCClient, signature string, window ScanWindow) ([]Transfer, error) {
+	var raw json.RawMessage
+	err := solanaCall(rpcClient, "getTransaction", []interface{}{signature, map[string]interface{}{
+		"encoding":                       "jsonParsed",
+		"commitment":                     "confirmed",
+		"maxSupportedTransactionVersion": 0,
+	}}, &raw)
+	if err != nil {
+		sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, fmt.Errorf("failed to get transaction %s: %w", signature, err)
+	}
+	sc.s.metrics.RecordRPCCall(listener.chain, true, 0)
+	if string(raw) == "null" {
+		return nil, fmt.Errorf("transaction %s not available", signature)
+	}
+
+	parsed, err := listener.scanner.ParseTransfers(listener, raw, window)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transaction %s: %w", signature, err)
+	}
+	return parsed, nil
+}
+
+// signatures 查询代币账户在 afterSlot 之后的交易签名(新到旧)，最多翻 maxPages 页
+func (sc *solanaScanner) signatures(listener *ChainListener, rpcClient *RPCClient, account string, afterSlot uint64, maxPages int) ([]solanaSignature, error) {
+	var result []solanaSignature
+	before := ""
+	for page := 0; page < maxPages; page++ {
+		opts := map[string]interface{}{
+			"limit":      solanaSignaturePageSize,
+			"commitment": "confirmed",
+		}
+		if before != "" {
+			opts["before"] = before
+		}
+
+		var sigs []solanaSignature
+		if err := solanaCall(rpcClient, "getSignaturesForAddress", []interface{}{account, opts}, &sigs); err != nil {
+			sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+			return nil, fmt.Errorf("failed to get signatures for %s: %w", account, err)
+		}
+		sc.s.metrics.RecordRPCCall(listener.chain, true, 0)
+
+		for _, sig := range sigs {
+			if sig.Slot <= afterSlot {
+				return result, nil
+			}
+			result = append(result, sig)
+		}
+		if len(sigs) < solanaSignaturePageSize {
+			return result, nil
+		}
+		before = sigs[len(sigs)-1].Signature
+	}
+
+	log.Printf("[%s] Too many signatures for %s, older ones skipped", listener.chain, account)
+	return result, nil
+}
+
+func (sc *solanaScanner) RescanUnit() string {
+	return RescanUnitBlock
+}
+
+// RescanChunk 补扫 from~to slot 内已最终确认的转账
+// 签名只能从新到旧翻页，一次查完整个范围
+func (sc *solanaScanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	rpcClient := sc.s.rpcClients[listener.chain]
+	owners := sc.s.walletCache.GetOriginalAddresses(listener.chain)
+
+	var transfers []Transfer
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		program, err := sc.tokenProgram(rpcClient, token.Contract)
+		if err != nil {
+			sc.s.metrics.RecordRPCCall(listener.chain, false, 0)
+			return nil, 0, fmt.Errorf("failed to get %s mint: %w", token.Symbol, err)
+		}
+
+		for _, owner := range owners {
+			account, err := sc.associatedTokenAccount(owner, token.Contract, program)
+			if err != nil {
+				continue
+			}
+
+			var afterSlot uint64
+			if from > 0 {
+				afterSlot = from - 1
+			}
+			sigs, err := sc.signatures(listener, rpcClient, account, afterSlot, solanaRescanMaxPages)
+			if err != nil {
+				return nil, 0, err
+			}
+			if len(sigs) >= solanaRescanMaxPages*solanaSignaturePageSize {
+				return nil, 0, fmt.Errorf("too many signatures for %s, narrow the slot range", account)
+			}
+
+			for i := len(sigs) - 1; i >= 0; i-- {
+				sig := sigs[i]
+				if sig.Slot > to || sig.Err != nil || sig.ConfirmationStatus != "finalized" {
+					continue
+				}
+				parsed, err := sc.transaction(listener, rpcClient, sig.Signature, ScanWindow{
+					Addresses:    addresses,
+					Token:        &token,
+					CurrentBlock: to,
+				})
+				if err != nil {
+					return nil, 0, err
+				}
+				transfers = append(transfers, parsed...)
+			}
+		}
+	}
+	return transfers, to, nil
+}
+
+// ParseTransfers 解析 getTransaction(jsonParsed) 返回的交易，按代币余额变化识别转入收款地址的 SPL 转账
+// 交易中的只读非签名账户(Solana Pay reference)和 memo 作为付款引用候选
+func (sc *solanaScanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var tx struct {
+		Slot uint64 `json:"slot"`
+		Meta *struct {
+			Err               interface{}          `json:"err"`
+			PreTokenBalances  []solanaTokenBalance `json:"preTokenBalances"`
+			PostTokenBalances []solanaTokenBalance `json:"postTokenBalances"`
+		} `json:"meta"`
+		Transaction struct {
+			Signatures []string `json:"signatures"`
+			Message    struct {
+				AccountKeys []struct {
+					Pubkey   string `json:"pubkey"`
+					Signer   bool   `json:"signer"`
+					Writable bool   `json:"writable"`
+				} `json:"accountKeys"`
+				Instructions []struct {
+					Program string          `json:"program"`
+					Parsed  json.RawMessage `json:"parsed"`
+				} `json:"instructions"`
+			} `json:"message"`
+		} `json:"transaction"`
+	}
+
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return nil, err
+	}
+	if window.Token == nil {
+		return nil, fmt.Errorf("token is required")
+	}
+	if tx.Meta == nil || tx.Meta.Err != nil || len(tx.Transaction.Signatures) == 0 {
+		return nil, nil
+	}
+	txHash := tx.Transaction.Signatures[0]
+
+	// 检查是否已处理
+	var count int64
+	model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", txHash).Count(&count)
+	if count > 0 {
+		sc.s.metrics.RecordDuplicateTx(listener.chain)
+		return nil, nil
+	}
+
+	// 按账户计算该代币的余额变化
+	mint := window.Token.Contract
+	owners := make(map[int]string)
+	deltas := make(map[int]*big.Int)
+	for _, balance := range tx.Meta.PreTokenBalances {
+		if balance.Mint != mint {
+			continue
+		}
+		amount, _ := new(big.Int).SetString(balance.UITokenAmount.Amount, 10)
+		if amount == nil {
+			continue
+		}
+		owners[balance.AccountIndex] = balance.Owner
+		deltas[balance.AccountIndex] = amount.Neg(amount)
+	}
+	for _, balance := range tx.Meta.PostTokenBalances {
+		if balance.Mint != mint {
+			continue
+		}
+		amount, _ := new(big.Int).SetString(balance.UITokenAmount.Amount, 10)
+		if amount == nil {
+			continue
+		}
+		owners[balance.AccountIndex] = balance.Owner
+		if pre, ok := deltas[balance.AccountIndex]; ok {
+			amount.Add(amount, pre)
+		}
+		deltas[balance.AccountIndex] = amount
+	}
+
+	// 余额减少最多的账户所有者为付款方，没有时取手续费支付者
+	var from string
+	var maxOut *big.Int
+	for index, delta := range deltas {
+		if delta.Sign() < 0 && (maxOut == nil || delta.Cmp(maxOut) < 0) {
+			maxOut = delta
+			from = owners[index]
+		}
+	}
+	if from == "" && len(tx.Transaction.Message.AccountKeys) > 0 {
+		from = tx.Transaction.Message.AccountKeys[0].Pubkey
+	}
+
+	var references []string
+	for _, key := range tx.Transaction.Message.AccountKeys {
+		if !key.Signer && !key.Writable {
+			references = append(references, key.Pubkey)
+		}
+	}
+	for _, ins := range tx.Transaction.Message.Instructions {
+		var memo string
+		if ins.Program == "spl-memo" && json.Unmarshal(ins.Parsed, &memo) == nil && strings.TrimSpace(memo) != "" {
+			references = append(references, strings.TrimSpace(memo))
+		}
+	}
+
+	var transfers []Transfer
+	for index, delta := range deltas {
+		owner := owners[index]
+		if delta.Sign() <= 0 || !window.Addresses[strings.ToLower(owner)] {
+			continue
+		}
+		transfer := Transfer{
+			TxHash:      txHash,
+			From:        from,
+			To:          owner,
+			Amount:      parseTokenAmount(delta.String(), window.Token.Decimals),
+			Token:       window.Token.Symbol,
+			BlockNumber: tx.Slot,
+			Chain:       listener.chain,
+			Unconfirmed: window.Unconfirmed,
+			References:  references,
+		}
+		if window.Unconfirmed && window.CurrentBlock > tx.Slot {
+			transfer.Confirmations = int(window.CurrentBlock - tx.Slot)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// TxConfirmation 通过签名状态查询交易确认情况，最终确认(finalized)即视为达到确认数
+func (sc *solanaScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	var statuses struct {
+		Value []*struct {
+			Slot               uint64      `json:"slot"`
+			Err                interface{} `json:"err"`
+			ConfirmationStatus string      `json:"confirmationStatus"`
+		} `json:"value"`
+	}
+	err := solanaCall(sc.s.rpcClients[listener.chain], "getSignatureStatuses", []interface{}{
+		[]string{txHash},
+		map[string]bool{"searchTransactionHistory": true},
+	}, &statuses)
+	if err != nil {
+		return nil, err
+	}
+	if len(statuses.Value) == 0 || statuses.Value[0] == nil {
+		return &txConfirmation{}, nil
+	}
+
+	status := statuses.Value[0]
+	conf := &txConfirmation{
+		found:       true,
+		failed:      status.Err != nil,
+		blockNumber: status.Slot,
+	}
+	if currentBlock > conf.blockNumber {
+		conf.confirmations = int(currentBlock - conf.blockNumber)
+	}
+	// 以最终确认为准，slot 差值只用于展示进度
+	if status.ConfirmationStatus == "finalized" {
+		if conf.confirmations < listener.confirmations {
+			conf.confirmations = listener.confirmations
+		}
+	} else if conf.confirmations >= listener.confirmations {
+		conf.confirmations = listener.confirmations - 1
+	}
+	return conf, nil
+}
+
+// ValidateAddress Solana 地址: Base58 编码的 32 字节公钥
+func (sc *solanaScanner) ValidateAddress(address string) bool {
+	if len(address) < 32 || len(address) > 44 {
+		return false
+	}
+	decoded, err := base58Decode(address)
+	return err == nil && len(decoded) == 32
+}
+
+// NormalizeAddress Solana 地址区分大小写，保持原样
+func (sc *solanaScanner) NormalizeAddress(address string) string {
+	return strings.TrimSpace(address)
+}
+
+// NewReference 生成 Solana Pay reference(随机公钥)，付款交易附带该账户时按引用匹配订单
+func (sc *solanaScanner) NewReference(order *model.Order) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return ""
+	}
+	return base58Encode(key)
+}
+
+// ReferenceRequired 不支持 Solana Pay 的钱包无法附带 reference，仍按唯一金额匹配
+func (sc *solanaScanner) ReferenceRequired() bool {
+	return false
+}
+
+// PaymentURI 生成 Solana Pay 转账链接，支持的钱包扫码后自动填写金额、代币、reference 和 memo(订单号)
+func (sc *solanaScanner) PaymentURI(order *model.Order) string {
+	token, ok := GetTokenService().GetToken(order.Chain, order.PayCurrency)
+	if !ok || order.ToAddress == "" {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("amount", order.UniqueAmount.String())
+	query.Set("spl-token", token.Contract)
+	if order.PayReference != "" {
+		query.Set("reference", order.PayReference)
+	}
+	query.Set("memo", order.TradeNo)
+	return "solana:" + order.ToAddress + "?" + query.Encode()
+}
+
+// tokenProgram 查询 Mint 所属的代币程序(Token 或 Token-2022)
+func (sc *solanaScanner) tokenProgram(rpcClient *RPCClient, mint string) (string, error) {
+	sc.mu.Lock()
+	program, ok := sc.programs[mint]
+	sc.mu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	var info struct {
+		Value *struct {
+			Owner string `json:"owner"`
+		} `json:"value"`
+	}
+	if err := solanaCall(rpcClient, "getAccountInfo", []interface{}{mint, map[string]string{"encoding": "base64"}}, &info); err != nil {
+		return "", err
+	}
+	if info.Value == nil || info.Value.Owner == "" {
+		return "", errors.New("mint account not found")
+	}
+
+	sc.mu.Lock()
+	sc.programs[mint] = info.Value.Owner
+	sc.mu.Unlock()
+	return info.Value.Owner, nil
+}
+
+// associatedTokenAccount 推导钱包在指定 Mint 下的关联代币账户(ATA)
+func (sc *solanaScanner) associatedTokenAccount(owner, mint, program string) (string, error) {
+	key := owner + "|" + mint
+	sc.mu.Lock()
+	account, ok := sc.accounts[key]
+	sc.mu.Unlock()
+	if ok {
+		return account, nil
+	}
+
+	var seeds [][]byte
+	for _, address := range []string{owner, program, mint} {
+		decoded, err := base58Decode(address)
+		if err != nil || len(decoded) != 32 {
+			return "", fmt.Errorf("invalid address %s", address)
+		}
+		seeds = append(seeds, decoded)
+	}
+	programID, _ := base58Decode(solanaAssociatedTokenProgram)
+	pda, err := findProgramAddress(seeds, programID)
+	if err != nil {
+		return "", err
+	}
+
+	account = base58Encode(pda)
+	sc.mu.Lock()
+	sc.accounts[key] = account
+	sc.mu.Unlock()
+	return account, nil
+}
+
+// findProgramAddress 推导程序派生地址(PDA): 从 bump=255 开始递减，取第一个不在 ed25519 曲线上的哈希
+func findProgramAddress(seeds [][]byte, programID []byte) ([]byte, error) {
+	for bump := 255; bump >= 0; bump-- {
+		h := sha256.New()
+		for _, seed := range seeds {
+			h.Write(seed)
+		}
+		h.Write([]byte{byte(bump)})
+		h.Write(programID)
+		h.Write([]byte("ProgramDerivedAddress"))
+		key := h.Sum(nil)
+		if !isOnEd25519Curve(key) {
+			return key, nil
+		}
+	}
+	return nil, errors.New("unable to find a viable program address")
+}
+
+// ed25519 曲线参数: p = 2^255 - 19, d = -121665/121666
+var (
+	ed25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	ed25519D = func() *big.Int {
+		d := new(big.Int).ModInverse(big.NewInt(121666), ed25519P)
+		d.Mul(d, big.NewInt(-121665))
+		return d.Mod(d, ed25519P)
+	}()
+)
+
+// isOnEd25519Curve 32 字节压缩点是否在 ed25519 曲线上
+// 压缩点为小端序 y 坐标(最高位为 x 的符号位)，x² = (y²-1)/(d·y²+1) 有解即在曲线上
+func isOnEd25519Curve(key []byte) bool {
+	if len(key) != 32 {
+		return false
+	}
+	be := make([]byte, 32)
+	for i, b := range key {
+		be[31-i] = b
+	}
+	be[0] &= 0x7f
+
+	y := new(big.Int).SetBytes(be)
+	y2 := new(big.Int).Mul(y, y)
+	y2.Mod(y2, ed25519P)
+	u := new(big.Int).Sub(y2, big.NewInt(1))
+	v := new(big.Int).Mul(ed25519D, y2)
+	v.Add(v, big.NewInt(1))
+
+	// v 恒不为 0，u/v 为平方数等价于 u·v 为平方数(含 0)
+	uv := new(big.Int).Mul(u, v)
+	uv.Mod(uv, ed25519P)
+	return big.Jacobi(uv, ed25519P) >= 0
+}
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// solanaKey 测试用 Solana 地址(32 字节重复 b)
+func solanaKey(b byte) string {
+	return base58Encode(bytes.Repeat([]byte{b}, 32))
+}
+
+var (
+	solWallet    = solanaKey(1)
+	solPayer     = solanaKey(2)
+	solReference = solanaKey(3)
+	solMint      = solanaKey(7)
+	solProgram   = solanaKey(9)
+)
+
+func splBalance(index int, mint, owner, amount string) solanaTokenBalance {
+	b := solanaTokenBalance{AccountIndex: index, Mint: mint, Owner: owner}
+	b.UITokenAmount.Amount = amount
+	return b
+}
+
+// solanaTx getTransaction(jsonParsed) 返回的交易，附带一个 reference 账户和 memo
+func solanaTx(sig string, slot uint64, failed bool, pre, post []solanaTokenBalance) map[string]interface{} {
+	var txErr interface{}
+	if failed {
+		txErr = map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}
+	}
+	return map[string]interface{}{
+		"slot": slot,
+		"meta": map[string]interface{}{
+			"err":               txErr,
+			"preTokenBalances":  pre,
+			"postTokenBalances": post,
+		},
+		"transaction": map[string]interface{}{
+			"signatures": []string{sig},
+			"message": map[string]interface{}{
+				"accountKeys": []map[string]interface{}{
+					{"pubkey": solPayer, "signer": true, "writable": true},
+					{"pubkey": solanaKey(4), "signer": false, "writable": true},
+					{"pubkey": solReference, "signer": false, "writable": false},
+				},
+				"instructions": []map[string]interface{}{
+					{"program": "spl-token", "parsed": map[string]interface{}{"type": "transferChecked"}},
+					{"program": "spl-memo", "parsed": "ORDER123"},
+				},
+			},
+		},
+	}
+}
+
+// incomingSPL 付款方向收款钱包转入 amount(最小单位)
+func incomingSPL(sig string, slot uint64, amount string) map[string]interface{} {
+	return solanaTx(sig, slot, false,
+		[]solanaTokenBalance{splBalance(1, solMint, solPayer, "5000000"), splBalance(2, solMint, solWallet, "0")},
+		[]solanaTokenBalance{splBalance(1, solMint, solPayer, "3500000"), splBalance(2, solMint, solWallet, amount)})
+}
+
+func setupSolanaToken(t *testing.T) *model.Token {
+	t.Helper()
+	db := setupTestDB(t)
+	token := &model.Token{Chain: "solana", Symbol: "USDT", Contract: solMint, Decimals: 6, Enabled: true}
+	db.Create(token)
+	return token
+}
+
+func TestSolanaParseTransfers(t *testing.T) {
+	token := setupSolanaToken(t)
+	listener := newTestChain(t, "solana", jsonRPCStub{}, solWallet)
+
+	tests := []struct {
+		name      string
+		tx        map[string]interface{}
+		window    ScanWindow
+		processed bool
+		want      []Transfer
+	}{
+		{
+			name:   "incoming transfer",
+			tx:     incomingSPL("sig1", 1000, "1500000"),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token},
+			want: []Transfer{{TxHash: "sig1", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("1.5"), Token: "USDT",
+				BlockNumber: 1000, Chain: "solana", References: []string{solReference, "ORDER123"}}},
+		},
+		{
+			name: "new token account without pre balance",
+			tx: solanaTx("sig2", 1000, false,
+				[]solanaTokenBalance{splBalance(1, solMint, solPayer, "5000000")},
+				[]solanaTokenBalance{splBalance(1, solMint, solPayer, "4000000"), splBalance(2, solMint, solWallet, "1000000")}),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token},
+			want: []Transfer{{TxHash: "sig2", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("1"), Token: "USDT",
+				BlockNumber: 1000, Chain: "solana", References: []string{solReference, "ORDER123"}}},
+		},
+		{
+			name:   "unconfirmed transfer reports confirmations",
+			tx:     incomingSPL("sig3", 1000, "1500000"),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token, Unconfirmed: true, CurrentBlock: 1012},
+			want: []Transfer{{TxHash: "sig3", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("1.5"), Token: "USDT",
+				BlockNumber: 1000, Chain: "solana", Unconfirmed: true, Confirmations: 12, References: []string{solReference, "ORDER123"}}},
+		},
+		{
+			name: "outgoing transfer",
+			tx: solanaTx("sig4", 1000, false,
+				[]solanaTokenBalance{splBalance(1, solMint, solWallet, "5000000"), splBalance(2, solMint, solPayer, "0")},
+				[]solanaTokenBalance{splBalance(1, solMint, solWallet, "3500000"), splBalance(2, solMint, solPayer, "1500000")}),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token},
+		},
+		{
+			name:   "other wallet",
+			tx:     incomingSPL("sig5", 1000, "1500000"),
+			window: ScanWindow{Addresses: watched(solanaKey(5)), Token: token},
+		},
+		{
+			name: "other mint",
+			tx: solanaTx("sig6", 1000, false,
+				[]solanaTokenBalance{splBalance(2, solanaKey(8), solWallet, "0")},
+				[]solanaTokenBalance{splBalance(2, solanaKey(8), solWallet, "1500000")}),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token},
+		},
+		{
+			name: "failed transaction",
+			tx: solanaTx("sig7", 1000, true,
+				[]solanaTokenBalance{splBalance(2, solMint, solWallet, "0")},
+				[]solanaTokenBalance{splBalance(2, solMint, solWallet, "1500000")}),
+			window: ScanWindow{Addresses: watched(solWallet), Token: token},
+		},
+		{
+			name:      "already processed",
+			tx:        incomingSPL("sig8", 1000, "1500000"),
+			window:    ScanWindow{Addresses: watched(solWallet), Token: token},
+			processed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.processed {
+				sig := tt.tx["transaction"].(map[string]interface{})["signatures"].([]string)[0]
+				model.GetDB().Create(&model.TransactionLog{Chain: "solana", TxHash: sig})
+			}
+			raw, _ := json.Marshal(tt.tx)
+			got, err := listener.scanner.ParseTransfers(listener, raw, tt.window)
+			if err != nil {
+				t.Fatalf("ParseTransfers: %v", err)
+			}
+			assertTransfers(t, got, tt.want)
+		})
+	}
+}
+
+func TestSolanaScanRange(t *testing.T) {
+	setupSolanaToken(t)
+	// 新到旧: 未最终确认(高于/低于 finalized slot)、执行失败、已最终确认、已扫描过
+	txs := map[string]map[string]interface{}{
+		"sigA": incomingSPL("sigA", 990, "1000000"),
+		"sigB": incomingSPL("sigB", 998, "2000000"),
+		"sigC": incomingSPL("sigC", 1005, "3000000"),
+	}
+	var account string
+	stub := jsonRPCStub{
+		"getSlot": func(params []json.RawMessage) interface{} {
+			var opts struct{ Commitment string }
+			json.Unmarshal(params[0], &opts)
+			if opts.Commitment == "finalized" {
+				return 1000
+			}
+			return 1010
+		},
+		"getAccountInfo": func(params []json.RawMessage) interface{} {
+			return map[string]interface{}{"value": map[string]string{"owner": solProgram}}
+		},
+		"getSignaturesForAddress": func(params []json.RawMessage) interface{} {
+			json.Unmarshal(params[0], &account)
+			return []map[string]interface{}{
+				{"signature": "sigC", "slot": 1005, "confirmationStatus": "confirmed"},
+				{"signature": "sigB", "slot": 998, "confirmationStatus": "confirmed"},
+				{"signature": "sigF", "slot": 995, "confirmationStatus": "finalized", "err": map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}},
+				{"signature": "sigA", "slot": 990, "confirmationStatus": "finalized"},
+				{"signature": "sigOld", "slot": 900, "confirmationStatus": "finalized"},
+			}
+		},
+		"getTransaction": func(params []json.RawMessage) interface{} {
+			var sig string
+			json.Unmarshal(params[0], &sig)
+			if tx, ok := txs[sig]; ok {
+				return tx
+			}
+			return nil
+		},
+	}
+	listener := newTestChain(t, "solana", stub, solWallet)
+	listener.lastBlock = 950
+
+	got, err := listener.scanner.ScanRange(listener, watched(solWallet))
+	if err != nil {
+		t.Fatalf("ScanRange: %v", err)
+	}
+	want, _ := listener.scanner.(*solanaScanner).associatedTokenAccount(solWallet, solMint, solProgram)
+	if account != want {
+		t.Errorf("queried signatures for %s, want associated token account %s", account, want)
+	}
+
+	refs := []string{solReference, "ORDER123"}
+	assertTransfers(t, got, []Transfer{
+		{TxHash: "sigA", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("1"), Token: "USDT", BlockNumber: 990, Chain: "solana", References: refs},
+		{TxHash: "sigB", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("2"), Token: "USDT", BlockNumber: 998, Chain: "solana",
+			Unconfirmed: true, Confirmations: 12, References: refs},
+		{TxHash: "sigC", From: solPayer, To: solWallet, Amount: decimal.RequireFromString("3"), Token: "USDT", BlockNumber: 1005, Chain: "solana",
+			Unconfirmed: true, Confirmations: 5, References: refs},
+	})
+	// 进度停在最早的未最终确认交易之前，下一轮重新查询
+	if listener.lastBlock != 997 {
+		t.Errorf("lastBlock = %d, want 997", listener.lastBlock)
+	}
+}
+
+func TestSolanaScanRangeErrors(t *testing.T) {
+	setupSolanaToken(t)
+	slots := func(params []json.RawMessage) interface{} { return 1000 }
+	mint := func(params []json.RawMessage) interface{} {
+		return map[string]interface{}{"value": map[string]string{"owner": solProgram}}
+	}
+	sigs := func(params []json.RawMessage) interface{} {
+		return []map[string]interface{}{{"signature": "sigA", "slot": 990, "confirmationStatus": "finalized"}}
+	}
+
+	tests := []struct {
+		name string
+		stub jsonRPCStub
+	}{
+		{name: "slot rpc error", stub: jsonRPCStub{"getSlot": func([]json.RawMessage) interface{} {
+			return &RPCError{Code: -32005, Message: "node is behind"}
+		}}},
+		{name: "mint not found", stub: jsonRPCStub{"getSlot": slots, "getAccountInfo": func([]json.RawMessage) interface{} {
+			return map[string]interface{}{"value": nil}
+		}}},
+		{name: "signatures http error", stub: jsonRPCStub{"getSlot": slots, "getAccountInfo": mint}},
+		{name: "transaction not available", stub: jsonRPCStub{"getSlot": slots, "getAccountInfo": mint, "getSignaturesForAddress": sigs,
+			"getTransaction": func([]json.RawMessage) interface{} { return nil }}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "solana", tt.stub, solWallet)
+			listener.lastBlock = 950
+			if _, err := listener.scanner.ScanRange(listener, watched(solWallet)); err == nil {
+				t.Fatal("ScanRange returned no error")
+			}
+			if listener.lastBlock != 950 {
+				t.Errorf("lastBlock advanced to %d after a failed scan", listener.lastBlock)
+			}
+		})
+	}
+}
+
+func TestSolanaTxConfirmation(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  interface{} // getSignatureStatuses value[0]
+		rpcErr  bool
+		want    txConfirmation
+		wantErr bool
+	}{
+		{name: "unknown signature", status: nil, want: txConfirmation{}},
+		{name: "finalized", status: map[string]interface{}{"slot": 999, "confirmationStatus": "finalized"},
+			want: txConfirmation{found: true, blockNumber: 999, confirmations: 2}},
+		{name: "confirmed but not finalized", status: map[string]interface{}{"slot": 900, "confirmationStatus": "confirmed"},
+			want: txConfirmation{found: true, blockNumber: 900, confirmations: 1}},
+		{name: "processed in current slot", status: map[string]interface{}{"slot": 1000, "confirmationStatus": "processed"},
+			want: txConfirmation{found: true, blockNumber: 1000}},
+		{name: "failed", status: map[string]interface{}{"slot": 990, "confirmationStatus": "finalized", "err": map[string]interface{}{"InstructionError": []interface{}{0, "Custom"}}},
+			want: txConfirmation{found: true, failed: true, blockNumber: 990, confirmations: 10}},
+		{name: "rpc error", rpcErr: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "solana", jsonRPCStub{
+				"getSignatureStatuses": func([]json.RawMessage) interface{} {
+					if tt.rpcErr {
+						return &RPCError{Code: -32603, Message: "internal error"}
+					}
+					return map[string]interface{}{"value": []interface{}{tt.status}}
+				},
+			})
+			got, err := listener.scanner.TxConfirmation(listener, "sig1", 1000)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TxConfirmation error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("TxConfirmation = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolanaMatchReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		order     model.Order
+		wantMatch bool
+	}{
+		{name: "reference account", order: model.Order{PayReference: solReference, USDTAmount: decimal.RequireFromString("1.5")}, wantMatch: true},
+		{name: "memo trade no", order: model.Order{TradeNo: "ORDER123", USDTAmount: decimal.RequireFromString("1.5")}, wantMatch: true},
+		{name: "unique amount without reference", order: model.Order{UniqueAmount: decimal.RequireFromString("1.5")}, wantMatch: true},
+		{name: "reference for another wallet", order: model.Order{PayReference: solReference, USDTAmount: decimal.RequireFromString("1.5"),
+			ToAddress: strings.ToLower(solanaKey(5))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := setupSolanaToken(t)
+			listener := newTestChain(t, "solana", jsonRPCStub{}, solWallet)
+			// 同金额的另一笔待支付订单，按金额无法确定归属
+			model.GetDB().Create(&model.Order{TradeNo: "T0", OutTradeNo: "O0", Type: "usdt_solana", Chain: "solana", PayCurrency: "USDT",
+				ToAddress: strings.ToLower(solWallet), USDTAmount: decimal.RequireFromString("1.5"), Status: model.OrderStatusPending,
+				ExpiredAt: time.Now().Add(time.Hour)})
+			order := tt.order
+			if order.TradeNo == "" {
+				order.TradeNo = "T1"
+			}
+			if order.ToAddress == "" {
+				order.ToAddress = strings.ToLower(solWallet)
+			}
+			order.OutTradeNo, order.Type, order.Chain, order.PayCurrency = "O1", "usdt_solana", "solana", "USDT"
+			order.Status, order.ExpiredAt = model.OrderStatusPending, time.Now().Add(time.Hour)
+			model.GetDB().Create(&order)
+
+			// 付款 1.5 USDT，附带 reference 账户和订单号 memo
+			raw, _ := json.Marshal(incomingSPL("sig1", 1000, "1500000"))
+			transfers, err := listener.scanner.ParseTransfers(listener, raw, ScanWindow{Addresses: watched(solWallet), Token: token})
+			if err != nil || len(transfers) != 1 {
+				t.Fatalf("ParseTransfers = %+v, %v", transfers, err)
+			}
+			match := listener.scanner.(*solanaScanner).s.matchTransfer(transfers[0])
+			if matched := match.order != nil && match.order.ID == order.ID; matched != tt.wantMatch {
+				t.Fatalf("matched order = %v (note %s), want %v", matched, match.note, tt.wantMatch)
+			}
+			if tt.wantMatch && match.newStatus != model.OrderStatusPaid {
+				t.Errorf("new status = %d, want paid", match.newStatus)
+			}
+		})
+	}
+}
+
+// assertTransfers 按交易哈希顺序比较解析结果
+func assertTransfers(t *testing.T, got, want []Transfer) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d transfers %+v, want %d", len(got), got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Amount.Equal(w.Amount) {
+			t.Errorf("transfer %d amount = %s, want %s", i, g.Amount, w.Amount)
+		}
+		g.Amount, w.Amount = decimal.Zero, decimal.Zero
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("transfer %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
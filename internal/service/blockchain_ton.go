@@ -0,0 +1,536 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ezpay/internal/model"
+)
+
+const (
+	// tonTransferPageSize jetton/transfers 单页数量
+	tonTransferPageSize = 100
+	// tonMaxTransferPages 单个收款地址每轮最多翻页数
+	tonMaxTransferPages = 5
+	// tonInitialSeconds 首次启动时回溯的时间(秒)
+	tonInitialSeconds = 600
+	// tonScanOverlap 每轮查询与上一轮重叠的时间(秒)，防止索引延迟漏单，重复的交易按哈希去重
+	tonScanOverlap = 60
+	// tonRescanWindow 补扫每段的时间跨度(秒)
+	tonRescanWindow = 3600
+	// tonRescanMaxPages 补扫单个收款地址每段最多翻页数
+	tonRescanMaxPages = 50
+)
+
+// tonScanner TON Jetton 扫描器(toncenter v3 API)
+// 索引服务只收录已进入主链的交易，查询结果即为最终确认，不需要跟踪确认数
+// TON 区块按分片并行产生，listener.lastBlock 记录已扫描到的主链区块时间(Unix 秒)，转账的 BlockNumber 同样为交易时间
+// 钱包普遍支持转账备注(comment)，付款必须附带订单号作为备注，按备注匹配订单，不使用唯一标识金额
+type tonScanner struct {
+	s *BlockchainService
+}
+
+func newTONScanner(s *BlockchainService) *tonScanner {
+	return &tonScanner{s: s}
+}
+
+// tonJettonTransfer jetton/transfers 返回的转账记录
+// source/destination 为转账双方的钱包地址(raw 格式 0:HEX)，forward_payload 为附带消息的 BOC(base64)
+type tonJettonTransfer struct {
+	Source             string `json:"source"`
+	Destination        string `json:"destination"`
+	Amount             string `json:"amount"`
+	JettonMaster       string `json:"jetton_master"`
+	TransactionHash    string `json:"transaction_hash"`
+	TransactionNow     int64  `json:"transaction_now"`
+	TransactionAborted bool   `json:"transaction_aborted"`
+	ForwardPayload     string `json:"forward_payload"`
+}
+
+// tonGet 调用 toncenter v3 API，配置了 API Key 时附加到查询参数
+func (t *tonScanner) tonGet(listener *ChainListener, path string, query url.Values, result interface{}) error {
+	if listener.apiKey != "" {
+		query.Set("api_key", listener.apiKey)
+	}
+	resp, err := t.s.rpcClients[listener.chain].Get(path + "?" + query.Encode())
+	if err != nil {
+		t.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return err
+	}
+	if resp.StatusCode != 200 {
+		t.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	t.s.metrics.RecordRPCCall(listener.chain, true, 0)
+	return json.Unmarshal(body, result)
+}
+
+// LatestHeight 最新主链区块时间(Unix 秒)，与 listener.lastBlock 的单位一致
+func (t *tonScanner) LatestHeight(listener *ChainListener) (uint64, error) {
+	var info struct {
+		Last *struct {
+			GenUtime json.RawMessage `json:"gen_utime"` // 部分版本以字符串返回
+		} `json:"last"`
+	}
+	if err := t.tonGet(listener, "/api/v3/masterchainInfo", url.Values{}, &info); err != nil {
+		return 0, err
+	}
+	if info.Last == nil {
+		return 0, errors.New("empty masterchain info")
+	}
+	genUtime, err := strconv.ParseUint(strings.Trim(string(info.Last.GenUtime), `"`), 10, 64)
+	if err != nil || genUtime == 0 {
+		return 0, fmt.Errorf("invalid masterchain block time %s", info.Last.GenUtime)
+	}
+	return genUtime, nil
+}
+
+func (t *tonScanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	current, err := t.LatestHeight(listener)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get masterchain info: %w", err)
+	}
+	t.s.metrics.UpdateBlockHeight(listener.chain, current, listener.lastBlock)
+
+	if listener.lastBlock == 0 {
+		listener.lastBlock = current - tonInitialSeconds // 首次启动，只扫描最近的交易
+	}
+	startUtime := listener.lastBlock - tonScanOverlap
+
+	// 本轮扫描后的进度为最新主链区块时间，翻页未查完的地址从最后一条记录的时间继续
+	nextBlock := current
+	owners := t.s.walletCache.GetOriginalAddresses(listener.chain)
+
+	var transfers []Transfer
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		for _, owner := range owners {
+			ownerRaw, err := tonRawAddress(owner)
+			if err != nil {
+				log.Printf("[%s] Invalid wallet address %s: %v", listener.chain, owner, err)
+				continue
+			}
+
+			for page := 0; ; page++ {
+				if page == tonMaxTransferPages {
+					log.Printf("[%s] Too many %s transfers for %s, continuing next round", listener.chain, token.Symbol, owner)
+					break
+				}
+
+				parsed, count, last, err := t.transferPage(listener, &token, owner, ownerRaw, startUtime, current, page)
+				if err != nil {
+					return nil, err
+				}
+				transfers = append(transfers, parsed...)
+
+				if count < tonTransferPageSize {
+					break
+				}
+				if page == tonMaxTransferPages-1 && last > 0 && last < nextBlock {
+					nextBlock = last
+				}
+			}
+		}
+	}
+
+	if nextBlock > listener.lastBlock {
+		listener.lastBlock = nextBlock
+	}
+	return transfers, nil
+}
+
+// transferPage 查询收款地址在 start~end(Unix 秒)内转入的一页 Jetton 转账
+// 返回解析出的转账、本页条数和最后一条的交易时间
+func (t *tonScanner) transferPage(listener *ChainListener, token *model.Token, owner, ownerRaw string, start, end uint64, page int) ([]Transfer, int, uint64, error) {
+	query := url.Values{}
+	query.Set("owner_address", owner)
+	query.Set("jetton_master", token.Contract)
+	query.Set("direction", "in")
+	query.Set("start_utime", strconv.FormatUint(start, 10))
+	query.Set("end_utime", strconv.FormatUint(end, 10))
+	query.Set("limit", strconv.Itoa(tonTransferPageSize))
+	query.Set("offset", strconv.Itoa(page*tonTransferPageSize))
+	query.Set("sort", "asc")
+
+	var raw json.RawMessage
+	if err := t.tonGet(listener, "/api/v3/jetton/transfers", query, &raw); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to get %s transfers for %s: %w", token.Symbol, owner, err)
+	}
+
+	parsed, err := listener.scanner.ParseTransfers(listener, raw, ScanWindow{
+		Addresses:    map[string]bool{strings.ToLower(ownerRaw): true},
+		Token:        token,
+		CurrentBlock: end,
+	})
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to parse %s transfers for %s: %w", token.Symbol, owner, err)
+	}
+	// 收款地址换回登记时的格式，与订单收款地址一致
+	for i := range parsed {
+		parsed[i].To = owner
+	}
+
+	count, last := tonTransferPage(raw)
+	return parsed, count, last, nil
+}
+
+func (t *tonScanner) RescanUnit() string {
+	return RescanUnitTime
+}
+
+// RescanChunk 按时间补扫一段 Jetton 转账
+func (t *tonScanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	end := min(to, from+tonRescanWindow-1)
+
+	var transfers []Transfer
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		for _, owner := range t.s.walletCache.GetOriginalAddresses(listener.chain) {
+			ownerRaw, err := tonRawAddress(owner)
+			if err != nil {
+				continue
+			}
+			for page := 0; ; page++ {
+				if page == tonRescanMaxPages {
+					return nil, 0, fmt.Errorf("too many %s transfers for %s, narrow the time range", token.Symbol, owner)
+				}
+				parsed, count, _, err := t.transferPage(listener, &token, owner, ownerRaw, from, end, page)
+				if err != nil {
+					return nil, 0, err
+				}
+				transfers = append(transfers, parsed...)
+				if count < tonTransferPageSize {
+					break
+				}
+			}
+		}
+	}
+	return transfers, end, nil
+}
+
+// tonTransferPage 返回一页转账的条数和最后一条的交易时间
+func tonTransferPage(raw json.RawMessage) (int, uint64) {
+	var result struct {
+		JettonTransfers []tonJettonTransfer `json:"jetton_transfers"`
+	}
+	if json.Unmarshal(raw, &result) != nil || len(result.JettonTransfers) == 0 {
+		return 0, 0
+	}
+	last := result.JettonTransfers[len(result.JettonTransfers)-1]
+	return len(result.JettonTransfers), uint64(last.TransactionNow)
+}
+
+// ParseTransfers 解析 jetton/transfers 返回的转账列表，转账备注(text comment)作为付款引用
+// window.Addresses 为 raw 格式(小写)的收款地址，返回的收款地址为 raw 格式，由 ScanRange 换回登记时的地址
+func (t *tonScanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var result struct {
+		JettonTransfers []tonJettonTransfer `json:"jetton_transfers"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	if window.Token == nil {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	var transfers []Transfer
+	for _, tx := range result.JettonTransfers {
+		// 执行失败的转账没有到账
+		if tx.TransactionAborted || tx.TransactionHash == "" {
+			continue
+		}
+		if tx.JettonMaster != "" && !tonSameAddress(tx.JettonMaster, window.Token.Contract) {
+			continue
+		}
+		to, err := tonRawAddress(tx.Destination)
+		if err != nil || !window.Addresses[strings.ToLower(to)] {
+			continue
+		}
+
+		// 检查是否已处理
+		var count int64
+		model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", tx.TransactionHash).Count(&count)
+		if count > 0 {
+			t.s.metrics.RecordDuplicateTx(listener.chain)
+			continue
+		}
+
+		transfer := Transfer{
+			TxHash:      tx.TransactionHash,
+			From:        tx.Source,
+			To:          to,
+			Amount:      parseTokenAmount(tx.Amount, window.Token.Decimals),
+			Token:       window.Token.Symbol,
+			BlockNumber: uint64(tx.TransactionNow),
+			Chain:       listener.chain,
+		}
+		if comment := tonTextComment(tx.ForwardPayload); comment != "" {
+			transfer.References = []string{comment}
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+// TxConfirmation 查询交易是否已被索引，索引服务只收录主链已确认的交易，查到即视为达到确认数
+func (t *tonScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	var result struct {
+		Transactions []struct {
+			Now         int64 `json:"now"`
+			Description struct {
+				Aborted bool `json:"aborted"`
+			} `json:"description"`
+		} `json:"transactions"`
+	}
+	query := url.Values{}
+	query.Set("hash", txHash)
+	query.Set("limit", "1")
+	if err := t.tonGet(listener, "/api/v3/transactions", query, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Transactions) == 0 {
+		return &txConfirmation{}, nil
+	}
+
+	tx := result.Transactions[0]
+	return &txConfirmation{
+		found:         true,
+		failed:        tx.Description.Aborted,
+		blockNumber:   uint64(tx.Now),
+		confirmations: listener.confirmations,
+	}, nil
+}
+
+// ValidateAddress TON 地址: 用户友好格式(48 位 base64/base64url，含 CRC16 校验)或 raw 格式(workchain:64 位十六进制)
+func (t *tonScanner) ValidateAddress(address string) bool {
+	_, err := tonRawAddress(address)
+	return err == nil
+}
+
+// NormalizeAddress TON 地址区分大小写，保持原样(同一地址的 bounceable/non-bounceable 格式按 raw 格式比较)
+func (t *tonScanner) NormalizeAddress(address string) string {
+	return strings.TrimSpace(address)
+}
+
+// NewReference TON 订单以订单号作为转账备注
+func (t *tonScanner) NewReference(order *model.Order) string {
+	return order.TradeNo
+}
+
+// ReferenceRequired TON 付款必须附带备注，按备注匹配订单
+func (t *tonScanner) ReferenceRequired() bool {
+	return true
+}
+
+// PaymentURI 生成 TON 转账链接，支持的钱包(Tonkeeper 等)扫码后自动填写 Jetton、金额和备注
+func (t *tonScanner) PaymentURI(order *model.Order) string {
+	token, ok := GetTokenService().GetToken(order.Chain, order.PayCurrency)
+	if !ok || order.ToAddress == "" {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("jetton", token.Contract)
+	query.Set("amount", order.UniqueAmount.Shift(int32(token.Decimals)).Truncate(0).String())
+	query.Set("text", order.PayReference)
+	return "ton://transfer/" + order.ToAddress + "?" + query.Encode()
+}
+
+// tonRawAddress 将 TON 地址转换为 raw 格式(workchain:大写十六进制)
+func tonRawAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+
+	if wc, hash, ok := strings.Cut(address, ":"); ok {
+		workchain, err := strconv.ParseInt(wc, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid workchain %q", wc)
+		}
+		decoded, err := hex.DecodeString(hash)
+		if err != nil || len(decoded) != 32 {
+			return "", errors.New("invalid account id")
+		}
+		return fmt.Sprintf("%d:%X", workchain, decoded), nil
+	}
+
+	if len(address) != 48 {
+		return "", errors.New("invalid address length")
+	}
+	// 用户友好格式: 1 字节标志 + 1 字节 workchain + 32 字节账户 + 2 字节 CRC16
+	normalized := strings.NewReplacer("-", "+", "_", "/").Replace(address)
+	decoded, err := base64.StdEncoding.DecodeString(normalized)
+	if err != nil || len(decoded) != 36 {
+		return "", errors.New("invalid base64 address")
+	}
+	if binary.BigEndian.Uint16(decoded[34:]) != crc16XModem(decoded[:34]) {
+		return "", errors.New("invalid address checksum")
+	}
+	switch decoded[0] &^ 0x80 { // 最高位为测试网标志
+	case 0x11, 0x51: // bounceable / non-bounceable
+	default:
+		return "", errors.New("invalid address tag")
+	}
+	return fmt.Sprintf("%d:%X", int8(decoded[1]), decoded[2:34]), nil
+}
+
+// tonSameAddress 两个 TON 地址(任意格式)是否为同一账户
+func tonSameAddress(a, b string) bool {
+	rawA, errA := tonRawAddress(a)
+	rawB, errB := tonRawAddress(b)
+	return errA == nil && errB == nil && rawA == rawB
+}
+
+// crc16XModem CRC16-XMODEM(多项式 0x1021，初值 0)，TON 用户友好地址的校验和
+func crc16XModem(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// tonTextComment 解析 forward_payload 中的文本备注(op=0 + UTF-8 文本，超长部分按引用链续接)，不是文本备注时返回空
+func tonTextComment(payload string) string {
+	if payload == "" {
+		return ""
+	}
+	boc, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		if boc, err = base64.URLEncoding.DecodeString(payload); err != nil {
+			return ""
+		}
+	}
+	cells, root, err := parseBOC(boc)
+	if err != nil {
+		return ""
+	}
+
+	var text []byte
+	for i, index := 0, root; ; i++ {
+		cell := cells[index]
+		data := cell.data[:cell.bits/8]
+		if i == 0 {
+			if len(data) < 4 || binary.BigEndian.Uint32(data) != 0 {
+				return ""
+			}
+			data = data[4:]
+		}
+		text = append(text, data...)
+		if len(cell.refs) == 0 {
+			break
+		}
+		index = cell.refs[0]
+	}
+	if !utf8.Valid(text) {
+		return ""
+	}
+	return strings.TrimSpace(string(text))
+}
+
+// tonCell BOC 中的单元: 数据位和引用的单元序号
+type tonCell struct {
+	data []byte
+	bits int
+	refs []int
+}
+
+// parseBOC 解析单根的 BOC(bag of cells)，返回全部单元和根单元序号
+func parseBOC(boc []byte) ([]tonCell, int, error) {
+	errInvalid := errors.New("invalid boc")
+	if len(boc) < 6 || binary.BigEndian.Uint32(boc) != 0xb5ee9c72 {
+		return nil, 0, errInvalid
+	}
+	flags := boc[4]
+	hasIndex := flags&0x80 != 0
+	refSize := int(flags & 0x07)
+	offSize := int(boc[5])
+	if refSize == 0 || refSize > 4 || offSize == 0 || offSize > 8 {
+		return nil, 0, errInvalid
+	}
+
+	pos := 6
+	readUint := func(size int) (int, bool) {
+		if pos+size > len(boc) {
+			return 0, false
+		}
+		v := 0
+		for _, b := range boc[pos : pos+size] {
+			v = v<<8 | int(b)
+		}
+		pos += size
+		return v, true
+	}
+
+	cellCount, ok1 := readUint(refSize)
+	rootCount, ok2 := readUint(refSize)
+	_, ok3 := readUint(refSize) // absent
+	_, ok4 := readUint(offSize) // tot_cells_size
+	if !ok1 || !ok2 || !ok3 || !ok4 || rootCount != 1 || cellCount == 0 {
+		return nil, 0, errInvalid
+	}
+	root, ok := readUint(refSize)
+	if !ok || root >= cellCount {
+		return nil, 0, errInvalid
+	}
+	if hasIndex {
+		pos += cellCount * offSize
+	}
+
+	cells := make([]tonCell, cellCount)
+	for i := range cells {
+		if pos+2 > len(boc) {
+			return nil, 0, errInvalid
+		}
+		d1, d2 := boc[pos], boc[pos+1]
+		pos += 2
+		refCount := int(d1 & 0x07)
+		dataLen := int(d2+1) / 2
+		if refCount > 4 || pos+dataLen > len(boc) {
+			return nil, 0, errInvalid
+		}
+
+		data := boc[pos : pos+dataLen]
+		pos += dataLen
+		bits := dataLen * 8
+		if d2%2 == 1 && dataLen > 0 {
+			// 位数不是 8 的倍数时，末字节以 1 和若干 0 补齐
+			last := data[dataLen-1]
+			trailing := 0
+			for trailing < 8 && last&(1<<trailing) == 0 {
+				trailing++
+			}
+			bits -= trailing + 1
+		}
+
+		refs := make([]int, refCount)
+		for j := range refs {
+			ref, ok := readUint(refSize)
+			if !ok || ref >= cellCount || ref <= i {
+				return nil, 0, errInvalid
+			}
+			refs[j] = ref
+		}
+		cells[i] = tonCell{data: data, bits: bits, refs: refs}
+	}
+	return cells, root, nil
+}
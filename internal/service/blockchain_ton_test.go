@@ -0,0 +1,356 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// tonFriendly 生成用户友好格式地址(tag: 0x11 bounceable, 0x51 non-bounceable)
+func tonFriendly(tag byte, workchain int8, account []byte, urlSafe bool) string {
+	data := append([]byte{tag, byte(workchain)}, account...)
+	data = binary.BigEndian.AppendUint16(data, crc16XModem(data))
+	if urlSafe {
+		return base64.URLEncoding.EncodeToString(data)
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// tonCommentBOC 生成文本备注的 BOC，多段文本按引用链续接
+func tonCommentBOC(parts ...string) string {
+	var cells []byte
+	for i, part := range parts {
+		data := []byte(part)
+		if i == 0 {
+			data = append([]byte{0, 0, 0, 0}, data...)
+		}
+		refs := 0
+		if i < len(parts)-1 {
+			refs = 1
+		}
+		cells = append(cells, byte(refs), byte(2*len(data)))
+		cells = append(cells, data...)
+		if refs > 0 {
+			cells = append(cells, byte(i+1))
+		}
+	}
+	boc := []byte{0xb5, 0xee, 0x9c, 0x72, 0x01, 0x01, byte(len(parts)), 1, 0, byte(len(cells)), 0}
+	return base64.StdEncoding.EncodeToString(append(boc, cells...))
+}
+
+var (
+	tonWalletID  = bytes.Repeat([]byte{0x01}, 32)
+	tonWallet    = tonFriendly(0x51, 0, tonWalletID, true) // 登记的收款地址(non-bounceable)
+	tonWalletRaw = fmt.Sprintf("0:%X", tonWalletID)
+	tonMasterID  = bytes.Repeat([]byte{0xAA}, 32)
+	tonMaster    = fmt.Sprintf("0:%X", tonMasterID)
+	tonPayer     = fmt.Sprintf("0:%X", bytes.Repeat([]byte{0x02}, 32))
+)
+
+func setupTONToken(t *testing.T) *model.Token {
+	t.Helper()
+	db := setupTestDB(t)
+	token := &model.Token{Chain: "ton", Symbol: "USDT", Contract: tonMaster, Decimals: 6, Enabled: true}
+	db.Create(token)
+	return token
+}
+
+func tonTransfer(hash string, now int64, amount string) tonJettonTransfer {
+	return tonJettonTransfer{
+		Source:          tonPayer,
+		Destination:     tonWalletRaw,
+		Amount:          amount,
+		JettonMaster:    tonFriendly(0x11, 0, tonMasterID, false),
+		TransactionHash: hash,
+		TransactionNow:  now,
+		ForwardPayload:  tonCommentBOC("ORDER123"),
+	}
+}
+
+func TestTONRawAddress(t *testing.T) {
+	account := bytes.Repeat([]byte{0xAB}, 32)
+	want := fmt.Sprintf("0:%X", account)
+	bad := []byte(tonFriendly(0x11, 0, account, false))
+	bad[10] ^= 0x01
+
+	tests := []struct {
+		name    string
+		address string
+		want    string
+		wantErr bool
+	}{
+		{name: "raw lowercase", address: fmt.Sprintf("0:%x", account), want: want},
+		{name: "raw masterchain", address: fmt.Sprintf("-1:%X", account), want: fmt.Sprintf("-1:%X", account)},
+		{name: "bounceable", address: tonFriendly(0x11, 0, account, false), want: want},
+		{name: "non-bounceable url safe", address: tonFriendly(0x51, 0, account, true), want: want},
+		{name: "testnet", address: tonFriendly(0x91, 0, account, true), want: want},
+		{name: "bad checksum", address: string(bad), wantErr: true},
+		{name: "bad tag", address: tonFriendly(0x22, 0, account, true), wantErr: true},
+		{name: "bad length", address: "EQAB", wantErr: true},
+		{name: "bad account id", address: "0:abcd", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tonRawAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tonRawAddress(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("tonRawAddress(%q) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTONTextComment(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "single cell", payload: tonCommentBOC("ORDER123"), want: "ORDER123"},
+		{name: "continued in ref", payload: tonCommentBOC("ORDER", "123 "), want: "ORDER123"},
+		{name: "empty", payload: ""},
+		{name: "not base64", payload: "%%%"},
+		{name: "not a boc", payload: base64.StdEncoding.EncodeToString([]byte("hello world"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tonTextComment(tt.payload); got != tt.want {
+				t.Errorf("tonTextComment = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 非文本备注(op != 0)
+	boc, _ := base64.StdEncoding.DecodeString(tonCommentBOC("ORDER123"))
+	boc[13] = 0x0f
+	if got := tonTextComment(base64.StdEncoding.EncodeToString(boc)); got != "" {
+		t.Errorf("tonTextComment with non-zero op = %q, want empty", got)
+	}
+}
+
+func TestTONParseTransfers(t *testing.T) {
+	token := setupTONToken(t)
+	listener := newTestChain(t, "ton", http.NotFoundHandler(), tonWallet)
+	model.GetDB().Create(&model.TransactionLog{Chain: "ton", TxHash: "done"})
+
+	aborted := tonTransfer("aborted", 1700000000, "1000000")
+	aborted.TransactionAborted = true
+	otherJetton := tonTransfer("other-jetton", 1700000000, "1000000")
+	otherJetton.JettonMaster = tonPayer
+	otherWallet := tonTransfer("other-wallet", 1700000000, "1000000")
+	otherWallet.Destination = tonPayer
+	noMaster := tonTransfer("no-master", 1700000001, "2500000")
+	noMaster.JettonMaster = ""
+	noComment := tonTransfer("no-comment", 1700000002, "1000000")
+	noComment.ForwardPayload = ""
+
+	raw, _ := json.Marshal(map[string]interface{}{"jetton_transfers": []tonJettonTransfer{
+		tonTransfer("paid", 1700000000, "1500000"),
+		aborted,
+		otherJetton,
+		otherWallet,
+		tonTransfer("done", 1700000000, "1000000"),
+		noMaster,
+		noComment,
+	}})
+	got, err := listener.scanner.ParseTransfers(listener, raw, ScanWindow{Addresses: watched(tonWalletRaw), Token: token})
+	if err != nil {
+		t.Fatalf("ParseTransfers: %v", err)
+	}
+	assertTransfers(t, got, []Transfer{
+		{TxHash: "paid", From: tonPayer, To: tonWalletRaw, Amount: decimal.RequireFromString("1.5"), Token: "USDT",
+			BlockNumber: 1700000000, Chain: "ton", References: []string{"ORDER123"}},
+		{TxHash: "no-master", From: tonPayer, To: tonWalletRaw, Amount: decimal.RequireFromString("2.5"), Token: "USDT",
+			BlockNumber: 1700000001, Chain: "ton", References: []string{"ORDER123"}},
+		{TxHash: "no-comment", From: tonPayer, To: tonWalletRaw, Amount: decimal.RequireFromString("1"), Token: "USDT",
+			BlockNumber: 1700000002, Chain: "ton"},
+	})
+
+	if _, err := listener.scanner.ParseTransfers(listener, json.RawMessage(`{"jetton_transfers":`), ScanWindow{Token: token}); err == nil {
+		t.Error("ParseTransfers accepted malformed JSON")
+	}
+}
+
+func TestTONMatchComment(t *testing.T) {
+	tests := []struct {
+		name      string
+		comment   string // 转账备注 BOC，空表示未附带备注
+		wantMatch bool
+		wantNote  string
+	}{
+		{name: "comment is the trade no", comment: tonCommentBOC("ORDER123"), wantMatch: true, wantNote: model.MatchNotePaid},
+		{name: "comment of another order", comment: tonCommentBOC("ORDER999"), wantNote: model.MatchNoteNoReference},
+		{name: "no comment", wantNote: model.MatchNoteNoReference},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := setupTONToken(t)
+			listener := newTestChain(t, "ton", http.NotFoundHandler(), tonWallet)
+			// 订单唯一金额与转账金额相同，备注不符时也不能按金额匹配
+			order := model.Order{TradeNo: "ORDER123", OutTradeNo: "O1", Type: "usdt_ton", Chain: "ton", PayCurrency: "USDT",
+				ToAddress: strings.ToLower(tonWalletRaw), UniqueAmount: decimal.RequireFromString("1.5"), USDTAmount: decimal.RequireFromString("1.5"),
+				Status: model.OrderStatusPending, ExpiredAt: time.Now().Add(time.Hour)}
+			model.GetDB().Create(&order)
+
+			transfer := tonTransfer("tx1", 1700000000, "1500000")
+			transfer.ForwardPayload = tt.comment
+			raw, _ := json.Marshal(map[string]interface{}{"jetton_transfers": []tonJettonTransfer{transfer}})
+			transfers, err := listener.scanner.ParseTransfers(listener, raw, ScanWindow{Addresses: watched(tonWalletRaw), Token: token})
+			if err != nil || len(transfers) != 1 {
+				t.Fatalf("ParseTransfers = %+v, %v", transfers, err)
+			}
+			match := listener.scanner.(*tonScanner).s.matchTransfer(transfers[0])
+			if matched := match.order != nil && match.order.ID == order.ID; matched != tt.wantMatch || match.note != tt.wantNote {
+				t.Errorf("matched = %v note = %q, want %v and %q", matched, match.note, tt.wantMatch, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestTONScanRange(t *testing.T) {
+	setupTONToken(t)
+	const current = 1700000600
+	var queries []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/masterchainInfo":
+			fmt.Fprintf(w, `{"last":{"seqno":1,"gen_utime":"%d"}}`, current) // 部分版本以字符串返回
+		case "/api/v3/jetton/transfers":
+			q := r.URL.Query()
+			queries = append(queries, r.URL.RawQuery)
+			if q.Get("owner_address") != tonWallet || q.Get("jetton_master") != tonMaster || q.Get("direction") != "in" ||
+				q.Get("start_utime") != "1699999940" || q.Get("end_utime") != strconv.Itoa(current) || q.Get("api_key") != "secret" {
+				http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+				return
+			}
+			// 第一页满页，继续翻第二页
+			var page []tonJettonTransfer
+			if q.Get("offset") == "0" {
+				for i := 0; i < tonTransferPageSize; i++ {
+					page = append(page, tonTransfer(fmt.Sprintf("tx%03d", i), 1700000100, "1000000"))
+				}
+			} else {
+				page = append(page, tonTransfer("last", 1700000200, "2000000"))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"jetton_transfers": page})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	listener := newTestChain(t, "ton", handler, tonWallet)
+	listener.apiKey = "secret"
+	listener.lastBlock = 1700000000
+
+	got, err := listener.scanner.ScanRange(listener, watched(tonWallet))
+	if err != nil {
+		t.Fatalf("ScanRange: %v (queries %v)", err, queries)
+	}
+	if len(got) != tonTransferPageSize+1 || len(queries) != 2 {
+		t.Fatalf("got %d transfers in %d pages, want %d in 2", len(got), len(queries), tonTransferPageSize+1)
+	}
+	last := got[len(got)-1]
+	// 收款地址换回登记时的格式，与订单收款地址一致
+	if last.TxHash != "last" || last.To != tonWallet || !last.Amount.Equal(decimal.RequireFromString("2")) {
+		t.Errorf("last transfer = %+v", last)
+	}
+	if listener.lastBlock != current {
+		t.Errorf("lastBlock = %d, want %d", listener.lastBlock, current)
+	}
+}
+
+func TestTONScanRangeErrors(t *testing.T) {
+	setupTONToken(t)
+	info := func(w http.ResponseWriter) { fmt.Fprint(w, `{"last":{"gen_utime":1700000600}}`) }
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "masterchain info http error", handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}},
+		{name: "masterchain info empty", handler: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"last":null}`)
+		}},
+		{name: "masterchain info invalid time", handler: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"last":{"gen_utime":"soon"}}`)
+		}},
+		{name: "transfers rate limited", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v3/masterchainInfo" {
+				info(w)
+				return
+			}
+			http.Error(w, `{"error":"Ratelimit exceed"}`, http.StatusTooManyRequests)
+		}},
+		{name: "transfers malformed", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v3/masterchainInfo" {
+				info(w)
+				return
+			}
+			fmt.Fprint(w, `{"jetton_transfers":{}}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "ton", tt.handler, tonWallet)
+			listener.lastBlock = 1700000000
+			if _, err := listener.scanner.ScanRange(listener, watched(tonWallet)); err == nil {
+				t.Fatal("ScanRange returned no error")
+			}
+			if listener.lastBlock != 1700000000 {
+				t.Errorf("lastBlock advanced to %d after a failed scan", listener.lastBlock)
+			}
+		})
+	}
+}
+
+func TestTONTxConfirmation(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		want    txConfirmation
+		wantErr bool
+	}{
+		{name: "not indexed", body: `{"transactions":[]}`, want: txConfirmation{}},
+		{name: "indexed", body: `{"transactions":[{"now":1700000000,"description":{"aborted":false}}]}`,
+			want: txConfirmation{found: true, blockNumber: 1700000000, confirmations: 2}},
+		{name: "aborted", body: `{"transactions":[{"now":1700000000,"description":{"aborted":true}}]}`,
+			want: txConfirmation{found: true, failed: true, blockNumber: 1700000000, confirmations: 2}},
+		{name: "http error", body: `{"error":"invalid hash"}`, status: http.StatusUnprocessableEntity, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "ton", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/transactions" || r.URL.Query().Get("hash") != "abc" {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			got, err := listener.scanner.TxConfirmation(listener, "abc", 1700000600)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TxConfirmation error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("TxConfirmation = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
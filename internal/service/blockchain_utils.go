@@ -7,6 +7,8 @@ import (
 	"math/big"
 	"strings"
 
+	"ezpay/internal/util"
+
 	"github.com/shopspring/decimal"
 )
 
@@ -182,7 +184,7 @@ func normalizeAddress(addr string, chain string) string {
 	addr = strings.TrimSpace(addr)
 
 	// For Tron chains, ensure base58 format
-	if chain == "trx" || chain == "trc20" {
+	if util.IsTronChain(chain) {
 		// If it's hex format, convert to base58
 		if strings.HasPrefix(addr, "41") {
 			addr = hexToBase58(addr)
@@ -0,0 +1,526 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+)
+
+const (
+	// utxoDecimals BTC/LTC 精度(1 聪 = 1e-8)
+	utxoDecimals = 8
+	// utxoPageSize Esplora 地址交易列表每页返回的已确认交易数
+	utxoPageSize = 25
+	// utxoMaxPages 单个地址每轮最多翻页数
+	utxoMaxPages = 5
+	// utxoInitialBlocks 首次启动时回溯的区块数
+	utxoInitialBlocks = 6
+	// utxoRescanMaxPages 补扫单个地址最多翻页数
+	utxoRescanMaxPages = 200
+)
+
+// UTXO 地址脚本类型
+const (
+	utxoScriptP2PKH      = "p2pkh"       // 传统地址(1.../L...)
+	utxoScriptP2SHP2WPKH = "p2sh-p2wpkh" // 兼容隔离见证地址(3.../M...)
+	utxoScriptP2WPKH     = "p2wpkh"      // 原生隔离见证地址(bc1q.../ltc1q...)
+)
+
+// utxoNetwork UTXO 链地址参数
+type utxoNetwork struct {
+	Bech32HRP  string // 隔离见证地址前缀
+	PubKeyHash byte   // P2PKH 版本字节
+	ScriptHash byte   // P2SH 版本字节
+	LegacyP2SH byte   // 旧版 P2SH 版本字节(LTC 曾与 BTC 共用 0x05)，0 表示没有
+	URIScheme  string // 付款链接协议(BIP21)
+}
+
+// utxoNetworks 按 HD 链族登记的主网地址参数
+var utxoNetworks = map[string]utxoNetwork{
+	model.HDFamilyBTC: {Bech32HRP: "bc", PubKeyHash: 0x00, ScriptHash: 0x05, URIScheme: "bitcoin"},
+	model.HDFamilyLTC: {Bech32HRP: "ltc", PubKeyHash: 0x30, ScriptHash: 0x32, LegacyP2SH: 0x05, URIScheme: "litecoin"},
+}
+
+// utxoScanner UTXO 链原生币扫描器(Esplora API，如 blockstream.info、mempool.space、litecoinspace.org)
+// 按收款地址逐个查询交易列表，内存池中的交易记为已检测，确认数达到要求后结算
+// 一笔交易可以同时付款给多个地址，转账以输出(txid:vout)为单位，TxHash 记录为 txid:vout
+type utxoScanner struct {
+	s       *BlockchainService
+	network utxoNetwork
+	valid   bool // 链有对应的地址参数(配置文件新增的 UTXO 链没有时无法校验地址)
+}
+
+func newUTXOScanner(s *BlockchainService, info util.ChainInfo) *utxoScanner {
+	network, ok := utxoNetworks[model.ChainHDFamily(info.ID)]
+	return &utxoScanner{s: s, network: network, valid: ok}
+}
+
+// esploraTx Esplora 交易
+type esploraTx struct {
+	TxID string `json:"txid"`
+	Vin  []struct {
+		Prevout *struct {
+			ScriptPubKeyAddress string `json:"scriptpubkey_address"`
+		} `json:"prevout"`
+	} `json:"vin"`
+	Vout []struct {
+		ScriptPubKeyAddress string `json:"scriptpubkey_address"`
+		Value               int64  `json:"value"`
+	} `json:"vout"`
+	Status esploraTxStatus `json:"status"`
+}
+
+// esploraTxStatus Esplora 交易确认状态
+type esploraTxStatus struct {
+	Confirmed   bool   `json:"confirmed"`
+	BlockHeight uint64 `json:"block_height"`
+	BlockHash   string `json:"block_hash"`
+}
+
+// esploraGet 调用 Esplora API，返回响应体和 HTTP 状态码
+func (u *utxoScanner) esploraGet(listener *ChainListener, path string) ([]byte, int, error) {
+	resp, err := u.s.rpcClients[listener.chain].Get(path)
+	if err != nil {
+		u.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		u.s.metrics.RecordRPCCall(listener.chain, false, 0)
+		return nil, 0, err
+	}
+	u.s.metrics.RecordRPCCall(listener.chain, resp.StatusCode == http.StatusOK, 0)
+	return body, resp.StatusCode, nil
+}
+
+func (u *utxoScanner) LatestHeight(listener *ChainListener) (uint64, error) {
+	body, status, err := u.esploraGet(listener, "/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(body)), 10, 64)
+}
+
+func (u *utxoScanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	current, err := u.LatestHeight(listener)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tip height: %w", err)
+	}
+	u.s.metrics.UpdateBlockHeight(listener.chain, current, listener.lastBlock)
+
+	if listener.lastBlock == 0 && current > utxoInitialBlocks {
+		listener.lastBlock = current - utxoInitialBlocks // 首次启动，只扫描最近的区块
+	}
+	// 上一轮已达到确认数的区块之前的交易都已处理，不再翻页查询
+	var settled uint64
+	if listener.lastBlock > uint64(listener.confirmations) {
+		settled = listener.lastBlock - uint64(listener.confirmations)
+	}
+
+	var transfers []Transfer
+	for _, address := range u.s.walletCache.GetOriginalAddresses(listener.chain) {
+		path := "/address/" + url.PathEscape(address) + "/txs"
+		for page := 0; page < utxoMaxPages; page++ {
+			body, status, err := u.esploraGet(listener, path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get transactions for %s: %w", address, err)
+			}
+			if status == http.StatusBadRequest {
+				// 地址格式不被节点接受(如网络不匹配)，跳过该地址
+				log.Printf("[%s] Invalid wallet address %s: %s", listener.chain, address, strings.TrimSpace(string(body)))
+				break
+			}
+			if status != http.StatusOK {
+				return nil, fmt.Errorf("failed to get transactions for %s: HTTP %d", address, status)
+			}
+
+			// 只保留发往该地址的输出，同一交易付款给多个收款地址时在各自地址的查询中处理
+			parsed, err := listener.scanner.ParseTransfers(listener, body, ScanWindow{
+				Addresses:    map[string]bool{strings.ToLower(address): true},
+				CurrentBlock: current,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse transactions for %s: %w", address, err)
+			}
+			transfers = append(transfers, parsed...)
+
+			lastTxID, lastHeight, count := esploraConfirmedPage(body)
+			if count < utxoPageSize || lastHeight <= settled {
+				break
+			}
+			path = "/address/" + url.PathEscape(address) + "/txs/chain/" + lastTxID
+			if page == utxoMaxPages-1 {
+				log.Printf("[%s] Too many transactions for %s, older ones skipped", listener.chain, address)
+			}
+		}
+	}
+
+	listener.lastBlock = current
+	return transfers, nil
+}
+
+func (u *utxoScanner) RescanUnit() string {
+	return RescanUnitBlock
+}
+
+// RescanChunk 补扫 from~to 区块内已达到确认数的转账
+// 地址交易列表只能从新到旧翻页，一次查完整个范围
+func (u *utxoScanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	current, err := u.LatestHeight(listener)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get tip height: %w", err)
+	}
+
+	var transfers []Transfer
+	for _, address := range u.s.walletCache.GetOriginalAddresses(listener.chain) {
+		path := "/address/" + url.PathEscape(address) + "/txs/chain"
+		for page := 0; ; page++ {
+			if page == utxoRescanMaxPages {
+				return nil, 0, fmt.Errorf("too many transactions for %s, narrow the block range", address)
+			}
+			body, status, err := u.esploraGet(listener, path)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to get transactions for %s: %w", address, err)
+			}
+			if status == http.StatusBadRequest {
+				break
+			}
+			if status != http.StatusOK {
+				return nil, 0, fmt.Errorf("failed to get transactions for %s: HTTP %d", address, status)
+			}
+
+			parsed, err := listener.scanner.ParseTransfers(listener, body, ScanWindow{
+				Addresses:    map[string]bool{strings.ToLower(address): true},
+				CurrentBlock: current,
+			})
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to parse transactions for %s: %w", address, err)
+			}
+			for _, transfer := range parsed {
+				if !transfer.Unconfirmed && transfer.BlockNumber >= from && transfer.BlockNumber <= to {
+					transfers = append(transfers, transfer)
+				}
+			}
+
+			lastTxID, lastHeight, count := esploraConfirmedPage(body)
+			if count < utxoPageSize || lastHeight < from {
+				break
+			}
+			path = "/address/" + url.PathEscape(address) + "/txs/chain/" + lastTxID
+		}
+	}
+	return transfers, to, nil
+}
+
+// esploraConfirmedPage 返回一页交易中最后一笔已确认交易、其区块高度和已确认交易数(翻页使用)
+func esploraConfirmedPage(body []byte) (string, uint64, int) {
+	var txs []esploraTx
+	if json.Unmarshal(body, &txs) != nil {
+		return "", 0, 0
+	}
+	var lastTxID string
+	var lastHeight uint64
+	count := 0
+	for _, tx := range txs {
+		if tx.Status.Confirmed {
+			lastTxID, lastHeight = tx.TxID, tx.Status.BlockHeight
+			count++
+		}
+	}
+	return lastTxID, lastHeight, count
+}
+
+// ParseTransfers 解析 Esplora 地址交易列表，每个发往收款地址的输出为一笔转账
+// 内存池中(确认数 0)和确认数不足的交易标记为未确认，由确认跟踪流程处理
+func (u *utxoScanner) ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error) {
+	var txs []esploraTx
+	if err := json.Unmarshal(raw, &txs); err != nil {
+		return nil, err
+	}
+
+	var transfers []Transfer
+	for _, tx := range txs {
+		var from string
+		if len(tx.Vin) > 0 && tx.Vin[0].Prevout != nil {
+			from = tx.Vin[0].Prevout.ScriptPubKeyAddress
+		}
+
+		confirmations := 0
+		if tx.Status.Confirmed && window.CurrentBlock >= tx.Status.BlockHeight {
+			confirmations = int(window.CurrentBlock-tx.Status.BlockHeight) + 1
+		}
+
+		for index, out := range tx.Vout {
+			if out.Value <= 0 || !window.Addresses[strings.ToLower(out.ScriptPubKeyAddress)] {
+				continue
+			}
+			txHash := tx.TxID + ":" + strconv.Itoa(index)
+
+			// 检查是否已处理
+			var count int64
+			model.GetDB().Model(&model.TransactionLog{}).Where("tx_hash = ?", txHash).Count(&count)
+			if count > 0 {
+				u.s.metrics.RecordDuplicateTx(listener.chain)
+				continue
+			}
+
+			transfer := Transfer{
+				TxHash:      txHash,
+				From:        from,
+				To:          out.ScriptPubKeyAddress,
+				Amount:      parseTokenAmount(strconv.FormatInt(out.Value, 10), utxoDecimals),
+				Token:       model.NativeToken(listener.chain),
+				BlockNumber: tx.Status.BlockHeight,
+				BlockHash:   tx.Status.BlockHash,
+				Chain:       listener.chain,
+			}
+			if confirmations < listener.confirmations {
+				transfer.Unconfirmed = true
+				transfer.Confirmations = confirmations
+			}
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers, nil
+}
+
+// TxConfirmation 查询交易确认情况，txHash 为 txid:vout
+// 交易被替换(RBF)或双花后查不到，超时后由确认跟踪流程回退订单
+func (u *utxoScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	txid, _, _ := strings.Cut(txHash, ":")
+	body, status, err := u.esploraGet(listener, "/tx/"+txid+"/status")
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return &txConfirmation{}, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+	}
+
+	var txStatus esploraTxStatus
+	if err := json.Unmarshal(body, &txStatus); err != nil {
+		return nil, err
+	}
+	conf := &txConfirmation{found: true}
+	if txStatus.Confirmed {
+		conf.blockNumber = txStatus.BlockHeight
+		conf.blockHash = txStatus.BlockHash
+		if currentBlock >= txStatus.BlockHeight {
+			conf.confirmations = int(currentBlock-txStatus.BlockHeight) + 1
+		}
+	}
+	return conf, nil
+}
+
+// ValidateAddress 校验链的地址格式: Base58Check(P2PKH/P2SH)或 Bech32/Bech32m(隔离见证)
+func (u *utxoScanner) ValidateAddress(address string) bool {
+	if !u.valid {
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(address), u.network.Bech32HRP+"1") {
+		_, _, err := segwitAddressDecode(u.network.Bech32HRP, address)
+		return err == nil
+	}
+
+	version, payload, err := base58CheckDecode(address)
+	if err != nil || len(payload) != 20 {
+		return false
+	}
+	return version == u.network.PubKeyHash || version == u.network.ScriptHash ||
+		(u.network.LegacyP2SH != 0 && version == u.network.LegacyP2SH)
+}
+
+// NormalizeAddress 隔离见证地址统一为小写，Base58 地址区分大小写保持原样
+func (u *utxoScanner) NormalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if u.valid && strings.HasPrefix(strings.ToLower(address), u.network.Bech32HRP+"1") {
+		return strings.ToLower(address)
+	}
+	return address
+}
+
+// NewReference UTXO 链按收款地址(派生地址)或唯一金额匹配订单，不使用付款引用
+func (u *utxoScanner) NewReference(order *model.Order) string {
+	return ""
+}
+
+// ReferenceRequired UTXO 链付款不附带引用
+func (u *utxoScanner) ReferenceRequired() bool {
+	return false
+}
+
+// PaymentURI 生成 BIP21 付款链接，钱包扫码后自动填写地址和金额
+func (u *utxoScanner) PaymentURI(order *model.Order) string {
+	if !u.valid || order.ToAddress == "" {
+		return ""
+	}
+	return u.network.URIScheme + ":" + order.ToAddress + "?amount=" + order.UniqueAmount.String()
+}
+
+// base58CheckEncode Base58Check 编码: 版本字节 + 数据 + 4 字节校验和
+func base58CheckEncode(version byte, payload []byte) string {
+	data := append([]byte{version}, payload...)
+	return base58Encode(append(data, doubleSHA256(data)[:4]...))
+}
+
+// base58CheckDecode Base58Check 解码，返回版本字节和数据
+func base58CheckDecode(address string) (byte, []byte, error) {
+	data, err := base58Decode(address)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 5 {
+		return 0, nil, errors.New("invalid length")
+	}
+	if !bytes.Equal(doubleSHA256(data[:len(data)-4])[:4], data[len(data)-4:]) {
+		return 0, nil, errors.New("invalid checksum")
+	}
+	return data[0], data[1 : len(data)-4], nil
+}
+
+// Bech32 编码(BIP173)，见证版本 1 及以上使用 Bech32m(BIP350)
+const (
+	bech32Charset   = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Const     = 1
+	bech32mConst    = 0x2bc830a3
+	bech32MaxLength = 90
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits 按位重新分组(8 位 <-> 5 位)
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<toBits - 1
+	var out []byte
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("invalid data")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+// segwitAddressEncode 编码隔离见证地址
+func segwitAddressEncode(hrp string, version byte, program []byte) (string, error) {
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	data = append([]byte{version}, data...)
+
+	constant := uint32(bech32Const)
+	if version > 0 {
+		constant = bech32mConst
+	}
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ constant
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range data {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String(), nil
+}
+
+// segwitAddressDecode 解码并校验隔离见证地址，返回见证版本和见证程序
+func segwitAddressDecode(hrp, address string) (byte, []byte, error) {
+	if len(address) > bech32MaxLength || (strings.ToLower(address) != address && strings.ToUpper(address) != address) {
+		return 0, nil, errors.New("invalid bech32 string")
+	}
+	address = strings.ToLower(address)
+	pos := strings.LastIndexByte(address, '1')
+	if pos < 1 || pos+7 > len(address) || address[:pos] != hrp {
+		return 0, nil, errors.New("invalid bech32 prefix")
+	}
+
+	data := make([]byte, 0, len(address)-pos-1)
+	for i := pos + 1; i < len(address); i++ {
+		v := strings.IndexByte(bech32Charset, address[i])
+		if v < 0 {
+			return 0, nil, errors.New("invalid bech32 character")
+		}
+		data = append(data, byte(v))
+	}
+	if len(data) < 7 {
+		return 0, nil, errors.New("invalid bech32 data")
+	}
+
+	version := data[0]
+	constant := uint32(bech32Const)
+	if version > 0 {
+		constant = bech32mConst
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), data...)) != constant {
+		return 0, nil, errors.New("invalid bech32 checksum")
+	}
+
+	program, err := convertBits(data[1:len(data)-6], 5, 8, false)
+	if err != nil {
+		return 0, nil, err
+	}
+	if version > 16 || len(program) < 2 || len(program) > 40 || (version == 0 && len(program) != 20 && len(program) != 32) {
+		return 0, nil, errors.New("invalid witness program")
+	}
+	return version, program, nil
+}
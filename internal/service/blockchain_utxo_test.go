@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+)
+
+func segwitAddress(hrp string, b byte) string {
+	address, _ := segwitAddressEncode(hrp, 0, bytes.Repeat([]byte{b}, 20))
+	return address
+}
+
+var (
+	btcWallet = segwitAddress("bc", 0x11)
+	btcChange = segwitAddress("bc", 0x22)
+	btcPayer  = base58CheckEncode(0x00, bytes.Repeat([]byte{0x33}, 20))
+)
+
+// esploraTxJSON Esplora 交易，outputs 为 地址 -> 聪，height 为 0 表示在内存池中
+type esploraOut struct {
+	address string
+	value   int64
+}
+
+func esploraTxJSON(txid string, height uint64, outputs ...esploraOut) map[string]interface{} {
+	vout := make([]map[string]interface{}, len(outputs))
+	for i, out := range outputs {
+		vout[i] = map[string]interface{}{"scriptpubkey_address": out.address, "value": out.value}
+	}
+	status := map[string]interface{}{"confirmed": false}
+	if height > 0 {
+		status = map[string]interface{}{"confirmed": true, "block_height": height, "block_hash": fmt.Sprintf("hash%d", height)}
+	}
+	return map[string]interface{}{
+		"txid":   txid,
+		"vin":    []map[string]interface{}{{"prevout": map[string]interface{}{"scriptpubkey_address": btcPayer}}},
+		"vout":   vout,
+		"status": status,
+	}
+}
+
+func TestUTXOValidateAddress(t *testing.T) {
+	btc := newUTXOScanner(nil, utxoChain(t, "btc"))
+	ltc := newUTXOScanner(nil, utxoChain(t, "ltc"))
+	payload := bytes.Repeat([]byte{0x44}, 20)
+	badChecksum := []byte(base58CheckEncode(0x00, payload))
+	badChecksum[len(badChecksum)-1] ^= 0x01
+
+	tests := []struct {
+		name    string
+		scanner *utxoScanner
+		address string
+		want    bool
+	}{
+		{name: "btc bech32 vector", scanner: btc, address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", want: true},
+		{name: "btc bech32 uppercase", scanner: btc, address: "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", want: true},
+		{name: "btc bech32 mixed case", scanner: btc, address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7KV8f3t4"},
+		{name: "btc bech32 bad checksum", scanner: btc, address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5"},
+		{name: "btc p2pkh", scanner: btc, address: base58CheckEncode(0x00, payload), want: true},
+		{name: "btc p2sh", scanner: btc, address: base58CheckEncode(0x05, payload), want: true},
+		{name: "btc base58 bad checksum", scanner: btc, address: string(badChecksum)},
+		{name: "btc rejects ltc address", scanner: btc, address: base58CheckEncode(0x30, payload)},
+		{name: "ltc bech32", scanner: ltc, address: segwitAddress("ltc", 0x44), want: true},
+		{name: "ltc p2pkh", scanner: ltc, address: base58CheckEncode(0x30, payload), want: true},
+		{name: "ltc p2sh", scanner: ltc, address: base58CheckEncode(0x32, payload), want: true},
+		{name: "ltc legacy p2sh", scanner: ltc, address: base58CheckEncode(0x05, payload), want: true},
+		{name: "ltc rejects btc bech32", scanner: ltc, address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scanner.ValidateAddress(tt.address); got != tt.want {
+				t.Errorf("ValidateAddress(%q) = %v, want %v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUTXOParseTransfers(t *testing.T) {
+	setupTestDB(t)
+	listener := newTestChain(t, "btc", http.NotFoundHandler(), btcWallet)
+	model.GetDB().Create(&model.TransactionLog{Chain: "btc", TxHash: "done:0"})
+
+	raw, _ := json.Marshal([]map[string]interface{}{
+		esploraTxJSON("mempool", 0, esploraOut{btcWallet, 50000}),
+		esploraTxJSON("shallow", 850010, esploraOut{btcChange, 1000}, esploraOut{btcWallet, 120000}),
+		esploraTxJSON("deep", 850000, esploraOut{btcWallet, 100000000}, esploraOut{btcWallet, 1}),
+		esploraTxJSON("other", 850000, esploraOut{btcChange, 100000}),
+		esploraTxJSON("done", 850000, esploraOut{btcWallet, 100000}),
+		esploraTxJSON("dust", 850000, esploraOut{btcWallet, 0}),
+	})
+	got, err := listener.scanner.ParseTransfers(listener, raw, ScanWindow{Addresses: watched(btcWallet), CurrentBlock: 850010})
+	if err != nil {
+		t.Fatalf("ParseTransfers: %v", err)
+	}
+	assertTransfers(t, got, []Transfer{
+		{TxHash: "mempool:0", From: btcPayer, To: btcWallet, Amount: decimal.RequireFromString("0.0005"), Token: "BTC",
+			Chain: "btc", Unconfirmed: true},
+		{TxHash: "shallow:1", From: btcPayer, To: btcWallet, Amount: decimal.RequireFromString("0.0012"), Token: "BTC",
+			BlockNumber: 850010, BlockHash: "hash850010", Chain: "btc", Unconfirmed: true, Confirmations: 1},
+		{TxHash: "deep:0", From: btcPayer, To: btcWallet, Amount: decimal.RequireFromString("1"), Token: "BTC",
+			BlockNumber: 850000, BlockHash: "hash850000", Chain: "btc"},
+		{TxHash: "deep:1", From: btcPayer, To: btcWallet, Amount: decimal.RequireFromString("0.00000001"), Token: "BTC",
+			BlockNumber: 850000, BlockHash: "hash850000", Chain: "btc"},
+	})
+
+	if _, err := listener.scanner.ParseTransfers(listener, json.RawMessage(`{"error":"x"}`), ScanWindow{}); err == nil {
+		t.Error("ParseTransfers accepted a non-array response")
+	}
+}
+
+func TestUTXOScanRange(t *testing.T) {
+	setupTestDB(t)
+	rejected := base58CheckEncode(0x6f, bytes.Repeat([]byte{0x55}, 20)) // 测试网地址，节点返回 400
+
+	var paths []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var txs []map[string]interface{}
+		switch r.URL.Path {
+		case "/blocks/tip/height":
+			fmt.Fprint(w, "850010\n")
+			return
+		case "/address/" + rejected + "/txs":
+			http.Error(w, "Invalid Bitcoin address", http.StatusBadRequest)
+			return
+		case "/address/" + btcWallet + "/txs":
+			// 内存池交易 + 一整页已确认交易，继续翻页
+			txs = append(txs, esploraTxJSON("mempool", 0, esploraOut{btcWallet, 1000}))
+			for i := 0; i < utxoPageSize; i++ {
+				txs = append(txs, esploraTxJSON(fmt.Sprintf("p1-%02d", i), 850005, esploraOut{btcWallet, 1000}))
+			}
+		case "/address/" + btcWallet + "/txs/chain/p1-24":
+			for i := 0; i < 3; i++ {
+				txs = append(txs, esploraTxJSON(fmt.Sprintf("p2-%02d", i), 849999, esploraOut{btcWallet, 1000}))
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(txs)
+	})
+	listener := newTestChain(t, "btc", handler, rejected, btcWallet)
+	listener.lastBlock = 850000
+
+	got, err := listener.scanner.ScanRange(listener, watched(rejected, btcWallet))
+	if err != nil {
+		t.Fatalf("ScanRange: %v (paths %v)", err, paths)
+	}
+	if len(got) != 1+utxoPageSize+3 {
+		t.Errorf("got %d transfers, want %d (paths %v)", len(got), 1+utxoPageSize+3, paths)
+	}
+	var unconfirmed int
+	for _, transfer := range got {
+		if transfer.Unconfirmed {
+			unconfirmed++
+		}
+	}
+	if unconfirmed != 1 {
+		t.Errorf("%d unconfirmed transfers, want only the mempool one", unconfirmed)
+	}
+	if listener.lastBlock != 850010 {
+		t.Errorf("lastBlock = %d, want 850010", listener.lastBlock)
+	}
+}
+
+func TestUTXOScanRangeSplitOutputs(t *testing.T) {
+	db := setupTestDB(t)
+	// 两个订单的独立派生地址，同一笔交易分别付款给两个订单并找零
+	orderA, orderB := segwitAddress("bc", 0xA1), segwitAddress("bc", 0xB2)
+	split := esploraTxJSON("split", 850000, esploraOut{orderA, 100000}, esploraOut{btcChange, 5000}, esploraOut{orderB, 200000})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blocks/tip/height":
+			fmt.Fprint(w, "850010")
+		case "/address/" + orderA + "/txs", "/address/" + orderB + "/txs":
+			json.NewEncoder(w).Encode([]map[string]interface{}{split})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	listener := newTestChain(t, "btc", handler, orderA, orderB)
+	listener.lastBlock = 850005
+
+	var orders []model.Order
+	for i, address := range []string{orderA, orderB} {
+		order := model.Order{TradeNo: fmt.Sprintf("T%d", i), OutTradeNo: fmt.Sprintf("O%d", i), Type: "btc", Chain: "btc", PayCurrency: "BTC",
+			ToAddress: address, USDTAmount: decimal.RequireFromString("0.001").Mul(decimal.NewFromInt(int64(i + 1))), HDWalletID: 1,
+			Status: model.OrderStatusPending, ExpiredAt: time.Now().Add(time.Hour)}
+		db.Create(&order)
+		orders = append(orders, order)
+	}
+
+	got, err := listener.scanner.ScanRange(listener, watched(orderA, orderB))
+	if err != nil {
+		t.Fatalf("ScanRange: %v", err)
+	}
+	assertTransfers(t, got, []Transfer{
+		{TxHash: "split:0", From: btcPayer, To: orderA, Amount: decimal.RequireFromString("0.001"), Token: "BTC",
+			BlockNumber: 850000, BlockHash: "hash850000", Chain: "btc"},
+		{TxHash: "split:2", From: btcPayer, To: orderB, Amount: decimal.RequireFromString("0.002"), Token: "BTC",
+			BlockNumber: 850000, BlockHash: "hash850000", Chain: "btc"},
+	})
+	for i, transfer := range got {
+		match := listener.scanner.(*utxoScanner).s.matchTransfer(transfer)
+		if match.order == nil || match.order.ID != orders[i].ID || match.newStatus != model.OrderStatusPaid {
+			t.Errorf("%s matched %+v (note %s), want order %s paid", transfer.TxHash, match.order, match.note, orders[i].TradeNo)
+		}
+	}
+}
+
+func TestUTXOScanRangeErrors(t *testing.T) {
+	setupTestDB(t)
+	tip := func(w http.ResponseWriter) { fmt.Fprint(w, "850010") }
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{name: "tip height unavailable", handler: func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "upstream down", http.StatusServiceUnavailable)
+		}},
+		{name: "tip height not a number", handler: func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<html>")
+		}},
+		{name: "address txs rate limited", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/blocks/tip/height" {
+				tip(w)
+				return
+			}
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		}},
+		{name: "address txs malformed", handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/blocks/tip/height" {
+				tip(w)
+				return
+			}
+			fmt.Fprint(w, `{"txs":[]}`)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "btc", tt.handler, btcWallet)
+			listener.lastBlock = 850000
+			if _, err := listener.scanner.ScanRange(listener, watched(btcWallet)); err == nil {
+				t.Fatal("ScanRange returned no error")
+			}
+			if listener.lastBlock != 850000 {
+				t.Errorf("lastBlock advanced to %d after a failed scan", listener.lastBlock)
+			}
+		})
+	}
+}
+
+func TestUTXOTxConfirmation(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    txConfirmation
+		wantErr bool
+	}{
+		{name: "replaced or unknown", status: http.StatusNotFound, body: "Transaction not found", want: txConfirmation{}},
+		{name: "in mempool", body: `{"confirmed":false}`, want: txConfirmation{found: true}},
+		{name: "confirmed", body: `{"confirmed":true,"block_height":850000,"block_hash":"abc"}`,
+			want: txConfirmation{found: true, blockNumber: 850000, blockHash: "abc", confirmations: 3}},
+		{name: "tip behind block", body: `{"confirmed":true,"block_height":850005,"block_hash":"abc"}`,
+			want: txConfirmation{found: true, blockNumber: 850005, blockHash: "abc"}},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: "slow down", wantErr: true},
+		{name: "malformed", body: `confirmed`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := newTestChain(t, "btc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/tx/txid1/status" {
+					http.Error(w, "unexpected path "+r.URL.Path, http.StatusBadRequest)
+					return
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				fmt.Fprint(w, tt.body)
+			}))
+			got, err := listener.scanner.TxConfirmation(listener, "txid1:1", 850002)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TxConfirmation error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("TxConfirmation = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func utxoChain(t *testing.T, chain string) util.ChainInfo {
+	t.Helper()
+	info, ok := util.GetChain(chain)
+	if !ok {
+		t.Fatalf("unknown chain %s", chain)
+	}
+	return info
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+)
+
+// ChainScanner 链扫描器
+// 每种链类型(tron/trc20/evm/solana/ton/utxo)实现一个扫描器，新增同类型的链只需在配置文件中添加，不需要修改代码
+type ChainScanner interface {
+	// LatestHeight 链上最新区块高度
+	LatestHeight(listener *ChainListener) (uint64, error)
+	// ScanRange 扫描本轮区块范围内发往收款地址的转账，并推进 listener.lastBlock
+	ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error)
+	// ParseTransfers 解析节点/API 返回的原始数据，只保留发往收款地址且未处理过的转账
+	ParseTransfers(listener *ChainListener, raw json.RawMessage, window ScanWindow) ([]Transfer, error)
+	// TxConfirmation 查询交易确认情况(未确认转账跟踪使用)
+	TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error)
+	// ValidateAddress 校验地址格式
+	ValidateAddress(address string) bool
+	// NormalizeAddress 标准化地址(保存收款地址时使用)
+	NormalizeAddress(address string) string
+}
+
+// PaymentReferencer 支持付款引用的扫描器(可选接口，如 Solana Pay reference、TON comment)
+// 创建订单时生成引用，付款交易附带引用时按引用匹配订单，收银台二维码使用付款链接
+type PaymentReferencer interface {
+	// NewReference 生成订单付款引用
+	NewReference(order *model.Order) string
+	// ReferenceRequired 付款是否必须附带引用，必填时订单不使用唯一标识金额，也不按金额匹配
+	ReferenceRequired() bool
+	// PaymentURI 订单付款链接，钱包扫码后自动填写收款信息
+	PaymentURI(order *model.Order) string
+}
+
+// 补扫范围单位
+const (
+	RescanUnitBlock = "block" // 区块号(Solana 为 slot)
+	RescanUnitTime  = "time"  // Unix 秒(TronGrid、toncenter 等按时间查询的 API)
+)
+
+// RangeRescanner 支持补扫历史范围的扫描器(可选接口)
+// 节点故障导致漏扫时按范围重新查询，不改变监听进度；结果经 processTransfer 按 tx_hash 去重后处理
+type RangeRescanner interface {
+	// RescanUnit 补扫范围单位
+	RescanUnit() string
+	// RescanChunk 补扫从 from 开始、不超过 to 的一段范围，返回其中已确认的转账和本段扫描到的位置
+	RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error)
+}
+
+// ScanWindow 一次查询的上下文，解析转账时使用
+type ScanWindow struct {
+	Addresses    map[string]bool // 收款地址(小写)
+	Token        *model.Token    // 按合约逐个查询时的代币(TRC20/Solana/TON)
+	Unconfirmed  bool            // 查询的是未确认交易(TronGrid/Solana)
+	ConfirmedTo  uint64          // 已达到确认数的最高区块(EVM)，更高区块的转账只跟踪不结算
+	CurrentBlock uint64          // 最新区块(EVM/UTXO)/slot(Solana)
+}
+
+var (
+	scannerMu        sync.RWMutex
+	scannerFactories = make(map[string]func(*BlockchainService, util.ChainInfo) ChainScanner)
+)
+
+// RegisterChainScanner 注册链类型的扫描器，地址格式因链而异的扫描器(如 UTXO)按 ChainInfo 创建
+func RegisterChainScanner(chainType string, factory func(*BlockchainService, util.ChainInfo) ChainScanner) {
+	scannerMu.Lock()
+	defer scannerMu.Unlock()
+	scannerFactories[chainType] = factory
+}
+
+func init() {
+	RegisterChainScanner(util.ChainTypeTron, func(s *BlockchainService, _ util.ChainInfo) ChainScanner { return &tronScanner{s: s} })
+	RegisterChainScanner(util.ChainTypeTRC20, func(s *BlockchainService, _ util.ChainInfo) ChainScanner { return &trc20Scanner{tronScanner{s: s}} })
+	RegisterChainScanner(util.ChainTypeEVM, func(s *BlockchainService, _ util.ChainInfo) ChainScanner { return &evmScanner{s: s} })
+	RegisterChainScanner(util.ChainTypeSolana, func(s *BlockchainService, _ util.ChainInfo) ChainScanner { return newSolanaScanner(s) })
+	RegisterChainScanner(util.ChainTypeTON, func(s *BlockchainService, _ util.ChainInfo) ChainScanner { return newTONScanner(s) })
+	RegisterChainScanner(util.ChainTypeUTXO, func(s *BlockchainService, info util.ChainInfo) ChainScanner { return newUTXOScanner(s, info) })
+}
+
+// newChainScanner 按链类型创建扫描器，未注册的类型返回 nil
+func (s *BlockchainService) newChainScanner(info util.ChainInfo) ChainScanner {
+	scannerMu.RLock()
+	factory, ok := scannerFactories[info.Type]
+	scannerMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return factory(s, info)
+}
+
+// scannerFor 获取链的扫描器
+func (s *BlockchainService) scannerFor(chain string) ChainScanner {
+	s.mu.RLock()
+	listener, ok := s.listeners[chain]
+	s.mu.RUnlock()
+	if ok && listener.scanner != nil {
+		return listener.scanner
+	}
+	info, ok := util.GetChain(chain)
+	if !ok {
+		return nil
+	}
+	return s.newChainScanner(info)
+}
+
+// ValidateAddress 校验链上地址格式，法币收款方式不校验
+func (s *BlockchainService) ValidateAddress(chain, address string) bool {
+	if util.IsFiatChain(chain) {
+		return true
+	}
+	scanner := s.scannerFor(chain)
+	return scanner != nil && scanner.ValidateAddress(strings.TrimSpace(address))
+}
+
+// NormalizeAddress 标准化链上地址，未知链原样返回
+func (s *BlockchainService) NormalizeAddress(chain, address string) string {
+	scanner := s.scannerFor(chain)
+	if scanner == nil {
+		return address
+	}
+	return scanner.NormalizeAddress(address)
+}
+
+// NewPaymentReference 生成订单付款引用，链的扫描器不支持时返回空
+func (s *BlockchainService) NewPaymentReference(order *model.Order) string {
+	if referencer, ok := s.scannerFor(order.Chain).(PaymentReferencer); ok {
+		return referencer.NewReference(order)
+	}
+	return ""
+}
+
+// ReferenceRequired 链的付款是否必须附带引用(如 TON comment)
+func (s *BlockchainService) ReferenceRequired(chain string) bool {
+	referencer, ok := s.scannerFor(chain).(PaymentReferencer)
+	return ok && referencer.ReferenceRequired()
+}
+
+// PaymentURI 订单付款链接(如 Solana Pay、BIP21)，链的扫描器不支持时返回空
+func (s *BlockchainService) PaymentURI(order *model.Order) string {
+	if order.Channel != "local" {
+		return ""
+	}
+	if referencer, ok := s.scannerFor(order.Chain).(PaymentReferencer); ok {
+		return referencer.PaymentURI(order)
+	}
+	return ""
+}
+
+// tronScanner TRX 原生币扫描器(TronGrid)
+type tronScanner struct {
+	s *BlockchainService
+}
+
+func (t *tronScanner) LatestHeight(listener *ChainListener) (uint64, error) {
+	return t.s.getTronBlockNumber(t.s.rpcClients[listener.chain])
+}
+
+func (t *tronScanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	return t.s.scanTRXImproved(listener, addresses)
+}
+
+func (t *tronScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	return t.s.getTronTxConfirmation(t.s.rpcClients[listener.chain], txHash, currentBlock)
+}
+
+// ValidateAddress TRON 地址: T 开头的 Base58Check 或 41 开头的十六进制
+func (t *tronScanner) ValidateAddress(address string) bool {
+	if strings.HasPrefix(address, "41") {
+		address = hexToBase58(address)
+	}
+	_, err := base58ToHex(address)
+	return err == nil
+}
+
+// NormalizeAddress TRON 地址统一为 Base58 格式(区分大小写，保持原样)
+func (t *tronScanner) NormalizeAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(address, "41") {
+		address = hexToBase58(address)
+	}
+	return address
+}
+
+// trc20Scanner TRC20 代币扫描器，地址规则与 TRX 相同
+type trc20Scanner struct {
+	tronScanner
+}
+
+func (t *trc20Scanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	return t.s.scanTRC20Improved(listener, addresses)
+}
+
+// evmScanner EVM 兼容链扫描器(ERC20 Transfer 日志 + 原生币逐块扫描)
+type evmScanner struct {
+	s *BlockchainService
+}
+
+var evmAddressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+func (e *evmScanner) LatestHeight(listener *ChainListener) (uint64, error) {
+	return e.s.getEVMBlockNumberWithRetry(e.s.rpcClients[listener.chain])
+}
+
+func (e *evmScanner) ScanRange(listener *ChainListener, addresses map[string]bool) ([]Transfer, error) {
+	return e.s.scanEVMImproved(listener, addresses)
+}
+
+func (e *evmScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	return e.s.getEVMTxConfirmation(e.s.rpcClients[listener.chain], txHash, currentBlock)
+}
+
+func (e *evmScanner) ValidateAddress(address string) bool {
+	return evmAddressPattern.MatchString(address)
+}
+
+// NormalizeAddress EVM 地址统一为小写
+func (e *evmScanner) NormalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HDWalletService HD 钱包服务
+// 按链族登记扩展公钥，为每个订单派生独立收款地址，付款只按地址匹配，不依赖唯一标识金额
+type HDWalletService struct{}
+
+var (
+	hdWalletService     *HDWalletService
+	hdWalletServiceOnce sync.Once
+)
+
+// GetHDWalletService 获取 HD 钱包服务实例
+func GetHDWalletService() *HDWalletService {
+	hdWalletServiceOnce.Do(func() {
+		hdWalletService = &HDWalletService{}
+	})
+	return hdWalletService
+}
+
+// hdFamilyVersions 各链族接受的扩展公钥版本号，UTXO 链按版本号决定地址类型
+var hdFamilyVersions = map[string][]uint32{
+	model.HDFamilyEVM:  {xpubVersion},
+	model.HDFamilyTron: {xpubVersion},
+	model.HDFamilyBTC:  {zpubVersion, ypubVersion, xpubVersion},
+	model.HDFamilyLTC:  {zpubVersion, mtubVersion, ltubVersion, xpubVersion},
+}
+
+// Create 登记扩展公钥，merchantID 为 0 表示系统 HD 钱包
+func (s *HDWalletService) Create(merchantID uint, family, xpub, label string) (*model.HDWallet, error) {
+	if !model.IsValidHDFamily(family) {
+		return nil, errors.New("不支持的链族")
+	}
+	xpub = strings.TrimSpace(xpub)
+	key, err := parseExtendedPubKey(xpub)
+	if err != nil {
+		return nil, err
+	}
+	if key.depth != 3 && key.depth != 4 {
+		return nil, errors.New("请使用账户层级(m/44'/coin'/0')或外部链层级(m/44'/coin'/0'/0)的扩展公钥")
+	}
+	if !slices.Contains(hdFamilyVersions[family], key.version) {
+		return nil, ErrXPubVersion
+	}
+
+	var count int64
+	model.GetDB().Model(&model.HDWallet{}).Where("merchant_id = ? AND family = ?", merchantID, family).Count(&count)
+	if count > 0 {
+		return nil, errors.New("该链族已登记扩展公钥")
+	}
+	// 同一扩展公钥派生出相同地址，不能被多个钱包共用
+	model.GetDB().Model(&model.HDWallet{}).Where("xpub = ?", xpub).Count(&count)
+	if count > 0 {
+		return nil, errors.New("该扩展公钥已被使用")
+	}
+
+	wallet := &model.HDWallet{
+		MerchantID: merchantID,
+		Family:     family,
+		XPub:       xpub,
+		Label:      label,
+		Status:     1,
+	}
+	if err := model.GetDB().Create(wallet).Error; err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// Delete 删除 HD 钱包，已有订单使用的钱包只能禁用(订单地址仍需监听)
+func (s *HDWalletService) Delete(wallet *model.HDWallet) error {
+	var count int64
+	model.GetDB().Model(&model.Order{}).Where("hd_wallet_id = ?", wallet.ID).Count(&count)
+	if count > 0 {
+		return errors.New("已有订单使用该钱包，只能禁用")
+	}
+	return model.GetDB().Delete(wallet).Error
+}
+
+// DeriveAddress 派生指定序号的收款地址
+// 账户层级扩展公钥派生 0/index，外部链层级扩展公钥直接派生 index
+func (s *HDWalletService) DeriveAddress(wallet *model.HDWallet, index uint32) (string, error) {
+	key, err := parseExtendedPubKey(wallet.XPub)
+	if err != nil {
+		return "", err
+	}
+	if key.depth == 3 {
+		if key, err = key.child(0); err != nil {
+			return "", err
+		}
+	}
+	child, err := key.child(index)
+	if err != nil {
+		return "", err
+	}
+
+	switch wallet.Family {
+	case model.HDFamilyTron:
+		return child.tronAddress(), nil
+	case model.HDFamilyBTC, model.HDFamilyLTC:
+		return child.utxoAddress(utxoNetworks[wallet.Family])
+	}
+	return child.evmAddress(), nil
+}
+
+// Select 按商户钱包模式选择 HD 钱包，返回 nil 时使用普通收款地址
+// WalletMode: 1=仅系统钱包, 2=仅个人钱包, 3=混合模式(优先个人，商户已有普通收款地址时不使用系统 HD 钱包)
+func (s *HDWalletService) Select(merchant *model.Merchant, chain string) (*model.HDWallet, bool) {
+	family := model.ChainHDFamily(chain)
+	if family == "" {
+		return nil, false
+	}
+
+	find := func(merchantID uint) *model.HDWallet {
+		var wallet model.HDWallet
+		if err := model.GetDB().Where("merchant_id = ? AND family = ? AND status = 1", merchantID, family).First(&wallet).Error; err != nil {
+			return nil
+		}
+		return &wallet
+	}
+
+	switch merchant.WalletMode {
+	case 1:
+		return find(0), false
+	case 2:
+		return find(merchant.ID), true
+	default:
+		if wallet := find(merchant.ID); wallet != nil {
+			return wallet, true
+		}
+		var count int64
+		model.GetDB().Model(&model.Wallet{}).Where("chain = ? AND status = 1 AND merchant_id = ?", chain, merchant.ID).Count(&count)
+		if count > 0 {
+			return nil, false
+		}
+		return find(0), false
+	}
+}
+
+// Families 商户按钱包模式可以使用的 HD 钱包链族(支付方式列表使用)
+func (s *HDWalletService) Families(merchant *model.Merchant) map[string]bool {
+	query := model.GetDB().Model(&model.HDWallet{}).Where("status = 1")
+	switch merchant.WalletMode {
+	case 1:
+		query = query.Where("merchant_id = 0")
+	case 2:
+		query = query.Where("merchant_id = ?", merchant.ID)
+	default:
+		query = query.Where("merchant_id IN ?", []uint{0, merchant.ID})
+	}
+
+	var families []string
+	query.Distinct().Pluck("family", &families)
+	result := make(map[string]bool, len(families))
+	for _, family := range families {
+		result[family] = true
+	}
+	return result
+}
+
+// Allocate 在事务中分配下一个派生序号并派生收款地址
+func (s *HDWalletService) Allocate(tx *gorm.DB, walletID uint) (string, uint32, error) {
+	var wallet model.HDWallet
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&wallet, walletID).Error; err != nil {
+		return "", 0, err
+	}
+
+	// 极少数序号派生结果无效(BIP32 规定跳过)
+	index := wallet.NextIndex
+	address, err := s.DeriveAddress(&wallet, index)
+	for errors.Is(err, ErrInvalidChildKey) {
+		index++
+		address, err = s.DeriveAddress(&wallet, index)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := tx.Model(&wallet).Update("next_index", index+1).Error; err != nil {
+		return "", 0, err
+	}
+	return address, index, nil
+}
+
+// WatchedAddresses 需要监听的派生地址(chain -> addresses)
+// 订单待支付/确认中时监听，过期后在商户允许的过期到账窗口内继续监听
+func (s *HDWalletService) WatchedAddresses() map[string][]string {
+	now := time.Now()
+	var orders []model.Order
+	model.GetDB().Preload("Merchant").
+		Select("id", "merchant_id", "chain", "to_address", "status", "expired_at").
+		Where("hd_wallet_id > 0 AND (status IN ? OR (status = ? AND expired_at > ?))",
+			[]model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial, model.OrderStatusDetected, model.OrderStatusConfirming},
+			model.OrderStatusExpired, now.Add(-maxLateWindow)).
+		Find(&orders)
+
+	result := make(map[string][]string)
+	for i := range orders {
+		order := &orders[i]
+		if order.Status == model.OrderStatusExpired {
+			policy := orderPaymentPolicy(order)
+			if !policy.AllowLate || now.After(order.ExpiredAt.Add(time.Duration(policy.LateWindowMinutes)*time.Minute)) {
+				continue
+			}
+		}
+		result[order.Chain] = append(result[order.Chain], order.ToAddress)
+	}
+	return result
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// secp256k1 曲线参数 (y² = x³ + 7 mod p)
+var (
+	secp256k1P, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F", 16)
+	secp256k1N, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+	secp256k1Gx, _ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798", 16)
+	secp256k1Gy, _ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8", 16)
+)
+
+// 主网扩展公钥版本号，UTXO 链按版本号决定派生地址的脚本类型(SLIP-132)
+const (
+	xpubVersion uint32 = 0x0488B21E // xpub: BIP44，P2PKH(EVM/TRON 只接受该版本)
+	ypubVersion uint32 = 0x049D7CB2 // ypub: BIP49，P2SH-P2WPKH
+	zpubVersion uint32 = 0x04B24746 // zpub: BIP84，P2WPKH
+	ltubVersion uint32 = 0x019DA462 // Ltub: Litecoin BIP44，P2PKH
+	mtubVersion uint32 = 0x01B26792 // Mtub: Litecoin BIP49，P2SH-P2WPKH
+)
+
+// xpubScriptTypes 扩展公钥版本号对应的 UTXO 地址脚本类型
+var xpubScriptTypes = map[uint32]string{
+	xpubVersion: utxoScriptP2PKH,
+	ypubVersion: utxoScriptP2SHP2WPKH,
+	zpubVersion: utxoScriptP2WPKH,
+	ltubVersion: utxoScriptP2PKH,
+	mtubVersion: utxoScriptP2SHP2WPKH,
+}
+
+// bip32HardenedOffset 硬化派生起始序号，扩展公钥无法派生硬化子密钥
+const bip32HardenedOffset = 0x80000000
+
+var (
+	ErrInvalidXPub      = errors.New("扩展公钥格式无效")
+	ErrInvalidChildKey  = errors.New("派生子密钥无效")
+	ErrHardenedFromXPub = errors.New("扩展公钥不能派生硬化子密钥")
+	ErrXPubVersion      = errors.New("扩展公钥类型与链族不匹配")
+)
+
+// ecPoint secp256k1 曲线上的点，x 为 nil 表示无穷远点
+type ecPoint struct {
+	x, y *big.Int
+}
+
+func (p ecPoint) isInfinity() bool {
+	return p.x == nil
+}
+
+// ecAdd 点加法(仿射坐标)
+func ecAdd(a, b ecPoint) ecPoint {
+	if a.isInfinity() {
+		return b
+	}
+	if b.isInfinity() {
+		return a
+	}
+	if a.x.Cmp(b.x) == 0 {
+		if a.y.Cmp(b.y) == 0 {
+			return ecDouble(a)
+		}
+		return ecPoint{}
+	}
+
+	// λ = (y2 - y1) / (x2 - x1)
+	num := new(big.Int).Sub(b.y, a.y)
+	den := new(big.Int).Sub(b.x, a.x)
+	den.Mod(den, secp256k1P)
+	lambda := num.Mul(num, den.ModInverse(den, secp256k1P))
+	lambda.Mod(lambda, secp256k1P)
+
+	return ecFromLambda(lambda, a, b.x)
+}
+
+// ecDouble 倍点
+func ecDouble(a ecPoint) ecPoint {
+	if a.isInfinity() || a.y.Sign() == 0 {
+		return ecPoint{}
+	}
+
+	// λ = 3x² / 2y
+	num := new(big.Int).Mul(a.x, a.x)
+	num.Mul(num, big.NewInt(3))
+	den := new(big.Int).Lsh(a.y, 1)
+	den.Mod(den, secp256k1P)
+	lambda := num.Mul(num, den.ModInverse(den, secp256k1P))
+	lambda.Mod(lambda, secp256k1P)
+
+	return ecFromLambda(lambda, a, a.x)
+}
+
+// ecFromLambda 由斜率计算结果点: x3 = λ² - x1 - x2, y3 = λ(x1 - x3) - y1
+func ecFromLambda(lambda *big.Int, a ecPoint, x2 *big.Int) ecPoint {
+	x3 := new(big.Int).Mul(lambda, lambda)
+	x3.Sub(x3, a.x)
+	x3.Sub(x3, x2)
+	x3.Mod(x3, secp256k1P)
+
+	y3 := new(big.Int).Sub(a.x, x3)
+	y3.Mul(y3, lambda)
+	y3.Sub(y3, a.y)
+	y3.Mod(y3, secp256k1P)
+
+	return ecPoint{x: x3, y: y3}
+}
+
+// ecScalarBaseMult 计算 k·G
+func ecScalarBaseMult(k *big.Int) ecPoint {
+	result := ecPoint{}
+	addend := ecPoint{x: secp256k1Gx, y: secp256k1Gy}
+	for i := 0; i < k.BitLen(); i++ {
+		if k.Bit(i) == 1 {
+			result = ecAdd(result, addend)
+		}
+		addend = ecDouble(addend)
+	}
+	return result
+}
+
+// decompressPubKey 解析 33 字节压缩公钥
+func decompressPubKey(data []byte) (ecPoint, error) {
+	if len(data) != 33 || (data[0] != 0x02 && data[0] != 0x03) {
+		return ecPoint{}, ErrInvalidXPub
+	}
+	x := new(big.Int).SetBytes(data[1:])
+	if x.Cmp(secp256k1P) >= 0 {
+		return ecPoint{}, ErrInvalidXPub
+	}
+
+	// y = sqrt(x³ + 7)，p ≡ 3 (mod 4) 时 sqrt(a) = a^((p+1)/4)
+	rhs := new(big.Int).Exp(x, big.NewInt(3), secp256k1P)
+	rhs.Add(rhs, big.NewInt(7))
+	rhs.Mod(rhs, secp256k1P)
+	exp := new(big.Int).Add(secp256k1P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(rhs, exp, secp256k1P)
+	if new(big.Int).Exp(y, big.NewInt(2), secp256k1P).Cmp(rhs) != 0 {
+		return ecPoint{}, ErrInvalidXPub
+	}
+	if y.Bit(0) != uint(data[0]&1) {
+		y.Sub(secp256k1P, y)
+	}
+	return ecPoint{x: x, y: y}, nil
+}
+
+// compressPubKey 压缩公钥(33 字节)
+func compressPubKey(p ecPoint) []byte {
+	out := make([]byte, 33)
+	out[0] = 0x02 + byte(p.y.Bit(0))
+	p.x.FillBytes(out[1:])
+	return out
+}
+
+// extendedPubKey BIP32 扩展公钥
+type extendedPubKey struct {
+	key       ecPoint
+	chainCode []byte
+	depth     byte
+	version   uint32
+}
+
+// parseExtendedPubKey 解析 Base58Check 编码的扩展公钥(xpub)
+func parseExtendedPubKey(xpub string) (*extendedPubKey, error) {
+	data, err := base58Decode(xpub)
+	if err != nil || len(data) != 82 {
+		return nil, ErrInvalidXPub
+	}
+	if !bytes.Equal(doubleSHA256(data[:78])[:4], data[78:]) {
+		return nil, ErrInvalidXPub
+	}
+	version := binary.BigEndian.Uint32(data[:4])
+	if _, ok := xpubScriptTypes[version]; !ok {
+		return nil, ErrInvalidXPub
+	}
+
+	key, err := decompressPubKey(data[45:78])
+	if err != nil {
+		return nil, err
+	}
+	return &extendedPubKey{
+		key:       key,
+		chainCode: data[13:45],
+		depth:     data[4],
+		version:   version,
+	}, nil
+}
+
+// child 非硬化子公钥派生 (BIP32 CKDpub)
+func (k *extendedPubKey) child(index uint32) (*extendedPubKey, error) {
+	if index >= bip32HardenedOffset {
+		return nil, ErrHardenedFromXPub
+	}
+
+	data := make([]byte, 37)
+	copy(data, compressPubKey(k.key))
+	binary.BigEndian.PutUint32(data[33:], index)
+
+	mac := hmac.New(sha512.New, k.chainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidChildKey
+	}
+	key := ecAdd(ecScalarBaseMult(il), k.key)
+	if key.isInfinity() {
+		return nil, ErrInvalidChildKey
+	}
+
+	return &extendedPubKey{
+		key:       key,
+		chainCode: sum[32:],
+		depth:     k.depth + 1,
+		version:   k.version,
+	}, nil
+}
+
+// addressHash 公钥对应的 20 字节账户哈希(EVM 与 TRON 相同)
+func (k *extendedPubKey) addressHash() []byte {
+	return pubKeyAddressHash(k.key)
+}
+
+// pubKeyAddressHash 公钥的账户哈希: Keccak256(x || y) 的后 20 字节
+func pubKeyAddressHash(p ecPoint) []byte {
+	pub := make([]byte, 64)
+	p.x.FillBytes(pub[:32])
+	p.y.FillBytes(pub[32:])
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(pub)
+	return hash.Sum(nil)[12:]
+}
+
+// evmAddress EVM 地址(小写 0x 格式)
+func (k *extendedPubKey) evmAddress() string {
+	return "0x" + hex.EncodeToString(k.addressHash())
+}
+
+// tronAddress TRON 地址(Base58 T 开头)
+func (k *extendedPubKey) tronAddress() string {
+	return hexToBase58("41" + hex.EncodeToString(k.addressHash()))
+}
+
+// hash160 压缩公钥的 RIPEMD160(SHA256) 哈希(UTXO 链地址使用)
+func (k *extendedPubKey) hash160() []byte {
+	sum := sha256.Sum256(compressPubKey(k.key))
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// utxoAddress UTXO 链地址，脚本类型由扩展公钥版本号决定
+func (k *extendedPubKey) utxoAddress(network utxoNetwork) (string, error) {
+	hash := k.hash160()
+	switch xpubScriptTypes[k.version] {
+	case utxoScriptP2WPKH:
+		return segwitAddressEncode(network.Bech32HRP, 0, hash)
+	case utxoScriptP2SHP2WPKH:
+		// 赎回脚本: OP_0 <20 字节公钥哈希>
+		script := append([]byte{0x00, 0x14}, hash...)
+		sum := sha256.Sum256(script)
+		h := ripemd160.New()
+		h.Write(sum[:])
+		return base58CheckEncode(network.ScriptHash, h.Sum(nil)), nil
+	default:
+		return base58CheckEncode(network.PubKeyHash, hash), nil
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"ezpay/internal/model"
+)
+
+// BIP32 测试向量 1、2 中可由扩展公钥派生的非硬化子密钥
+func TestBIP32PublicDerivation(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		index  uint32
+		child  string
+	}{
+		{
+			name:   "TV1 m/0H/1",
+			parent: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			index:  1,
+			child:  "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+		},
+		{
+			name:   "TV1 m/0H/1/2H/2",
+			parent: "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+			index:  2,
+			child:  "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV",
+		},
+		{
+			name:   "TV1 m/0H/1/2H/2/1000000000",
+			parent: "xpub6FHa3pjLCk84BayeJxFW2SP4XRrFd1JYnxeLeU8EqN3vDfZmbqBqaGJAyiLjTAwm6ZLRQUMv1ZACTj37sR62cfN7fe5JnJ7dh8zL4fiyLHV",
+			index:  1000000000,
+			child:  "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy",
+		},
+		{
+			name:   "TV2 m/0",
+			parent: "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB",
+			index:  0,
+			child:  "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH",
+		},
+		{
+			name:   "TV2 m/0/2147483647H/1",
+			parent: "xpub6ASAVgeehLbnwdqV6UKMHVzgqAG8Gr6riv3Fxxpj8ksbH9ebxaEyBLZ85ySDhKiLDBrQSARLq1uNRts8RuJiHjaDMBU4Zn9h8LZNnBC5y4a",
+			index:  1,
+			child:  "xpub6DF8uhdarytz3FWdA8TvFSvvAh8dP3283MY7p2V4SeE2wyWmG5mg5EwVvmdMVCQcoNJxGoWaU9DCWh89LojfZ537wTfunKau47EL2dhHKon",
+		},
+		{
+			name:   "TV2 m/0/2147483647H/1/2147483646H/2",
+			parent: "xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL",
+			index:  2,
+			child:  "xpub6FnCn6nSzZAw5Tw7cgR9bi15UV96gLZhjDstkXXxvCLsUXBGXPdSnLFbdpq8p9HmGsApME5hQTZ3emM2rnY5agb9rXpVGyy3bdW6EEgAtqt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent, err := parseExtendedPubKey(tt.parent)
+			if err != nil {
+				t.Fatalf("parse parent: %v", err)
+			}
+			want, err := parseExtendedPubKey(tt.child)
+			if err != nil {
+				t.Fatalf("parse child: %v", err)
+			}
+			got, err := parent.child(tt.index)
+			if err != nil {
+				t.Fatalf("child(%d): %v", tt.index, err)
+			}
+			if !bytes.Equal(compressPubKey(got.key), compressPubKey(want.key)) || !bytes.Equal(got.chainCode, want.chainCode) || got.depth != want.depth {
+				t.Errorf("child key=%x chain code=%x depth=%d, want %x %x %d",
+					compressPubKey(got.key), got.chainCode, got.depth, compressPubKey(want.key), want.chainCode, want.depth)
+			}
+		})
+	}
+
+	parent, _ := parseExtendedPubKey(tests[0].parent)
+	if _, err := parent.child(bip32HardenedOffset); !errors.Is(err, ErrHardenedFromXPub) {
+		t.Errorf("hardened child from xpub error = %v, want ErrHardenedFromXPub", err)
+	}
+}
+
+// 账户层级扩展公钥派生的收款地址，助记词为 "abandon ×11 about" 的公开测试钱包
+func TestDeriveAddressVectors(t *testing.T) {
+	tests := []struct {
+		name   string
+		family string
+		xpub   string
+		want   []string // 序号 0、1 的地址
+	}{
+		{
+			name:   "EVM m/44'/60'/0'",
+			family: model.HDFamilyEVM,
+			xpub:   "xpub6DCoCpSuQZB2jawqnGMEPS63ePKWkwWPH4TU45Q7LPXWuNd8TMtVxRrgjtEshuqpK3mdhaWHPFsBngh5GFZaM6si3yZdUsT8ddYM3PwnATt",
+			want:   []string{"0x9858effd232b4033e47d90003d41ec34ecaeda94", "0x6fac4d18c912343bf86fa7049364dd4e424ab9c0"},
+		},
+		{
+			name:   "TRON m/44'/195'/0'",
+			family: model.HDFamilyTron,
+			xpub:   "xpub6D1AabNHCupeiLM65ZR9UStMhJ1vCpyV4XbZdyhMZBiJXALQtmn9p42VTQckoHVn8WNqS7dqnJokZHAHcHGoaQgmv8D45oNUKx6DZMNZBCd",
+			want:   []string{"TUEZSdKsoDHQMeZwihtdoBiN46zxhGWYdH", "TSeJkUh4Qv67VNFwY8LaAxERygNdy6NQZK"},
+		},
+		{
+			name:   "BTC xpub m/44'/0'/0'",
+			family: model.HDFamilyBTC,
+			xpub:   "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+			want:   []string{"1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "1Ak8PffB2meyfYnbXZR9EGfLfFZVpzJvQP"},
+		},
+		{
+			name:   "BTC ypub m/49'/0'/0'",
+			family: model.HDFamilyBTC,
+			xpub:   "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP",
+			want:   []string{"37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf", "3LtMnn87fqUeHBUG414p9CWwnoV6E2pNKS"},
+		},
+		{
+			name:   "BTC zpub m/84'/0'/0'",
+			family: model.HDFamilyBTC,
+			xpub:   "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			want:   []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		},
+		{
+			name:   "LTC Ltub m/44'/2'/0'",
+			family: model.HDFamilyLTC,
+			xpub:   "Ltub2YDQmP391UYeDYvLye9P1SuNJFkcRGN7SYHM8JMxaDnegcPTXHJ2BnYmvHnFnGPGKu2WMuCga6iZV3SDxDMGrRyMcrYEfSPhrpS1EPkC43E",
+			want:   []string{"LUWPbpM43E2p7ZSh8cyTBEkvpHmr3cB8Ez", "Ldatw8ZjgMGNUo5HMN6RgCrjmh7q494Si3"},
+		},
+		{
+			name:   "LTC zpub m/84'/2'/0'",
+			family: model.HDFamilyLTC,
+			xpub:   "zpub6rPo5mF47z5coVm5rvWv7fv181awb7Vckn5Cf3xQXBVKu18kuBHDhNi1Jrb4br6vVD3ZbrnXemEsWJoR18mZwkUdzwD8TQnHDUCGxqZ6swA",
+			want:   []string{"ltc1qjmxnz78nmc8nq77wuxh25n2es7rzm5c2rkk4wh", "ltc1qwlezpr3890hcp6vva9twqh27mr6edadreqvhnn"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wallet := &model.HDWallet{Family: tt.family, XPub: tt.xpub}
+			for i, want := range tt.want {
+				got, err := GetHDWalletService().DeriveAddress(wallet, uint32(i))
+				if err != nil {
+					t.Fatalf("DeriveAddress(%d): %v", i, err)
+				}
+				if got != want {
+					t.Errorf("address %d = %s, want %s", i, got, want)
+				}
+			}
+		})
+	}
+}
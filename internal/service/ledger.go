@@ -0,0 +1,221 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LedgerService 商户余额账本服务
+// 所有商户余额/冻结余额的变动都必须通过 Apply 在事务中完成，保证每一笔变动都有账本流水
+type LedgerService struct{}
+
+var (
+	ledgerService     *LedgerService
+	ledgerServiceOnce sync.Once
+)
+
+var (
+	ErrInsufficientBalance   = errors.New("可用余额不足")
+	ErrInvalidLedgerAmount   = errors.New("账本变动金额无效")
+	ErrUnsupportedLedgerType = errors.New("不支持的账本流水类型")
+)
+
+// GetLedgerService 获取账本服务实例
+func GetLedgerService() *LedgerService {
+	ledgerServiceOnce.Do(func() {
+		ledgerService = &LedgerService{}
+	})
+	return ledgerService
+}
+
+// LedgerEntry 一笔余额变动
+type LedgerEntry struct {
+	Type    model.LedgerType
+	Amount  decimal.Decimal // 变动金额（USD，正数）
+	RefType model.LedgerRefType
+	RefID   uint
+	RefNo   string
+	Actor   string
+	Remark  string
+	// Overdraft 冲正类流水允许余额不足(如区块重组撤销已入账订单)，出账/冻结后余额可能为负
+	Overdraft bool
+}
+
+// LedgerQuery 账本查询条件
+type LedgerQuery struct {
+	MerchantID uint
+	Type       string
+	RefType    string
+	RefNo      string
+	StartDate  string
+	EndDate    string
+	Page       int
+	PageSize   int
+}
+
+// Apply 在事务中锁定商户行，按顺序应用余额变动并写入账本流水
+// 必须传入事务 tx，调用方负责与业务数据（订单、提现等）的更新放在同一事务中
+func (s *LedgerService) Apply(tx *gorm.DB, merchantID uint, entries ...LedgerEntry) (*model.Merchant, error) {
+	var merchant model.Merchant
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", merchantID).First(&merchant).Error; err != nil {
+		return nil, errors.New("商户不存在")
+	}
+
+	balance := decimal.NewFromFloat(merchant.Balance).Round(2)
+	frozen := decimal.NewFromFloat(merchant.FrozenBalance).Round(2)
+	changed := false
+	var applied []WebhookBalanceEntry
+
+	for _, entry := range entries {
+		amount := entry.Amount.Round(2)
+		if amount.IsNegative() {
+			return nil, ErrInvalidLedgerAmount
+		}
+		if amount.IsZero() {
+			continue
+		}
+
+		ledger := model.BalanceLedger{
+			MerchantID:    merchantID,
+			Type:          entry.Type,
+			Amount:        amount,
+			BalanceBefore: balance,
+			FrozenBefore:  frozen,
+			RefType:       entry.RefType,
+			RefID:         entry.RefID,
+			RefNo:         entry.RefNo,
+			Actor:         entry.Actor,
+			Remark:        entry.Remark,
+		}
+		if ledger.Actor == "" {
+			ledger.Actor = model.LedgerActorSystem
+		}
+
+		switch entry.Type {
+		case model.LedgerTypeCredit:
+			balance = balance.Add(amount)
+		case model.LedgerTypeDebit:
+			if balance.LessThan(amount) && !entry.Overdraft {
+				return nil, ErrInsufficientBalance
+			}
+			balance = balance.Sub(amount)
+		case model.LedgerTypeFreeze:
+			if balance.Sub(frozen).LessThan(amount) && !entry.Overdraft {
+				return nil, ErrInsufficientBalance
+			}
+			frozen = frozen.Add(amount)
+		case model.LedgerTypeUnfreeze:
+			frozen = frozen.Sub(amount)
+			if frozen.IsNegative() {
+				// 历史数据可能存在冻结余额不足的情况，归零而不是报错，差额记录在备注中
+				ledger.Remark = fmt.Sprintf("%s (冻结余额不足，差额 %s)", ledger.Remark, frozen.Neg().String())
+				frozen = decimal.Zero
+			}
+		default:
+			return nil, ErrUnsupportedLedgerType
+		}
+
+		ledger.BalanceAfter = balance
+		ledger.FrozenAfter = frozen
+		if err := tx.Create(&ledger).Error; err != nil {
+			return nil, err
+		}
+		changed = true
+		applied = append(applied, WebhookBalanceEntry{
+			Type:    ledger.Type,
+			Amount:  ledger.Amount,
+			RefType: ledger.RefType,
+			RefNo:   ledger.RefNo,
+			Remark:  ledger.Remark,
+		})
+	}
+
+	if !changed {
+		return &merchant, nil
+	}
+
+	if err := tx.Model(&model.Merchant{}).Where("id = ?", merchantID).Updates(map[string]interface{}{
+		"balance":        balance.InexactFloat64(),
+		"frozen_balance": frozen.InexactFloat64(),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	merchant.Balance = balance.InexactFloat64()
+	merchant.FrozenBalance = frozen.InexactFloat64()
+
+	// Webhook 事件 - 余额变动，与流水在同一事务中写入
+	if err := GetNotifyService().enqueueEvent(tx, &merchant, 0, model.WebhookEventBalanceChanged, newEventID(), WebhookBalanceData{
+		Balance:       balance,
+		FrozenBalance: frozen,
+		Entries:       applied,
+	}); err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+// ListEntries 分页查询账本流水
+func (s *LedgerService) ListEntries(q *LedgerQuery) ([]model.BalanceLedger, int64, error) {
+	query := model.GetDB().Model(&model.BalanceLedger{})
+
+	if q.MerchantID > 0 {
+		query = query.Where("merchant_id = ?", q.MerchantID)
+	}
+	if q.Type != "" {
+		query = query.Where("type = ?", q.Type)
+	}
+	if q.RefType != "" {
+		query = query.Where("ref_type = ?", q.RefType)
+	}
+	if q.RefNo != "" {
+		query = query.Where("ref_no = ?", q.RefNo)
+	}
+	if q.StartDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", q.StartDate, time.Local); err == nil {
+			query = query.Where("created_at >= ?", t)
+		}
+	}
+	if q.EndDate != "" {
+		if t, err := time.ParseInLocation("2006-01-02", q.EndDate, time.Local); err == nil {
+			query = query.Where("created_at < ?", t.AddDate(0, 0, 1))
+		}
+	}
+
+	var total int64
+	query.Count(&total)
+
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize < 1 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+
+	var entries []model.BalanceLedger
+	offset := (q.Page - 1) * q.PageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(q.PageSize).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+// AdminActor 生成管理员操作者标识
+func AdminActor(username string) string {
+	return "admin:" + username
+}
+
+// MerchantActor 生成商户操作者标识
+func MerchantActor(pid string) string {
+	return "merchant:" + pid
+}
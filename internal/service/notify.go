@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -13,11 +14,25 @@ import (
 
 	"ezpay/internal/model"
 	"ezpay/internal/util"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	notifyWorkerCount = 4                // 回调投递协程数
+	notifyBatchSize   = 20               // 每次取出的到期任务数
+	notifyBackoffBase = 30 * time.Second // 首次重试间隔，之后每次翻倍
+	notifyBackoffCap  = time.Hour        // 重试间隔上限
+	notifyLease       = 5 * time.Minute  // 任务取出后的租约，投递进程异常退出时租约到期后重新投递
 )
 
 // NotifyService 回调通知服务
+// 回调以任务形式持久化在 notify_tasks 表中，由工作池按指数退避投递
 type NotifyService struct {
-	mu sync.Mutex
+	mu    sync.Mutex
+	wake  chan struct{}
+	tasks chan uint
 }
 
 var notifyService *NotifyService
@@ -26,15 +41,19 @@ var notifyOnce sync.Once
 // GetNotifyService 获取通知服务单例
 func GetNotifyService() *NotifyService {
 	notifyOnce.Do(func() {
-		notifyService = &NotifyService{}
+		notifyService = &NotifyService{
+			wake:  make(chan struct{}, 1),
+			tasks: make(chan uint, notifyBatchSize),
+		}
 	})
 	return notifyService
 }
 
 // NotifyOrder 通知订单支付结果
+// 用于不经过区块链结算事务的支付路径(手动确认、上游通道、监控APP推送等)
 func (s *NotifyService) NotifyOrder(orderID uint) {
 	var order model.Order
-	if err := model.GetDB().Preload("Merchant").First(&order, orderID).Error; err != nil {
+	if err := model.GetDB().First(&order, orderID).Error; err != nil {
 		log.Printf("NotifyOrder: order not found: %d", orderID)
 		return
 	}
@@ -42,63 +61,321 @@ func (s *NotifyService) NotifyOrder(orderID uint) {
 	// 发送机器人通知
 	GetBotService().NotifyOrderPaid(&order)
 
+	if err := s.EnqueueOrderPaid(model.GetDB(), &order); err != nil {
+		log.Printf("NotifyOrder: enqueue failed for order %s: %v", order.TradeNo, err)
+	}
+}
+
+// EnqueueOrderPaid 写入支付成功的 Webhook 事件与商户回调任务
+// 传入业务事务时与订单状态变更一同提交，提交后由投递协程发送
+func (s *NotifyService) EnqueueOrderPaid(db *gorm.DB, order *model.Order) error {
+	// Webhook 事件 - 支付成功（事件ID固定，手动重发回调时不会重复推送）
+	s.EmitOrderEvent(db, order, model.WebhookEventOrderPaid, WebhookOrderData{})
+
 	if order.NotifyURL == "" {
 		log.Printf("NotifyOrder: no notify url for order: %s", order.TradeNo)
+		return nil
+	}
+
+	var merchant model.Merchant
+	if err := db.Select("id", "p_id").First(&merchant, order.MerchantID).Error; err != nil {
+		return fmt.Errorf("merchant not found for order: %s", order.TradeNo)
+	}
+
+	// 构建通知参数（签名在投递时生成）
+	params := map[string]string{
+		"pid":          merchant.PID,
+		"trade_no":     order.TradeNo,
+		"out_trade_no": order.OutTradeNo,
+		"type":         order.Type,
+		"name":         order.Name,
+		"money":        order.Money.String(),
+		"trade_status": orderTradeStatus(order),
+	}
+
+	// 添加附加参数
+	if order.Param != "" {
+		params["param"] = order.Param
+	}
+
+	return s.enqueue(db, order, model.NotifyTaskKindOrder, 0, params)
+}
+
+// NotifyRefund 通知订单退款结果 (trade_status=REFUND_SUCCESS)
+func (s *NotifyService) NotifyRefund(refundID uint) {
+	var refund model.Refund
+	if err := model.GetDB().First(&refund, refundID).Error; err != nil {
+		log.Printf("NotifyRefund: refund not found: %d", refundID)
 		return
 	}
 
-	if order.Merchant == nil {
-		log.Printf("NotifyOrder: merchant not found for order: %s", order.TradeNo)
+	var order model.Order
+	if err := model.GetDB().Preload("Merchant").First(&order, refund.OrderID).Error; err != nil || order.Merchant == nil {
+		log.Printf("NotifyRefund: order not found for refund: %s", refund.RefundNo)
 		return
 	}
 
-	// 构建通知参数
-	params := util.BuildNotifyParams(
-		order.Merchant.PID,
-		order.TradeNo,
-		order.OutTradeNo,
-		order.Type,
-		order.Name,
-		order.Money.String(),
-		"TRADE_SUCCESS",
-		order.Merchant.Key,
-	)
+	if order.NotifyURL == "" {
+		log.Printf("NotifyRefund: no notify url for order: %s", order.TradeNo)
+		return
+	}
 
-	// 添加附加参数
+	params := map[string]string{
+		"pid":           order.Merchant.PID,
+		"trade_no":      order.TradeNo,
+		"out_trade_no":  order.OutTradeNo,
+		"type":          order.Type,
+		"name":          order.Name,
+		"money":         order.Money.String(),
+		"trade_status":  "REFUND_SUCCESS",
+		"refund_no":     refund.RefundNo,
+		"out_refund_no": refund.OutRefundNo,
+		"refund_amount": refund.Amount.StringFixed(2),
+	}
 	if order.Param != "" {
 		params["param"] = order.Param
 	}
 
-	// 重试通知
-	maxRetry := s.getMaxRetry()
-	for i := 0; i < maxRetry; i++ {
-		order.NotifyCount++
+	if err := s.enqueue(model.GetDB(), &order, model.NotifyTaskKindRefund, refund.ID, params); err != nil {
+		log.Printf("NotifyRefund: enqueue failed for refund %s: %v", refund.RefundNo, err)
+	}
+}
+
+// enqueue 写入回调任务并唤醒投递协程，db 可以是业务事务
+// 同一订单(退款)已有未完成的同类任务时不重复创建，只将其提前到立即投递
+func (s *NotifyService) enqueue(db *gorm.DB, order *model.Order, kind model.NotifyTaskKind, refID uint, params map[string]string) error {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := db.Model(&model.NotifyTask{}).
+		Where("order_id = ? AND kind = ? AND ref_id = ? AND status = ?", order.ID, kind, refID, model.NotifyTaskPending).
+		Updates(map[string]interface{}{
+			"notify_url":      order.NotifyURL,
+			"payload":         string(payload),
+			"next_attempt_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		task := &model.NotifyTask{
+			MerchantID:    order.MerchantID,
+			OrderID:       order.ID,
+			RefID:         refID,
+			Kind:          kind,
+			NotifyURL:     order.NotifyURL,
+			Payload:       string(payload),
+			Status:        model.NotifyTaskPending,
+			MaxAttempts:   s.getMaxRetry(),
+			NextAttemptAt: now,
+		}
+		if err := db.Create(task).Error; err != nil {
+			return err
+		}
+	}
+
+	s.signal()
+	return nil
+}
+
+// signal 唤醒调度协程（非阻塞）
+func (s *NotifyService) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claimDueTasks 取出到期任务并延长租约，多实例部署时通过 SKIP LOCKED 避免重复取出
+func (s *NotifyService) claimDueTasks(limit int) []uint {
+	var ids []uint
+	now := time.Now()
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		var tasks []model.NotifyTask
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("id").
+			Where("status = ? AND next_attempt_at <= ?", model.NotifyTaskPending, now).
+			Order("next_attempt_at ASC").
+			Limit(limit).
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		return tx.Model(&model.NotifyTask{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(notifyLease)).Error
+	})
+	if err != nil {
+		log.Printf("claimDueTasks error: %v", err)
+		return nil
+	}
+	return ids
+}
+
+// deliver 投递一次回调任务
+func (s *NotifyService) deliver(taskID uint) {
+	var task model.NotifyTask
+	if err := model.GetDB().First(&task, taskID).Error; err != nil || task.Status != model.NotifyTaskPending {
+		return
+	}
+
+	var merchant model.Merchant
+	if err := model.GetDB().First(&merchant, task.MerchantID).Error; err != nil {
+		s.finishTask(&task, notifyResult{Err: fmt.Errorf("merchant not found")}, true)
+		return
+	}
+
+	// Webhook 事件：请求体已在写入任务时生成
+	if task.Kind == model.NotifyTaskKindEvent {
+		s.finishTask(&task, s.deliverEvent(&task, &merchant), false)
+		return
+	}
+
+	params := make(map[string]string)
+	if err := json.Unmarshal([]byte(task.Payload), &params); err != nil {
+		s.finishTask(&task, notifyResult{Err: fmt.Errorf("invalid payload: %v", err)}, true)
+		return
+	}
+
+	// JSON 格式：POST 完整订单信息 + HMAC-SHA256 签名头
+	if merchant.CallbackFormat == model.CallbackFormatJSON {
+		timestamp := time.Now().Unix()
+		body, err := s.buildJSONCallback(&task, &merchant, params, timestamp)
+		if err != nil {
+			s.finishTask(&task, notifyResult{Err: err}, true)
+			return
+		}
+		s.finishTask(&task, s.sendJSONNotify(task.NotifyURL, body, merchant.Key, timestamp, nil), false)
+		return
+	}
+
+	params["sign_type"] = "MD5"
+	params["sign"] = util.GenerateSign(params, merchant.Key)
+
+	result := s.sendNotify(task.NotifyURL, params)
+	s.finishTask(&task, result, false)
+}
+
+// finishTask 记录投递结果，失败时按指数退避安排下次投递，达到最大次数后标记为放弃
+func (s *NotifyService) finishTask(task *model.NotifyTask, result notifyResult, fatal bool) {
+	now := time.Now()
+	attempt := task.Attempt + 1
+
+	updates := map[string]interface{}{
+		"attempt":          attempt,
+		"last_http_status": result.HTTPStatus,
+		"last_body":        strings.ToValidUTF8(util.TruncateString(result.Body, 500), ""),
+		"last_error":       "",
+		"last_attempt_at":  &now,
+	}
+	if result.Err != nil {
+		updates["last_error"] = strings.ToValidUTF8(util.TruncateString(result.Err.Error(), 500), "")
+	}
+
+	// 投递记录
+	attemptLog := &model.NotifyAttempt{
+		TaskID:     task.ID,
+		OrderID:    task.OrderID,
+		MerchantID: task.MerchantID,
+		Kind:       task.Kind,
+		Attempt:    attempt,
+		URL:        util.TruncateString(result.URL, 1000),
+		HTTPStatus: result.HTTPStatus,
+		Response:   updates["last_body"].(string),
+		LatencyMs:  result.Latency.Milliseconds(),
+		Error:      updates["last_error"].(string),
+		Success:    result.Success,
+	}
+	if err := model.GetDB().Create(attemptLog).Error; err != nil {
+		log.Printf("Notify task %d: save attempt log failed: %v", task.ID, err)
+	}
+
+	status := model.NotifyTaskPending
+	switch {
+	case result.Success:
+		status = model.NotifyTaskSuccess
+	case fatal || attempt >= task.MaxAttempts:
+		status = model.NotifyTaskDead
+	default:
+		updates["next_attempt_at"] = now.Add(notifyBackoff(attempt))
+	}
+	updates["status"] = status
+
+	// 以尝试次数作为乐观锁，避免租约过期后同一次投递被重复记录
+	res := model.GetDB().Model(&model.NotifyTask{}).
+		Where("id = ? AND attempt = ? AND status = ?", task.ID, task.Attempt, model.NotifyTaskPending).
+		Updates(updates)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+
+	// 同步订单/退款上的通知状态
+	recordUpdates := map[string]interface{}{"notify_count": gorm.Expr("notify_count + 1")}
+	switch status {
+	case model.NotifyTaskSuccess:
+		recordUpdates["notify_status"] = model.NotifyStatusSuccess
+	case model.NotifyTaskDead:
+		recordUpdates["notify_status"] = model.NotifyStatusFailed
+	}
+	switch task.Kind {
+	case model.NotifyTaskKindRefund:
+		model.GetDB().Model(&model.Refund{}).Where("id = ?", task.RefID).Updates(recordUpdates)
+	case model.NotifyTaskKindOrder:
+		model.GetDB().Model(&model.Order{}).Where("id = ?", task.OrderID).Updates(recordUpdates)
+	}
 
-		success := s.sendNotify(order.NotifyURL, params)
-		if success {
-			model.GetDB().Model(&order).Updates(map[string]interface{}{
-				"notify_count":  order.NotifyCount,
-				"notify_status": model.NotifyStatusSuccess,
-			})
-			log.Printf("NotifyOrder: success for order: %s", order.TradeNo)
+	switch status {
+	case model.NotifyTaskSuccess:
+		log.Printf("Notify task %d (%s, order %d): success after %d attempts", task.ID, task.Kind, task.OrderID, attempt)
+	case model.NotifyTaskDead:
+		log.Printf("Notify task %d (%s, order %d): dead after %d attempts", task.ID, task.Kind, task.OrderID, attempt)
+
+		// Webhook 事件失败不发送 Telegram 告警，投递记录中可查
+		if task.Kind == model.NotifyTaskKindEvent {
 			return
 		}
 
-		// 等待后重试
-		if i < maxRetry-1 {
-			time.Sleep(time.Duration(i+1) * 10 * time.Second)
+		// 回调失败通知
+		var order model.Order
+		if err := model.GetDB().First(&order, task.OrderID).Error; err == nil {
+			lastError := "回调失败，已达到最大重试次数"
+			if result.Err != nil {
+				lastError = result.Err.Error()
+			}
+			go GetTelegramService().NotifyCallbackFailed(&order, attempt, lastError)
 		}
 	}
+}
 
-	// 通知失败
-	model.GetDB().Model(&order).Updates(map[string]interface{}{
-		"notify_count":  order.NotifyCount,
-		"notify_status": model.NotifyStatusFailed,
-	})
-	log.Printf("NotifyOrder: failed for order: %s after %d retries", order.TradeNo, maxRetry)
+// notifyBackoff 第 attempt 次失败后的重试间隔
+func notifyBackoff(attempt int) time.Duration {
+	delay := notifyBackoffBase
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= notifyBackoffCap {
+			return notifyBackoffCap
+		}
+	}
+	return delay
+}
 
-	// 回调失败通知
-	go GetTelegramService().NotifyCallbackFailed(&order, maxRetry, "回调失败，已达到最大重试次数")
+// orderTradeStatus 回调中的交易状态
+// 过期后到账的订单使用独立状态，由商户决定是否继续履约
+func orderTradeStatus(order *model.Order) string {
+	if order.Status == model.OrderStatusPaidLate {
+		return "TRADE_PAID_LATE"
+	}
+	return "TRADE_SUCCESS"
 }
 
 // encodeQueryString 构建查询字符串，空格编码为 %20 而不是 +
@@ -112,8 +389,32 @@ func encodeQueryString(params map[string]string) string {
 	return strings.ReplaceAll(values.Encode(), "+", "%20")
 }
 
+// notifyResult 单次回调请求结果
+type notifyResult struct {
+	Success    bool
+	URL        string // 请求地址(签名已遮蔽)
+	HTTPStatus int
+	Body       string
+	Latency    time.Duration
+	Err        error
+}
+
+// maskNotifyURL 遮蔽回调地址中的签名参数
+func maskNotifyURL(fullURL string) string {
+	u, err := url.Parse(fullURL)
+	if err != nil {
+		return fullURL
+	}
+	query := u.Query()
+	if query.Get("sign") != "" {
+		query.Set("sign", "***")
+	}
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "%2A%2A%2A", "***")
+	return u.String()
+}
+
 // sendNotify 发送通知请求
-func (s *NotifyService) sendNotify(notifyURL string, params map[string]string) bool {
+func (s *NotifyService) sendNotify(notifyURL string, params map[string]string) notifyResult {
 	// 构建查询字符串（空格用 %20 编码）
 	queryString := encodeQueryString(params)
 
@@ -125,48 +426,63 @@ func (s *NotifyService) sendNotify(notifyURL string, params map[string]string) b
 		fullURL += "?" + queryString
 	}
 
+	result := notifyResult{URL: maskNotifyURL(fullURL)}
+	start := time.Now()
+
 	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Get(fullURL)
 	if err != nil {
 		log.Printf("sendNotify error: %v", err)
-		return false
+		result.Latency = time.Since(start)
+		result.Err = err
+		return result
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	result.Latency = time.Since(start)
+	result.HTTPStatus = resp.StatusCode
 	if err != nil {
 		log.Printf("sendNotify read error: %v", err)
-		return false
+		result.Err = err
+		return result
 	}
 
 	// 检查响应
 	responseStr := strings.TrimSpace(strings.ToLower(string(body)))
-	return responseStr == "success"
+	result.Success = responseStr == "success"
+	result.Body = string(body)
+	if !result.Success {
+		result.Err = fmt.Errorf("unexpected response")
+	}
+	return result
 }
 
-// getMaxRetry 获取最大重试次数
+// getMaxRetry 获取回调最大尝试次数
 func (s *NotifyService) getMaxRetry() int {
 	var config model.SystemConfig
 	if err := model.GetDB().Where("`key` = ?", model.ConfigKeyNotifyRetry).First(&config).Error; err != nil {
-		return 5
+		return 10
 	}
 	retry, err := strconv.Atoi(config.Value)
-	if err != nil {
-		return 5
+	if err != nil || retry < 1 {
+		return 10
 	}
 	return retry
 }
 
-// RetryFailedNotify 重试失败的通知
-func (s *NotifyService) RetryFailedNotify() {
-	var orders []model.Order
-	model.GetDB().
-		Where("status = ? AND notify_status = ?", model.OrderStatusPaid, model.NotifyStatusFailed).
-		Find(&orders)
+// ListOrderTasks 获取订单的回调任务记录
+func (s *NotifyService) ListOrderTasks(orderID uint) ([]model.NotifyTask, error) {
+	var tasks []model.NotifyTask
+	err := model.GetDB().Where("order_id = ?", orderID).Order("id DESC").Find(&tasks).Error
+	return tasks, err
+}
 
-	for _, order := range orders {
-		go s.NotifyOrder(order.ID)
-	}
+// ListOrderAttempts 获取订单的回调投递记录（最近100条）
+func (s *NotifyService) ListOrderAttempts(orderID uint) ([]model.NotifyAttempt, error) {
+	var attempts []model.NotifyAttempt
+	err := model.GetDB().Where("order_id = ?", orderID).Order("id DESC").Limit(100).Find(&attempts).Error
+	return attempts, err
 }
 
 // BuildReturnURL 构建同步返回URL
@@ -182,7 +498,7 @@ func (s *NotifyService) BuildReturnURL(order *model.Order, merchant *model.Merch
 		order.Type,
 		order.Name,
 		order.Money.String(),
-		"TRADE_SUCCESS",
+		orderTradeStatus(order),
 		merchant.Key,
 	)
 
@@ -203,15 +519,36 @@ func (s *NotifyService) BuildReturnURL(order *model.Order, merchant *model.Merch
 	return returnURL
 }
 
-// StartNotifyWorker 启动通知工作协程
+// StartNotifyWorker 启动回调投递工作池
 func (s *NotifyService) StartNotifyWorker() {
-	// 定期重试失败的通知
+	for i := 0; i < notifyWorkerCount; i++ {
+		go func() {
+			for id := range s.tasks {
+				s.deliver(id)
+			}
+		}()
+	}
+
+	// 调度协程：定时或被唤醒时取出到期任务
 	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
+		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			s.RetryFailedNotify()
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			}
+
+			for {
+				ids := s.claimDueTasks(notifyBatchSize)
+				for _, id := range ids {
+					s.tasks <- id
+				}
+				if len(ids) < notifyBatchSize {
+					break
+				}
+			}
 		}
 	}()
 
@@ -225,7 +562,7 @@ func (s *NotifyService) ManualNotify(orderID uint) error {
 		return fmt.Errorf("order not found")
 	}
 
-	if order.Status != model.OrderStatusPaid {
+	if !order.Status.IsPaid() {
 		return fmt.Errorf("order not paid")
 	}
 
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+)
+
+// JSON 回调签名头
+// 签名内容为 "{timestamp}.{body}"，使用商户密钥做 HMAC-SHA256，结果为小写十六进制
+const (
+	CallbackHeaderTimestamp = "X-Ezpay-Timestamp"
+	CallbackHeaderSignature = "X-Ezpay-Signature"
+)
+
+// JSONCallbackRefund JSON 回调中的退款信息
+type JSONCallbackRefund struct {
+	RefundNo     string          `json:"refund_no"`
+	OutRefundNo  string          `json:"out_refund_no"`
+	Amount       decimal.Decimal `json:"amount"` // 退款金额(USD)
+	PayoutTxHash string          `json:"payout_tx_hash,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// OrderPayload JSON 回调及 Webhook 事件中的订单信息
+type OrderPayload struct {
+	TradeNo            string            `json:"trade_no"`
+	OutTradeNo         string            `json:"out_trade_no"`
+	Status             model.OrderStatus `json:"status"`
+	Type               string            `json:"type"`
+	Name               string            `json:"name"`
+	Currency           string            `json:"currency"`
+	Money              decimal.Decimal   `json:"money"`
+	PayCurrency        string            `json:"pay_currency"`
+	PayAmount          decimal.Decimal   `json:"pay_amount"`
+	ActualAmount       decimal.Decimal   `json:"actual_amount"`
+	SettlementAmount   decimal.Decimal   `json:"settlement_amount"`
+	SettlementCurrency string            `json:"settlement_currency"`
+	Fee                decimal.Decimal   `json:"fee"`
+	Rate               decimal.Decimal   `json:"rate"`
+	RefundedAmount     decimal.Decimal   `json:"refunded_amount"`
+	Chain              string            `json:"chain"`
+	ToAddress          string            `json:"to_address"`
+	FromAddress        string            `json:"from_address"`
+	TxHash             string            `json:"tx_hash"`
+	Param              string            `json:"param,omitempty"`
+	CreatedAt          time.Time         `json:"created_at"`
+	ExpiredAt          time.Time         `json:"expired_at"`
+	PaidAt             *time.Time        `json:"paid_at"`
+}
+
+// newOrderPayload 由订单生成回调中的订单信息
+func newOrderPayload(order *model.Order) OrderPayload {
+	return OrderPayload{
+		TradeNo:            order.TradeNo,
+		OutTradeNo:         order.OutTradeNo,
+		Status:             order.Status,
+		Type:               order.Type,
+		Name:               order.Name,
+		Currency:           order.Currency,
+		Money:              order.Money,
+		PayCurrency:        order.PayCurrency,
+		PayAmount:          order.PayAmount,
+		ActualAmount:       order.ActualAmount,
+		SettlementAmount:   order.SettlementAmount,
+		SettlementCurrency: "USD",
+		Fee:                order.Fee,
+		Rate:               order.Rate,
+		RefundedAmount:     order.RefundedAmount,
+		Chain:              order.Chain,
+		ToAddress:          order.ToAddress,
+		FromAddress:        order.FromAddress,
+		TxHash:             order.TxHash,
+		Param:              order.Param,
+		CreatedAt:          order.CreatedAt,
+		ExpiredAt:          order.ExpiredAt,
+		PaidAt:             order.PaidAt,
+	}
+}
+
+// JSONCallback JSON 格式回调内容
+type JSONCallback struct {
+	PID         string `json:"pid"`
+	TradeStatus string `json:"trade_status"` // TRADE_SUCCESS / TRADE_PAID_LATE / REFUND_SUCCESS
+	OrderPayload
+	Confirmations int                 `json:"confirmations"` // 订单跟踪到的确认数(结算时的实际确认数)
+	Refund        *JSONCallbackRefund `json:"refund,omitempty"`
+	Timestamp     int64               `json:"timestamp"`
+}
+
+// buildJSONCallback 按订单当前状态构建 JSON 回调内容，timestamp 与请求头中的签名时间戳一致
+func (s *NotifyService) buildJSONCallback(task *model.NotifyTask, merchant *model.Merchant, params map[string]string, timestamp int64) ([]byte, error) {
+	var order model.Order
+	if err := model.GetDB().First(&order, task.OrderID).Error; err != nil {
+		return nil, fmt.Errorf("order not found")
+	}
+
+	payload := JSONCallback{
+		PID:           merchant.PID,
+		TradeStatus:   params["trade_status"],
+		OrderPayload:  newOrderPayload(&order),
+		Confirmations: order.Confirmations,
+		Timestamp:     timestamp,
+	}
+
+	if task.Kind == model.NotifyTaskKindRefund {
+		var refund model.Refund
+		if err := model.GetDB().First(&refund, task.RefID).Error; err != nil {
+			return nil, fmt.Errorf("refund not found")
+		}
+		payload.Refund = &JSONCallbackRefund{
+			RefundNo:     refund.RefundNo,
+			OutRefundNo:  refund.OutRefundNo,
+			Amount:       refund.Amount,
+			PayoutTxHash: refund.PayoutTxHash,
+			CreatedAt:    refund.CreatedAt,
+		}
+	}
+
+	return json.Marshal(payload)
+}
+
+// sendJSONNotify 以 POST JSON 方式发送回调，HTTP 2xx 视为成功
+// timestamp: 签名时间戳(Unix 秒)；headers: 额外请求头(如 Webhook 事件类型与事件ID)
+func (s *NotifyService) sendJSONNotify(notifyURL string, body []byte, key string, timestamp int64, headers map[string]string) notifyResult {
+	result := notifyResult{URL: notifyURL}
+
+	ts := strconv.FormatInt(timestamp, 10)
+	req, err := http.NewRequest(http.MethodPost, notifyURL, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CallbackHeaderTimestamp, ts)
+	req.Header.Set(CallbackHeaderSignature, util.HMACSHA256(ts+"."+string(body), key))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("sendJSONNotify error: %v", err)
+		result.Latency = time.Since(start)
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	result.Latency = time.Since(start)
+	result.HTTPStatus = resp.StatusCode
+	result.Body = strings.TrimSpace(string(respBody))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !result.Success {
+		result.Err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestJSONCallbackTrackedConfirmations(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, FrozenBalance: 2}
+	db.Create(&merchant)
+	order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+		Money: decimal.NewFromInt(100), SettlementAmount: decimal.NewFromInt(100), Fee: decimal.NewFromInt(2),
+		FeeType: model.FeeTypeBalance, Status: model.OrderStatusConfirming, Confirmations: 3, RequiredConfirmations: 19}
+	db.Create(&order)
+	db.Create(&model.PendingTransfer{Chain: "trc20", TxHash: "0xabc", ToAddress: "TWallet", Amount: decimal.NewFromInt(100),
+		OrderID: order.ID, PrevStatus: model.OrderStatusPending, NewStatus: model.OrderStatusPaid, Total: decimal.NewFromInt(100),
+		MatchNote: model.MatchNotePaid, Confirmations: 3, RequiredConfirmations: 19})
+
+	// 确认跟踪刷新时交易已有 25 个确认，要求 19 个
+	s := &BlockchainService{listeners: map[string]*ChainListener{"trc20": {chain: "trc20", confirmations: 19}}}
+	s.processTransfer(Transfer{TxHash: "0xabc", To: "TWallet", Amount: decimal.NewFromInt(100), Token: "USDT",
+		BlockNumber: 1000, Chain: "trc20", Confirmations: 25})
+
+	var paid model.Order
+	db.First(&paid, order.ID)
+	if paid.Status != model.OrderStatusPaid || paid.Confirmations != 25 || paid.RequiredConfirmations != 19 {
+		t.Fatalf("order status=%d confirmations=%d/%d, want paid with 25/19", paid.Status, paid.Confirmations, paid.RequiredConfirmations)
+	}
+
+	body, err := GetNotifyService().buildJSONCallback(&model.NotifyTask{OrderID: order.ID}, &merchant,
+		map[string]string{"trade_status": "TRADE_SUCCESS"}, 1700000000)
+	if err != nil {
+		t.Fatalf("buildJSONCallback: %v", err)
+	}
+	var payload JSONCallback
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("unmarshal callback: %v", err)
+	}
+	if payload.Confirmations != 25 {
+		t.Errorf("callback confirmations = %d, want the tracked 25", payload.Confirmations)
+	}
+	if payload.Timestamp != 1700000000 {
+		t.Errorf("callback timestamp = %d, want the signing timestamp", payload.Timestamp)
+	}
+}
+
+func TestJSONCallbackSignedTimestamp(t *testing.T) {
+	db := setupTestDB(t)
+	type request struct {
+		timestamp, signature string
+		body                 []byte
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Header.Get(CallbackHeaderTimestamp), r.Header.Get(CallbackHeaderSignature), body}
+	}))
+	defer server.Close()
+
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, CallbackFormat: model.CallbackFormatJSON}
+	db.Create(&merchant)
+	order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+		Money: decimal.NewFromInt(100), Status: model.OrderStatusPaid}
+	db.Create(&order)
+	task := model.NotifyTask{MerchantID: merchant.ID, OrderID: order.ID, Kind: model.NotifyTaskKindOrder, NotifyURL: server.URL,
+		Payload: `{"trade_status":"TRADE_SUCCESS"}`, Status: model.NotifyTaskPending, MaxAttempts: 3, NextAttemptAt: time.Now()}
+	db.Create(&task)
+
+	GetNotifyService().deliver(task.ID)
+	req := <-received
+
+	// 请求体中的 timestamp 与签名使用的请求头时间戳一致，商户可用任一字段校验时效
+	var payload JSONCallback
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("unmarshal callback: %v", err)
+	}
+	if strconv.FormatInt(payload.Timestamp, 10) != req.timestamp {
+		t.Errorf("body timestamp %d != header timestamp %s", payload.Timestamp, req.timestamp)
+	}
+	if want := util.HMACSHA256(req.timestamp+"."+string(req.body), "key"); req.signature != want {
+		t.Errorf("signature = %s, want %s", req.signature, want)
+	}
+}
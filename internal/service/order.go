@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
@@ -71,6 +70,7 @@ type CreateOrderResponse struct {
 	Rate           string `json:"rate,omitempty"`
 	Address        string `json:"address,omitempty"`
 	Chain          string `json:"chain,omitempty"`
+	PayReference   string `json:"pay_reference,omitempty"`    // 付款引用(Solana Pay reference)
 	QRCode         string `json:"qrcode,omitempty"`
 	ExpiredAt      string `json:"expired_at,omitempty"`
 	PayURL         string `json:"pay_url,omitempty"`
@@ -100,11 +100,18 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 
 	// 标准化支付类型
 	payType := util.NormalizePaymentType(req.Type)
-	chain := util.GetPaymentTypeChain(req.Type)
+	token, chain := util.ParsePaymentType(req.Type)
 
 	if !util.IsValidChain(chain) {
 		return nil, errors.New("不支持的支付类型")
 	}
+	// 链上代币必须是链的原生币或在代币登记表中启用
+	isNative := model.IsNativeToken(chain, token)
+	if !isNative && !util.IsFiatChain(chain) {
+		if _, ok := GetTokenService().GetToken(chain, token); !ok {
+			return nil, errors.New("不支持的支付币种")
+		}
+	}
 
 	// 检查订单号是否重复
 	var existingOrder model.Order
@@ -146,13 +153,8 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 	if isFiat {
 		payCurrency = "CNY" // 法币收款
 	} else {
-		// 加密货币收款：根据链确定币种
-		switch chain {
-		case "trx":
-			payCurrency = "TRX"
-		default:
-			payCurrency = "USDT" // trc20, erc20, bep20, polygon, optimism, arbitrum, avalanche, base
-		}
+		// 加密货币收款：原生币(TRX/ETH/BNB 等)或代币登记表中的稳定币(USDT/USDC/DAI 等)
+		payCurrency = token
 	}
 
 	// 从 USD 转换为支付货币（使用买入浮动，让用户多付）
@@ -163,8 +165,8 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 		buyFloatStr := rateService.GetConfigValue(model.ConfigKeyRateBuyFloat, "0")
 		buyFloat, _ := decimal.NewFromString(buyFloatStr)
 
-		if payCurrency == "USDT" {
-			// USD -> USDT: 基础汇率 1:1
+		if !isNative && payCurrency != "CNY" {
+			// USD -> USDT/USDC 等稳定币: 基础汇率 1:1
 			// 应用买入浮动：让用户多付
 			// 公式: payAmount = settlementAmount / (1 - buyFloat)
 			// 例如: 110.16 USD / (1 - 0.02) = 110.16 / 0.98 = 112.41 USDT
@@ -174,19 +176,22 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 				divisor := decimal.NewFromInt(1).Sub(buyFloat)
 				payAmount = settlementAmount.Div(divisor).Round(6)
 			}
-		} else if payCurrency == "TRX" {
-			// USD -> TRX: 获取 TRX/USD 价格
-			trxUsdRate, err := rateService.GetTRXUSDRate()
+		} else if isNative {
+			// USD -> 原生币(TRX/ETH/BNB 等): 获取原生币/USD 价格
+			coinUsdRate, err := rateService.GetCoinUSDRate(payCurrency)
 			if err != nil {
-				return nil, errors.New("TRX汇率获取失败: " + err.Error())
+				return nil, errors.New(payCurrency + "汇率获取失败: " + err.Error())
 			}
-			// 应用买入浮动：让用户多付 TRX
-			// 公式: payAmount = settlementAmount / (trxUsdRate * (1 - buyFloat))
+			if !coinUsdRate.IsPositive() {
+				return nil, errors.New(payCurrency + "汇率无效")
+			}
+			// 应用买入浮动：让用户多付原生币
+			// 公式: payAmount = settlementAmount / (coinUsdRate * (1 - buyFloat))
 			var adjustedRate decimal.Decimal
 			if buyFloat.IsZero() {
-				adjustedRate = trxUsdRate
+				adjustedRate = coinUsdRate
 			} else {
-				adjustedRate = trxUsdRate.Mul(decimal.NewFromInt(1).Sub(buyFloat))
+				adjustedRate = coinUsdRate.Mul(decimal.NewFromInt(1).Sub(buyFloat))
 			}
 			payAmount = settlementAmount.Div(adjustedRate).Round(6)
 		} else if payCurrency == "CNY" {
@@ -240,34 +245,53 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 	}
 
 	// 根据通道类型处理
+	var preFreezeFee bool
+	var hdWallet *model.HDWallet
 	if channel == "local" {
 		var wallet model.Wallet
 		var useMerchantWallet bool
 
+		// 已登记 HD 钱包时为订单派生独立收款地址(地址在事务中分配)
+		if !isFiat {
+			hdWallet, useMerchantWallet = GetHDWalletService().Select(&merchant, chain)
+		}
+
 		// 根据商户钱包模式选择钱包
 		// WalletMode: 1=仅系统钱包, 2=仅个人钱包, 3=混合模式(优先个人)
-		wallet, useMerchantWallet, err = s.selectWalletByMode(&merchant, chain)
-		if err != nil {
-			return nil, err
+		if hdWallet == nil {
+			wallet, useMerchantWallet, err = s.selectWalletByMode(&merchant, chain)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		if isFiat {
 			// 法币收款：使用收款码
 			order.ToAddress = wallet.Address // 微信/支付宝账号
 			order.QRCode = wallet.QRCode     // 收款二维码
+		} else if hdWallet != nil {
+			// 独立收款地址按地址匹配，不需要唯一标识金额
+			order.PayAmount = payAmount
+			order.UniqueAmount = payAmount
+			order.USDTAmount = payAmount
 		} else {
 			// 加密货币收款：生成唯一标识金额
-			// TRC20地址保持原始大小写(Base58编码)，ERC20/BEP20转小写
-			if chain == "trc20" || chain == "trx" {
-				order.ToAddress = wallet.Address
+			// 地址按链的扫描器标准化：TRON 保持原始大小写(Base58编码)，EVM 转小写
+			order.ToAddress = GetBlockchainService().NormalizeAddress(chain, wallet.Address)
+			// 支持付款引用的链(Solana Pay/TON 备注)生成引用，付款交易带引用时不依赖金额匹配
+			order.PayReference = GetBlockchainService().NewPaymentReference(&order)
+			if GetBlockchainService().ReferenceRequired(chain) {
+				// 付款必须附带备注的链(TON)按备注匹配，不需要唯一标识金额
+				order.PayAmount = payAmount
+				order.UniqueAmount = payAmount
+				order.USDTAmount = payAmount
 			} else {
-				order.ToAddress = strings.ToLower(wallet.Address)
+				// 生成唯一标识金额（含偏移）
+				uniqueAmount := rateService.GenerateUniqueAmount(payAmount, chain)
+				order.PayAmount = payAmount       // 展示金额（无偏移，如 102.04）
+				order.UniqueAmount = uniqueAmount // 标识金额（含偏移，如 102.040023）
+				order.USDTAmount = uniqueAmount   // 兼容旧字段
 			}
-			// 生成唯一标识金额（含偏移）
-			uniqueAmount := rateService.GenerateUniqueAmount(payAmount, chain)
-			order.PayAmount = payAmount       // 展示金额（无偏移，如 102.04）
-			order.UniqueAmount = uniqueAmount // 标识金额（含偏移，如 102.040023）
-			order.USDTAmount = uniqueAmount   // 兼容旧字段
 		}
 
 		// 法币收款也需要设置 UniqueAmount
@@ -298,25 +322,41 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 		order.Fee = fee
 
 		// 商户钱包模式需要预扣手续费
-		if useMerchantWallet && fee.GreaterThan(decimal.Zero) {
-			// 使用原子操作：检查余额并扣款，避免并发问题
-			// UPDATE merchants SET frozen_balance = frozen_balance + fee
-			// WHERE id = ? AND (balance - frozen_balance) >= fee
-			result := model.GetDB().Model(&model.Merchant{}).
-				Where("id = ? AND (balance - frozen_balance) >= ?", merchant.ID, fee.InexactFloat64()).
-				Update("frozen_balance", gorm.Expr("frozen_balance + ?", fee.InexactFloat64()))
-
-			if result.Error != nil {
-				return nil, errors.New("扣除手续费失败")
+		preFreezeFee = useMerchantWallet && fee.GreaterThan(decimal.Zero)
+	}
+
+	// 创建订单与预冻结手续费在同一事务中完成
+	// 预冻结时锁定商户行并校验可用余额，避免并发问题
+	if err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		if hdWallet != nil {
+			address, index, err := GetHDWalletService().Allocate(tx, hdWallet.ID)
+			if err != nil {
+				return errors.New("收款地址派生失败")
 			}
-			if result.RowsAffected == 0 {
-				return nil, errors.New("商户余额不足以支付手续费，请先充值")
+			order.ToAddress = address
+			order.HDWalletID = hdWallet.ID
+			order.DerivationIndex = index
+		}
+		if err := tx.Create(&order).Error; err != nil {
+			return errors.New("订单创建失败")
+		}
+		GetNotifyService().EmitOrderEvent(tx, &order, model.WebhookEventOrderCreated, WebhookOrderData{})
+		if preFreezeFee {
+			if err := GetWithdrawService().FreezeOrderFee(tx, &order); err != nil {
+				if errors.Is(err, ErrInsufficientBalance) {
+					return errors.New("商户余额不足以支付手续费，请先充值")
+				}
+				return errors.New("扣除手续费失败")
 			}
 		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
-	if err := model.GetDB().Create(&order).Error; err != nil {
-		return nil, errors.New("订单创建失败")
+	// 新派生地址需要加入监听
+	if hdWallet != nil {
+		GetBlockchainService().InvalidateWalletCache()
 	}
 
 	// 发送Telegram通知 - 订单创建
@@ -333,14 +373,14 @@ func (s *OrderService) CreateOrder(req *CreateOrderRequest) (*CreateOrderRespons
 			if err := model.GetDB().Where("chain = ? AND status = 1", chain).Order("RAND()").First(&wallet).Error; err != nil {
 				return nil, errors.New("暂无可用的收款地址")
 			}
-			// TRC20地址保持原始大小写
-			if chain == "trc20" || chain == "trx" {
-				order.ToAddress = wallet.Address
-			} else {
-				order.ToAddress = strings.ToLower(wallet.Address)
+			// 地址按链的扫描器标准化
+			order.ToAddress = GetBlockchainService().NormalizeAddress(chain, wallet.Address)
+			order.PayReference = GetBlockchainService().NewPaymentReference(&order)
+			// 生成唯一标识金额(付款必须附带备注的链不需要)
+			uniqueAmount := payAmount
+			if !GetBlockchainService().ReferenceRequired(chain) {
+				uniqueAmount = rateService.GenerateUniqueAmount(payAmount, chain)
 			}
-			// 生成唯一标识金额
-			uniqueAmount := rateService.GenerateUniqueAmount(payAmount, chain)
 			order.PayAmount = payAmount       // 展示金额
 			order.UniqueAmount = uniqueAmount // 标识金额
 			order.USDTAmount = uniqueAmount   // 兼容旧字段
@@ -435,6 +475,9 @@ func (s *OrderService) buildOrderResponse(order *model.Order, merchant *model.Me
 	if isFiat {
 		// 微信/支付宝使用存储的收款码
 		qrcode = order.QRCode
+	} else if uri := GetBlockchainService().PaymentURI(order); uri != "" {
+		// 支持付款链接的链(Solana Pay)使用链接
+		qrcode = uri
 	} else {
 		// USDT使用收款地址
 		qrcode = order.ToAddress
@@ -455,6 +498,7 @@ func (s *OrderService) buildOrderResponse(order *model.Order, merchant *model.Me
 		Rate:         order.Rate.String(),
 		Address:      order.ToAddress,
 		Chain:        order.Chain,
+		PayReference: order.PayReference,
 		QRCode:       qrcode,
 		ExpiredAt:    order.ExpiredAt.Format("2006-01-02 15:04:05"),
 		Channel:     order.Channel,
@@ -581,7 +625,7 @@ func (s *OrderService) GetOrderStats(merchantID uint) (*model.OrderStats, error)
 	if merchantID > 0 {
 		dbPaid = dbPaid.Where("merchant_id = ?", merchantID)
 	}
-	dbPaid.Where("status = ?", model.OrderStatusPaid).Select("COALESCE(SUM(settlement_amount), 0)").Scan(&totalUSD)
+	dbPaid.Where("status IN ?", model.PaidOrderStatuses).Select("COALESCE(SUM(settlement_amount), 0)").Scan(&totalUSD)
 	stats.TotalUSD = decimal.NewFromFloat(totalUSD)
 
 	// 各状态订单数
@@ -595,7 +639,7 @@ func (s *OrderService) GetOrderStats(merchantID uint) (*model.OrderStats, error)
 	if merchantID > 0 {
 		dbPaidCount = dbPaidCount.Where("merchant_id = ?", merchantID)
 	}
-	dbPaidCount.Where("status = ?", model.OrderStatusPaid).Count(&stats.PaidOrders)
+	dbPaidCount.Where("status IN ?", model.PaidOrderStatuses).Count(&stats.PaidOrders)
 
 	dbExpired := model.GetDB().Model(&model.Order{})
 	if merchantID > 0 {
@@ -613,7 +657,7 @@ func (s *OrderService) GetOrderStats(merchantID uint) (*model.OrderStats, error)
 	todayDB.Count(&stats.TodayOrders)
 
 	var todayUSD float64
-	todayDB.Where("status = ?", model.OrderStatusPaid).Select("COALESCE(SUM(settlement_amount), 0)").Scan(&todayUSD)
+	todayDB.Where("status IN ?", model.PaidOrderStatuses).Select("COALESCE(SUM(settlement_amount), 0)").Scan(&todayUSD)
 	stats.TodayUSD = decimal.NewFromFloat(todayUSD)
 
 	// 可用支付链路数量
@@ -638,20 +682,31 @@ func (s *OrderService) GetOrderStats(merchantID uint) (*model.OrderStats, error)
 func (s *OrderService) ExpireOrders() {
 	// 查找所有即将过期的订单
 	var orders []model.Order
-	if err := model.GetDB().Where("status = ? AND expired_at < ?", model.OrderStatusPending, time.Now()).Find(&orders).Error; err != nil {
+	// 部分支付的订单到期未补足同样过期，已收金额保留在订单上供人工处理
+	if err := model.GetDB().Where("status IN ? AND expired_at < ?", []model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial}, time.Now()).Find(&orders).Error; err != nil {
 		return
 	}
 
 	for _, order := range orders {
-		// 更新订单状态
-		model.GetDB().Model(&order).Update("status", model.OrderStatusExpired)
-
-		// 退还预扣的手续费 (仅商户钱包模式)
-		if order.FeeType == model.FeeTypeBalance {
-			fee, _ := order.Fee.Float64()
-			if err := GetWithdrawService().RefundPreChargedFee(order.MerchantID, fee); err != nil {
-				fmt.Printf("Failed to refund fee for expired order %s: %v\n", order.TradeNo, err)
+		// 更新订单状态并退还预扣的手续费 (仅商户钱包模式)
+		expired := false
+		err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&order).Where("status = ?", order.Status).Update("status", model.OrderStatusExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				// 订单已被支付或取消
+				return result.Error
 			}
+			expired = true
+			order.Status = model.OrderStatusExpired
+			GetNotifyService().EmitOrderEvent(tx, &order, model.WebhookEventOrderExpired, WebhookOrderData{})
+			return GetWithdrawService().RefundPreChargedFee(tx, &order)
+		})
+		if err != nil {
+			fmt.Printf("Failed to expire order %s: %v\n", order.TradeNo, err)
+			continue
+		}
+		if !expired {
+			continue
 		}
 
 		// 发送Telegram通知 - 订单过期
@@ -764,33 +819,42 @@ func (s *OrderService) CancelOrder(tradeNo string) error {
 		return errors.New("订单不存在或无法取消")
 	}
 
-	// 更新订单状态
-	if err := model.GetDB().Model(&order).Update("status", model.OrderStatusCancelled).Error; err != nil {
-		return err
-	}
-
-	// 退还预扣的手续费 (仅商户钱包模式)
-	if order.FeeType == model.FeeTypeBalance {
-		fee, _ := order.Fee.Float64()
-		if err := GetWithdrawService().RefundPreChargedFee(order.MerchantID, fee); err != nil {
+	// 更新订单状态并退还预扣的手续费 (仅商户钱包模式)
+	return model.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&order).Where("status = ?", model.OrderStatusPending).Update("status", model.OrderStatusCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("订单不存在或无法取消")
+		}
+		if err := GetWithdrawService().RefundPreChargedFee(tx, &order); err != nil {
 			return fmt.Errorf("退还手续费失败: %v", err)
 		}
-	}
-
-	return nil
+		order.Status = model.OrderStatusCancelled
+		GetNotifyService().EmitOrderEvent(tx, &order, model.WebhookEventOrderCancelled, WebhookOrderData{})
+		return nil
+	})
 }
 
 // MarkOrderPaid 手动标记订单已支付 (仅管理员)
-func (s *OrderService) MarkOrderPaid(tradeNo string, txHash string, amount decimal.Decimal) error {
+// 与自动匹配相同，订单状态更新与商户入账(含预冻结手续费解冻)在同一事务中完成
+func (s *OrderService) MarkOrderPaid(tradeNo string, txHash string, amount decimal.Decimal, operator string) error {
 	var order model.Order
 	if err := model.GetDB().Where("trade_no = ?", tradeNo).First(&order).Error; err != nil {
 		return errors.New("订单不存在")
 	}
 
-	if order.Status != model.OrderStatusPending && order.Status != model.OrderStatusExpired {
-		return errors.New("订单状态不正确，只能确认待支付或已过期订单")
+	if order.Status != model.OrderStatusPending && order.Status != model.OrderStatusExpired && order.Status != model.OrderStatusPartial {
+		return errors.New("订单状态不正确，只能确认待支付、部分支付或已过期订单")
+	}
+
+	// 未填写到账金额时按应收金额处理
+	if !amount.IsPositive() {
+		amount = orderRequiredAmount(&order)
 	}
 
+	prevStatus := order.Status
 	now := time.Now()
 	updates := map[string]interface{}{
 		"status":        model.OrderStatusPaid,
@@ -799,7 +863,25 @@ func (s *OrderService) MarkOrderPaid(tradeNo string, txHash string, amount decim
 		"paid_at":       &now,
 	}
 
-	if err := model.GetDB().Model(&order).Updates(updates).Error; err != nil {
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 只更新仍处于确认前状态的订单，避免与自动匹配或其他管理员重复入账
+		query := tx.Model(&order).Where("status = ?", prevStatus)
+		if prevStatus == model.OrderStatusPartial {
+			query = query.Where("actual_amount = ?", order.ActualAmount)
+		}
+		result := query.Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errOrderAlreadyProcessed
+		}
+		// 预冻结手续费按确认前的状态解冻(过期订单的预冻结已退还)
+		order.ActualAmount = amount
+		_, err := GetWithdrawService().SettleOrderBalance(tx, &order, prevStatus, AdminActor(operator))
+		return err
+	})
+	if err != nil {
 		return err
 	}
 
@@ -825,7 +907,7 @@ func (s *OrderService) CheckOrderPaid(tradeNo string) (bool, *model.Order, error
 		item := cached.(orderCacheItem)
 		// 如果缓存未过期且订单已支付或已过期，直接返回缓存结果
 		// 已支付和已过期的订单状态不会再变化，可以长期缓存
-		if time.Since(item.timestamp) < s.cacheTTL || item.order.Status == model.OrderStatusPaid || item.order.Status == model.OrderStatusExpired {
+		if time.Since(item.timestamp) < s.cacheTTL || item.order.Status.IsPaid() || item.order.Status == model.OrderStatusExpired {
 			return item.paid, item.order, nil
 		}
 	}
@@ -839,7 +921,7 @@ func (s *OrderService) CheckOrderPaid(tradeNo string) (bool, *model.Order, error
 		return false, nil, err
 	}
 
-	paid := order.Status == model.OrderStatusPaid
+	paid := order.Status.IsPaid()
 
 	// 更新缓存
 	s.cache.Store(tradeNo, orderCacheItem{
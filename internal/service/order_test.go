@@ -0,0 +1,86 @@
+package service
+
+import (
+	"testing"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func TestMarkOrderPaidSettlesBalance(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      model.OrderStatus
+		feeType     model.FeeType
+		frozen      float64 // 商户冻结余额(待支付订单的预冻结手续费)
+		wantBalance float64
+		wantFrozen  float64
+	}{
+		{name: "pending with pre-frozen fee", status: model.OrderStatusPending, feeType: model.FeeTypeBalance, frozen: 2, wantBalance: 98, wantFrozen: 0},
+		{name: "partial with pre-frozen fee", status: model.OrderStatusPartial, feeType: model.FeeTypeBalance, frozen: 2, wantBalance: 98, wantFrozen: 0},
+		{name: "expired fee already refunded", status: model.OrderStatusExpired, feeType: model.FeeTypeBalance, wantBalance: 98, wantFrozen: 0},
+		{name: "fee deducted from payment", status: model.OrderStatusPending, feeType: model.FeeTypeDeduction, wantBalance: 98, wantFrozen: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, FrozenBalance: tt.frozen}
+			db.Create(&merchant)
+			order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Status: tt.status,
+				Money: decimal.NewFromInt(100), SettlementAmount: decimal.NewFromInt(100), Fee: decimal.NewFromInt(2), FeeType: tt.feeType}
+			db.Create(&order)
+
+			if err := GetOrderService().MarkOrderPaid("T1", "0xabc", decimal.NewFromInt(100), "root"); err != nil {
+				t.Fatalf("MarkOrderPaid: %v", err)
+			}
+
+			var got model.Order
+			db.First(&got, order.ID)
+			if got.Status != model.OrderStatusPaid {
+				t.Errorf("order status = %d, want paid", got.Status)
+			}
+			db.First(&merchant, merchant.ID)
+			if merchant.Balance != tt.wantBalance || merchant.FrozenBalance != tt.wantFrozen {
+				t.Errorf("merchant balance=%.2f frozen=%.2f, want %.2f and %.2f",
+					merchant.Balance, merchant.FrozenBalance, tt.wantBalance, tt.wantFrozen)
+			}
+			var entries int64
+			db.Model(&model.BalanceLedger{}).Where("ref_type = ? AND ref_id = ?", model.LedgerRefOrder, order.ID).Count(&entries)
+			if entries == 0 {
+				t.Error("no ledger entries recorded for the manually paid order")
+			}
+		})
+	}
+}
+
+func TestMarkOrderPaidConcurrentSettlement(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, FrozenBalance: 2}
+	db.Create(&merchant)
+	order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Status: model.OrderStatusPartial,
+		Money: decimal.NewFromInt(100), ActualAmount: decimal.NewFromInt(40), SettlementAmount: decimal.NewFromInt(100),
+		Fee: decimal.NewFromInt(2), FeeType: model.FeeTypeBalance}
+	db.Create(&order)
+
+	// 读取订单后、更新前，补款转账已被自动匹配并结算
+	raced := false
+	db.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "orders" {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE orders SET status = ?, actual_amount = ? WHERE id = ?",
+			model.OrderStatusPaid, decimal.NewFromInt(100), order.ID)
+	})
+
+	if err := GetOrderService().MarkOrderPaid("T1", "0xabc", decimal.NewFromInt(100), "root"); err == nil {
+		t.Fatal("MarkOrderPaid settled an order that was already paid")
+	}
+	var entries int64
+	db.Model(&model.BalanceLedger{}).Where("ref_type = ? AND ref_id = ?", model.LedgerRefOrder, order.ID).Count(&entries)
+	if entries != 0 {
+		t.Errorf("%d ledger entries written for a lost race, want 0", entries)
+	}
+}
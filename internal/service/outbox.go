@@ -0,0 +1,224 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 事务外发消息主题
+const (
+	OutboxTopicOrderPaid    = "order.paid"    // 订单支付成功通知(管理员 Bot + 商户 Telegram)
+	OutboxTopicOrderSettled = "order.settled" // 订单入账余额变动通知
+)
+
+const (
+	outboxBatchSize   = 50
+	outboxMaxAttempts = 5
+	outboxLease       = 2 * time.Minute // 取出后的租约，处理进程异常退出时租约到期后重新处理
+)
+
+// outboxHandler 外发消息处理函数，返回错误时按退避重试
+type outboxHandler func(payload []byte) error
+
+// OutboxService 事务外发消息服务
+// 业务事务中通过 Publish 写入消息，提交后由后台协程按主题分发执行
+type OutboxService struct {
+	handlers map[string]outboxHandler
+	wake     chan struct{}
+}
+
+var (
+	outboxService     *OutboxService
+	outboxServiceOnce sync.Once
+)
+
+// GetOutboxService 获取外发消息服务实例
+func GetOutboxService() *OutboxService {
+	outboxServiceOnce.Do(func() {
+		outboxService = &OutboxService{
+			handlers: map[string]outboxHandler{
+				OutboxTopicOrderPaid:    handleOutboxOrderPaid,
+				OutboxTopicOrderSettled: handleOutboxOrderSettled,
+			},
+			wake: make(chan struct{}, 1),
+		}
+	})
+	return outboxService
+}
+
+// outboxOrderPayload 订单类外发消息内容
+type outboxOrderPayload struct {
+	OrderID uint `json:"order_id"`
+}
+
+// outboxSettledPayload 订单入账外发消息内容
+type outboxSettledPayload struct {
+	OrderID uint            `json:"order_id"`
+	Balance decimal.Decimal `json:"balance"` // 入账后余额
+}
+
+// Publish 在事务中写入外发消息，必须传入业务事务 tx
+func (s *OutboxService) Publish(tx *gorm.DB, topic string, payload interface{}) error {
+	if _, ok := s.handlers[topic]; !ok {
+		return fmt.Errorf("unknown outbox topic: %s", topic)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.OutboxEvent{
+		Topic:         topic,
+		Payload:       string(data),
+		Status:        model.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// Signal 唤醒分发协程（事务提交后调用，非阻塞）
+func (s *OutboxService) Signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// StartOutboxWorker 启动外发消息分发协程
+func (s *OutboxService) StartOutboxWorker() {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.wake:
+			}
+
+			for {
+				events := s.claimDue(outboxBatchSize)
+				for i := range events {
+					s.dispatch(&events[i])
+				}
+				if len(events) < outboxBatchSize {
+					break
+				}
+			}
+		}
+	}()
+
+	log.Println("Outbox worker started")
+}
+
+// claimDue 取出到期消息并延长租约，多实例部署时通过 SKIP LOCKED 避免重复取出
+func (s *OutboxService) claimDue(limit int) []model.OutboxEvent {
+	var events []model.OutboxEvent
+	now := time.Now()
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", model.OutboxPending, now).
+			Order("id ASC").
+			Limit(limit).
+			Find(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(events))
+		for _, event := range events {
+			ids = append(ids, event.ID)
+		}
+		return tx.Model(&model.OutboxEvent{}).Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(outboxLease)).Error
+	})
+	if err != nil {
+		log.Printf("Outbox claim error: %v", err)
+		return nil
+	}
+	return events
+}
+
+// dispatch 执行一条外发消息并记录结果
+func (s *OutboxService) dispatch(event *model.OutboxEvent) {
+	handler, ok := s.handlers[event.Topic]
+	var err error
+	if !ok {
+		err = fmt.Errorf("unknown outbox topic: %s", event.Topic)
+	} else {
+		err = handler([]byte(event.Payload))
+	}
+
+	now := time.Now()
+	attempts := event.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"last_error": "",
+	}
+	switch {
+	case err == nil:
+		updates["status"] = model.OutboxDone
+		updates["processed_at"] = &now
+	case !ok || attempts >= outboxMaxAttempts:
+		updates["status"] = model.OutboxFailed
+		updates["last_error"] = strings.ToValidUTF8(util.TruncateString(err.Error(), 500), "")
+		log.Printf("Outbox event %d (%s) failed after %d attempts: %v", event.ID, event.Topic, attempts, err)
+	default:
+		updates["next_attempt_at"] = now.Add(notifyBackoff(attempts))
+		updates["last_error"] = strings.ToValidUTF8(util.TruncateString(err.Error(), 500), "")
+	}
+
+	model.GetDB().Model(&model.OutboxEvent{}).
+		Where("id = ? AND attempts = ?", event.ID, event.Attempts).
+		Updates(updates)
+}
+
+// handleOutboxOrderPaid 订单支付成功通知
+func handleOutboxOrderPaid(payload []byte) error {
+	var p outboxOrderPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var order model.Order
+	if err := model.GetDB().First(&order, p.OrderID).Error; err != nil {
+		return fmt.Errorf("order %d not found", p.OrderID)
+	}
+
+	GetBotService().NotifyOrderPaid(&order)
+	GetTelegramService().NotifyOrderPaid(&order)
+	return nil
+}
+
+// handleOutboxOrderSettled 订单入账余额变动通知
+func handleOutboxOrderSettled(payload []byte) error {
+	var p outboxSettledPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var order model.Order
+	if err := model.GetDB().First(&order, p.OrderID).Error; err != nil {
+		return fmt.Errorf("order %d not found", p.OrderID)
+	}
+
+	realAmount := order.SettlementAmount.Sub(order.Fee)
+	GetTelegramService().NotifyBalanceChanged(
+		order.MerchantID,
+		"订单入账",
+		realAmount.Round(2),
+		p.Balance,
+		fmt.Sprintf("订单结算 USD %s，扣除手续费 USD %s", order.SettlementAmount.StringFixed(2), order.Fee.StringFixed(2)),
+	)
+	return nil
+}
@@ -0,0 +1,760 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"ezpay/config"
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// payoutSender 链上代币打款实现
+type payoutSender interface {
+	// Address 热钱包在该链的地址
+	Address() string
+	// Prepare 发送一批打款前的准备(如授权 disperse 合约)，未就绪时本轮不打款
+	Prepare(listener *ChainListener, token *model.Token, total *big.Int, count int) (bool, error)
+	// Build 构建并签名一批代币转账(不广播)，签名后的交易可重复广播；
+	// 返回的交易按发送顺序排列，中途失败时返回已构建的交易和错误
+	Build(listener *ChainListener, token *model.Token, transfers []payoutTransfer) ([]*payoutTx, error)
+	// Broadcast 广播已签名交易，交易已在节点中时不返回错误
+	Broadcast(listener *ChainListener, raw string) error
+	// Dropped 查不到交易时判断其是否已不可能上链(nonce 被占用/已过期)
+	Dropped(listener *ChainListener, w *model.Withdrawal) (payoutDropState, error)
+}
+
+// payoutDropState 查不到打款交易时对交易能否上链的判断
+type payoutDropState int
+
+const (
+	payoutPending   payoutDropState = iota // 交易仍可能上链，继续广播等待
+	payoutDropped                          // 当前节点上交易已失效且查不到
+	payoutUncertain                        // 节点数据互相矛盾(如 nonce 已被占用但交易仍在)，需人工核实
+)
+
+// payoutTransfer 一笔代币转账
+type payoutTransfer struct {
+	To     string
+	Amount *big.Int // 最小单位
+}
+
+// payoutTx 已签名的打款交易
+type payoutTx struct {
+	Hash      string
+	Raw       string
+	Nonce     uint64 // EVM nonce
+	Transfers []int  // 交易包含的转账(Build 参数中的下标)，disperse 交易包含整批
+}
+
+// payoutMaxAttempts 提现的打款交易失败达到该次数后标记为打款失败，不再自动重试
+const payoutMaxAttempts = 3
+
+// payoutDropRounds 交易需在同一 RPC 节点上连续多轮判定为已失效才退回重新打款，
+// 避免节点故障转移或节点数据滞后时把已上链的交易误判为失效而重复打款
+const payoutDropRounds = 5
+
+// payoutDropCheck 交易已失效的连续判定
+type payoutDropCheck struct {
+	endpoint string // 判定所用的 RPC 节点
+	rounds   int    // 连续判定轮数
+}
+
+// PayoutService 热钱包自动打款服务
+// 审核通过的提现按链和币种合并为一批(batch_size)，先签名并记录交易哈希再广播，每条链同时只有一批打款在途(保证 EVM nonce 连续)；
+// 达到链的确认数后按 CompleteWithdrawal 相同的方式扣款。交易失败或在同一节点连续多轮确认无法上链时只退回受影响的提现，
+// 重新进入待打款，多次失败或交易状态无法确认时标记为打款失败，资金保持冻结，由管理员核实
+type PayoutService struct {
+	cfg        config.PayoutConfig
+	senders    map[string]payoutSender     // 链 -> 打款实现
+	dropChecks map[string]*payoutDropCheck // 交易哈希 -> 已失效判定，重启后重新计数
+	mu         sync.Mutex                  // 串行执行打款轮次
+}
+
+var (
+	payoutService     *PayoutService
+	payoutServiceOnce sync.Once
+)
+
+// GetPayoutService 获取自动打款服务实例
+func GetPayoutService() *PayoutService {
+	payoutServiceOnce.Do(func() {
+		payoutService = &PayoutService{
+			senders:    make(map[string]payoutSender),
+			dropChecks: make(map[string]*payoutDropCheck),
+		}
+	})
+	return payoutService
+}
+
+// Init 加载热钱包 keystore 并登记自动打款的链，未启用时不做任何事
+func (s *PayoutService) Init(cfg *config.Config) error {
+	s.cfg = cfg.Payout
+	if !s.cfg.Enabled {
+		return nil
+	}
+	if s.cfg.Keystore == "" {
+		return errors.New("未配置 payout.keystore")
+	}
+	password := os.Getenv(s.cfg.PasswordEnv)
+	if password == "" {
+		return fmt.Errorf("环境变量 %s 未设置 keystore 密码", s.cfg.PasswordEnv)
+	}
+	wallet, err := loadHotWallet(s.cfg.Keystore, password)
+	if err != nil {
+		return err
+	}
+
+	for _, chain := range s.cfg.Chains {
+		info, ok := util.GetChain(chain)
+		if !ok {
+			return fmt.Errorf("自动打款的链 %s 未配置", chain)
+		}
+		switch info.Type {
+		case util.ChainTypeEVM:
+			s.senders[chain] = &evmPayout{wallet: wallet, gasPriceBump: s.cfg.GasPriceBump, disperse: s.cfg.DisperseContracts[chain]}
+		case util.ChainTypeTRC20:
+			s.senders[chain] = &tronPayout{wallet: wallet, feeLimit: s.cfg.TronFeeLimit * 1_000_000}
+		default:
+			return fmt.Errorf("链 %s 不支持自动打款(仅支持 TRC20/EVM 代币)", chain)
+		}
+		log.Printf("[%s] Payout hot wallet: %s", chain, s.senders[chain].Address())
+	}
+	return nil
+}
+
+// Enabled 该链是否由热钱包自动打款
+func (s *PayoutService) Enabled(chain string) bool {
+	_, ok := s.senders[chain]
+	return ok
+}
+
+// CanSend 热钱包能否在该链自动发送该币种: 只支持已登记的代币，原生币(TRX 等)由管理员手动打款
+func (s *PayoutService) CanSend(chain, currency string) bool {
+	if !s.Enabled(chain) {
+		return false
+	}
+	_, ok := GetTokenService().GetToken(chain, currency)
+	return ok
+}
+
+// StartPayoutWorker 启动自动打款任务
+func (s *PayoutService) StartPayoutWorker() {
+	if len(s.senders) == 0 {
+		return
+	}
+	interval := time.Duration(s.cfg.Interval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.RunOnce()
+		}
+	}()
+
+	log.Println("Payout worker started")
+}
+
+// RunOnce 执行一轮打款: 跟踪在途交易，没有在途打款时为每条链发出下一批
+func (s *PayoutService) RunOnce() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for chain, sender := range s.senders {
+		listener := s.listener(chain)
+		if listener == nil {
+			continue
+		}
+		if s.track(listener, sender) == 0 {
+			s.sendBatch(listener, sender)
+		}
+	}
+}
+
+// listener 链的监听器(提供 RPC 客户端和确认数查询)
+func (s *PayoutService) listener(chain string) *ChainListener {
+	bs := GetBlockchainService()
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	listener, ok := bs.listeners[chain]
+	if !ok || bs.rpcClients[chain] == nil {
+		return nil
+	}
+	return listener
+}
+
+// batchSize 每批最多合并的提现笔数
+func (s *PayoutService) batchSize() int {
+	if s.cfg.BatchSize < 1 {
+		return 1
+	}
+	return min(s.cfg.BatchSize, 200)
+}
+
+// track 跟踪在途打款，返回仍在途的提现数量
+// disperse 交易包含整批提现，按交易哈希分组查询
+func (s *PayoutService) track(listener *ChainListener, sender payoutSender) int {
+	var withdrawals []model.Withdrawal
+	if err := model.GetDB().Where("pay_method = ? AND status = ?", listener.chain, model.WithdrawStatusPaying).
+		Order("id ASC").Find(&withdrawals).Error; err != nil || len(withdrawals) == 0 {
+		return len(withdrawals)
+	}
+
+	currentBlock, err := listener.scanner.LatestHeight(listener)
+	if err != nil || currentBlock == 0 {
+		log.Printf("[%s] Payout: failed to get block number: %v", listener.chain, err)
+		return len(withdrawals)
+	}
+
+	var hashes []string
+	groups := make(map[string][]*model.Withdrawal)
+	batches := make(map[uint]bool)
+	for i := range withdrawals {
+		w := &withdrawals[i]
+		if _, ok := groups[w.PayoutTxHash]; !ok {
+			hashes = append(hashes, w.PayoutTxHash)
+		}
+		groups[w.PayoutTxHash] = append(groups[w.PayoutTxHash], w)
+		batches[w.PayoutBatchID] = true
+	}
+
+	inFlight := 0
+	for _, hash := range hashes {
+		group := groups[hash]
+		if hash == "" {
+			// 领取后未能签名(服务中断)，交易从未广播
+			s.revert(group, "打款交易未生成", false)
+			continue
+		}
+
+		// 先查 nonce/有效期再查交易，避免交易恰好在两次查询之间上链被误判；
+		// 查询期间切换了 RPC 节点时两次结果不可比较，本轮不做失效判定
+		endpoint := s.endpoint(listener.chain)
+		drop, err := sender.Dropped(listener, group[0])
+		if err != nil {
+			inFlight += len(group)
+			continue
+		}
+		conf, err := listener.scanner.TxConfirmation(listener, hash, currentBlock)
+		if err != nil {
+			inFlight += len(group)
+			continue
+		}
+		if s.endpoint(listener.chain) != endpoint {
+			drop = payoutPending
+		}
+		if conf.found || drop != payoutDropped {
+			delete(s.dropChecks, hash)
+		}
+
+		switch {
+		case conf.failed:
+			s.revert(group, "打款交易执行失败", false)
+		case !conf.found && drop == payoutUncertain:
+			// 保留交易哈希在原因中，供管理员核实
+			s.revert(group, fmt.Sprintf("打款交易 %s 状态无法确认，请在区块浏览器核实后处理", hash), true)
+		case !conf.found && drop == payoutDropped:
+			if !s.confirmDropped(hash, endpoint) {
+				inFlight += len(group)
+				continue
+			}
+			delete(s.dropChecks, hash)
+			s.revert(group, "打款交易未上链且已失效", false)
+		case !conf.found:
+			inFlight += len(group)
+			if err := sender.Broadcast(listener, group[0].PayoutRawTx); err != nil {
+				s.recordError(group, err)
+			}
+		case conf.confirmations >= listener.confirmations:
+			for _, w := range group {
+				if err := s.complete(w); err != nil {
+					log.Printf("[%s] Payout: failed to complete withdrawal %d: %v", listener.chain, w.ID, err)
+					inFlight++
+				}
+			}
+		default:
+			inFlight += len(group)
+		}
+	}
+
+	for batchID := range batches {
+		s.finishBatch(batchID)
+	}
+	return inFlight
+}
+
+// endpoint 链当前使用的 RPC 节点
+func (s *PayoutService) endpoint(chain string) string {
+	rpcClient := GetBlockchainService().rpcClients[chain]
+	if rpcClient == nil {
+		return ""
+	}
+	return rpcClient.getCurrentEndpoint()
+}
+
+// confirmDropped 记录一轮交易已失效的判定，同一节点连续 payoutDropRounds 轮判定后返回 true
+func (s *PayoutService) confirmDropped(hash, endpoint string) bool {
+	check, ok := s.dropChecks[hash]
+	if !ok || check.endpoint != endpoint {
+		check = &payoutDropCheck{endpoint: endpoint}
+		s.dropChecks[hash] = check
+	}
+	check.rounds++
+	return check.rounds >= payoutDropRounds
+}
+
+// sendBatch 将最早的待打款提现及其后同币种的提现合并为一批，签名并广播
+// 先领取提现(approved -> paying)并登记批次，签名后保存交易再广播，未签名成功的提现退回待打款
+func (s *PayoutService) sendBatch(listener *ChainListener, sender payoutSender) {
+	// 只领取热钱包能发送的币种，其他币种(如 TRX)保持待打款，由管理员手动打款
+	var symbols []string
+	for _, token := range GetTokenService().EnabledTokens(listener.chain) {
+		symbols = append(symbols, token.Symbol)
+	}
+	if len(symbols) == 0 {
+		return
+	}
+
+	var withdrawals []model.Withdrawal
+	if err := model.GetDB().Where("pay_method = ? AND status = ? AND payout_currency IN ?", listener.chain, model.WithdrawStatusApproved, symbols).
+		Order("id ASC").Limit(s.batchSize() * 4).Find(&withdrawals).Error; err != nil || len(withdrawals) == 0 {
+		return
+	}
+
+	var token *model.Token
+	var batch []*model.Withdrawal
+	var transfers []payoutTransfer
+	total := new(big.Int)
+	for i := range withdrawals {
+		w := &withdrawals[i]
+		t, amount, err := s.validate(listener, w)
+		if err != nil {
+			// 提现本身的问题不阻塞后面的提现
+			s.recordError([]*model.Withdrawal{w}, err)
+			continue
+		}
+		if token == nil {
+			token = t
+		} else if t.ID != token.ID {
+			continue
+		}
+		batch = append(batch, w)
+		transfers = append(transfers, payoutTransfer{To: w.Account, Amount: amount})
+		total.Add(total, amount)
+		if len(batch) >= s.batchSize() {
+			break
+		}
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	ready, err := sender.Prepare(listener, token, total, len(batch))
+	if err != nil {
+		s.recordError(batch, err)
+		log.Printf("[%s] Payout: prepare batch failed: %v", listener.chain, err)
+		return
+	}
+	if !ready {
+		return
+	}
+
+	record, err := s.claim(listener.chain, token, batch, transfers)
+	if err != nil {
+		return
+	}
+
+	txs, buildErr := sender.Build(listener, token, transfers)
+	if len(txs) == 0 {
+		if buildErr == nil {
+			buildErr = errors.New("打款交易未生成")
+		}
+		s.release(record, batch, buildErr)
+		log.Printf("[%s] Payout: build batch failed: %v", listener.chain, buildErr)
+		return
+	}
+	for _, tx := range txs {
+		group := make([]*model.Withdrawal, 0, len(tx.Transfers))
+		for _, i := range tx.Transfers {
+			group = append(group, batch[i])
+		}
+		if err := s.save(record, group, tx); err != nil {
+			// 保存失败的交易不广播；EVM 后续 nonce 出现空缺，后面的交易同样不广播
+			log.Printf("[%s] Payout: failed to save tx %s: %v", listener.chain, tx.Hash, err)
+			break
+		}
+		if err := sender.Broadcast(listener, tx.Raw); err != nil {
+			// 交易已保存，下一轮查不到时重新广播
+			s.recordError(group, err)
+			log.Printf("[%s] Payout: broadcast tx %s failed: %v", listener.chain, tx.Hash, err)
+			continue
+		}
+		log.Printf("[%s] Payout: batch %d sent %d withdrawal(s), tx %s", listener.chain, record.ID, len(group), tx.Hash)
+	}
+
+	var unsent []*model.Withdrawal
+	for _, w := range batch {
+		if w.PayoutTxHash == "" {
+			unsent = append(unsent, w)
+		}
+	}
+	if len(unsent) > 0 {
+		reason := "打款交易未生成"
+		if buildErr != nil {
+			reason = buildErr.Error()
+			log.Printf("[%s] Payout: batch %d: %d withdrawal(s) not sent: %v", listener.chain, record.ID, len(unsent), buildErr)
+		}
+		s.revert(unsent, reason, false)
+	}
+	if len(txs) == 1 && len(txs[0].Transfers) > 1 {
+		model.GetDB().Model(record).Update("mode", model.PayoutModeDisperse)
+	}
+	s.finishBatch(record.ID)
+}
+
+// claim 领取一批待打款提现并登记批次，任何一笔状态已变化时放弃本批
+func (s *PayoutService) claim(chain string, token *model.Token, batch []*model.Withdrawal, transfers []payoutTransfer) (*model.PayoutBatch, error) {
+	record := &model.PayoutBatch{
+		Chain:  chain,
+		Token:  token.Symbol,
+		Mode:   model.PayoutModeSequence,
+		Count:  len(batch),
+		Status: model.PayoutBatchSending,
+	}
+	items := make([]model.PayoutBatchItem, len(batch))
+	ids := make([]uint, len(batch))
+	total := decimal.Zero
+	for i, w := range batch {
+		amount := decimal.NewFromBigInt(transfers[i].Amount, -int32(token.Decimals))
+		total = total.Add(amount)
+		items[i] = model.PayoutBatchItem{WithdrawalID: w.ID, Amount: amount, Account: w.Account}
+		ids[i] = w.ID
+	}
+	record.TotalAmount = total
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			items[i].BatchID = record.ID
+		}
+		if err := tx.Create(&items).Error; err != nil {
+			return err
+		}
+
+		result := tx.Model(&model.Withdrawal{}).Where("id IN ? AND status = ?", ids, model.WithdrawStatusApproved).
+			Updates(map[string]interface{}{
+				"status":          model.WithdrawStatusPaying,
+				"payout_batch_id": record.ID,
+				"payout_tx_hash":  "",
+				"payout_raw_tx":   "",
+				"payout_error":    "",
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(ids)) {
+			return errors.New("提现状态已变更")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range batch {
+		w.Status = model.WithdrawStatusPaying
+		w.PayoutBatchID = record.ID
+	}
+	return record, nil
+}
+
+// release 一笔交易都未生成(如热钱包余额不足)时撤销领取: 提现退回待打款并删除批次，不计打款次数
+func (s *PayoutService) release(record *model.PayoutBatch, batch []*model.Withdrawal, cause error) {
+	ids := make([]uint, len(batch))
+	for i, w := range batch {
+		ids[i] = w.ID
+	}
+	msg := cause.Error()
+	if runes := []rune(msg); len(runes) > 500 {
+		msg = string(runes[:500])
+	}
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Withdrawal{}).Where("id IN ? AND status = ?", ids, model.WithdrawStatusPaying).
+			Updates(map[string]interface{}{
+				"status":          model.WithdrawStatusApproved,
+				"payout_batch_id": 0,
+				"payout_error":    msg,
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("batch_id = ?", record.ID).Delete(&model.PayoutBatchItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(record).Error
+	})
+	if err != nil {
+		// 未能撤销时由 track 按未生成交易退回
+		log.Printf("[%s] Payout: failed to release batch %d: %v", record.Chain, record.ID, err)
+	}
+}
+
+// save 保存已签名交易，保存成功后才广播
+func (s *PayoutService) save(record *model.PayoutBatch, group []*model.Withdrawal, tx *payoutTx) error {
+	now := time.Now()
+	ids := make([]uint, len(group))
+	for i, w := range group {
+		ids[i] = w.ID
+	}
+
+	err := model.GetDB().Transaction(func(db *gorm.DB) error {
+		if err := db.Model(&model.Withdrawal{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"payout_tx_hash":  tx.Hash,
+			"payout_raw_tx":   tx.Raw,
+			"payout_nonce":    tx.Nonce,
+			"payout_sent_at":  &now,
+			"payout_attempts": gorm.Expr("payout_attempts + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		return db.Model(&model.PayoutBatchItem{}).Where("batch_id = ? AND withdrawal_id IN ?", record.ID, ids).
+			Update("tx_hash", tx.Hash).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, w := range group {
+		w.PayoutTxHash = tx.Hash
+		w.PayoutAttempts++
+		GetNotifyService().EmitWithdrawalEvent(nil, w)
+	}
+	return nil
+}
+
+// validate 校验提现的打款币种、地址和金额，返回代币和链上金额(最小单位)
+func (s *PayoutService) validate(listener *ChainListener, w *model.Withdrawal) (*model.Token, *big.Int, error) {
+	token, ok := GetTokenService().GetToken(listener.chain, w.PayoutCurrency)
+	if !ok {
+		return nil, nil, fmt.Errorf("链 %s 未启用代币 %s", listener.chain, w.PayoutCurrency)
+	}
+	if !listener.scanner.ValidateAddress(w.Account) {
+		return nil, nil, errors.New("收款地址格式无效")
+	}
+	amount := decimal.NewFromFloat(w.PayoutAmount).Shift(int32(token.Decimals)).BigInt()
+	if amount.Sign() <= 0 {
+		return nil, nil, errors.New("打款金额无效")
+	}
+	return token, amount, nil
+}
+
+// complete 打款交易已确认: 解冻并扣除余额，提现标记为已打款
+func (s *PayoutService) complete(w *model.Withdrawal) error {
+	now := time.Now()
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(w).Where("status = ?", model.WithdrawStatusPaying).Updates(map[string]interface{}{
+			"status":       model.WithdrawStatusPaid,
+			"processed_at": &now,
+			"payout_error": "",
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("提现状态已变更")
+		}
+
+		amount := decimal.NewFromFloat(w.Amount)
+		_, err := GetLedgerService().Apply(tx, w.MerchantID,
+			LedgerEntry{
+				Type:    model.LedgerTypeUnfreeze,
+				Amount:  amount,
+				RefType: model.LedgerRefWithdrawal,
+				RefID:   w.ID,
+				RefNo:   w.PayoutTxHash,
+				Actor:   model.LedgerActorSystem,
+				Remark:  "提现自动打款，解冻",
+			},
+			LedgerEntry{
+				Type:    model.LedgerTypeDebit,
+				Amount:  amount,
+				RefType: model.LedgerRefWithdrawal,
+				RefID:   w.ID,
+				RefNo:   w.PayoutTxHash,
+				Actor:   model.LedgerActorSystem,
+				Remark:  "提现自动打款",
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&model.PayoutBatchItem{}).
+			Where("batch_id = ? AND withdrawal_id = ?", w.PayoutBatchID, w.ID).
+			Update("status", model.PayoutItemPaid).Error; err != nil {
+			return err
+		}
+
+		w.Status = model.WithdrawStatusPaid
+		w.ProcessedAt = &now
+		GetNotifyService().EmitWithdrawalEvent(tx, w)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Payout: withdrawal %d paid, tx %s", w.PayMethod, w.ID, w.PayoutTxHash)
+	go GetTelegramService().NotifyWithdrawPaid(w)
+	return nil
+}
+
+// revert 打款交易失败、已失效或未能签名: 只退回受影响的提现，重新进入待打款；
+// 打款交易失败次数达到上限或需人工核实(review)的提现标记为打款失败，资金保持冻结，由管理员核实后重新打款或拒绝
+func (s *PayoutService) revert(group []*model.Withdrawal, reason string, review bool) {
+	if runes := []rune(reason); len(runes) > 500 {
+		reason = string(runes[:500])
+	}
+	for _, w := range group {
+		status := model.WithdrawStatusApproved
+		if review || w.PayoutAttempts >= payoutMaxAttempts {
+			status = model.WithdrawStatusFailed
+		}
+
+		err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(w).Where("status = ?", model.WithdrawStatusPaying).Updates(map[string]interface{}{
+				"status":         status,
+				"payout_tx_hash": "",
+				"payout_raw_tx":  "",
+				"payout_nonce":   0,
+				"payout_sent_at": nil,
+				"payout_error":   reason,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("提现状态已变更")
+			}
+			return tx.Model(&model.PayoutBatchItem{}).
+				Where("batch_id = ? AND withdrawal_id = ?", w.PayoutBatchID, w.ID).
+				Updates(map[string]interface{}{"status": model.PayoutItemFailed, "error": reason}).Error
+		})
+		if err != nil {
+			continue
+		}
+
+		log.Printf("[%s] Payout: withdrawal %d reverted to status %d (attempts %d), tx %s: %s",
+			w.PayMethod, w.ID, status, w.PayoutAttempts, w.PayoutTxHash, reason)
+		w.Status = status
+		w.PayoutTxHash = ""
+		if status == model.WithdrawStatusFailed {
+			GetNotifyService().EmitWithdrawalEvent(nil, w)
+		}
+	}
+}
+
+// finishBatch 批次内所有提现都有结果后记录批次状态
+func (s *PayoutService) finishBatch(id uint) {
+	if id == 0 {
+		return
+	}
+	var counts []struct {
+		Status model.PayoutItemStatus
+		Count  int
+	}
+	if err := model.GetDB().Model(&model.PayoutBatchItem{}).Select("status, COUNT(*) AS count").
+		Where("batch_id = ?", id).Group("status").Scan(&counts).Error; err != nil {
+		return
+	}
+
+	var paid, failed int
+	for _, c := range counts {
+		switch c.Status {
+		case model.PayoutItemSending:
+			return
+		case model.PayoutItemPaid:
+			paid = c.Count
+		case model.PayoutItemFailed:
+			failed = c.Count
+		}
+	}
+
+	status := model.PayoutBatchPartial
+	switch {
+	case failed == 0:
+		status = model.PayoutBatchDone
+	case paid == 0:
+		status = model.PayoutBatchFailed
+	}
+	now := time.Now()
+	model.GetDB().Model(&model.PayoutBatch{}).Where("id = ? AND status = ?", id, model.PayoutBatchSending).
+		Updates(map[string]interface{}{
+			"status":      status,
+			"paid":        paid,
+			"failed":      failed,
+			"finished_at": &now,
+		})
+}
+
+// recordError 记录打款错误(不改变状态)，管理后台展示
+func (s *PayoutService) recordError(group []*model.Withdrawal, err error) {
+	msg := err.Error()
+	if runes := []rune(msg); len(runes) > 500 {
+		msg = string(runes[:500])
+	}
+	for _, w := range group {
+		model.GetDB().Model(w).Update("payout_error", msg)
+	}
+}
+
+// ListBatches 批量打款记录
+func (s *PayoutService) ListBatches(chain string, page, pageSize int) ([]model.PayoutBatch, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := model.GetDB().Model(&model.PayoutBatch{})
+	if chain != "" {
+		query = query.Where("chain = ?", chain)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var batches []model.PayoutBatch
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&batches).Error
+	return batches, total, err
+}
+
+// GetBatch 批量打款详情及明细
+func (s *PayoutService) GetBatch(id uint) (*model.PayoutBatch, []model.PayoutBatchItem, error) {
+	var batch model.PayoutBatch
+	if err := model.GetDB().First(&batch, id).Error; err != nil {
+		return nil, nil, errors.New("批次不存在")
+	}
+	var items []model.PayoutBatchItem
+	if err := model.GetDB().Where("batch_id = ?", id).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+	return &batch, items, nil
+}
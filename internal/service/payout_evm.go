@@ -0,0 +1,403 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+
+	"ezpay/internal/model"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// evmTransferGasMargin 预估 gas 的余量百分比
+const evmTransferGasMargin = 20
+
+// disperseTokenSelector disperseToken(address,address[],uint256[]) 函数选择器(Disperse 合约)
+var disperseTokenSelector = keccak256([]byte("disperseToken(address,address[],uint256[])"))[:4]
+
+// evmPayout EVM 链代币打款: ERC20 transfer(address,uint256)，EIP-155 legacy 交易
+// 配置了 disperse 合约时，一批多笔提现合并为一笔 disperseToken 调用(需先 approve 合约)；
+// 否则每笔提现一笔 transfer，使用连续 nonce
+type evmPayout struct {
+	wallet       *hotWallet
+	gasPriceBump int
+	disperse     string // disperse 合约地址，为空时逐笔转账
+
+	approveRaw   string // 在途的 approve 交易
+	approveNonce uint64
+}
+
+// evmTxParams 一批交易共用的参数
+type evmTxParams struct {
+	chainID  *big.Int
+	nonce    uint64
+	gasPrice *big.Int
+}
+
+func (e *evmPayout) Address() string {
+	return e.wallet.evmAddress()
+}
+
+// Prepare 使用 disperse 合约时确保合约有足够的代币授权额度
+// 额度不足时发送 approve(最大额度)交易，交易上链前本轮不打款
+func (e *evmPayout) Prepare(listener *ChainListener, token *model.Token, total *big.Int, count int) (bool, error) {
+	if e.disperse == "" || count < 2 {
+		return true, nil
+	}
+	rpcClient := GetBlockchainService().rpcClients[listener.chain]
+
+	if e.approveRaw != "" {
+		nonce, err := evmRPCUint(rpcClient, "eth_getTransactionCount", e.Address(), "latest")
+		if err != nil {
+			return false, err
+		}
+		if nonce.Uint64() <= e.approveNonce {
+			// approve 尚未上链，重新广播
+			return false, e.Broadcast(listener, e.approveRaw)
+		}
+		e.approveRaw = ""
+	}
+
+	allowance, err := evmCallUint(rpcClient, token.Contract, erc20AllowanceData(e.Address(), e.disperse))
+	if err != nil {
+		return false, fmt.Errorf("查询 disperse 合约授权额度失败: %w", err)
+	}
+	if allowance.Cmp(total) >= 0 {
+		return true, nil
+	}
+
+	params, err := e.txParams(rpcClient)
+	if err != nil {
+		return false, err
+	}
+	maxAmount := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	tx, _, err := e.buildTx(rpcClient, params, token.Contract, erc20ApproveData(e.disperse, maxAmount), nil)
+	if err != nil {
+		return false, fmt.Errorf("构建 approve 交易失败: %w", err)
+	}
+	e.approveRaw, e.approveNonce = tx.Raw, tx.Nonce
+	if err := e.Broadcast(listener, tx.Raw); err != nil {
+		return false, fmt.Errorf("广播 approve 交易失败: %w", err)
+	}
+	log.Printf("[%s] Payout: approve %s for disperse contract %s, tx %s", listener.chain, token.Symbol, e.disperse, tx.Hash)
+	return false, nil
+}
+
+func (e *evmPayout) Build(listener *ChainListener, token *model.Token, transfers []payoutTransfer) ([]*payoutTx, error) {
+	rpcClient := GetBlockchainService().rpcClients[listener.chain]
+	from := e.Address()
+
+	total := new(big.Int)
+	for _, t := range transfers {
+		total.Add(total, t.Amount)
+	}
+	balance, err := evmCallUint(rpcClient, token.Contract, erc20BalanceOfData(from))
+	if err != nil {
+		return nil, fmt.Errorf("查询热钱包余额失败: %w", err)
+	}
+	if balance.Cmp(total) < 0 {
+		return nil, fmt.Errorf("热钱包 %s 余额不足", token.Symbol)
+	}
+
+	params, err := e.txParams(rpcClient)
+	if err != nil {
+		return nil, err
+	}
+	native, err := evmRPCUint(rpcClient, "eth_getBalance", from, "latest")
+	if err != nil {
+		return nil, fmt.Errorf("查询热钱包余额失败: %w", err)
+	}
+
+	if e.disperse != "" && len(transfers) > 1 {
+		tx, _, err := e.buildTx(rpcClient, params, e.disperse, disperseTokenData(token.Contract, transfers), native)
+		if err != nil {
+			return nil, err
+		}
+		tx.Transfers = make([]int, len(transfers))
+		for i := range transfers {
+			tx.Transfers[i] = i
+		}
+		return []*payoutTx{tx}, nil
+	}
+
+	// 逐笔转账，nonce 连续递增；原生币只够支付部分交易时只发送前面的交易
+	var txs []*payoutTx
+	for i, t := range transfers {
+		tx, fee, err := e.buildTx(rpcClient, params, token.Contract, erc20TransferData(t.To, t.Amount), native)
+		if err != nil {
+			return txs, err
+		}
+		tx.Transfers = []int{i}
+		txs = append(txs, tx)
+		native.Sub(native, fee)
+		params.nonce++
+	}
+	return txs, nil
+}
+
+// txParams 获取 chainId、pending nonce 和 gas price
+func (e *evmPayout) txParams(rpcClient *RPCClient) (*evmTxParams, error) {
+	chainID, err := evmRPCUint(rpcClient, "eth_chainId")
+	if err != nil {
+		return nil, fmt.Errorf("获取 chainId 失败: %w", err)
+	}
+	nonce, err := evmRPCUint(rpcClient, "eth_getTransactionCount", e.Address(), "pending")
+	if err != nil {
+		return nil, fmt.Errorf("获取 nonce 失败: %w", err)
+	}
+	gasPrice, err := evmRPCUint(rpcClient, "eth_gasPrice")
+	if err != nil {
+		return nil, fmt.Errorf("获取 gas price 失败: %w", err)
+	}
+	gasPrice.Mul(gasPrice, big.NewInt(int64(100+e.gasPriceBump)))
+	gasPrice.Div(gasPrice, big.NewInt(100))
+	return &evmTxParams{chainID: chainID, nonce: nonce.Uint64(), gasPrice: gasPrice}, nil
+}
+
+// buildTx 预估 gas 并签名一笔合约调用，返回交易和最大手续费
+// native 不为空时检查原生币是否足以支付手续费
+func (e *evmPayout) buildTx(rpcClient *RPCClient, params *evmTxParams, to string, data []byte, native *big.Int) (*payoutTx, *big.Int, error) {
+	gas, err := evmRPCUint(rpcClient, "eth_estimateGas", map[string]string{
+		"from": e.Address(),
+		"to":   to,
+		"data": "0x" + hex.EncodeToString(data),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("预估 gas 失败: %w", err)
+	}
+	gas.Mul(gas, big.NewInt(100+evmTransferGasMargin))
+	gas.Div(gas, big.NewInt(100))
+
+	fee := new(big.Int).Mul(gas, params.gasPrice)
+	if native != nil && native.Cmp(fee) < 0 {
+		return nil, nil, errors.New("热钱包原生币不足以支付 gas")
+	}
+
+	nonce := new(big.Int).SetUint64(params.nonce)
+	contract, _ := hex.DecodeString(strings.TrimPrefix(strings.ToLower(to), "0x"))
+	tx := signEVMTx(e.wallet, params.chainID, [][]byte{
+		rlpUint(nonce), rlpUint(params.gasPrice), rlpUint(gas),
+		rlpBytes(contract), rlpUint(new(big.Int)), rlpBytes(data),
+	})
+	tx.Nonce = params.nonce
+	return tx, fee, nil
+}
+
+// signEVMTx 签名 legacy 交易，fields 为已编码的 nonce、gasPrice、gas、to、value、data
+// EIP-155: 签名哈希包含 chainId，v = recovery + chainId*2 + 35
+func signEVMTx(wallet *hotWallet, chainID *big.Int, fields [][]byte) *payoutTx {
+	unsigned := rlpList(append(fields, rlpUint(chainID), rlpUint(new(big.Int)), rlpUint(new(big.Int)))...)
+	r, s, recovery := wallet.sign(keccak256(unsigned))
+	v := new(big.Int).Mul(chainID, big.NewInt(2))
+	v.Add(v, big.NewInt(int64(recovery)+35))
+
+	signed := rlpList(append(fields, rlpUint(v), rlpUint(r), rlpUint(s))...)
+	return &payoutTx{
+		Hash: "0x" + hex.EncodeToString(keccak256(signed)),
+		Raw:  "0x" + hex.EncodeToString(signed),
+	}
+}
+
+func (e *evmPayout) Broadcast(listener *ChainListener, raw string) error {
+	_, err := evmRPC(GetBlockchainService().rpcClients[listener.chain], "eth_sendRawTransaction", raw)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "already known") {
+		return nil
+	}
+	return err
+}
+
+// Dropped 交易 nonce 已被其他已上链交易占用且节点查不到该交易时，该交易不会再上链；
+// nonce 已被占用但节点仍有该交易且未打包时无法判断，交由人工核实
+func (e *evmPayout) Dropped(listener *ChainListener, w *model.Withdrawal) (payoutDropState, error) {
+	rpcClient := GetBlockchainService().rpcClients[listener.chain]
+	nonce, err := evmRPCUint(rpcClient, "eth_getTransactionCount", e.Address(), "latest")
+	if err != nil {
+		return payoutPending, err
+	}
+	if nonce.Uint64() <= w.PayoutNonce {
+		return payoutPending, nil
+	}
+
+	raw, err := evmRPC(rpcClient, "eth_getTransactionByHash", w.PayoutTxHash)
+	if err != nil {
+		return payoutPending, err
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return payoutDropped, nil
+	}
+	var tx struct {
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(raw, &tx); err != nil {
+		return payoutPending, err
+	}
+	if tx.BlockNumber != nil {
+		// 已打包，收据稍后可查
+		return payoutPending, nil
+	}
+	return payoutUncertain, nil
+}
+
+// evmRPC 调用 EVM JSON-RPC 方法
+func evmRPC(rpcClient *RPCClient, method string, params ...interface{}) (json.RawMessage, error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := rpcClient.PostJSON("", map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("rpc error: %s", result.Error.Message)
+	}
+	return result.Result, nil
+}
+
+// evmRPCUint 调用返回十六进制数值的 JSON-RPC 方法
+func evmRPCUint(rpcClient *RPCClient, method string, params ...interface{}) (*big.Int, error) {
+	raw, err := evmRPC(rpcClient, method, params...)
+	if err != nil {
+		return nil, err
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(value, "0x"), 16)
+	if !ok {
+		if value == "0x" {
+			return new(big.Int), nil
+		}
+		return nil, fmt.Errorf("invalid %s result: %s", method, value)
+	}
+	return n, nil
+}
+
+// evmCallUint 只读调用合约，返回 uint256 结果
+func evmCallUint(rpcClient *RPCClient, contract string, data []byte) (*big.Int, error) {
+	return evmRPCUint(rpcClient, "eth_call", map[string]string{
+		"to":   contract,
+		"data": "0x" + hex.EncodeToString(data),
+	}, "latest")
+}
+
+// erc20TransferData transfer(address,uint256) 调用数据
+func erc20TransferData(to string, amount *big.Int) []byte {
+	data := make([]byte, 68)
+	copy(data, []byte{0xa9, 0x05, 0x9c, 0xbb})
+	addr, _ := hex.DecodeString(strings.TrimPrefix(strings.ToLower(to), "0x"))
+	copy(data[36-len(addr):36], addr)
+	amount.FillBytes(data[36:])
+	return data
+}
+
+// erc20ApproveData approve(address,uint256) 调用数据
+func erc20ApproveData(spender string, amount *big.Int) []byte {
+	data := erc20TransferData(spender, amount)
+	copy(data, []byte{0x09, 0x5e, 0xa7, 0xb3})
+	return data
+}
+
+// erc20AllowanceData allowance(address,address) 调用数据
+func erc20AllowanceData(owner, spender string) []byte {
+	data := make([]byte, 68)
+	copy(data, []byte{0xdd, 0x62, 0xed, 0x3e})
+	copy(data[16:36], evmAddressBytes(owner))
+	copy(data[48:68], evmAddressBytes(spender))
+	return data
+}
+
+// disperseTokenData disperseToken(address,address[],uint256[]) 调用数据
+func disperseTokenData(token string, transfers []payoutTransfer) []byte {
+	n := len(transfers)
+	data := make([]byte, 4+32*(5+2*n))
+	copy(data, disperseTokenSelector)
+	word := func(i int) []byte { return data[4+32*i : 4+32*(i+1)] }
+
+	copy(word(0)[12:], evmAddressBytes(token))
+	// 动态参数偏移量(相对参数起始位置)
+	big.NewInt(3 * 32).FillBytes(word(1))
+	big.NewInt(int64((4 + n) * 32)).FillBytes(word(2))
+
+	big.NewInt(int64(n)).FillBytes(word(3))
+	big.NewInt(int64(n)).FillBytes(word(4 + n))
+	for i, t := range transfers {
+		copy(word(4 + i)[12:], evmAddressBytes(t.To))
+		t.Amount.FillBytes(word(5 + n + i))
+	}
+	return data
+}
+
+// evmAddressBytes 0x 地址的 20 字节
+func evmAddressBytes(addr string) []byte {
+	b, _ := hex.DecodeString(strings.TrimPrefix(strings.ToLower(addr), "0x"))
+	if len(b) > 20 {
+		return b[len(b)-20:]
+	}
+	return b
+}
+
+// erc20BalanceOfData balanceOf(address) 调用数据
+func erc20BalanceOfData(owner string) []byte {
+	data := make([]byte, 36)
+	copy(data, []byte{0x70, 0xa0, 0x82, 0x31})
+	addr, _ := hex.DecodeString(strings.TrimPrefix(strings.ToLower(owner), "0x"))
+	copy(data[36-len(addr):], addr)
+	return data
+}
+
+func keccak256(data []byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(data)
+	return hash.Sum(nil)
+}
+
+// rlpBytes RLP 编码字节串
+func rlpBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpLength(len(b), 0x80), b...)
+}
+
+// rlpUint RLP 编码整数(大端、无前导零)
+func rlpUint(n *big.Int) []byte {
+	return rlpBytes(n.Bytes())
+}
+
+// rlpList RLP 编码列表，items 为已编码的元素
+func rlpList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpLength(len(payload), 0xc0), payload...)
+}
+
+func rlpLength(length int, offset byte) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	size := new(big.Int).SetInt64(int64(length)).Bytes()
+	return append([]byte{offset + 55 + byte(len(size))}, size...)
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"ezpay/internal/model"
+)
+
+// EIP-155 规范中的示例交易
+func TestSignEVMTxEIP155(t *testing.T) {
+	wallet := testWallet(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	to, _ := hex.DecodeString("3535353535353535353535353535353535353535")
+	value, _ := new(big.Int).SetString("1000000000000000000", 10)
+
+	tx := signEVMTx(wallet, big.NewInt(1), [][]byte{
+		rlpUint(big.NewInt(9)), rlpUint(big.NewInt(20_000_000_000)), rlpUint(big.NewInt(21000)),
+		rlpBytes(to), rlpUint(value), rlpBytes(nil),
+	})
+	want := "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025" +
+		"a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276" +
+		"a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83"
+	if tx.Raw != want {
+		t.Errorf("raw tx = %s\nwant     %s", tx.Raw, want)
+	}
+	raw, _ := hex.DecodeString(want[2:])
+	if tx.Hash != "0x"+hex.EncodeToString(keccak256(raw)) {
+		t.Errorf("tx hash = %s, want keccak256 of the raw tx", tx.Hash)
+	}
+}
+
+// evmPayoutNode EVM 桩节点: 记录广播的交易，mined 后返回回执，replaced 时 nonce 被其他交易占用
+type evmPayoutNode struct {
+	mu       sync.Mutex
+	sent     []string
+	mined    bool
+	replaced bool
+}
+
+func (n *evmPayoutNode) stub() jsonRPCStub {
+	return jsonRPCStub{
+		"eth_chainId":  func([]json.RawMessage) interface{} { return "0x1" },
+		"eth_gasPrice": func([]json.RawMessage) interface{} { return "0x4a817c800" }, // 20 gwei
+		"eth_getTransactionCount": func(params []json.RawMessage) interface{} {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if (n.mined || n.replaced) && string(params[1]) == `"latest"` {
+				return "0xa"
+			}
+			return "0x9"
+		},
+		"eth_estimateGas": func([]json.RawMessage) interface{} { return "0xc350" }, // 50000
+		"eth_getBalance":  func([]json.RawMessage) interface{} { return "0xde0b6b3a7640000" },
+		"eth_call": func([]json.RawMessage) interface{} {
+			return "0x00000000000000000000000000000000000000000000000000000000ffffffff"
+		},
+		"eth_sendRawTransaction": func(params []json.RawMessage) interface{} {
+			var raw string
+			json.Unmarshal(params[0], &raw)
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			n.sent = append(n.sent, raw)
+			return "0x"
+		},
+		"eth_blockNumber": func([]json.RawMessage) interface{} { return "0x66" },
+		"eth_getTransactionByHash": func([]json.RawMessage) interface{} {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if !n.mined {
+				return nil
+			}
+			return map[string]string{"blockNumber": "0x64"}
+		},
+		"eth_getTransactionReceipt": func([]json.RawMessage) interface{} {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if !n.mined {
+				return nil
+			}
+			return map[string]string{"blockNumber": "0x64", "blockHash": "0xb1", "status": "0x1"}
+		},
+	}
+}
+
+// startEVMPayout 登记 erc20 USDT 和一笔审核通过的提现，经桩节点发出打款
+func startEVMPayout(t *testing.T, node *evmPayoutNode) (*ChainListener, *evmPayout, model.Withdrawal) {
+	t.Helper()
+	db := model.GetDB()
+	db.Create(&model.Token{Chain: "erc20", Symbol: "USDT", Contract: "0xdac17f958d2ee523a2206206994597c13d831ec7", Decimals: 6, Enabled: true})
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: 100, FrozenBalance: 10}
+	db.Create(&merchant)
+	withdrawal := model.Withdrawal{MerchantID: merchant.ID, Amount: 10, RealAmount: 10, PayoutAmount: 10, PayoutCurrency: "USDT",
+		PayMethod: "erc20", Account: "0x3535353535353535353535353535353535353535", Status: model.WithdrawStatusApproved}
+	db.Create(&withdrawal)
+
+	listener := newTestChain(t, "erc20", node.stub())
+	withGlobalChain(t, listener)
+	sender := &evmPayout{wallet: testWallet(t, "4646464646464646464646464646464646464646464646464646464646464646"), gasPriceBump: 10}
+	withPayoutSender(t, "erc20", sender)
+	GetPayoutService().sendBatch(listener, sender)
+	return listener, sender, withdrawal
+}
+
+func TestEVMPayoutEndToEnd(t *testing.T) {
+	db := setupTestDB(t)
+	node := &evmPayoutNode{}
+	listener, sender, withdrawal := startEVMPayout(t, node)
+	wallet := sender.wallet
+	s := GetPayoutService()
+
+	// transfer(0x3535..., 10 USDT)，gas price 上浮 10%，gas 预估加 20% 余量，nonce 取 pending
+	data, _ := hex.DecodeString("a9059cbb" +
+		"0000000000000000000000003535353535353535353535353535353535353535" +
+		"0000000000000000000000000000000000000000000000000000000000989680")
+	contract, _ := hex.DecodeString("dac17f958d2ee523a2206206994597c13d831ec7")
+	want := signEVMTx(wallet, big.NewInt(1), [][]byte{
+		rlpUint(big.NewInt(9)), rlpUint(big.NewInt(22_000_000_000)), rlpUint(big.NewInt(60000)),
+		rlpBytes(contract), rlpUint(new(big.Int)), rlpBytes(data),
+	})
+	if len(node.sent) != 1 || node.sent[0] != want.Raw {
+		t.Fatalf("broadcast %v, want the signed transfer %s", node.sent, want.Raw)
+	}
+	sent := loadWithdrawal(t, db, withdrawal.ID)
+	if sent.Status != model.WithdrawStatusPaying || sent.PayoutTxHash != want.Hash || sent.PayoutNonce != 9 {
+		t.Fatalf("withdrawal status=%d tx=%s nonce=%d, want paying with %s nonce 9", sent.Status, sent.PayoutTxHash, sent.PayoutNonce, want.Hash)
+	}
+
+	// 未上链且 nonce 未被占用: 重新广播
+	if inFlight := s.track(listener, sender); inFlight != 1 {
+		t.Fatalf("track in flight = %d, want 1", inFlight)
+	}
+	if len(node.sent) != 2 || node.sent[1] != want.Raw {
+		t.Errorf("rebroadcast %d tx(s), want the same signed tx again", len(node.sent)-1)
+	}
+
+	node.mu.Lock()
+	node.mined = true
+	node.mu.Unlock()
+	if inFlight := s.track(listener, sender); inFlight != 0 {
+		t.Fatalf("track in flight = %d after the tx was mined", inFlight)
+	}
+	paid := loadWithdrawal(t, db, withdrawal.ID)
+	if paid.Status != model.WithdrawStatusPaid {
+		t.Errorf("withdrawal status = %d, want paid", paid.Status)
+	}
+	var merchant model.Merchant
+	db.First(&merchant, withdrawal.MerchantID)
+	if merchant.Balance != 90 || merchant.FrozenBalance != 0 {
+		t.Errorf("merchant balance=%.2f frozen=%.2f, want 90 and 0", merchant.Balance, merchant.FrozenBalance)
+	}
+}
+
+func TestEVMPayoutReplacedNonce(t *testing.T) {
+	db := setupTestDB(t)
+	node := &evmPayoutNode{}
+	listener, sender, withdrawal := startEVMPayout(t, node)
+	s := GetPayoutService()
+
+	// nonce 被其他交易占用且节点查不到打款交易: 同一节点连续多轮确认后才退回重新打款
+	node.mu.Lock()
+	node.replaced = true
+	node.mu.Unlock()
+	for round := 1; round < payoutDropRounds; round++ {
+		if inFlight := s.track(listener, sender); inFlight != 1 {
+			t.Fatalf("round %d: track in flight = %d, want 1", round, inFlight)
+		}
+	}
+	if got := loadWithdrawal(t, db, withdrawal.ID); got.Status != model.WithdrawStatusPaying {
+		t.Fatalf("withdrawal status = %d before the drop was confirmed, want paying", got.Status)
+	}
+	s.track(listener, sender)
+	if got := loadWithdrawal(t, db, withdrawal.ID); got.Status != model.WithdrawStatusApproved || got.PayoutTxHash != "" {
+		t.Errorf("withdrawal status=%d tx=%s, want approved for a new payout", got.Status, got.PayoutTxHash)
+	}
+}
+
+func TestDisperseTokenData(t *testing.T) {
+	const (
+		token = "0xdac17f958d2ee523a2206206994597c13d831ec7"
+		a     = "0x1111111111111111111111111111111111111111"
+		b     = "0x2222222222222222222222222222222222222222"
+		c     = "0x3333333333333333333333333333333333333333"
+	)
+	word := func(hexValue string) string {
+		return strings.Repeat("0", 64-len(hexValue)) + hexValue
+	}
+	tests := []struct {
+		name      string
+		transfers []payoutTransfer
+		want      []string // 选择器后的 32 字节参数
+	}{
+		{
+			name:      "one transfer",
+			transfers: []payoutTransfer{{To: a, Amount: big.NewInt(1_000_000)}},
+			want: []string{
+				word(token[2:]), word("60"), word("a0"),
+				word("1"), word(a[2:]),
+				word("1"), word("f4240"),
+			},
+		},
+		{
+			name: "three transfers",
+			transfers: []payoutTransfer{
+				{To: a, Amount: big.NewInt(1_000_000)},
+				{To: b, Amount: big.NewInt(2_500_000)},
+				{To: c, Amount: big.NewInt(1)},
+			},
+			want: []string{
+				word(token[2:]), word("60"), word("e0"),
+				word("3"), word(a[2:]), word(b[2:]), word(c[2:]),
+				word("3"), word("f4240"), word("2625a0"), word("1"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := hex.EncodeToString(disperseTokenData(token, tt.transfers))
+			// disperseToken(address,address[],uint256[]) 选择器
+			want := "c73a2d60" + strings.Join(tt.want, "")
+			if got != want {
+				t.Errorf("call data =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestEVMPayoutBuildDisperse(t *testing.T) {
+	setupTestDB(t)
+	node := &evmPayoutNode{}
+	listener := newTestChain(t, "erc20", node.stub())
+	withGlobalChain(t, listener)
+	const contract = "0x00000000000000000000000000000000000d1590"
+	sender := &evmPayout{wallet: testWallet(t, "4646464646464646464646464646464646464646464646464646464646464646"), disperse: contract}
+	token := &model.Token{Chain: "erc20", Symbol: "USDT", Contract: "0xdac17f958d2ee523a2206206994597c13d831ec7", Decimals: 6}
+	transfers := []payoutTransfer{
+		{To: "0x1111111111111111111111111111111111111111", Amount: big.NewInt(1_000_000)},
+		{To: "0x2222222222222222222222222222222222222222", Amount: big.NewInt(2_500_000)},
+		{To: "0x3333333333333333333333333333333333333333", Amount: big.NewInt(1)},
+	}
+
+	txs, err := sender.Build(listener, token, transfers)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	// 整批合并为一笔发往 disperse 合约的交易
+	if len(txs) != 1 || len(txs[0].Transfers) != 3 || txs[0].Nonce != 9 {
+		t.Fatalf("built %d tx(s), want one disperse tx for all 3 transfers", len(txs))
+	}
+	to, _ := hex.DecodeString(contract[2:])
+	want := signEVMTx(sender.wallet, big.NewInt(1), [][]byte{
+		rlpUint(big.NewInt(9)), rlpUint(big.NewInt(20_000_000_000)), rlpUint(big.NewInt(60000)),
+		rlpBytes(to), rlpUint(new(big.Int)), rlpBytes(disperseTokenData(token.Contract, transfers)),
+	})
+	if txs[0].Raw != want.Raw {
+		t.Errorf("raw tx = %s\nwant     %s", txs[0].Raw, want.Raw)
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	ErrKeystoreFormat   = errors.New("keystore 格式无效")
+	ErrKeystorePassword = errors.New("keystore 密码错误")
+)
+
+// keystoreV3 以太坊 V3 keystore (Web3 Secret Storage)
+type keystoreV3 struct {
+	Address string `json:"address"`
+	Version int    `json:"version"`
+	Crypto  struct {
+		Cipher       string `json:"cipher"`
+		CipherText   string `json:"ciphertext"`
+		CipherParams struct {
+			IV string `json:"iv"`
+		} `json:"cipherparams"`
+		KDF       string `json:"kdf"`
+		KDFParams struct {
+			DKLen int    `json:"dklen"`
+			Salt  string `json:"salt"`
+			N     int    `json:"n"` // scrypt
+			R     int    `json:"r"`
+			P     int    `json:"p"`
+			C     int    `json:"c"` // pbkdf2
+			PRF   string `json:"prf"`
+		} `json:"kdfparams"`
+		MAC string `json:"mac"`
+	} `json:"crypto"`
+}
+
+// hotWallet 热钱包私钥，EVM 与 TRON 使用同一个 secp256k1 密钥
+type hotWallet struct {
+	key *big.Int
+	pub ecPoint
+}
+
+// loadHotWallet 解密 keystore 文件
+func loadHotWallet(path, password string) (*hotWallet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ks keystoreV3
+	if err := json.Unmarshal(data, &ks); err != nil || ks.Version != 3 {
+		return nil, ErrKeystoreFormat
+	}
+	if ks.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("不支持的 keystore 加密算法: %s", ks.Crypto.Cipher)
+	}
+
+	salt, err := hex.DecodeString(ks.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, ErrKeystoreFormat
+	}
+	params := ks.Crypto.KDFParams
+	var derived []byte
+	switch ks.Crypto.KDF {
+	case "scrypt":
+		derived, err = scrypt.Key([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+		if err != nil {
+			return nil, ErrKeystoreFormat
+		}
+	case "pbkdf2":
+		if params.PRF != "hmac-sha256" {
+			return nil, fmt.Errorf("不支持的 keystore PRF: %s", params.PRF)
+		}
+		derived = pbkdf2.Key([]byte(password), salt, params.C, params.DKLen, sha256.New)
+	default:
+		return nil, fmt.Errorf("不支持的 keystore KDF: %s", ks.Crypto.KDF)
+	}
+	if len(derived) < 32 {
+		return nil, ErrKeystoreFormat
+	}
+
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, ErrKeystoreFormat
+	}
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, ErrKeystoreFormat
+	}
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, ErrKeystoreFormat
+	}
+
+	// MAC = Keccak256(derivedKey[16:32] || ciphertext)
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(derived[16:32])
+	hash.Write(cipherText)
+	if !hmac.Equal(hash.Sum(nil), mac) {
+		return nil, ErrKeystorePassword
+	}
+
+	block, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, len(cipherText))
+	cipher.NewCTR(block, iv).XORKeyStream(key, cipherText)
+
+	wallet, err := newHotWallet(key)
+	if err != nil {
+		return nil, err
+	}
+	if ks.Address != "" && !strings.EqualFold(strings.TrimPrefix(ks.Address, "0x"), strings.TrimPrefix(wallet.evmAddress(), "0x")) {
+		return nil, errors.New("keystore 地址与私钥不匹配")
+	}
+	return wallet, nil
+}
+
+// newHotWallet 由 32 字节私钥创建热钱包
+func newHotWallet(key []byte) (*hotWallet, error) {
+	d := new(big.Int).SetBytes(key)
+	if len(key) != 32 || d.Sign() == 0 || d.Cmp(secp256k1N) >= 0 {
+		return nil, errors.New("私钥无效")
+	}
+	return &hotWallet{key: d, pub: ecScalarBaseMult(d)}, nil
+}
+
+// evmAddress 热钱包 EVM 地址(小写 0x 格式)
+func (w *hotWallet) evmAddress() string {
+	return "0x" + hex.EncodeToString(pubKeyAddressHash(w.pub))
+}
+
+// tronAddress 热钱包 TRON 地址(Base58 T 开头)
+func (w *hotWallet) tronAddress() string {
+	return hexToBase58("41" + hex.EncodeToString(pubKeyAddressHash(w.pub)))
+}
+
+// sign 对 32 字节哈希签名，返回 r、s(low-S)和恢复标识(0/1)
+// k 按 RFC 6979 由私钥和哈希确定性生成，不依赖随机数源
+func (w *hotWallet) sign(hash []byte) (*big.Int, *big.Int, byte) {
+	z := new(big.Int).SetBytes(hash)
+	halfN := new(big.Int).Rsh(secp256k1N, 1)
+
+	nonces := newRFC6979(w.key, hash)
+	for {
+		k := nonces.next()
+		point := ecScalarBaseMult(k)
+		if point.x.Cmp(secp256k1N) >= 0 {
+			// r 溢出时无法用一位恢复标识表示，换下一个 k(概率约 2^-128)
+			continue
+		}
+		r := new(big.Int).Set(point.x)
+
+		// s = k⁻¹(z + r·d) mod n
+		s := new(big.Int).Mul(r, w.key)
+		s.Add(s, z)
+		s.Mul(s, new(big.Int).ModInverse(k, secp256k1N))
+		s.Mod(s, secp256k1N)
+		if r.Sign() == 0 || s.Sign() == 0 {
+			continue
+		}
+
+		recovery := byte(point.y.Bit(0))
+		if s.Cmp(halfN) > 0 {
+			s.Sub(secp256k1N, s)
+			recovery ^= 1
+		}
+		return r, s, recovery
+	}
+}
+
+// rfc6979 确定性 k 生成器(HMAC-SHA256)
+type rfc6979 struct {
+	k, v []byte
+}
+
+func newRFC6979(key *big.Int, hash []byte) *rfc6979 {
+	x := make([]byte, 32)
+	key.FillBytes(x)
+	h := new(big.Int).SetBytes(hash)
+	h.Mod(h, secp256k1N)
+	h1 := make([]byte, 32)
+	h.FillBytes(h1)
+
+	g := &rfc6979{k: make([]byte, 32), v: make([]byte, 32)}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+	g.k = g.mac(g.v, []byte{0x00}, x, h1)
+	g.v = g.mac(g.v)
+	g.k = g.mac(g.v, []byte{0x01}, x, h1)
+	g.v = g.mac(g.v)
+	return g
+}
+
+func (g *rfc6979) mac(parts ...[]byte) []byte {
+	m := hmac.New(sha256.New, g.k)
+	for _, part := range parts {
+		m.Write(part)
+	}
+	return m.Sum(nil)
+}
+
+// next 下一个候选 k (1 ≤ k < n)，调用方拒绝当前 k 时继续调用
+func (g *rfc6979) next() *big.Int {
+	for {
+		g.v = g.mac(g.v)
+		k := new(big.Int).SetBytes(g.v)
+		g.k = g.mac(g.v, []byte{0x00})
+		g.v = g.mac(g.v)
+		if k.Sign() > 0 && k.Cmp(secp256k1N) < 0 {
+			return k
+		}
+	}
+}
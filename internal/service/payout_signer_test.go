@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testWallet 由十六进制私钥创建热钱包
+func testWallet(t *testing.T, key string) *hotWallet {
+	t.Helper()
+	raw, err := hex.DecodeString(key)
+	if err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	wallet, err := newHotWallet(raw)
+	if err != nil {
+		t.Fatalf("newHotWallet: %v", err)
+	}
+	return wallet
+}
+
+// RFC 6979 secp256k1 测试向量(私钥 1，消息为 SHA-256 哈希，签名为 low-S)
+func TestSignRFC6979Vectors(t *testing.T) {
+	tests := []struct {
+		message string
+		k       string
+		r, s    string
+	}{
+		{
+			message: "Satoshi Nakamoto",
+			k:       "8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15",
+			r:       "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8",
+			s:       "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5",
+		},
+		{
+			message: "All those moments will be lost in time, like tears in rain. Time to die...",
+			k:       "38aa22d72376b4dbc472e06c3ba403ee0a394da63fc58d88686c611aba98d6b3",
+			r:       "8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b",
+			s:       "547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21",
+		},
+	}
+	wallet := testWallet(t, "0000000000000000000000000000000000000000000000000000000000000001")
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			hash := sha256.Sum256([]byte(tt.message))
+			if k := newRFC6979(wallet.key, hash[:]).next(); hex.EncodeToString(k.Bytes()) != tt.k {
+				t.Errorf("k = %x, want %s", k, tt.k)
+			}
+			r, s, _ := wallet.sign(hash[:])
+			if got := hex.EncodeToString(r.FillBytes(make([]byte, 32))); got != tt.r {
+				t.Errorf("r = %s, want %s", got, tt.r)
+			}
+			if got := hex.EncodeToString(s.FillBytes(make([]byte, 32))); got != tt.s {
+				t.Errorf("s = %s, want %s", got, tt.s)
+			}
+		})
+	}
+}
+
+// Web3 Secret Storage 规范中的 pbkdf2 测试向量
+const testKeystorePBKDF2 = `{
+	"crypto": {
+		"cipher": "aes-128-ctr",
+		"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+		"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+		"kdf": "pbkdf2",
+		"kdfparams": {
+			"c": 262144,
+			"dklen": 32,
+			"prf": "hmac-sha256",
+			"salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"
+		},
+		"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+	},
+	"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+	"version": 3
+}`
+
+func TestLoadHotWalletPBKDF2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := os.WriteFile(path, []byte(testKeystorePBKDF2), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := loadHotWallet(path, "testpassword")
+	if err != nil {
+		t.Fatalf("loadHotWallet: %v", err)
+	}
+	if got := hex.EncodeToString(wallet.key.FillBytes(make([]byte, 32))); got != "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d" {
+		t.Errorf("private key = %s", got)
+	}
+	if got := wallet.evmAddress(); got != "0x008aeeda4d805471df9b2a5b0f38a0c3bcba786b" {
+		t.Errorf("address = %s", got)
+	}
+
+	if _, err := loadHotWallet(path, "wrong"); !errors.Is(err, ErrKeystorePassword) {
+		t.Errorf("wrong password error = %v, want ErrKeystorePassword", err)
+	}
+
+	// keystore 记录的地址与私钥不符
+	mismatched := strings.Replace(testKeystorePBKDF2, `"version": 3`, `"address": "3535353535353535353535353535353535353535", "version": 3`, 1)
+	if err := os.WriteFile(path, []byte(mismatched), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHotWallet(path, "testpassword"); err == nil {
+		t.Error("keystore with mismatched address loaded")
+	}
+}
+
+// verifySignature 按 ECDSA 校验签名: (z·s⁻¹)·G + (r·s⁻¹)·Q 的 x 坐标等于 r
+func verifySignature(pub ecPoint, hash []byte, r, s *big.Int) bool {
+	w := new(big.Int).ModInverse(s, secp256k1N)
+	u1 := new(big.Int).Mul(new(big.Int).SetBytes(hash), w)
+	u1.Mod(u1, secp256k1N)
+	u2 := new(big.Int).Mul(r, w)
+	u2.Mod(u2, secp256k1N)
+
+	q := ecPoint{}
+	addend := pub
+	for i := 0; i < u2.BitLen(); i++ {
+		if u2.Bit(i) == 1 {
+			q = ecAdd(q, addend)
+		}
+		addend = ecDouble(addend)
+	}
+	point := ecAdd(ecScalarBaseMult(u1), q)
+	return !point.isInfinity() && new(big.Int).Mod(point.x, secp256k1N).Cmp(r) == 0
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"ezpay/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// seedPayout 登记 trc20 USDT 和一个冻结了提现金额的商户，返回 n 笔审核通过的提现
+func seedPayout(t *testing.T, db *gorm.DB, n int, attempts int) []model.Withdrawal {
+	t.Helper()
+	db.Create(&model.Token{Chain: "trc20", Symbol: "USDT", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6, Enabled: true})
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: 100, FrozenBalance: float64(10 * n)}
+	if err := db.Create(&merchant).Error; err != nil {
+		t.Fatalf("create merchant: %v", err)
+	}
+	withdrawals := make([]model.Withdrawal, n)
+	for i := range withdrawals {
+		withdrawals[i] = model.Withdrawal{MerchantID: merchant.ID, Amount: 10, RealAmount: 10, PayoutAmount: 10, PayoutCurrency: "USDT",
+			PayMethod: "trc20", Account: "TReceiver", Status: model.WithdrawStatusApproved, PayoutAttempts: attempts}
+		db.Create(&withdrawals[i])
+	}
+	return withdrawals
+}
+
+func withBatchSize(t *testing.T, size int) {
+	s := GetPayoutService()
+	prev := s.cfg.BatchSize
+	s.cfg.BatchSize = size
+	t.Cleanup(func() { s.cfg.BatchSize = prev })
+}
+
+func loadWithdrawal(t *testing.T, db *gorm.DB, id uint) model.Withdrawal {
+	t.Helper()
+	var w model.Withdrawal
+	if err := db.First(&w, id).Error; err != nil {
+		t.Fatalf("load withdrawal %d: %v", id, err)
+	}
+	return w
+}
+
+func TestPayoutClaimLease(t *testing.T) {
+	db := setupTestDB(t)
+	seeded := seedPayout(t, db, 2, 0)
+	token, _ := GetTokenService().GetToken("trc20", "USDT")
+	s := GetPayoutService()
+
+	batch := []*model.Withdrawal{&seeded[0], &seeded[1]}
+	transfers := []payoutTransfer{{To: "TReceiver", Amount: big.NewInt(10_000_000)}, {To: "TReceiver", Amount: big.NewInt(10_000_000)}}
+	record, err := s.claim("trc20", token, batch, transfers)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	for _, w := range seeded {
+		got := loadWithdrawal(t, db, w.ID)
+		if got.Status != model.WithdrawStatusPaying || got.PayoutBatchID != record.ID {
+			t.Errorf("withdrawal %d: status=%d batch=%d, want paying in batch %d", w.ID, got.Status, got.PayoutBatchID, record.ID)
+		}
+	}
+
+	// 已领取的提现不能再次领取，失败的领取不留下批次
+	if _, err := s.claim("trc20", token, batch, transfers); err == nil {
+		t.Fatal("second claim of leased withdrawals succeeded")
+	}
+	var batches, items int64
+	db.Model(&model.PayoutBatch{}).Count(&batches)
+	db.Model(&model.PayoutBatchItem{}).Count(&items)
+	if batches != 1 || items != 2 {
+		t.Errorf("after failed claim: %d batches, %d items, want 1 and 2", batches, items)
+	}
+}
+
+func TestPayoutClaimChangedWithdrawal(t *testing.T) {
+	db := setupTestDB(t)
+	seeded := seedPayout(t, db, 2, 0)
+	token, _ := GetTokenService().GetToken("trc20", "USDT")
+
+	// 领取前管理员拒绝了其中一笔，整批放弃
+	db.Model(&model.Withdrawal{}).Where("id = ?", seeded[1].ID).Update("status", model.WithdrawStatusRejected)
+	batch := []*model.Withdrawal{&seeded[0], &seeded[1]}
+	transfers := []payoutTransfer{{To: "TReceiver", Amount: big.NewInt(10_000_000)}, {To: "TReceiver", Amount: big.NewInt(10_000_000)}}
+	if _, err := GetPayoutService().claim("trc20", token, batch, transfers); err == nil {
+		t.Fatal("claim with a rejected withdrawal succeeded")
+	}
+	if got := loadWithdrawal(t, db, seeded[0].ID); got.Status != model.WithdrawStatusApproved || got.PayoutBatchID != 0 {
+		t.Errorf("withdrawal %d: status=%d batch=%d, want approved and unclaimed", got.ID, got.Status, got.PayoutBatchID)
+	}
+	var batches int64
+	db.Model(&model.PayoutBatch{}).Count(&batches)
+	if batches != 0 {
+		t.Errorf("%d batches left after abandoned claim", batches)
+	}
+}
+
+func TestPayoutSendFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		sender       *stubSender
+		wantStatus   model.WithdrawStatus
+		wantHash     bool
+		wantAttempts int
+		wantBatches  int64
+		wantError    string
+	}{
+		{
+			name:       "build failure releases the claim",
+			sender:     &stubSender{buildErr: errors.New("热钱包余额不足")},
+			wantStatus: model.WithdrawStatusApproved,
+			wantError:  "热钱包余额不足",
+		},
+		{
+			name:         "broadcast failure keeps the signed tx for rebroadcast",
+			sender:       &stubSender{broadcastErr: errors.New("connection refused")},
+			wantStatus:   model.WithdrawStatusPaying,
+			wantHash:     true,
+			wantAttempts: 1,
+			wantBatches:  1,
+			wantError:    "connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			seeded := seedPayout(t, db, 1, 0)
+			listener := withPayoutSender(t, "trc20", tt.sender)
+
+			GetPayoutService().sendBatch(listener, tt.sender)
+
+			got := loadWithdrawal(t, db, seeded[0].ID)
+			if got.Status != tt.wantStatus || (got.PayoutTxHash != "") != tt.wantHash ||
+				got.PayoutAttempts != tt.wantAttempts || got.PayoutError != tt.wantError {
+				t.Errorf("withdrawal: status=%d tx=%q attempts=%d error=%q", got.Status, got.PayoutTxHash, got.PayoutAttempts, got.PayoutError)
+			}
+			var batches int64
+			db.Model(&model.PayoutBatch{}).Count(&batches)
+			if batches != tt.wantBatches {
+				t.Errorf("%d batches, want %d", batches, tt.wantBatches)
+			}
+		})
+	}
+}
+
+func TestPayoutTrack(t *testing.T) {
+	tests := []struct {
+		name          string
+		attempts      int // 本次发送前已失败的次数
+		conf          *txConfirmation
+		drop          payoutDropState
+		rounds        int // 跟踪轮数，默认 1
+		wantStatus    model.WithdrawStatus
+		wantBatch     model.PayoutBatchStatus
+		wantBalance   float64
+		wantFrozen    float64
+		wantInFlight  int
+		wantItemState model.PayoutItemStatus
+	}{
+		{
+			name:          "confirmed tx completes the withdrawal",
+			conf:          &txConfirmation{found: true, confirmations: 1},
+			wantStatus:    model.WithdrawStatusPaid,
+			wantBatch:     model.PayoutBatchDone,
+			wantBalance:   90,
+			wantFrozen:    0,
+			wantItemState: model.PayoutItemPaid,
+		},
+		{
+			name:          "unconfirmed tx stays in flight",
+			conf:          &txConfirmation{found: true},
+			wantStatus:    model.WithdrawStatusPaying,
+			wantBatch:     model.PayoutBatchSending,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantInFlight:  1,
+			wantItemState: model.PayoutItemSending,
+		},
+		{
+			name:          "failed tx reverts to approved",
+			conf:          &txConfirmation{found: true, failed: true},
+			wantStatus:    model.WithdrawStatusApproved,
+			wantBatch:     model.PayoutBatchFailed,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantItemState: model.PayoutItemFailed,
+		},
+		{
+			name:          "dropped tx stays in flight until confirmed over several rounds",
+			conf:          &txConfirmation{},
+			drop:          payoutDropped,
+			rounds:        payoutDropRounds - 1,
+			wantStatus:    model.WithdrawStatusPaying,
+			wantBatch:     model.PayoutBatchSending,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantInFlight:  1,
+			wantItemState: model.PayoutItemSending,
+		},
+		{
+			name:          "dropped tx reverts to approved",
+			conf:          &txConfirmation{},
+			drop:          payoutDropped,
+			rounds:        payoutDropRounds,
+			wantStatus:    model.WithdrawStatusApproved,
+			wantBatch:     model.PayoutBatchFailed,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantItemState: model.PayoutItemFailed,
+		},
+		{
+			name:          "uncertain tx fails the withdrawal for manual review",
+			conf:          &txConfirmation{},
+			drop:          payoutUncertain,
+			wantStatus:    model.WithdrawStatusFailed,
+			wantBatch:     model.PayoutBatchFailed,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantItemState: model.PayoutItemFailed,
+		},
+		{
+			name:          "last attempt fails the withdrawal and keeps funds frozen",
+			attempts:      payoutMaxAttempts - 1,
+			conf:          &txConfirmation{found: true, failed: true},
+			wantStatus:    model.WithdrawStatusFailed,
+			wantBatch:     model.PayoutBatchFailed,
+			wantBalance:   100,
+			wantFrozen:    10,
+			wantItemState: model.PayoutItemFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			seeded := seedPayout(t, db, 1, tt.attempts)
+			sender := &stubSender{drop: tt.drop}
+			listener := withPayoutSender(t, "trc20", sender)
+			s := GetPayoutService()
+
+			s.sendBatch(listener, sender)
+			sent := loadWithdrawal(t, db, seeded[0].ID)
+			if sent.PayoutTxHash == "" {
+				t.Fatalf("withdrawal not sent: status=%d error=%q", sent.Status, sent.PayoutError)
+			}
+			listener.scanner.(*stubScanner).txs[sent.PayoutTxHash] = tt.conf
+
+			inFlight := 0
+			for i := 0; i < max(tt.rounds, 1); i++ {
+				inFlight = s.track(listener, sender)
+			}
+			if inFlight != tt.wantInFlight {
+				t.Errorf("track in flight = %d, want %d", inFlight, tt.wantInFlight)
+			}
+
+			got := loadWithdrawal(t, db, seeded[0].ID)
+			if got.Status != tt.wantStatus {
+				t.Errorf("withdrawal status = %d, want %d", got.Status, tt.wantStatus)
+			}
+			var batch model.PayoutBatch
+			db.First(&batch, sent.PayoutBatchID)
+			if batch.Status != tt.wantBatch {
+				t.Errorf("batch status = %v, want %v", batch.Status, tt.wantBatch)
+			}
+			var item model.PayoutBatchItem
+			db.Where("batch_id = ? AND withdrawal_id = ?", sent.PayoutBatchID, sent.ID).First(&item)
+			if item.Status != tt.wantItemState {
+				t.Errorf("batch item status = %v, want %v", item.Status, tt.wantItemState)
+			}
+			var merchant model.Merchant
+			db.First(&merchant, sent.MerchantID)
+			if merchant.Balance != tt.wantBalance || merchant.FrozenBalance != tt.wantFrozen {
+				t.Errorf("merchant balance=%.2f frozen=%.2f, want %.2f and %.2f",
+					merchant.Balance, merchant.FrozenBalance, tt.wantBalance, tt.wantFrozen)
+			}
+		})
+	}
+}
+
+func TestPayoutFinishPartialBatch(t *testing.T) {
+	db := setupTestDB(t)
+	withBatchSize(t, 2)
+	seeded := seedPayout(t, db, 2, 0)
+	sender := &stubSender{}
+	listener := withPayoutSender(t, "trc20", sender)
+	s := GetPayoutService()
+
+	s.sendBatch(listener, sender)
+	first := loadWithdrawal(t, db, seeded[0].ID)
+	second := loadWithdrawal(t, db, seeded[1].ID)
+	if first.PayoutBatchID == 0 || first.PayoutBatchID != second.PayoutBatchID {
+		t.Fatalf("withdrawals not sent in one batch: %d, %d", first.PayoutBatchID, second.PayoutBatchID)
+	}
+	scanner := listener.scanner.(*stubScanner)
+	scanner.txs[first.PayoutTxHash] = &txConfirmation{found: true, confirmations: 5}
+	scanner.txs[second.PayoutTxHash] = &txConfirmation{found: true, failed: true}
+
+	if inFlight := s.track(listener, sender); inFlight != 0 {
+		t.Errorf("track in flight = %d, want 0", inFlight)
+	}
+	var batch model.PayoutBatch
+	db.First(&batch, first.PayoutBatchID)
+	if batch.Status != model.PayoutBatchPartial || batch.Paid != 1 || batch.Failed != 1 || batch.FinishedAt == nil {
+		t.Errorf("batch: status=%v paid=%d failed=%d finished=%v, want partial 1/1",
+			batch.Status, batch.Paid, batch.Failed, batch.FinishedAt)
+	}
+}
+
+func TestPayoutFailedTxRevertScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		disperse   bool
+		wantStatus []model.WithdrawStatus
+		wantBatch  model.PayoutBatchStatus
+	}{
+		{
+			// disperse 交易包含整批提现，失败时全部退回
+			name:       "failed disperse tx reverts the whole batch",
+			disperse:   true,
+			wantStatus: []model.WithdrawStatus{model.WithdrawStatusApproved, model.WithdrawStatusApproved, model.WithdrawStatusApproved},
+			wantBatch:  model.PayoutBatchFailed,
+		},
+		{
+			// 逐笔交易只退回失败交易对应的提现
+			name:       "failed sequence tx reverts only its withdrawal",
+			wantStatus: []model.WithdrawStatus{model.WithdrawStatusPaid, model.WithdrawStatusApproved, model.WithdrawStatusPaid},
+			wantBatch:  model.PayoutBatchPartial,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			withBatchSize(t, 3)
+			seeded := seedPayout(t, db, 3, 0)
+			sender := &stubSender{disperse: tt.disperse}
+			listener := withPayoutSender(t, "trc20", sender)
+			s := GetPayoutService()
+
+			s.sendBatch(listener, sender)
+			// 第二笔提现所在的交易执行失败，其余交易已确认
+			scanner := listener.scanner.(*stubScanner)
+			for i, w := range seeded {
+				sent := loadWithdrawal(t, db, w.ID)
+				conf := &txConfirmation{found: true, confirmations: 5}
+				if i == 1 {
+					conf = &txConfirmation{found: true, failed: true}
+				}
+				if _, ok := scanner.txs[sent.PayoutTxHash]; !ok || i == 1 {
+					scanner.txs[sent.PayoutTxHash] = conf
+				}
+			}
+
+			batchID := loadWithdrawal(t, db, seeded[0].ID).PayoutBatchID
+			s.track(listener, sender)
+			for i, w := range seeded {
+				if got := loadWithdrawal(t, db, w.ID); got.Status != tt.wantStatus[i] {
+					t.Errorf("withdrawal %d status = %d, want %d", i, got.Status, tt.wantStatus[i])
+				}
+			}
+			var batch model.PayoutBatch
+			db.First(&batch, batchID)
+			if batch.Status != tt.wantBatch {
+				t.Errorf("batch status = %v, want %v", batch.Status, tt.wantBatch)
+			}
+		})
+	}
+}
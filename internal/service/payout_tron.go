@@ -0,0 +1,229 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"ezpay/internal/model"
+)
+
+const (
+	// tronPayoutExpiration 打款交易有效期，过期未上链的交易不会再被打包
+	tronPayoutExpiration = 10 * time.Minute
+	// tronPayoutDropGrace 判定交易过期前额外等待的时间(节点时钟误差)
+	tronPayoutDropGrace = 5 * time.Minute
+	// tronTriggerSmartContract 合约类型 TriggerSmartContract
+	tronTriggerSmartContract = 31
+)
+
+// tronPayout TRC20 代币打款
+// 交易在本地按 protobuf 构建并签名，不依赖节点代为构建，节点只提供参考区块和广播
+type tronPayout struct {
+	wallet   *hotWallet
+	feeLimit int64 // sun
+}
+
+func (t *tronPayout) Address() string {
+	return t.wallet.tronAddress()
+}
+
+// Prepare TRC20 转账直接由热钱包发起，无需准备
+func (t *tronPayout) Prepare(listener *ChainListener, token *model.Token, total *big.Int, count int) (bool, error) {
+	return true, nil
+}
+
+// Build 每笔提现一笔 TriggerSmartContract 交易，同一批交易使用同一个参考区块
+func (t *tronPayout) Build(listener *ChainListener, token *model.Token, transfers []payoutTransfer) ([]*payoutTx, error) {
+	rpcClient := GetBlockchainService().rpcClients[listener.chain]
+
+	owner, _ := hex.DecodeString("41" + hex.EncodeToString(pubKeyAddressHash(t.wallet.pub)))
+	contractHex, err := base58ToHex(token.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("代币合约地址无效: %w", err)
+	}
+	contract, _ := hex.DecodeString(contractHex)
+
+	total := new(big.Int)
+	for _, tr := range transfers {
+		total.Add(total, tr.Amount)
+	}
+	balance, err := t.balanceOf(listener, token.Contract)
+	if err != nil {
+		return nil, fmt.Errorf("查询热钱包余额失败: %w", err)
+	}
+	if balance.Cmp(total) < 0 {
+		return nil, fmt.Errorf("热钱包 %s 余额不足", token.Symbol)
+	}
+
+	body, err := rpcClient.PostJSON("/wallet/getnowblock", map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("获取最新区块失败: %w", err)
+	}
+	var block struct {
+		BlockID     string `json:"blockID"`
+		BlockHeader struct {
+			RawData struct {
+				Number    uint64 `json:"number"`
+				Timestamp int64  `json:"timestamp"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := json.Unmarshal(body, &block); err != nil {
+		return nil, err
+	}
+	blockID, err := hex.DecodeString(block.BlockID)
+	if err != nil || len(blockID) != 32 {
+		return nil, errors.New("获取最新区块失败: blockID 无效")
+	}
+
+	// 参考区块: 区块号的第 7-8 字节和区块哈希的第 9-16 字节
+	refBlock := make([]byte, 8)
+	binary.BigEndian.PutUint64(refBlock, block.BlockHeader.RawData.Number)
+	now := time.Now()
+	expiration := block.BlockHeader.RawData.Timestamp
+	if expiration <= 0 {
+		expiration = now.UnixMilli()
+	}
+	expiration += tronPayoutExpiration.Milliseconds()
+
+	var txs []*payoutTx
+	for i, tr := range transfers {
+		toHex, err := base58ToHex(tr.To)
+		if err != nil {
+			return txs, fmt.Errorf("收款地址无效: %w", err)
+		}
+		recipient, _ := hex.DecodeString(toHex)
+
+		// transfer(address,uint256): 地址参数取 20 字节账户哈希
+		data := make([]byte, 68)
+		copy(data, []byte{0xa9, 0x05, 0x9c, 0xbb})
+		copy(data[16:36], recipient[1:])
+		tr.Amount.FillBytes(data[36:])
+
+		trigger := pbBytes(nil, 1, owner)
+		trigger = pbBytes(trigger, 2, contract)
+		trigger = pbBytes(trigger, 4, data)
+
+		param := pbBytes(nil, 1, []byte("type.googleapis.com/protocol.TriggerSmartContract"))
+		param = pbBytes(param, 2, trigger)
+		contractMsg := pbVarint(nil, 1, tronTriggerSmartContract)
+		contractMsg = pbBytes(contractMsg, 2, param)
+
+		// timestamp 逐笔递增，保证同一批内转给同一地址同一金额的交易哈希不同
+		raw := pbBytes(nil, 1, refBlock[6:8])
+		raw = pbBytes(raw, 4, blockID[8:16])
+		raw = pbVarint(raw, 8, uint64(expiration))
+		raw = pbBytes(raw, 11, contractMsg)
+		raw = pbVarint(raw, 14, uint64(now.UnixMilli()+int64(i)))
+		raw = pbVarint(raw, 18, uint64(t.feeLimit))
+
+		txID := sha256.Sum256(raw)
+		r, s, recovery := t.wallet.sign(txID[:])
+		signature := make([]byte, 65)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:64])
+		signature[64] = recovery + 27
+
+		signed := pbBytes(nil, 1, raw)
+		signed = pbBytes(signed, 2, signature)
+		txs = append(txs, &payoutTx{
+			Hash:      hex.EncodeToString(txID[:]),
+			Raw:       hex.EncodeToString(signed),
+			Transfers: []int{i},
+		})
+	}
+	return txs, nil
+}
+
+func (t *tronPayout) Broadcast(listener *ChainListener, raw string) error {
+	body, err := GetBlockchainService().rpcClients[listener.chain].PostJSON("/wallet/broadcasthex", map[string]string{
+		"transaction": raw,
+	})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Result  bool   `json:"result"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if result.Result || result.Code == "DUP_TRANSACTION_ERROR" {
+		return nil
+	}
+	// message 通常为十六进制编码的文本
+	message := result.Message
+	if decoded, err := hex.DecodeString(message); err == nil {
+		message = string(decoded)
+	}
+	return fmt.Errorf("broadcast failed: %s %s", result.Code, message)
+}
+
+// Dropped 交易过期后仍未上链则不会再被打包
+func (t *tronPayout) Dropped(listener *ChainListener, w *model.Withdrawal) (payoutDropState, error) {
+	if w.PayoutSentAt == nil || time.Since(*w.PayoutSentAt) <= tronPayoutExpiration+tronPayoutDropGrace {
+		return payoutPending, nil
+	}
+	return payoutDropped, nil
+}
+
+// balanceOf 查询热钱包的 TRC20 余额
+func (t *tronPayout) balanceOf(listener *ChainListener, contract string) (*big.Int, error) {
+	body, err := GetBlockchainService().rpcClients[listener.chain].PostJSON("/wallet/triggerconstantcontract", map[string]interface{}{
+		"owner_address":     t.Address(),
+		"contract_address":  contract,
+		"function_selector": "balanceOf(address)",
+		"parameter":         fmt.Sprintf("%064s", hex.EncodeToString(pubKeyAddressHash(t.wallet.pub))),
+		"visible":           true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		ConstantResult []string `json:"constant_result"`
+		Result         struct {
+			Message string `json:"message"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	if len(result.ConstantResult) == 0 {
+		return nil, fmt.Errorf("balanceOf failed: %s", result.Result.Message)
+	}
+	balance, ok := new(big.Int).SetString(strings.TrimLeft(result.ConstantResult[0], "0"), 16)
+	if !ok {
+		return new(big.Int), nil
+	}
+	return balance, nil
+}
+
+// pbVarint 追加 protobuf varint 字段，零值按 proto3 规则省略
+func pbVarint(buf []byte, field int, value uint64) []byte {
+	if value == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(field<<3))
+	return binary.AppendUvarint(buf, value)
+}
+
+// pbBytes 追加 protobuf 字节串/嵌套消息字段
+func pbBytes(buf []byte, field int, value []byte) []byte {
+	if len(value) == 0 {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+)
+
+func TestProtobufEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{name: "varint", got: pbVarint(nil, 8, 300), want: "40ac02"},
+		{name: "zero varint omitted", got: pbVarint(nil, 8, 0), want: ""},
+		{name: "bytes", got: pbBytes(nil, 2, []byte("abc")), want: "1203616263"},
+		{name: "empty bytes omitted", got: pbBytes(nil, 2, nil), want: ""},
+		{name: "appended fields", got: pbBytes(pbVarint(nil, 1, 31), 18, []byte{0xff}), want: "081f920101ff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hex.EncodeToString(tt.got); got != tt.want {
+				t.Errorf("encoded = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// pbDecode 解析一层 protobuf 消息，返回各字段的字节串和 varint 值(同一字段取最后一个)
+func pbDecode(t *testing.T, buf []byte) (map[int][]byte, map[int]uint64) {
+	t.Helper()
+	fields, varints := make(map[int][]byte), make(map[int]uint64)
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		value, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		switch key & 7 {
+		case 0:
+			varints[int(key>>3)] = value
+		case 2:
+			fields[int(key>>3)] = buf[:value]
+			buf = buf[value:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields, varints
+}
+
+// tronPayoutNode TRON 桩节点: 记录广播的交易，mined 后返回交易信息
+type tronPayoutNode struct {
+	mu    sync.Mutex
+	sent  []string
+	mined string // 已上链的交易 ID
+}
+
+const tronTestBlockID = "0000000000a0b1c2d3e4f5061728394a5b6c7d8e9fa0b1c2d3e4f50617283940"
+
+func (n *tronPayoutNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var resp interface{}
+	switch r.URL.Path {
+	case "/wallet/triggerconstantcontract":
+		resp = map[string]interface{}{"constant_result": []string{strings.Repeat("0", 56) + "ffffffff"}}
+	case "/wallet/getnowblock":
+		resp = map[string]interface{}{
+			"blockID":      tronTestBlockID,
+			"block_header": map[string]interface{}{"raw_data": map[string]interface{}{"number": 0xa0b1c2, "timestamp": 1700000000000}},
+		}
+	case "/wallet/broadcasthex":
+		n.sent = append(n.sent, req["transaction"].(string))
+		resp = map[string]interface{}{"result": true}
+	case "/wallet/gettransactioninfobyid":
+		resp = map[string]interface{}{}
+		if id := req["value"].(string); id == n.mined {
+			resp = map[string]interface{}{"id": id, "blockNumber": 0xa0b1c0, "receipt": map[string]string{"result": "SUCCESS"}}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestTronPayoutEndToEnd(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&model.Token{Chain: "trc20", Symbol: "USDT", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6, Enabled: true})
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: 100, FrozenBalance: 10}
+	db.Create(&merchant)
+	recipient := hexToBase58("41" + strings.Repeat("35", 20))
+	withdrawal := model.Withdrawal{MerchantID: merchant.ID, Amount: 10, RealAmount: 10, PayoutAmount: 10, PayoutCurrency: "USDT",
+		PayMethod: "trc20", Account: recipient, Status: model.WithdrawStatusApproved}
+	db.Create(&withdrawal)
+
+	node := &tronPayoutNode{}
+	listener := newTestChain(t, "trc20", node)
+	withGlobalChain(t, listener)
+	wallet := testWallet(t, "4646464646464646464646464646464646464646464646464646464646464646")
+	sender := &tronPayout{wallet: wallet, feeLimit: 30_000_000}
+	withPayoutSender(t, "trc20", sender)
+	s := GetPayoutService()
+
+	s.sendBatch(listener, sender)
+	sent := loadWithdrawal(t, db, withdrawal.ID)
+	if len(node.sent) != 1 || sent.Status != model.WithdrawStatusPaying || node.sent[0] != sent.PayoutRawTx {
+		t.Fatalf("broadcast %d tx(s), withdrawal status=%d, want the saved tx broadcast once", len(node.sent), sent.Status)
+	}
+
+	// 已签名交易: raw_data(1) + signature(2)，交易 ID 为 raw_data 的 SHA-256，签名可由热钱包公钥验证
+	signed, _ := hex.DecodeString(node.sent[0])
+	tx, _ := pbDecode(t, signed)
+	txID := sha256.Sum256(tx[1])
+	if sent.PayoutTxHash != hex.EncodeToString(txID[:]) {
+		t.Errorf("tx hash = %s, want sha256 of raw_data %x", sent.PayoutTxHash, txID)
+	}
+	signature := tx[2]
+	if len(signature) != 65 || (signature[64] != 27 && signature[64] != 28) ||
+		!verifySignature(wallet.pub, txID[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:64])) {
+		t.Errorf("signature %x does not verify against the hot wallet", signature)
+	}
+
+	raw, rawVarints := pbDecode(t, tx[1])
+	blockID, _ := hex.DecodeString(tronTestBlockID)
+	if !bytes.Equal(raw[1], []byte{0xb1, 0xc2}) || !bytes.Equal(raw[4], blockID[8:16]) {
+		t.Errorf("ref block bytes=%x hash=%x, want b1c2 and %x", raw[1], raw[4], blockID[8:16])
+	}
+	if rawVarints[8] != uint64(1700000000000+tronPayoutExpiration.Milliseconds()) || rawVarints[18] != 30_000_000 {
+		t.Errorf("expiration=%d fee_limit=%d", rawVarints[8], rawVarints[18])
+	}
+	contract, contractVarints := pbDecode(t, raw[11])
+	param, _ := pbDecode(t, contract[2])
+	trigger, _ := pbDecode(t, param[2])
+	if contractVarints[1] != tronTriggerSmartContract || string(param[1]) != "type.googleapis.com/protocol.TriggerSmartContract" {
+		t.Errorf("contract type=%d url=%s", contractVarints[1], param[1])
+	}
+	if got := hexToBase58(hex.EncodeToString(trigger[1])); got != sender.Address() {
+		t.Errorf("owner = %s, want hot wallet %s", got, sender.Address())
+	}
+	if got := hexToBase58(hex.EncodeToString(trigger[2])); got != "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t" {
+		t.Errorf("contract = %s, want the USDT contract", got)
+	}
+	wantData := "a9059cbb" + "000000000000000000000000" + strings.Repeat("35", 20) +
+		"0000000000000000000000000000000000000000000000000000000000989680"
+	if got := hex.EncodeToString(trigger[4]); got != wantData {
+		t.Errorf("call data = %s\nwant        %s", got, wantData)
+	}
+
+	// 上链并达到确认数后完成提现
+	node.mu.Lock()
+	node.mined = sent.PayoutTxHash
+	node.mu.Unlock()
+	if inFlight := s.track(listener, sender); inFlight != 0 {
+		t.Fatalf("track in flight = %d after the tx was mined", inFlight)
+	}
+	if got := loadWithdrawal(t, db, withdrawal.ID); got.Status != model.WithdrawStatusPaid {
+		t.Errorf("withdrawal status = %d, want paid", got.Status)
+	}
+	db.First(&merchant, merchant.ID)
+	if merchant.Balance != 90 || merchant.FrozenBalance != 0 {
+		t.Errorf("merchant balance=%.2f frozen=%.2f, want 90 and 0", merchant.Balance, merchant.FrozenBalance)
+	}
+}
+
+func TestTronPayoutDropped(t *testing.T) {
+	sender := &tronPayout{}
+	recent := time.Now().Add(-tronPayoutExpiration)
+	expired := time.Now().Add(-tronPayoutExpiration - tronPayoutDropGrace - time.Minute)
+	for _, tt := range []struct {
+		sentAt *time.Time
+		want   payoutDropState
+	}{
+		{sentAt: nil, want: payoutPending},
+		{sentAt: &recent, want: payoutPending},
+		{sentAt: &expired, want: payoutDropped},
+	} {
+		if got, _ := sender.Dropped(nil, &model.Withdrawal{PayoutSentAt: tt.sentAt}); got != tt.want {
+			t.Errorf("Dropped(sent at %v) = %d, want %d", tt.sentAt, got, tt.want)
+		}
+	}
+}
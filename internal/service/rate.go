@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -573,10 +574,11 @@ func (s *RateService) getBaseRate(fromCurrency, toCurrency string) (decimal.Deci
 			return decimal.Zero, err
 		}
 
-		if fromCurrency == "TRX" && toCurrency == "USDT" {
+		// USD ≈ USDT (1:1)
+		if fromCurrency == "TRX" && (toCurrency == "USDT" || toCurrency == "USD") {
 			return trxRate, nil
 		}
-		if fromCurrency == "USDT" && toCurrency == "TRX" {
+		if (fromCurrency == "USDT" || fromCurrency == "USD") && toCurrency == "TRX" {
 			return decimal.NewFromInt(1).Div(trxRate), nil
 		}
 
@@ -672,14 +674,8 @@ func (s *RateService) ConvertFromSettlementCurrency(usdAmount decimal.Decimal, t
 		// USD -> USDT: amount * rate (通常 1:1，但可配置卖出浮动)
 		targetAmount = usdAmount.Mul(rate).Round(6)
 	} else if targetCurrency == "TRX" {
-		// USD -> TRX: 先获取 TRX/USD 价格
-		trxUsdRate, err := s.GetTRXUSDRate()
-		if err != nil {
-			return nil, fmt.Errorf("获取TRX价格失败: %w", err)
-		}
-		// 应用卖出浮动
-		trxUsdRate = trxUsdRate.Mul(decimal.NewFromInt(1).Add(rate.Sub(decimal.NewFromInt(1))))
-		targetAmount = usdAmount.Div(trxUsdRate).Round(6)
+		// USD -> TRX: rate 为 1 USD 兑换的 TRX 数量（已含卖出浮动）
+		targetAmount = usdAmount.Mul(rate).Round(6)
 	} else if targetCurrency == "CNY" {
 		// USD -> CNY: amount * rate
 		targetAmount = usdAmount.Mul(rate).Round(2)
@@ -855,7 +851,13 @@ func (s *RateService) GetUSDCNYRate() (decimal.Decimal, error) {
 
 // GetTRXUSDRate 获取 TRX/USD 价格（公开方法）
 func (s *RateService) GetTRXUSDRate() (decimal.Decimal, error) {
-	url := "https://api.binance.com/api/v3/ticker/price?symbol=TRXUSDT"
+	return s.GetCoinUSDRate("TRX")
+}
+
+// GetCoinUSDRate 获取原生币(TRX/ETH/BNB/POL/AVAX)的 USD 价格
+// 使用 Binance <SYMBOL>USDT 交易对，USDT ≈ USD
+func (s *RateService) GetCoinUSDRate(symbol string) (decimal.Decimal, error) {
+	url := "https://api.binance.com/api/v3/ticker/price?symbol=" + strings.ToUpper(symbol) + "USDT"
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Get(url)
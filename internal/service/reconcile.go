@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReconcileService 商户余额对账服务
+type ReconcileService struct {
+	mu      sync.Mutex
+	running bool
+}
+
+var (
+	reconcileService     *ReconcileService
+	reconcileServiceOnce sync.Once
+)
+
+// reconcileTolerance 对账容差（USD），低于该值的差异视为一致
+var reconcileTolerance = decimal.NewFromFloat(0.01)
+
+// GetReconcileService 获取对账服务实例
+func GetReconcileService() *ReconcileService {
+	reconcileServiceOnce.Do(func() {
+		reconcileService = &ReconcileService{}
+	})
+	return reconcileService
+}
+
+// ReconcileSummary 对账结果汇总
+type ReconcileSummary struct {
+	RunID      string    `json:"run_id"`
+	Checked    int       `json:"checked"`    // 核对商户数
+	Mismatched int       `json:"mismatched"` // 差异商户数
+	StartedAt  time.Time `json:"started_at"`
+	Duration   string    `json:"duration"`
+}
+
+// RunReconciliation 执行一次全量余额对账
+// 推算余额 = 已支付订单(结算金额-手续费) + 管理员调账净额 - 已打款提现 - 订单退款
+// 推算冻结 = 待审核/已审核提现 + 待支付/部分支付订单预冻结手续费(个人收款码)
+func (s *ReconcileService) RunReconciliation() (*ReconcileSummary, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, errors.New("对账任务正在执行中")
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	startedAt := time.Now()
+	summary := &ReconcileSummary{
+		RunID:     startedAt.Format("20060102150405"),
+		StartedAt: startedAt,
+	}
+
+	// 跳过系统商户(id=0)
+	var merchants []model.Merchant
+	if err := model.GetDB().Where("id > 0").Find(&merchants).Error; err != nil {
+		return nil, err
+	}
+
+	var mismatches []model.BalanceReconciliation
+	for _, merchant := range merchants {
+		record, err := s.reconcileMerchant(&merchant)
+		if err != nil {
+			log.Printf("[Reconcile] 商户 %d 对账失败: %v", merchant.ID, err)
+			continue
+		}
+		summary.Checked++
+
+		if record.BalanceDiff.Abs().LessThan(reconcileTolerance) && record.FrozenDiff.Abs().LessThan(reconcileTolerance) &&
+			record.LedgerBalance.Sub(record.ActualBalance).Abs().LessThan(reconcileTolerance) &&
+			record.LedgerFrozen.Sub(record.ActualFrozen).Abs().LessThan(reconcileTolerance) {
+			continue
+		}
+
+		record.RunID = summary.RunID
+		if err := model.GetDB().Create(record).Error; err != nil {
+			log.Printf("[Reconcile] 保存对账差异失败: %v", err)
+			continue
+		}
+		record.Merchant = merchant
+		mismatches = append(mismatches, *record)
+	}
+
+	summary.Mismatched = len(mismatches)
+	summary.Duration = time.Since(startedAt).Round(time.Millisecond).String()
+	log.Printf("[Reconcile] 对账完成: 批次 %s, 核对 %d 个商户, 差异 %d 个, 耗时 %s",
+		summary.RunID, summary.Checked, summary.Mismatched, summary.Duration)
+
+	if len(mismatches) > 0 {
+		s.alertMismatches(summary, mismatches)
+	}
+
+	return summary, nil
+}
+
+// reconcileMerchant 核对单个商户的余额
+func (s *ReconcileService) reconcileMerchant(merchant *model.Merchant) (*model.BalanceReconciliation, error) {
+	db := model.GetDB()
+	record := &model.BalanceReconciliation{
+		MerchantID:    merchant.ID,
+		ActualBalance: decimal.NewFromFloat(merchant.Balance).Round(2),
+		ActualFrozen:  decimal.NewFromFloat(merchant.FrozenBalance).Round(2),
+		Status:        model.ReconcileStatusOpen,
+	}
+
+	var sum struct {
+		Total decimal.Decimal
+	}
+
+	// 已支付订单入账（全额退款的订单同样入过账）
+	if err := db.Model(&model.Order{}).
+		Select("COALESCE(SUM(settlement_amount - fee), 0) AS total").
+		Where("merchant_id = ? AND status IN ?", merchant.ID, append([]model.OrderStatus{model.OrderStatusRefunded}, model.PaidOrderStatuses...)).
+		Scan(&sum).Error; err != nil {
+		return nil, err
+	}
+	record.PaidOrderAmount = sum.Total.Round(2)
+
+	// 管理员调账净额
+	var adjust struct {
+		Credit decimal.Decimal
+		Debit  decimal.Decimal
+	}
+	if err := db.Model(&model.BalanceLedger{}).
+		Select("COALESCE(SUM(CASE WHEN type = ? THEN amount ELSE 0 END), 0) AS credit, COALESCE(SUM(CASE WHEN type = ? THEN amount ELSE 0 END), 0) AS debit",
+			model.LedgerTypeCredit, model.LedgerTypeDebit).
+		Where("merchant_id = ? AND ref_type = ?", merchant.ID, model.LedgerRefAdmin).
+		Scan(&adjust).Error; err != nil {
+		return nil, err
+	}
+	record.AdjustAmount = adjust.Credit.Sub(adjust.Debit)
+
+	// 已打款提现
+	sum.Total = decimal.Zero
+	if err := db.Model(&model.Withdrawal{}).
+		Select("COALESCE(SUM(amount), 0) AS total").
+		Where("merchant_id = ? AND status = ?", merchant.ID, model.WithdrawStatusPaid).
+		Scan(&sum).Error; err != nil {
+		return nil, err
+	}
+	record.WithdrawnAmount = sum.Total.Round(2)
+
+	// 订单退款
+	sum.Total = decimal.Zero
+	if err := db.Model(&model.Refund{}).
+		Select("COALESCE(SUM(amount), 0) AS total").
+		Where("merchant_id = ?", merchant.ID).
+		Scan(&sum).Error; err != nil {
+		return nil, err
+	}
+	record.RefundAmount = sum.Total.Round(2)
+
+	// 处理中的提现（冻结）
+	sum.Total = decimal.Zero
+	if err := db.Model(&model.Withdrawal{}).
+		Select("COALESCE(SUM(amount), 0) AS total").
+		Where("merchant_id = ? AND status IN ?", merchant.ID, model.FrozenWithdrawStatuses).
+		Scan(&sum).Error; err != nil {
+		return nil, err
+	}
+	record.PendingWithdrawAmount = sum.Total.Round(2)
+
+	// 待支付订单预冻结的手续费: 待支付/部分支付的订单，以及检测前处于这两种状态、正在等待确认的订单
+	// (过期后检测到付款的订单预冻结已退还)
+	feeFrozenStatuses := []model.OrderStatus{model.OrderStatusPending, model.OrderStatusPartial}
+	confirming := db.Model(&model.PendingTransfer{}).Select("order_id").
+		Where("status = ? AND prev_status IN ?", model.PendingTransferTracking, feeFrozenStatuses)
+	sum.Total = decimal.Zero
+	if err := db.Model(&model.Order{}).
+		Select("COALESCE(SUM(ROUND(fee, 2)), 0) AS total").
+		Where("merchant_id = ? AND fee_type = ?", merchant.ID, model.FeeTypeBalance).
+		Where("status IN ? OR (status IN ? AND id IN (?))", feeFrozenStatuses, model.ConfirmingOrderStatuses, confirming).
+		Scan(&sum).Error; err != nil {
+		return nil, err
+	}
+	record.PendingFeeAmount = sum.Total.Round(2)
+
+	record.ExpectedBalance = record.PaidOrderAmount.Add(record.AdjustAmount).Sub(record.WithdrawnAmount).Sub(record.RefundAmount)
+	record.ExpectedFrozen = record.PendingWithdrawAmount.Add(record.PendingFeeAmount)
+	record.BalanceDiff = record.ActualBalance.Sub(record.ExpectedBalance)
+	record.FrozenDiff = record.ActualFrozen.Sub(record.ExpectedFrozen)
+
+	// 账本最后一条流水应与商户当前余额一致
+	var last model.BalanceLedger
+	if err := db.Where("merchant_id = ?", merchant.ID).Order("id DESC").First(&last).Error; err == nil {
+		record.LedgerBalance = last.BalanceAfter
+		record.LedgerFrozen = last.FrozenAfter
+	} else {
+		record.LedgerBalance = record.ActualBalance
+		record.LedgerFrozen = record.ActualFrozen
+	}
+
+	return record, nil
+}
+
+// alertMismatches 按商户推送对账差异(TelegramService 系统警告)，每个商户只收到自己的差异
+func (s *ReconcileService) alertMismatches(summary *ReconcileSummary, mismatches []model.BalanceReconciliation) {
+	telegram := GetTelegramService()
+	for _, m := range mismatches {
+		content := fmt.Sprintf(`批次: %s
+账户余额: %s (应为 %s, 差 %s)
+冻结余额: %s (应为 %s, 差 %s)
+
+平台正在核查，如有疑问请联系客服`,
+			summary.RunID,
+			m.ActualBalance.StringFixed(2), m.ExpectedBalance.StringFixed(2), m.BalanceDiff.StringFixed(2),
+			m.ActualFrozen.StringFixed(2), m.ExpectedFrozen.StringFixed(2), m.FrozenDiff.StringFixed(2))
+		go telegram.NotifySystemAlert(m.MerchantID, "⚠️ *余额对账发现差异*", content)
+	}
+}
+
+// ListReconciliations 分页查询对账差异
+func (s *ReconcileService) ListReconciliations(merchantID uint, status *model.ReconcileStatus, runID string, page, pageSize int) ([]model.BalanceReconciliation, int64, error) {
+	query := model.GetDB().Model(&model.BalanceReconciliation{})
+
+	if merchantID > 0 {
+		query = query.Where("merchant_id = ?", merchantID)
+	}
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+	if runID != "" {
+		query = query.Where("run_id = ?", runID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var records []model.BalanceReconciliation
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Merchant").Order("id DESC").Offset(offset).Limit(pageSize).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return records, total, nil
+}
+
+// ResolveReconciliation 标记对账差异已处理
+func (s *ReconcileService) ResolveReconciliation(id uint, operator string, remark string) error {
+	now := time.Now()
+	result := model.GetDB().Model(&model.BalanceReconciliation{}).
+		Where("id = ? AND status = ?", id, model.ReconcileStatusOpen).
+		Updates(map[string]interface{}{
+			"status":      model.ReconcileStatusResolved,
+			"resolved_by": operator,
+			"resolved_at": &now,
+			"remark":      remark,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("记录不存在或已处理")
+	}
+	return nil
+}
+
+// getReconcileHour 获取每日对账时间(小时)
+func (s *ReconcileService) getReconcileHour() int {
+	var config model.SystemConfig
+	if err := model.GetDB().Where("`key` = ?", model.ConfigKeyReconcileHour).First(&config).Error; err != nil {
+		return 3
+	}
+	hour, err := strconv.Atoi(config.Value)
+	if err != nil || hour < 0 || hour > 23 {
+		return 3
+	}
+	return hour
+}
+
+// StartReconcileWorker 启动每日对账工作协程
+func (s *ReconcileService) StartReconcileWorker() {
+	go func() {
+		for {
+			now := time.Now()
+			// 计算下一次对账时间
+			next := time.Date(now.Year(), now.Month(), now.Day(), s.getReconcileHour(), 0, 0, 0, now.Location())
+			if !next.After(now) {
+				next = next.Add(24 * time.Hour)
+			}
+			time.Sleep(time.Until(next))
+			if _, err := s.RunReconciliation(); err != nil {
+				log.Printf("[Reconcile] 对账任务执行失败: %v", err)
+			}
+		}
+	}()
+	log.Println("Reconcile worker started")
+}
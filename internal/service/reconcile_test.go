@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReconcilePendingFee(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+
+	orders := []struct {
+		status     model.OrderStatus
+		prevStatus *model.OrderStatus // 等待确认的订单检测前的状态
+		frozen     bool
+	}{
+		{status: model.OrderStatusPending, frozen: true},
+		{status: model.OrderStatusPartial, frozen: true},
+		{status: model.OrderStatusDetected, prevStatus: ptr(model.OrderStatusPending), frozen: true},
+		{status: model.OrderStatusConfirming, prevStatus: ptr(model.OrderStatusPartial), frozen: true},
+		{status: model.OrderStatusConfirming, prevStatus: ptr(model.OrderStatusExpired)},
+		{status: model.OrderStatusExpired},
+		{status: model.OrderStatusPaid},
+	}
+	want := decimal.Zero
+	for i, o := range orders {
+		order := model.Order{TradeNo: fmt.Sprintf("T%d", i), OutTradeNo: fmt.Sprintf("O%d", i), MerchantID: merchant.ID, Type: "usdt_trc20",
+			Money: decimal.NewFromInt(100), Fee: decimal.NewFromInt(int64(i + 1)), FeeType: model.FeeTypeBalance, Status: o.status}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+		if o.prevStatus != nil {
+			db.Create(&model.PendingTransfer{Chain: "trc20", TxHash: fmt.Sprintf("0x%d", i), OrderID: order.ID, PrevStatus: *o.prevStatus})
+		}
+		if o.frozen {
+			want = want.Add(order.Fee)
+		}
+	}
+
+	record, err := GetReconcileService().reconcileMerchant(&merchant)
+	if err != nil {
+		t.Fatalf("reconcileMerchant: %v", err)
+	}
+	if !record.PendingFeeAmount.Equal(want) {
+		t.Errorf("PendingFeeAmount = %s, want %s", record.PendingFeeAmount, want)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
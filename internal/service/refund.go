@@ -0,0 +1,267 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RefundService 订单退款服务
+type RefundService struct{}
+
+// errOutRefundNoUsed 商户退款单号已用于其他订单
+var errOutRefundNoUsed = errors.New("退款单号已被其他订单使用")
+
+var (
+	refundService     *RefundService
+	refundServiceOnce sync.Once
+)
+
+// GetRefundService 获取退款服务实例
+func GetRefundService() *RefundService {
+	refundServiceOnce.Do(func() {
+		refundService = &RefundService{}
+	})
+	return refundService
+}
+
+// CreateRefundRequest 退款请求
+type CreateRefundRequest struct {
+	MerchantID  uint
+	TradeNo     string          // 平台订单号(与 OutTradeNo 二选一)
+	OutTradeNo  string          // 商户订单号
+	OutRefundNo string          // 商户退款单号，相同单号重复提交返回原退款记录
+	Amount      decimal.Decimal // 退款金额（USD），为 0 时退还剩余全部金额
+	Reason      string
+	Payout      bool   // 是否原路打款到付款地址
+	Actor       string // 发起人
+}
+
+// CreateRefund 为已支付订单创建退款
+// 订单退款金额累计、商户余额扣除在同一事务中完成，提交后发送 REFUND_SUCCESS 回调
+func (s *RefundService) CreateRefund(req *CreateRefundRequest) (*model.Refund, error) {
+	if req.Amount.IsNegative() {
+		return nil, errors.New("退款金额无效")
+	}
+
+	var refund *model.Refund
+	var merchant *model.Merchant
+	existed := false
+
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 先锁定订单行，防止并发退款超额，同一订单的重复提交在锁后串行判断幂等
+		var order model.Order
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("merchant_id = ?", req.MerchantID)
+		if req.TradeNo != "" {
+			query = query.Where("trade_no = ?", req.TradeNo)
+		} else if req.OutTradeNo != "" {
+			query = query.Where("out_trade_no = ?", req.OutTradeNo)
+		} else {
+			return errors.New("请提供订单号")
+		}
+		if err := query.First(&order).Error; err != nil {
+			return errors.New("订单不存在")
+		}
+
+		// 幂等：相同商户退款单号直接返回原记录
+		if req.OutRefundNo != "" {
+			var exist model.Refund
+			if err := tx.Where("merchant_id = ? AND out_refund_no = ?", req.MerchantID, req.OutRefundNo).First(&exist).Error; err == nil {
+				if exist.OrderID != order.ID {
+					return errOutRefundNoUsed
+				}
+				refund = &exist
+				existed = true
+				return nil
+			}
+		}
+
+		if !order.Status.IsPaid() {
+			if order.Status == model.OrderStatusRefunded {
+				return errors.New("订单已全额退款")
+			}
+			return errors.New("订单未支付，无法退款")
+		}
+
+		refundable := order.SettlementAmount.Round(2).Sub(order.RefundedAmount)
+		amount := req.Amount.Round(2)
+		if amount.IsZero() {
+			amount = refundable
+		}
+		if !amount.IsPositive() {
+			return errors.New("退款金额无效")
+		}
+		if amount.GreaterThan(refundable) {
+			return fmt.Errorf("退款金额超过可退金额 %s USD", refundable.StringFixed(2))
+		}
+
+		refund = &model.Refund{
+			RefundNo:    util.GenerateTradeNo(),
+			OutRefundNo: req.OutRefundNo,
+			MerchantID:  order.MerchantID,
+			OrderID:     order.ID,
+			TradeNo:     order.TradeNo,
+			OutTradeNo:  order.OutTradeNo,
+			Amount:      amount,
+			Reason:      req.Reason,
+			Actor:       req.Actor,
+		}
+
+		// 原路打款：按退款金额占结算金额的比例折算实际收到的币数量
+		if req.Payout {
+			if util.IsFiatChain(order.Chain) || order.FromAddress == "" {
+				return errors.New("该订单没有链上付款地址，无法原路退回")
+			}
+			paid := order.ActualAmount
+			if !paid.IsPositive() {
+				paid = orderRequiredAmount(&order)
+			}
+			refund.PayoutStatus = model.RefundPayoutPending
+			refund.PayoutChain = order.Chain
+			refund.PayoutAddress = order.FromAddress
+			refund.PayoutCurrency = order.PayCurrency
+			refund.PayoutAmount = paid.Mul(amount).Div(order.SettlementAmount).Round(6)
+		}
+
+		// 未提供商户退款单号时使用平台退款单号，(merchant_id, out_refund_no) 唯一
+		if refund.OutRefundNo == "" {
+			refund.OutRefundNo = refund.RefundNo
+		}
+		if err := tx.Create(refund).Error; err != nil {
+			// 同一退款单号被并发用于其他订单
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return errOutRefundNoUsed
+			}
+			return err
+		}
+
+		// 扣除商户余额（写入账本）
+		var err error
+		merchant, err = GetLedgerService().Apply(tx, order.MerchantID, LedgerEntry{
+			Type:    model.LedgerTypeDebit,
+			Amount:  amount,
+			RefType: model.LedgerRefRefund,
+			RefID:   refund.ID,
+			RefNo:   order.TradeNo,
+			Actor:   req.Actor,
+			Remark:  "订单退款 " + refund.RefundNo,
+		})
+		if err != nil {
+			if errors.Is(err, ErrInsufficientBalance) {
+				return errors.New("商户余额不足，无法退款")
+			}
+			return err
+		}
+
+		// 更新订单累计退款金额，全额退款后标记为已退款
+		refunded := order.RefundedAmount.Add(amount)
+		updates := map[string]interface{}{
+			"refunded_amount": refunded,
+		}
+		if amount.Equal(refundable) {
+			updates["status"] = model.OrderStatusRefunded
+		}
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Webhook 事件 - 订单退款
+		order.RefundedAmount = refunded
+		if amount.Equal(refundable) {
+			order.Status = model.OrderStatusRefunded
+		}
+		GetNotifyService().EmitOrderEvent(tx, &order, model.WebhookEventOrderRefunded, WebhookOrderData{
+			Refund: &JSONCallbackRefund{
+				RefundNo:    refund.RefundNo,
+				OutRefundNo: refund.OutRefundNo,
+				Amount:      refund.Amount,
+				CreatedAt:   refund.CreatedAt,
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if existed {
+		return refund, nil
+	}
+
+	GetOrderService().InvalidateOrderCache(refund.TradeNo)
+
+	log.Printf("Refund %s created for order %s, amount: %s USD, by: %s", refund.RefundNo, refund.TradeNo, refund.Amount.StringFixed(2), refund.Actor)
+
+	// 余额变动通知
+	go GetTelegramService().NotifyBalanceChanged(
+		refund.MerchantID,
+		"订单退款",
+		refund.Amount.Neg(),
+		decimal.NewFromFloat(merchant.Balance),
+		fmt.Sprintf("订单 %s 退款 USD %s", refund.TradeNo, refund.Amount.StringFixed(2)),
+	)
+
+	// 退款回调
+	go GetNotifyService().NotifyRefund(refund.ID)
+
+	return refund, nil
+}
+
+// ListRefunds 分页查询退款记录
+func (s *RefundService) ListRefunds(merchantID uint, tradeNo string, payoutStatus *model.RefundPayoutStatus, page, pageSize int) ([]model.Refund, int64, error) {
+	query := model.GetDB().Model(&model.Refund{})
+
+	if merchantID > 0 {
+		query = query.Where("merchant_id = ?", merchantID)
+	}
+	if tradeNo != "" {
+		query = query.Where("trade_no = ?", tradeNo)
+	}
+	if payoutStatus != nil {
+		query = query.Where("payout_status = ?", *payoutStatus)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var refunds []model.Refund
+	offset := (page - 1) * pageSize
+	if err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&refunds).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return refunds, total, nil
+}
+
+// CompleteRefundPayout 管理员确认退款已原路打款
+func (s *RefundService) CompleteRefundPayout(id uint, txHash string, operator string) error {
+	if txHash == "" {
+		return errors.New("请填写打款交易哈希")
+	}
+
+	now := time.Now()
+	result := model.GetDB().Model(&model.Refund{}).
+		Where("id = ? AND payout_status = ?", id, model.RefundPayoutPending).
+		Updates(map[string]interface{}{
+			"payout_status":  model.RefundPayoutPaid,
+			"payout_tx_hash": txHash,
+			"paid_out_at":    &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("退款记录不存在或无需打款")
+	}
+
+	log.Printf("管理员[%s]确认退款 %d 已打款, tx: %s", operator, id, txHash)
+	return nil
+}
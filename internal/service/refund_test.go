@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+func TestCreateRefundOutRefundNo(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, Balance: 200}
+	db.Create(&merchant)
+	now := time.Now()
+	for _, no := range []string{"T1", "T2"} {
+		db.Create(&model.Order{TradeNo: no, OutTradeNo: "O" + no, MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+			Money: decimal.NewFromInt(100), SettlementAmount: decimal.NewFromInt(100), Status: model.OrderStatusPaid, PaidAt: &now})
+	}
+
+	s := GetRefundService()
+	first, err := s.CreateRefund(&CreateRefundRequest{MerchantID: merchant.ID, TradeNo: "T1", OutRefundNo: "R1", Amount: decimal.NewFromInt(10)})
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	// 重复提交返回原退款，不重复扣款
+	again, err := s.CreateRefund(&CreateRefundRequest{MerchantID: merchant.ID, TradeNo: "T1", OutRefundNo: "R1", Amount: decimal.NewFromInt(10)})
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("replayed refund = %+v (%v), want refund %d", again, err, first.ID)
+	}
+	if _, err := s.CreateRefund(&CreateRefundRequest{MerchantID: merchant.ID, TradeNo: "T2", OutRefundNo: "R1", Amount: decimal.NewFromInt(10)}); err == nil {
+		t.Error("refund number reused for another order")
+	}
+	// 并发请求绕过查询时由唯一索引拦截
+	err = db.Create(&model.Refund{RefundNo: "P1", OutRefundNo: "R1", MerchantID: merchant.ID, Amount: decimal.NewFromInt(1)}).Error
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("duplicate out_refund_no insert error = %v, want ErrDuplicatedKey", err)
+	}
+
+	// 未提供商户退款单号的退款互不冲突
+	for i := 0; i < 2; i++ {
+		if _, err := s.CreateRefund(&CreateRefundRequest{MerchantID: merchant.ID, TradeNo: "T2", Amount: decimal.NewFromInt(10)}); err != nil {
+			t.Fatalf("refund without out_refund_no: %v", err)
+		}
+	}
+
+	db.First(&merchant, merchant.ID)
+	if merchant.Balance != 170 {
+		t.Errorf("merchant balance = %.2f, want 170", merchant.Balance)
+	}
+}
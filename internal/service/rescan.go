@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+)
+
+const (
+	// rescanMaxBlocks 单个补扫任务最大区块数(Solana 为 slot 数)
+	rescanMaxBlocks = 200000
+	// rescanMaxSeconds 单个补扫任务最大时间跨度(秒)
+	rescanMaxSeconds = 7 * 24 * 3600
+	// rescanMaxRunning 同时执行的补扫任务数
+	rescanMaxRunning = 2
+)
+
+// RescanService 区块补扫服务
+// 任务在后台按段扫描，每段完成后记录进度；同一条链同时只允许一个任务，补扫与监听共用 RPC 限流
+type RescanService struct {
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // 任务 ID -> 取消函数
+	chains  map[string]uint             // 链 -> 执行中的任务 ID
+}
+
+var (
+	rescanService     *RescanService
+	rescanServiceOnce sync.Once
+)
+
+// GetRescanService 获取补扫服务实例
+func GetRescanService() *RescanService {
+	rescanServiceOnce.Do(func() {
+		rescanService = &RescanService{
+			running: make(map[uint]context.CancelFunc),
+			chains:  make(map[string]uint),
+		}
+	})
+	return rescanService
+}
+
+// rescanTarget 补扫任务使用的监听器和扫描器
+func (s *RescanService) rescanTarget(chain string) (*ChainListener, RangeRescanner, error) {
+	bs := GetBlockchainService()
+	bs.mu.RLock()
+	listener, ok := bs.listeners[chain]
+	bs.mu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("链 %s 未配置", chain)
+	}
+	rescanner, ok := listener.scanner.(RangeRescanner)
+	if !ok {
+		return nil, nil, fmt.Errorf("链 %s 不支持补扫", chain)
+	}
+	return listener, rescanner, nil
+}
+
+// Unit 链的补扫范围单位(block/time)
+func (s *RescanService) Unit(chain string) (string, error) {
+	_, rescanner, err := s.rescanTarget(chain)
+	if err != nil {
+		return "", err
+	}
+	return rescanner.RescanUnit(), nil
+}
+
+// ParseRange 解析补扫范围: 区块号，或按时间补扫的链使用 Unix 秒/本地时间(2006-01-02 15:04:05)
+func (s *RescanService) ParseRange(chain, from, to string) (uint64, uint64, error) {
+	unit, err := s.Unit(chain)
+	if err != nil {
+		return 0, 0, err
+	}
+	parse := func(value string) (uint64, error) {
+		value = strings.TrimSpace(value)
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			return n, nil
+		}
+		if unit != RescanUnitTime {
+			return 0, fmt.Errorf("无效的区块号: %s", value)
+		}
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时间: %s", value)
+		}
+		return uint64(t.Unix()), nil
+	}
+
+	fromPos, err := parse(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	toPos, err := parse(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	return fromPos, toPos, nil
+}
+
+// Start 创建补扫任务并在后台执行
+func (s *RescanService) Start(chain string, from, to uint64, operator string) (*model.RescanJob, error) {
+	job, listener, rescanner, ctx, err := s.create(chain, from, to, operator)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *job
+	go s.run(ctx, job, listener, rescanner, nil)
+	return &snapshot, nil
+}
+
+// Run 创建补扫任务并同步执行(命令行使用)，每段完成后调用 progress
+func (s *RescanService) Run(ctx context.Context, chain string, from, to uint64, operator string, progress func(*model.RescanJob)) (*model.RescanJob, error) {
+	job, listener, rescanner, jobCtx, err := s.create(chain, from, to, operator)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { s.Cancel(job.ID) })
+	defer stop()
+
+	s.run(jobCtx, job, listener, rescanner, progress)
+	if job.Status == model.RescanJobFailed {
+		return job, errors.New(job.Error)
+	}
+	return job, nil
+}
+
+// create 校验补扫范围并登记任务
+// 按区块补扫时范围不超过已达到确认数的区块，按时间补扫时不超过当前时间
+func (s *RescanService) create(chain string, from, to uint64, operator string) (*model.RescanJob, *ChainListener, RangeRescanner, context.Context, error) {
+	listener, rescanner, err := s.rescanTarget(chain)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if from == 0 || to < from {
+		return nil, nil, nil, nil, errors.New("补扫范围无效")
+	}
+
+	unit := rescanner.RescanUnit()
+	var limit, maxSpan uint64
+	if unit == RescanUnitTime {
+		limit, maxSpan = uint64(time.Now().Unix()), rescanMaxSeconds
+	} else {
+		current, err := listener.scanner.LatestHeight(listener)
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("获取最新区块失败: %w", err)
+		}
+		if current > uint64(listener.confirmations) {
+			limit = current - uint64(listener.confirmations)
+		}
+		maxSpan = rescanMaxBlocks
+	}
+	if from > limit {
+		return nil, nil, nil, nil, fmt.Errorf("起始位置 %d 尚未达到确认数(当前可补扫到 %d)", from, limit)
+	}
+	to = min(to, limit)
+	if to-from+1 > maxSpan {
+		return nil, nil, nil, nil, fmt.Errorf("补扫范围过大，单个任务最多 %d", maxSpan)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.chains[chain]; ok {
+		return nil, nil, nil, nil, fmt.Errorf("链 %s 已有执行中的补扫任务 #%d", chain, id)
+	}
+	if len(s.running) >= rescanMaxRunning {
+		return nil, nil, nil, nil, errors.New("执行中的补扫任务过多，请稍后再试")
+	}
+
+	job := &model.RescanJob{
+		Chain:    chain,
+		Unit:     unit,
+		FromPos:  from,
+		ToPos:    to,
+		Status:   model.RescanJobRunning,
+		Operator: operator,
+	}
+	if err := model.GetDB().Create(job).Error; err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(GetBlockchainService().ctx)
+	s.running[job.ID] = cancel
+	s.chains[chain] = job.ID
+	return job, listener, rescanner, ctx, nil
+}
+
+// run 按段执行补扫，转账经 processTransfer 处理(已处理过的交易按 tx_hash 跳过)
+func (s *RescanService) run(ctx context.Context, job *model.RescanJob, listener *ChainListener, rescanner RangeRescanner, progress func(*model.RescanJob)) {
+	defer func() {
+		s.mu.Lock()
+		if cancel, ok := s.running[job.ID]; ok {
+			cancel()
+			delete(s.running, job.ID)
+		}
+		delete(s.chains, job.Chain)
+		s.mu.Unlock()
+	}()
+
+	bs := GetBlockchainService()
+	log.Printf("[%s] Rescan job #%d started: %s %d-%d", job.Chain, job.ID, job.Unit, job.FromPos, job.ToPos)
+
+	pos := job.FromPos
+	for pos <= job.ToPos {
+		if ctx.Err() != nil {
+			s.finish(job, model.RescanJobCancelled, "")
+			return
+		}
+
+		addresses := bs.walletCache.GetAddresses(job.Chain)
+		if len(addresses) == 0 {
+			s.finish(job, model.RescanJobFailed, "该链没有收款地址")
+			return
+		}
+
+		transfers, end, err := rescanner.RescanChunk(listener, addresses, pos, job.ToPos)
+		if err != nil {
+			s.finish(job, model.RescanJobFailed, err.Error())
+			return
+		}
+
+		for _, transfer := range transfers {
+			if transfer.Unconfirmed {
+				continue
+			}
+			// 监听或之前的补扫已记录的交易不计入本次发现数
+			var txLog model.TransactionLog
+			if err := model.GetDB().Where("tx_hash = ?", transfer.TxHash).First(&txLog).Error; err == nil {
+				continue
+			}
+			bs.processTransfer(transfer)
+
+			if err := model.GetDB().Where("tx_hash = ?", transfer.TxHash).First(&txLog).Error; err == nil {
+				job.Found++
+				if txLog.Matched {
+					job.Matched++
+				}
+			}
+		}
+
+		job.Position = end
+		model.GetDB().Model(job).Updates(map[string]interface{}{
+			"position": job.Position,
+			"found":    job.Found,
+			"matched":  job.Matched,
+		})
+		if progress != nil {
+			progress(job)
+		}
+		pos = end + 1
+	}
+
+	s.finish(job, model.RescanJobDone, "")
+}
+
+// finish 记录任务结束状态
+func (s *RescanService) finish(job *model.RescanJob, status model.RescanJobStatus, errMsg string) {
+	if runes := []rune(errMsg); len(runes) > 500 {
+		errMsg = string(runes[:500])
+	}
+	now := time.Now()
+	job.Status = status
+	job.Error = errMsg
+	job.FinishedAt = &now
+	model.GetDB().Model(job).Updates(map[string]interface{}{
+		"status":      status,
+		"error":       errMsg,
+		"finished_at": now,
+	})
+	log.Printf("[%s] Rescan job #%d finished: status=%d position=%d found=%d matched=%d %s",
+		job.Chain, job.ID, status, job.Position, job.Found, job.Matched, errMsg)
+}
+
+// Cancel 取消执行中的补扫任务，当前段扫描完成后停止
+func (s *RescanService) Cancel(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.running[id]
+	if !ok {
+		return errors.New("任务不在执行中")
+	}
+	cancel()
+	return nil
+}
+
+// ListJobs 补扫任务列表
+func (s *RescanService) ListJobs(chain string, page, pageSize int) ([]model.RescanJob, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	query := model.GetDB().Model(&model.RescanJob{})
+	if chain != "" {
+		query = query.Where("chain = ?", chain)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []model.RescanJob
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&jobs).Error
+	return jobs, total, err
+}
+
+// GetJob 获取补扫任务
+func (s *RescanService) GetJob(id uint) (*model.RescanJob, error) {
+	var job model.RescanJob
+	if err := model.GetDB().First(&job, id).Error; err != nil {
+		return nil, errors.New("任务不存在")
+	}
+	return &job, nil
+}
+
+// MarkInterrupted 服务启动时将上次未结束的任务标记为中断，可从 Position+1 重新发起
+func (s *RescanService) MarkInterrupted() {
+	now := time.Now()
+	model.GetDB().Model(&model.RescanJob{}).
+		Where("status = ?", model.RescanJobRunning).
+		Updates(map[string]interface{}{
+			"status":      model.RescanJobFailed,
+			"error":       "服务重启，任务中断",
+			"finished_at": now,
+		})
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"github.com/shopspring/decimal"
+)
+
+// stubRescanner 按区块补扫的桩扫描器，每段最多 chunk 个区块，返回区块号在本段内的转账
+type stubRescanner struct {
+	stubScanner
+	chunk     uint64
+	transfers []Transfer
+	chunks    [][2]uint64 // 每段扫描的范围
+}
+
+func (s *stubRescanner) RescanUnit() string { return RescanUnitBlock }
+
+func (s *stubRescanner) RescanChunk(listener *ChainListener, addresses map[string]bool, from, to uint64) ([]Transfer, uint64, error) {
+	end := min(from+s.chunk-1, to)
+	s.chunks = append(s.chunks, [2]uint64{from, end})
+	var result []Transfer
+	for _, transfer := range s.transfers {
+		if transfer.BlockNumber >= from && transfer.BlockNumber <= end && addresses[strings.ToLower(transfer.To)] {
+			result = append(result, transfer)
+		}
+	}
+	return result, end, nil
+}
+
+// withRescanChain 在测试期间将补扫桩扫描器登记到全局区块链服务，wallets 为收款地址
+func withRescanChain(t *testing.T, chain string, rescanner ChainScanner, wallets ...string) {
+	t.Helper()
+	withGlobalChain(t, &ChainListener{chain: chain, scanner: rescanner, confirmations: 1, enabled: true})
+
+	cache := GetBlockchainService().walletCache
+	cache.mu.Lock()
+	cache.cache = map[string]map[string]bool{chain: watched(wallets...)}
+	cache.original = map[string][]string{chain: wallets}
+	cache.lastUpdate = time.Now()
+	cache.mu.Unlock()
+	t.Cleanup(cache.Invalidate)
+}
+
+func TestRescanCreateRange(t *testing.T) {
+	setupTestDB(t)
+	rescanner := &stubRescanner{stubScanner: stubScanner{height: rescanMaxBlocks + 100}, chunk: 100}
+	withRescanChain(t, "trc20", rescanner, "TWallet")
+	withRescanChain(t, "bep20", &stubScanner{height: 100}, "0xwallet")
+	limit := rescanner.height - 1
+
+	tests := []struct {
+		name     string
+		chain    string
+		from, to uint64
+		wantErr  string
+	}{
+		{name: "unknown chain", chain: "erc20", from: 1, to: 10, wantErr: "未配置"},
+		{name: "no range rescan", chain: "bep20", from: 1, to: 10, wantErr: "不支持补扫"},
+		{name: "zero start", chain: "trc20", from: 0, to: 10, wantErr: "补扫范围无效"},
+		{name: "reversed", chain: "trc20", from: 10, to: 9, wantErr: "补扫范围无效"},
+		{name: "not confirmed", chain: "trc20", from: limit + 1, to: limit + 10, wantErr: "尚未达到确认数"},
+		{name: "too large", chain: "trc20", from: limit - rescanMaxBlocks, to: limit, wantErr: "补扫范围过大"},
+	}
+	s := GetRescanService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, _, err := s.create(tt.chain, tt.from, tt.to, "root")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("create(%d, %d) error = %v, want %q", tt.from, tt.to, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRescanRunChunks(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+	order := model.Order{TradeNo: "T1", OutTradeNo: "O1", MerchantID: merchant.ID, Type: "usdt_trc20", Chain: "trc20",
+		PayCurrency: "USDT", ToAddress: "twallet", Money: decimal.NewFromInt(10), USDTAmount: decimal.NewFromInt(10),
+		SettlementAmount: decimal.NewFromInt(10), FeeType: model.FeeTypeDeduction, Status: model.OrderStatusPending,
+		ExpiredAt: time.Now().Add(time.Hour)}
+	db.Create(&order)
+	// 监听已记录过的交易，补扫时不计入发现数
+	db.Create(&model.TransactionLog{Chain: "trc20", TxHash: "0xseen", ToAddress: "TWallet", Amount: "3", Token: "USDT"})
+
+	transfer := func(hash string, block uint64, amount int64) Transfer {
+		return Transfer{TxHash: hash, From: "TPayer", To: "TWallet", Amount: decimal.NewFromInt(amount), Token: "USDT",
+			Chain: "trc20", BlockNumber: block}
+	}
+	unconfirmed := transfer("0xpending", 85, 7)
+	unconfirmed.Unconfirmed = true
+	rescanner := &stubRescanner{
+		stubScanner: stubScanner{height: 100},
+		chunk:       40,
+		transfers: []Transfer{
+			transfer("0xpaid", 5, 10),
+			transfer("0xunmatched", 50, 4),
+			transfer("0xseen", 81, 3),
+			unconfirmed,
+		},
+	}
+	withRescanChain(t, "trc20", rescanner, "TWallet")
+
+	var positions []uint64
+	job, err := GetRescanService().Run(context.Background(), "trc20", 1, 1000, "cli", func(job *model.RescanJob) {
+		positions = append(positions, job.Position)
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// 范围截止到已确认的区块 99，按 40 个区块一段扫描
+	want := [][2]uint64{{1, 40}, {41, 80}, {81, 99}}
+	if len(rescanner.chunks) != len(want) {
+		t.Fatalf("chunks = %v, want %v", rescanner.chunks, want)
+	}
+	for i := range want {
+		if rescanner.chunks[i] != want[i] {
+			t.Errorf("chunk %d = %v, want %v", i, rescanner.chunks[i], want[i])
+		}
+	}
+	if len(positions) != 3 || positions[2] != 99 {
+		t.Errorf("progress positions = %v, want 40, 80, 99", positions)
+	}
+
+	var saved model.RescanJob
+	db.First(&saved, job.ID)
+	if saved.Status != model.RescanJobDone || saved.ToPos != 99 || saved.Position != 99 {
+		t.Errorf("job status=%d to=%d position=%d, want done at 99", saved.Status, saved.ToPos, saved.Position)
+	}
+	if saved.Found != 2 || saved.Matched != 1 {
+		t.Errorf("job found=%d matched=%d, want 2 new transfers with 1 matched", saved.Found, saved.Matched)
+	}
+	db.First(&order, order.ID)
+	if order.Status != model.OrderStatusPaid {
+		t.Errorf("order status = %d, want paid by the rescanned transfer", order.Status)
+	}
+	var pending int64
+	db.Model(&model.TransactionLog{}).Where("tx_hash = ?", "0xpending").Count(&pending)
+	if pending != 0 {
+		t.Error("unconfirmed transfer recorded by rescan")
+	}
+}
@@ -404,10 +404,10 @@ func (s *TelegramService) handleStatus(chatID int64, user *TelegramUser) {
 	var todayAmount float64
 	today := time.Now().Format("2006-01-02")
 	model.GetDB().Model(&model.Order{}).
-		Where("merchant_id = ? AND DATE(created_at) = ? AND status = ?", merchant.ID, today, model.OrderStatusPaid).
+		Where("merchant_id = ? AND DATE(created_at) = ? AND status IN ?", merchant.ID, today, model.PaidOrderStatuses).
 		Count(&todayOrders)
 	model.GetDB().Model(&model.Order{}).
-		Where("merchant_id = ? AND DATE(created_at) = ? AND status = ?", merchant.ID, today, model.OrderStatusPaid).
+		Where("merchant_id = ? AND DATE(created_at) = ? AND status IN ?", merchant.ID, today, model.PaidOrderStatuses).
 		Select("COALESCE(SUM(money), 0)").Scan(&todayAmount)
 
 	notifyStatus := "🔔 开启"
@@ -708,6 +708,9 @@ func (s *TelegramService) NotifyWithdrawPaid(withdrawal *model.Withdrawal) {
 		withdrawal.PayMethod,
 		s.maskAccount(withdrawal.Account),
 		withdrawal.AccountName)
+	if withdrawal.PayoutTxHash != "" {
+		msg += fmt.Sprintf("\n交易哈希: `%s`", withdrawal.PayoutTxHash)
+	}
 
 	s.SendToMerchant(withdrawal.MerchantID, msg)
 }
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB 使用临时 SQLite 数据库替换 model.DB
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "ezpay.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent), TranslateError: true})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&model.Merchant{},
+		&model.Order{},
+		&model.SystemConfig{},
+		&model.TransactionLog{},
+		&model.Withdrawal{},
+		&model.WithdrawAddress{},
+		&model.BalanceLedger{},
+		&model.Refund{},
+		&model.NotifyTask{},
+		&model.NotifyAttempt{},
+		&model.OutboxEvent{},
+		&model.PendingTransfer{},
+		&model.Token{},
+		&model.PayoutBatch{},
+		&model.PayoutBatchItem{},
+		&model.Admin{},
+		&model.Approval{},
+		&model.WithdrawPolicy{},
+		&model.RescanJob{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	model.DB = db
+	GetTokenService().Invalidate()
+	// 不恢复 model.DB: 测试中启动的通知 goroutine 可能稍后才访问数据库，关闭后只会返回错误
+	t.Cleanup(func() {
+		GetTokenService().Invalidate()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// stubScanner 按预设结果返回最新高度和交易确认情况的扫描器
+type stubScanner struct {
+	ChainScanner
+	height uint64
+	txs    map[string]*txConfirmation // 未登记的交易视为未上链
+}
+
+func (s *stubScanner) LatestHeight(listener *ChainListener) (uint64, error) { return s.height, nil }
+
+func (s *stubScanner) TxConfirmation(listener *ChainListener, txHash string, currentBlock uint64) (*txConfirmation, error) {
+	if conf, ok := s.txs[txHash]; ok {
+		return conf, nil
+	}
+	return &txConfirmation{}, nil
+}
+
+func (s *stubScanner) ValidateAddress(address string) bool { return address != "" }
+
+// stubSender 记录调用的打款实现，每笔转账生成一笔交易，disperse 时整批生成一笔交易
+type stubSender struct {
+	disperse     bool
+	buildErr     error
+	broadcastErr error
+	drop         payoutDropState
+	built        [][]payoutTransfer
+	broadcasts   int
+}
+
+func (s *stubSender) Address() string { return "THotWallet" }
+
+func (s *stubSender) Prepare(listener *ChainListener, token *model.Token, total *big.Int, count int) (bool, error) {
+	return true, nil
+}
+
+func (s *stubSender) Build(listener *ChainListener, token *model.Token, transfers []payoutTransfer) ([]*payoutTx, error) {
+	s.built = append(s.built, transfers)
+	if s.buildErr != nil {
+		return nil, s.buildErr
+	}
+	if s.disperse {
+		hash := "0xtx" + big.NewInt(int64(len(s.built)*100)).String()
+		tx := &payoutTx{Hash: hash, Raw: "raw-" + hash}
+		for i := range transfers {
+			tx.Transfers = append(tx.Transfers, i)
+		}
+		return []*payoutTx{tx}, nil
+	}
+	txs := make([]*payoutTx, len(transfers))
+	for i := range transfers {
+		hash := "0xtx" + big.NewInt(int64(len(s.built)*100+i)).String()
+		txs[i] = &payoutTx{Hash: hash, Raw: "raw-" + hash, Nonce: uint64(i), Transfers: []int{i}}
+	}
+	return txs, nil
+}
+
+func (s *stubSender) Broadcast(listener *ChainListener, raw string) error {
+	s.broadcasts++
+	return s.broadcastErr
+}
+
+func (s *stubSender) Dropped(listener *ChainListener, w *model.Withdrawal) (payoutDropState, error) {
+	return s.drop, nil
+}
+
+// withPayoutSender 在测试期间让该链由 sender 自动打款
+func withPayoutSender(t *testing.T, chain string, sender payoutSender) *ChainListener {
+	t.Helper()
+	s := GetPayoutService()
+	prev, had := s.senders[chain]
+	s.senders[chain] = sender
+	t.Cleanup(func() {
+		if had {
+			s.senders[chain] = prev
+		} else {
+			delete(s.senders, chain)
+		}
+		s.dropChecks = make(map[string]*payoutDropCheck)
+	})
+	scanner := &stubScanner{height: 100, txs: make(map[string]*txConfirmation)}
+	return &ChainListener{chain: chain, scanner: scanner, confirmations: 1}
+}
+
+// newTestChain 创建连接到 handler 桩节点的链监听器(不重试、不限流)，wallets 为收款地址
+func newTestChain(t *testing.T, chain string, handler http.Handler, wallets ...string) *ChainListener {
+	t.Helper()
+	info, ok := util.GetChain(chain)
+	if !ok {
+		t.Fatalf("unknown chain %s", chain)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := newTestRPCClient(server.URL)
+
+	cache := NewWalletCache(time.Hour)
+	cache.cache[chain] = make(map[string]bool)
+	cache.original = map[string][]string{chain: wallets}
+	for _, w := range wallets {
+		cache.cache[chain][strings.ToLower(w)] = true
+	}
+	cache.lastUpdate = time.Now()
+
+	s := &BlockchainService{
+		listeners:   make(map[string]*ChainListener),
+		rpcClients:  map[string]*RPCClient{chain: client},
+		metrics:     NewBlockchainMetrics(),
+		walletCache: cache,
+		gasPrices:   make(map[string]float64),
+	}
+	listener := &ChainListener{chain: chain, chainType: info.Type, rpc: server.URL, confirmations: 2, enabled: true}
+	listener.scanner = s.newChainScanner(info)
+	s.listeners[chain] = listener
+	return listener
+}
+
+// newTestRPCClient 连接桩节点的 RPC 客户端(不重试、不限流)
+func newTestRPCClient(url string) *RPCClient {
+	client := NewRPCClient([]string{url})
+	client.maxRetries = 0
+	client.retryDelay = time.Millisecond
+	client.SetCustomRateLimit(10000)
+	return client
+}
+
+// withGlobalChain 在测试期间将监听器登记到全局区块链服务，打款实现通过 GetBlockchainService 访问节点
+func withGlobalChain(t *testing.T, listener *ChainListener) {
+	t.Helper()
+	bs := GetBlockchainService()
+	bs.mu.Lock()
+	bs.listeners[listener.chain] = listener
+	bs.rpcClients[listener.chain] = newTestRPCClient(listener.rpc)
+	bs.mu.Unlock()
+	t.Cleanup(func() {
+		bs.mu.Lock()
+		delete(bs.listeners, listener.chain)
+		delete(bs.rpcClients, listener.chain)
+		bs.mu.Unlock()
+	})
+}
+
+// watched 收款地址集合(小写)，ScanWindow.Addresses 使用
+func watched(addresses ...string) map[string]bool {
+	result := make(map[string]bool)
+	for _, a := range addresses {
+		result[strings.ToLower(a)] = true
+	}
+	return result
+}
+
+// jsonRPCStub JSON-RPC 桩节点: 按方法名返回结果，返回 *RPCError 时作为错误响应，未登记的方法返回 HTTP 500
+type jsonRPCStub map[string]func(params []json.RawMessage) interface{}
+
+func (stub jsonRPCStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     interface{}       `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	handler, ok := stub[req.Method]
+	if !ok {
+		http.Error(w, "unexpected method "+req.Method, http.StatusInternalServerError)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch result := handler(req.Params).(type) {
+	case *RPCError:
+		resp["error"] = result
+	default:
+		resp["result"] = result
+	}
+	json.NewEncoder(w).Encode(resp)
+}
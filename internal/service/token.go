@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+)
+
+// TokenService 代币登记服务
+// 扫描器每轮都需要查询链上启用的代币，登记表缓存在内存中，修改后失效
+type TokenService struct {
+	mu         sync.RWMutex
+	tokens     []model.Token
+	lastUpdate time.Time
+	ttl        time.Duration
+}
+
+var (
+	tokenService     *TokenService
+	tokenServiceOnce sync.Once
+)
+
+// GetTokenService 获取代币服务实例
+func GetTokenService() *TokenService {
+	tokenServiceOnce.Do(func() {
+		tokenService = &TokenService{ttl: 60 * time.Second}
+	})
+	return tokenService
+}
+
+// all 获取全部登记代币(带缓存)
+func (s *TokenService) all() []model.Token {
+	s.mu.RLock()
+	if time.Since(s.lastUpdate) <= s.ttl {
+		tokens := s.tokens
+		s.mu.RUnlock()
+		return tokens
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastUpdate) > s.ttl {
+		var tokens []model.Token
+		model.GetDB().Order("chain ASC, id ASC").Find(&tokens)
+		s.tokens = tokens
+		s.lastUpdate = time.Now()
+	}
+	return s.tokens
+}
+
+// Invalidate 使缓存失效
+func (s *TokenService) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUpdate = time.Time{}
+}
+
+// EnabledTokens 链上启用的代币
+func (s *TokenService) EnabledTokens(chain string) []model.Token {
+	var result []model.Token
+	for _, token := range s.all() {
+		if token.Chain == chain && token.Enabled {
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+// AllEnabled 全部启用的代币
+func (s *TokenService) AllEnabled() []model.Token {
+	var result []model.Token
+	for _, token := range s.all() {
+		if token.Enabled {
+			result = append(result, token)
+		}
+	}
+	return result
+}
+
+// GetToken 按链和符号查找启用的代币
+func (s *TokenService) GetToken(chain, symbol string) (*model.Token, bool) {
+	for _, token := range s.all() {
+		if token.Chain == chain && token.Enabled && strings.EqualFold(token.Symbol, symbol) {
+			return &token, true
+		}
+	}
+	return nil, false
+}
+
+// GetTokenByContract 按合约地址查找启用的代币
+func (s *TokenService) GetTokenByContract(chain, contract string) (*model.Token, bool) {
+	for _, token := range s.all() {
+		if token.Chain == chain && token.Enabled && strings.EqualFold(token.Contract, contract) {
+			return &token, true
+		}
+	}
+	return nil, false
+}
+
+// EnsureConfigToken 登记配置文件中的 USDT 合约，已登记时不覆盖(以后台修改为准)
+func (s *TokenService) EnsureConfigToken(chain, contract string) {
+	if contract == "" {
+		return
+	}
+	var count int64
+	model.GetDB().Model(&model.Token{}).Where("chain = ? AND symbol = ?", chain, "USDT").Count(&count)
+	if count > 0 {
+		return
+	}
+
+	// BSC 上的 USDT 为 18 位精度，其余链为 6 位
+	decimals := 6
+	if chain == "bep20" {
+		decimals = 18
+	}
+	model.GetDB().Create(&model.Token{
+		Chain:    chain,
+		Symbol:   "USDT",
+		Contract: contract,
+		Decimals: decimals,
+		Enabled:  true,
+	})
+	s.Invalidate()
+}
+
+// Validate 校验代币登记参数
+func (s *TokenService) Validate(token *model.Token) error {
+	token.Symbol = strings.ToUpper(strings.TrimSpace(token.Symbol))
+	token.Contract = strings.TrimSpace(token.Contract)
+	if token.Symbol == "" || strings.Contains(token.Symbol, "_") {
+		return errors.New("代币符号无效")
+	}
+	if token.Contract == "" {
+		return errors.New("请输入合约地址")
+	}
+	if token.Decimals < 0 || token.Decimals > 36 {
+		return errors.New("精度无效")
+	}
+	if info, ok := util.GetChain(token.Chain); !ok || info.Type == util.ChainTypeTron || info.Type == util.ChainTypeUTXO {
+		return errors.New("该链不支持代币")
+	}
+	if model.IsNativeToken(token.Chain, token.Symbol) {
+		return errors.New("原生币无需登记")
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// Webhook 事件请求头
+const (
+	WebhookHeaderEvent   = "X-Ezpay-Event"
+	WebhookHeaderEventID = "X-Ezpay-Event-Id"
+)
+
+// WebhookEvent Webhook 事件请求体
+type WebhookEvent struct {
+	ID        string                 `json:"id"` // 事件ID，重试时不变，商户据此去重
+	Type      model.WebhookEventType `json:"type"`
+	PID       string                 `json:"pid"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      interface{}            `json:"data"`
+}
+
+// WebhookTransfer 付款检测事件中的链上转账信息
+type WebhookTransfer struct {
+	TxHash      string          `json:"tx_hash"`
+	FromAddress string          `json:"from_address"`
+	Amount      decimal.Decimal `json:"amount"`
+	Received    decimal.Decimal `json:"received"` // 订单累计已收金额
+}
+
+// WebhookOrderData 订单类事件数据
+type WebhookOrderData struct {
+	Order    OrderPayload        `json:"order"`
+	Transfer *WebhookTransfer    `json:"transfer,omitempty"`
+	Refund   *JSONCallbackRefund `json:"refund,omitempty"`
+}
+
+// WebhookWithdrawalData 提现状态事件数据
+type WebhookWithdrawalData struct {
+	ID             uint                 `json:"id"`
+	Status         model.WithdrawStatus `json:"status"` // 0待处理 1已通过 2已拒绝 3已打款 4打款中 5打款失败
+	Amount         float64              `json:"amount"`
+	Fee            float64              `json:"fee"`
+	RealAmount     float64              `json:"real_amount"`
+	PayoutAmount   float64              `json:"payout_amount"`
+	PayoutCurrency string               `json:"payout_currency"`
+	PayoutRate     float64              `json:"payout_rate"` // 卖出汇率: 1 USD 兑换的打款货币数量
+	PayMethod      string               `json:"pay_method"`
+	Account        string               `json:"account"`
+	PayoutTxHash   string               `json:"payout_tx_hash,omitempty"`
+	AdminRemark    string               `json:"admin_remark"`
+	CreatedAt      time.Time            `json:"created_at"`
+	ProcessedAt    *time.Time           `json:"processed_at"`
+}
+
+// WebhookBalanceEntry 余额变动事件中的单笔流水
+type WebhookBalanceEntry struct {
+	Type    model.LedgerType    `json:"type"`
+	Amount  decimal.Decimal     `json:"amount"`
+	RefType model.LedgerRefType `json:"ref_type"`
+	RefNo   string              `json:"ref_no"`
+	Remark  string              `json:"remark"`
+}
+
+// WebhookBalanceData 余额变动事件数据
+type WebhookBalanceData struct {
+	Balance       decimal.Decimal       `json:"balance"`
+	FrozenBalance decimal.Decimal       `json:"frozen_balance"`
+	Entries       []WebhookBalanceEntry `json:"entries"`
+}
+
+// orderEventID 订单一次性事件(创建/支付/过期/取消/检测到某笔转账)使用确定的事件ID，重复触发时不会重复推送
+func orderEventID(order *model.Order, key string) string {
+	return "evt_" + util.MD5(order.TradeNo + "|" + key)[:24]
+}
+
+// newEventID 生成随机事件ID
+func newEventID() string {
+	return "evt_" + util.GenerateRandomHex(12)
+}
+
+// EmitOrderEvent 推送订单类事件
+// tx 不为空时事件任务与业务数据在同一事务中写入
+func (s *NotifyService) EmitOrderEvent(tx *gorm.DB, order *model.Order, eventType model.WebhookEventType, data WebhookOrderData) {
+	eventID := newEventID()
+	switch eventType {
+	case model.WebhookEventOrderCreated, model.WebhookEventOrderPaid, model.WebhookEventOrderExpired, model.WebhookEventOrderCancelled:
+		eventID = orderEventID(order, string(eventType))
+	case model.WebhookEventOrderDetected:
+		// 同一笔转账在检测和结算时都会触发，按交易哈希去重
+		if data.Transfer != nil {
+			eventID = orderEventID(order, string(eventType)+"|"+data.Transfer.TxHash)
+		}
+	}
+	data.Order = newOrderPayload(order)
+
+	if err := s.emitEvent(tx, order.MerchantID, order.ID, eventType, eventID, data); err != nil {
+		log.Printf("EmitOrderEvent: %s for order %s failed: %v", eventType, order.TradeNo, err)
+	}
+}
+
+// EmitWithdrawalEvent 推送提现状态变更事件
+func (s *NotifyService) EmitWithdrawalEvent(tx *gorm.DB, withdrawal *model.Withdrawal) {
+	data := WebhookWithdrawalData{
+		ID:             withdrawal.ID,
+		Status:         withdrawal.Status,
+		Amount:         withdrawal.Amount,
+		Fee:            withdrawal.Fee,
+		RealAmount:     withdrawal.RealAmount,
+		PayoutAmount:   withdrawal.PayoutAmount,
+		PayoutCurrency: withdrawal.PayoutCurrency,
+		PayoutRate:     withdrawal.PayoutRate,
+		PayMethod:      withdrawal.PayMethod,
+		Account:        withdrawal.Account,
+		PayoutTxHash:   withdrawal.PayoutTxHash,
+		AdminRemark:    withdrawal.AdminRemark,
+		CreatedAt:      withdrawal.CreatedAt,
+		ProcessedAt:    withdrawal.ProcessedAt,
+	}
+	if err := s.emitEvent(tx, withdrawal.MerchantID, 0, model.WebhookEventWithdrawalStatus, newEventID(), data); err != nil {
+		log.Printf("EmitWithdrawalEvent: withdrawal %d failed: %v", withdrawal.ID, err)
+	}
+}
+
+// emitEvent 按商户订阅设置写入事件推送任务，投递复用回调任务的重试机制
+func (s *NotifyService) emitEvent(tx *gorm.DB, merchantID, orderID uint, eventType model.WebhookEventType, eventID string, data interface{}) error {
+	db := tx
+	if db == nil {
+		db = model.GetDB()
+	}
+
+	var merchant model.Merchant
+	if err := db.Select("id", "p_id", "notify_url", "webhook_settings").First(&merchant, merchantID).Error; err != nil {
+		return fmt.Errorf("merchant not found")
+	}
+	return s.enqueueEvent(db, &merchant, orderID, eventType, eventID, data)
+}
+
+// enqueueEvent 写入事件推送任务（调用方已加载商户）
+func (s *NotifyService) enqueueEvent(db *gorm.DB, merchant *model.Merchant, orderID uint, eventType model.WebhookEventType, eventID string, data interface{}) error {
+	settings := merchant.WebhookSettings
+	if !settings.Subscribed(eventType) {
+		return nil
+	}
+	webhookURL := settings.URL
+	if webhookURL == "" {
+		webhookURL = merchant.NotifyURL
+	}
+	if webhookURL == "" {
+		return nil
+	}
+
+	// 同一事件ID只推送一次，并发写入时由 event_id 唯一索引保证
+	var count int64
+	db.Model(&model.NotifyTask{}).Where("event_id = ?", eventID).Count(&count)
+	if count > 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		PID:       merchant.PID,
+		CreatedAt: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	task := &model.NotifyTask{
+		MerchantID:    merchant.ID,
+		OrderID:       orderID,
+		Kind:          model.NotifyTaskKindEvent,
+		EventID:       eventID,
+		EventType:     eventType,
+		NotifyURL:     webhookURL,
+		Payload:       string(body),
+		Status:        model.NotifyTaskPending,
+		MaxAttempts:   s.getMaxRetry(),
+		NextAttemptAt: time.Now(),
+	}
+	if err := db.Create(task).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil
+		}
+		return err
+	}
+
+	s.signal()
+	return nil
+}
+
+// deliverEvent 投递 Webhook 事件，请求体为写入任务时的事件快照
+func (s *NotifyService) deliverEvent(task *model.NotifyTask, merchant *model.Merchant) notifyResult {
+	return s.sendJSONNotify(task.NotifyURL, []byte(task.Payload), merchant.Key, time.Now().Unix(), map[string]string{
+		WebhookHeaderEvent:   string(task.EventType),
+		WebhookHeaderEventID: task.EventID,
+	})
+}
+
+// ListEvents 分页查询商户的 Webhook 事件推送任务
+func (s *NotifyService) ListEvents(merchantID uint, eventType string, page, pageSize int) ([]model.NotifyTask, int64, error) {
+	query := model.GetDB().Model(&model.NotifyTask{}).
+		Where("merchant_id = ? AND kind = ?", merchantID, model.NotifyTaskKindEvent)
+	if eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var tasks []model.NotifyTask
+	err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&tasks).Error
+	return tasks, total, err
+}
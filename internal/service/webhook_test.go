@@ -0,0 +1,55 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestEnqueueEventConcurrentDuplicate(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1, NotifyURL: "http://127.0.0.1:1/notify",
+		WebhookSettings: model.WebhookSettings{Enabled: true, OrderPaid: true}}
+	db.Create(&merchant)
+
+	// 其他回调任务没有事件ID，不受唯一索引限制
+	for i := 0; i < 2; i++ {
+		if err := db.Create(&model.NotifyTask{MerchantID: merchant.ID, OrderID: 1, Kind: model.NotifyTaskKindOrder,
+			Status: model.NotifyTaskSuccess, NextAttemptAt: time.Now()}).Error; err != nil {
+			t.Fatalf("create order callback task: %v", err)
+		}
+	}
+
+	// 检查事件ID之后、写入之前，另一个进程已写入同一事件
+	raced := false
+	db.Callback().Create().Before("gorm:create").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "notify_tasks" {
+			return
+		}
+		raced = true
+		db.Exec(
+			"INSERT INTO notify_tasks (merchant_id, order_id, kind, event_id, status, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)",
+			merchant.ID, 1, model.NotifyTaskKindEvent, "evt_dup", model.NotifyTaskSuccess, time.Now())
+	})
+
+	s := GetNotifyService()
+	if err := s.enqueueEvent(db, &merchant, 1, model.WebhookEventOrderPaid, "evt_dup", nil); err != nil {
+		t.Fatalf("enqueueEvent duplicate: %v, want treated as already queued", err)
+	}
+	var count int64
+	db.Model(&model.NotifyTask{}).Where("event_id = ?", "evt_dup").Count(&count)
+	if count != 1 {
+		t.Errorf("%d tasks for one event, want 1", count)
+	}
+
+	var tasks []model.NotifyTask
+	if err := db.Where("kind = ?", model.NotifyTaskKindOrder).Find(&tasks).Error; err != nil || len(tasks) != 2 {
+		t.Fatalf("order callback tasks = %d, %v", len(tasks), err)
+	}
+	if tasks[0].EventID != "" {
+		t.Errorf("order callback event id = %q, want empty", tasks[0].EventID)
+	}
+}
@@ -2,14 +2,16 @@ package service
 
 import (
 	"errors"
-	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"ezpay/internal/model"
+	"ezpay/internal/util"
 
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // WithdrawService 提现服务
@@ -42,15 +44,6 @@ func (s *WithdrawService) CreateWithdrawal(merchantID uint, req *WithdrawRequest
 		return nil, errors.New("可用余额不足")
 	}
 
-	// 最低提现金额检查: 50 USD
-	if req.Amount < 50 {
-		return nil, errors.New("最低提现金额为 50 USD")
-	}
-
-	// 固定手续费: 1 USD
-	fee := 1.0
-	realAmount := req.Amount - fee
-
 	// 验证提现地址
 	if req.AddressID == 0 {
 		return nil, errors.New("请选择提现地址")
@@ -66,25 +59,51 @@ func (s *WithdrawService) CreateWithdrawal(merchantID uint, req *WithdrawRequest
 		return nil, errors.New("该提现地址尚未审核通过，请等待管理员审核")
 	}
 
+	currency, err := s.payoutCurrency(address.Chain, req.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按卖出汇率报价并锁定，审核时锁定期内按该报价打款
+	policy := s.EffectivePolicy(merchantID, address.Chain)
+	quote, err := s.quote(policy, req.Amount, currency)
+	if err != nil {
+		return nil, err
+	}
+
 	// 创建提现记录
 	withdrawal := &model.Withdrawal{
-		MerchantID:  merchantID,
-		Amount:      req.Amount,
-		Fee:         fee,
-		RealAmount:  realAmount,
-		PayMethod:   address.Chain,
-		Account:     address.Address,
-		AccountName: address.Label,
-		BankName:    "",
-		Status:      model.WithdrawStatusPending,
-		Remark:      req.Remark,
+		MerchantID:     merchantID,
+		Amount:         req.Amount,
+		Fee:            quote.Fee,
+		RealAmount:     quote.RealAmount,
+		PayoutAmount:   quote.PayoutAmount,
+		PayoutCurrency: quote.PayoutCurrency,
+		PayoutRate:     quote.PayoutRate,
+		QuotedAt:       &quote.QuotedAt,
+		PayMethod:      address.Chain,
+		Account:        address.Address,
+		AccountName:    address.Label,
+		BankName:       "",
+		Status:         model.WithdrawStatusPending,
+		Remark:         req.Remark,
+		CreatedBy:      req.CreatedBy,
+	}
+
+	actor := MerchantActor(merchant.PID)
+	if req.CreatedBy != 0 {
+		actor = AdminActor(req.Operator)
 	}
 
 	// 开启事务
-	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
-		// 冻结余额
-		if err := tx.Model(&model.Merchant{}).Where("id = ?", merchantID).
-			Update("frozen_balance", gorm.Expr("frozen_balance + ?", req.Amount)).Error; err != nil {
+	err = model.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 锁定商户，串行执行同一商户的累计额度检查
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model.Merchant{}, merchantID).Error; err != nil {
+			return err
+		}
+
+		// 按提现规则校验金额和额度
+		if _, err := s.checkWithdrawPolicy(tx, merchantID, policy, req.Amount); err != nil {
 			return err
 		}
 
@@ -93,6 +112,20 @@ func (s *WithdrawService) CreateWithdrawal(merchantID uint, req *WithdrawRequest
 			return err
 		}
 
+		// 冻结余额（写入账本）
+		_, err := GetLedgerService().Apply(tx, merchantID, LedgerEntry{
+			Type:    model.LedgerTypeFreeze,
+			Amount:  decimal.NewFromFloat(req.Amount),
+			RefType: model.LedgerRefWithdrawal,
+			RefID:   withdrawal.ID,
+			Actor:   actor,
+			Remark:  "提现申请冻结",
+		})
+		if err != nil {
+			return err
+		}
+
+		GetNotifyService().EmitWithdrawalEvent(tx, withdrawal)
 		return nil
 	})
 
@@ -110,7 +143,55 @@ func (s *WithdrawService) CreateWithdrawal(merchantID uint, req *WithdrawRequest
 type WithdrawRequest struct {
 	Amount    float64 `json:"amount" binding:"required,gt=0"`
 	AddressID uint    `json:"address_id" binding:"required"` // 提现地址ID
+	Currency  string  `json:"currency"`                      // 打款货币: USDT、TRX(仅 TRON 地址)，为空时使用链的默认货币
 	Remark    string  `json:"remark"`
+	CreatedBy uint    `json:"-"` // 代商户申请的管理员ID，商户自行申请时为 0
+	Operator  string  `json:"-"` // 代商户申请的管理员用户名，记录到账本流水
+}
+
+// CreateWithdrawAddress 添加提现地址，审核通过后才能用于提现
+// createdBy: 代商户添加的管理员ID，商户自行添加时为 0，该管理员不能审批此地址
+func (s *WithdrawService) CreateWithdrawAddress(merchantID uint, chain, address, label string, createdBy uint) (*model.WithdrawAddress, error) {
+	// 提现地址只支持已登记的区块链，地址格式由链的扫描器校验
+	if !util.IsValidChain(chain) || util.IsFiatChain(chain) {
+		return nil, errors.New("不支持的链类型")
+	}
+	address = strings.TrimSpace(address)
+	if !GetBlockchainService().ValidateAddress(chain, address) {
+		return nil, errors.New("钱包地址格式无效")
+	}
+
+	var count int64
+	model.GetDB().Model(&model.Merchant{}).Where("id = ?", merchantID).Count(&count)
+	if count == 0 {
+		return nil, errors.New("商户不存在")
+	}
+
+	// 检查地址是否已存在
+	model.GetDB().Model(&model.WithdrawAddress{}).
+		Where("merchant_id = ? AND chain = ? AND address = ?", merchantID, chain, address).
+		Count(&count)
+	if count > 0 {
+		return nil, errors.New("该地址已存在")
+	}
+
+	withdrawAddress := &model.WithdrawAddress{
+		MerchantID: merchantID,
+		Chain:      chain,
+		Address:    address,
+		Label:      label,
+		IsDefault:  false,
+		Status:     model.WithdrawAddressPending, // 待审核
+		CreatedBy:  createdBy,
+	}
+	if err := model.GetDB().Create(withdrawAddress).Error; err != nil {
+		return nil, errors.New("创建失败")
+	}
+
+	// 发送通知给管理员
+	go GetTelegramService().NotifyWithdrawAddressAdded(withdrawAddress)
+
+	return withdrawAddress, nil
 }
 
 // ListWithdrawals 获取提现记录列表
@@ -146,66 +227,85 @@ func (s *WithdrawService) GetWithdrawal(id uint) (*model.Withdrawal, error) {
 }
 
 // ApproveWithdrawal 审核通过提现
-func (s *WithdrawService) ApproveWithdrawal(id uint, adminRemark string) error {
+// 大额提现需要多名不同的管理员审批，审批人数未达到要求时只记录审批，提现保持待审核
+func (s *WithdrawService) ApproveWithdrawal(id uint, approver Approver, adminRemark string) (*ApprovalProgress, error) {
 	var withdrawal model.Withdrawal
-	if err := model.GetDB().First(&withdrawal, id).Error; err != nil {
-		return errors.New("提现记录不存在")
-	}
+	var progress *ApprovalProgress
+	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 锁定提现记录，串行处理同一提现的并发审批
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&withdrawal, id).Error; err != nil {
+			return errors.New("提现记录不存在")
+		}
+		if withdrawal.Status != model.WithdrawStatusPending {
+			return errors.New("该提现申请已处理")
+		}
 
-	if withdrawal.Status != model.WithdrawStatusPending {
-		return errors.New("该提现申请已处理")
-	}
+		var err error
+		progress, err = s.approve(tx, model.ApprovalRefWithdrawal, withdrawal.ID, withdrawal.CreatedBy, approver, adminRemark,
+			s.WithdrawalApprovalsRequired(withdrawal.Amount))
+		if err != nil || !progress.Done() {
+			return err
+		}
 
-	// 计算实际打款金额（使用卖出汇率）
-	var payoutCurrency string
-	switch withdrawal.PayMethod {
-	case "trc20", "erc20", "bep20", "polygon", "optimism", "arbitrum", "avalanche", "base":
-		payoutCurrency = "USDT"
-	case "trx":
-		payoutCurrency = "TRX"
-	default:
-		payoutCurrency = "USDT"
-	}
+		now := time.Now()
+		updates := map[string]interface{}{
+			"status":       model.WithdrawStatusApproved,
+			"admin_remark": adminRemark,
+			"processed_at": &now,
+		}
 
-	// 使用卖出汇率转换
-	rateService := GetRateService()
-	result, err := rateService.ConvertFromSettlementCurrency(
-		decimal.NewFromFloat(withdrawal.RealAmount),
-		payoutCurrency,
-	)
-	if err != nil {
-		return errors.New("计算打款金额失败: " + err.Error())
-	}
+		// 报价锁定期内按申请时的报价打款；超时或未报价的旧记录按当前卖出汇率重新报价
+		// 重新报价沿用申请时的币种，自动打款不支持的币种由管理员手动打款
+		if withdrawal.QuotedAt == nil || now.Sub(*withdrawal.QuotedAt) > s.quoteTTL() {
+			currency := withdrawal.PayoutCurrency
+			if currency == "" {
+				if currency, err = s.payoutCurrency(withdrawal.PayMethod, ""); err != nil {
+					return err
+				}
+			}
+			payoutAmount, payoutRate, err := s.convertPayout(withdrawal.RealAmount, currency)
+			if err != nil {
+				return err
+			}
+			updates["payout_amount"] = payoutAmount
+			updates["payout_currency"] = currency
+			updates["payout_rate"] = payoutRate
+			updates["quoted_at"] = &now
+			withdrawal.PayoutAmount, withdrawal.PayoutCurrency, withdrawal.PayoutRate = payoutAmount, currency, payoutRate
+			withdrawal.QuotedAt = &now
+		}
 
-	payoutAmount, _ := result.Amount.Float64()
-	payoutRate, _ := result.Rate.Float64()
+		if err := tx.Model(&withdrawal).Updates(updates).Error; err != nil {
+			return err
+		}
+		withdrawal.Status = model.WithdrawStatusApproved
 
-	now := time.Now()
-	if err := model.GetDB().Model(&withdrawal).Updates(map[string]interface{}{
-		"status":          model.WithdrawStatusApproved,
-		"admin_remark":    adminRemark,
-		"processed_at":    &now,
-		"payout_amount":   payoutAmount,
-		"payout_currency": payoutCurrency,
-		"payout_rate":     payoutRate,
-	}).Error; err != nil {
-		return err
+		GetNotifyService().EmitWithdrawalEvent(tx, &withdrawal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 发送Telegram通知 - 提现审批通过
-	go GetTelegramService().NotifyWithdrawApproved(&withdrawal)
+	if progress.Done() {
+		// 发送Telegram通知 - 提现审批通过
+		go GetTelegramService().NotifyWithdrawApproved(&withdrawal)
+	}
 
-	return nil
+	return progress, nil
 }
 
 // RejectWithdrawal 拒绝提现
-func (s *WithdrawService) RejectWithdrawal(id uint, adminRemark string) error {
+// operator: 操作管理员用户名，记录到账本流水
+func (s *WithdrawService) RejectWithdrawal(id uint, adminRemark string, operator string) error {
 	var withdrawal model.Withdrawal
 	if err := model.GetDB().First(&withdrawal, id).Error; err != nil {
 		return errors.New("提现记录不存在")
 	}
 
-	if withdrawal.Status != model.WithdrawStatusPending {
+	// 待审核或自动打款失败(资金仍冻结)的提现可以拒绝
+	rejectable := []model.WithdrawStatus{model.WithdrawStatusPending, model.WithdrawStatusFailed}
+	if withdrawal.Status != model.WithdrawStatusPending && withdrawal.Status != model.WithdrawStatusFailed {
 		return errors.New("该提现申请已处理")
 	}
 
@@ -213,21 +313,33 @@ func (s *WithdrawService) RejectWithdrawal(id uint, adminRemark string) error {
 
 	// 开启事务
 	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
-		// 更新状态
-		if err := tx.Model(&withdrawal).Updates(map[string]interface{}{
+		// 更新状态（仅处理待审核/打款失败的记录，防止重复处理）
+		result := tx.Model(&withdrawal).Where("status IN ?", rejectable).Updates(map[string]interface{}{
 			"status":       model.WithdrawStatusRejected,
 			"admin_remark": adminRemark,
 			"processed_at": &now,
-		}).Error; err != nil {
-			return err
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该提现申请已处理")
 		}
 
 		// 解冻余额
-		if err := tx.Model(&model.Merchant{}).Where("id = ?", withdrawal.MerchantID).
-			Update("frozen_balance", gorm.Expr("frozen_balance - ?", withdrawal.Amount)).Error; err != nil {
+		_, err := GetLedgerService().Apply(tx, withdrawal.MerchantID, LedgerEntry{
+			Type:    model.LedgerTypeUnfreeze,
+			Amount:  decimal.NewFromFloat(withdrawal.Amount),
+			RefType: model.LedgerRefWithdrawal,
+			RefID:   withdrawal.ID,
+			Actor:   AdminActor(operator),
+			Remark:  "提现被拒绝，解冻",
+		})
+		if err != nil {
 			return err
 		}
 
+		GetNotifyService().EmitWithdrawalEvent(tx, &withdrawal)
 		return nil
 	})
 
@@ -242,7 +354,8 @@ func (s *WithdrawService) RejectWithdrawal(id uint, adminRemark string) error {
 }
 
 // CompleteWithdrawal 完成打款
-func (s *WithdrawService) CompleteWithdrawal(id uint, adminRemark string) error {
+// operator: 操作管理员用户名，记录到账本流水
+func (s *WithdrawService) CompleteWithdrawal(id uint, adminRemark string, operator string) error {
 	var withdrawal model.Withdrawal
 	if err := model.GetDB().First(&withdrawal, id).Error; err != nil {
 		return errors.New("提现记录不存在")
@@ -256,23 +369,44 @@ func (s *WithdrawService) CompleteWithdrawal(id uint, adminRemark string) error
 
 	// 开启事务
 	err := model.GetDB().Transaction(func(tx *gorm.DB) error {
-		// 更新状态
-		if err := tx.Model(&withdrawal).Updates(map[string]interface{}{
+		// 更新状态（仅处理已审核的记录，防止重复扣款）
+		result := tx.Model(&withdrawal).Where("status = ?", model.WithdrawStatusApproved).Updates(map[string]interface{}{
 			"status":       model.WithdrawStatusPaid,
 			"admin_remark": adminRemark,
 			"processed_at": &now,
-		}).Error; err != nil {
-			return err
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("该提现申请未审核通过")
 		}
 
-		// 扣除余额和冻结余额
-		if err := tx.Model(&model.Merchant{}).Where("id = ?", withdrawal.MerchantID).Updates(map[string]interface{}{
-			"balance":        gorm.Expr("balance - ?", withdrawal.Amount),
-			"frozen_balance": gorm.Expr("frozen_balance - ?", withdrawal.Amount),
-		}).Error; err != nil {
+		// 解冻并扣除余额
+		amount := decimal.NewFromFloat(withdrawal.Amount)
+		_, err := GetLedgerService().Apply(tx, withdrawal.MerchantID,
+			LedgerEntry{
+				Type:    model.LedgerTypeUnfreeze,
+				Amount:  amount,
+				RefType: model.LedgerRefWithdrawal,
+				RefID:   withdrawal.ID,
+				Actor:   AdminActor(operator),
+				Remark:  "提现打款，解冻",
+			},
+			LedgerEntry{
+				Type:    model.LedgerTypeDebit,
+				Amount:  amount,
+				RefType: model.LedgerRefWithdrawal,
+				RefID:   withdrawal.ID,
+				Actor:   AdminActor(operator),
+				Remark:  "提现打款",
+			},
+		)
+		if err != nil {
 			return err
 		}
 
+		GetNotifyService().EmitWithdrawalEvent(tx, &withdrawal)
 		return nil
 	})
 
@@ -286,75 +420,134 @@ func (s *WithdrawService) CompleteWithdrawal(id uint, adminRemark string) error
 	return nil
 }
 
-// getWithdrawFeeRate 获取提现手续费率
-func (s *WithdrawService) getWithdrawFeeRate() float64 {
-	var config model.SystemConfig
-	if err := model.GetDB().Where("`key` = ?", "withdraw_fee_rate").First(&config).Error; err != nil {
-		return 0 // 默认无手续费
+// RetryPayout 自动打款失败的提现重新进入待打款，由热钱包重新签名发送
+// 自动判定的失败交易通常不会再上链(执行失败、nonce 被占用或已过期)，但节点数据可能滞后或不一致；
+// 重新打款前管理员应在区块浏览器核实原交易(哈希见批量打款明细)确未上链，否则会重复转账
+func (s *WithdrawService) RetryPayout(id uint, adminRemark string) error {
+	var withdrawal model.Withdrawal
+	if err := model.GetDB().First(&withdrawal, id).Error; err != nil {
+		return errors.New("提现记录不存在")
 	}
-	var rate float64
-	if err := model.GetDB().Raw("SELECT CAST(? AS DECIMAL(5,4))", config.Value).Scan(&rate).Error; err != nil {
-		return 0
+
+	result := model.GetDB().Model(&withdrawal).Where("status = ?", model.WithdrawStatusFailed).Updates(map[string]interface{}{
+		"status":          model.WithdrawStatusApproved,
+		"admin_remark":    adminRemark,
+		"payout_tx_hash":  "",
+		"payout_raw_tx":   "",
+		"payout_nonce":    0,
+		"payout_sent_at":  nil,
+		"payout_attempts": 0,
+	})
+	if result.Error != nil {
+		return result.Error
 	}
-	return rate
+	if result.RowsAffected == 0 {
+		return errors.New("该提现不是打款失败状态")
+	}
+
+	withdrawal.Status = model.WithdrawStatusApproved
+	GetNotifyService().EmitWithdrawalEvent(nil, &withdrawal)
+	return nil
 }
 
-// AddMerchantBalance 增加商户余额 (订单完成时调用)
-// amount: 结算金额（USD）
-// fee: 订单手续费（USD）
-// feeType: 1=余额扣除(个人收款码), 2=收款扣除(系统收款码)
+// SettleOrderBalance 在事务中为已支付订单入账
+// 结算金额（USD）记为入账，手续费记为出账；
+// 个人收款码(FeeTypeBalance)模式下创建订单时预冻结的手续费同时解冻
+// (订单过期时预冻结已退还，过期后到账的订单不再解冻)
+// order.ActualAmount 为订单累计收款金额，少付(容差内)的订单按实收比例入账
 //
 // 个人收款码：商户收到币（如 112.41 USDT）→ 增加结算金额（110.16 USD）→ 扣除手续费（1.10 USD）→ 最终余额 +109.06 USD
 // 系统收款码：平台收到币（如 112.41 USDT）→ 增加结算金额（110.16 USD）→ 扣除手续费（1.10 USD）→ 最终余额 +109.06 USD
-func (s *WithdrawService) AddMerchantBalance(merchantID uint, amount float64, fee float64, feeType model.FeeType) error {
-	var merchant model.Merchant
-	if err := model.GetDB().First(&merchant, merchantID).Error; err != nil {
-		return err
+func (s *WithdrawService) SettleOrderBalance(tx *gorm.DB, order *model.Order, prevStatus model.OrderStatus, actor string) (*model.Merchant, error) {
+	if err := prorateSettlement(tx, order); err != nil {
+		return nil, err
 	}
 
-	realAmount := amount - fee // 实际增加的余额
-	var err error
-
-	if feeType == model.FeeTypeBalance {
-		// 个人收款码模式：
-		// 1. 商户钱包实际收到加密货币（如 112.41 USDT）
-		// 2. 系统增加结算金额到余额（amount = 110.16 USD）
-		// 3. 扣除预扣的手续费冻结额
-		// 4. 从余额扣除手续费（fee = 1.10 USD）
-		err = model.GetDB().Model(&model.Merchant{}).Where("id = ?", merchantID).Updates(map[string]interface{}{
-			"balance":        gorm.Expr("balance + ?", realAmount),
-			"frozen_balance": gorm.Expr("frozen_balance - ?", fee),
-		}).Error
-	} else {
-		// 系统收款码模式：
-		// 1. 平台钱包收到加密货币（如 112.41 USDT）
-		// 2. 系统增加结算金额到余额（amount = 110.16 USD）
-		// 3. 扣除手续费后的金额入账
-		err = model.GetDB().Model(&model.Merchant{}).Where("id = ?", merchantID).
-			Update("balance", gorm.Expr("balance + ?", realAmount)).Error
-	}
-
-	if err == nil {
-		// 获取更新后的余额
-		model.GetDB().First(&merchant, merchantID)
-		// 余额变动通知
-		go GetTelegramService().NotifyBalanceChanged(
-			merchantID,
-			"订单入账",
-			decimal.NewFromFloat(realAmount),
-			decimal.NewFromFloat(merchant.Balance),
-			fmt.Sprintf("订单结算 USD %.2f，扣除手续费 USD %.2f", amount, fee),
-		)
+	entries := []LedgerEntry{
+		{
+			Type:    model.LedgerTypeCredit,
+			Amount:  order.SettlementAmount,
+			RefType: model.LedgerRefOrder,
+			RefID:   order.ID,
+			RefNo:   order.TradeNo,
+			Actor:   actor,
+			Remark:  "订单结算入账",
+		},
+	}
+
+	if order.FeeType == model.FeeTypeBalance && feeFrozen(prevStatus) {
+		entries = append(entries, LedgerEntry{
+			Type:    model.LedgerTypeUnfreeze,
+			Amount:  order.Fee,
+			RefType: model.LedgerRefOrder,
+			RefID:   order.ID,
+			RefNo:   order.TradeNo,
+			Actor:   actor,
+			Remark:  "释放预冻结手续费",
+		})
 	}
 
+	entries = append(entries, LedgerEntry{
+		Type:    model.LedgerTypeDebit,
+		Amount:  order.Fee,
+		RefType: model.LedgerRefOrder,
+		RefID:   order.ID,
+		RefNo:   order.TradeNo,
+		Actor:   actor,
+		Remark:  "订单手续费",
+	})
+
+	return GetLedgerService().Apply(tx, order.MerchantID, entries...)
+}
+
+// prorateSettlement 少付订单的结算金额按实收金额占应收金额的比例折算(最多 100%)，并写回订单
+// 避免少付容差内的订单按全额入账
+func prorateSettlement(tx *gorm.DB, order *model.Order) error {
+	required := orderRequiredAmount(order)
+	if !required.IsPositive() || !order.ActualAmount.IsPositive() || order.ActualAmount.GreaterThanOrEqual(required) {
+		return nil
+	}
+	settlement := order.SettlementAmount.Mul(order.ActualAmount).Div(required).Round(6)
+	if err := tx.Model(&model.Order{}).Where("id = ?", order.ID).Update("settlement_amount", settlement).Error; err != nil {
+		return err
+	}
+	order.SettlementAmount = settlement
+	return nil
+}
+
+// feeFrozen 该状态下订单的预扣手续费是否仍处于冻结中
+func feeFrozen(status model.OrderStatus) bool {
+	return status == model.OrderStatusPending || status == model.OrderStatusPartial
+}
+
+// FreezeOrderFee 在事务中预冻结订单手续费 (个人收款码模式创建订单时调用)
+func (s *WithdrawService) FreezeOrderFee(tx *gorm.DB, order *model.Order) error {
+	if !order.Fee.GreaterThan(decimal.Zero) {
+		return nil
+	}
+	_, err := GetLedgerService().Apply(tx, order.MerchantID, LedgerEntry{
+		Type:    model.LedgerTypeFreeze,
+		Amount:  order.Fee,
+		RefType: model.LedgerRefOrder,
+		RefID:   order.ID,
+		RefNo:   order.TradeNo,
+		Remark:  "预冻结订单手续费",
+	})
 	return err
 }
 
-// RefundPreChargedFee 退还预扣的手续费 (订单失败/取消时)
-func (s *WithdrawService) RefundPreChargedFee(merchantID uint, fee float64) error {
-	if fee <= 0 {
+// RefundPreChargedFee 在事务中退还预扣的手续费 (订单过期/取消/清理时)
+func (s *WithdrawService) RefundPreChargedFee(tx *gorm.DB, order *model.Order) error {
+	if order.FeeType != model.FeeTypeBalance || !order.Fee.GreaterThan(decimal.Zero) {
 		return nil
 	}
-	return model.GetDB().Model(&model.Merchant{}).Where("id = ?", merchantID).
-		Update("frozen_balance", gorm.Expr("frozen_balance - ?", fee)).Error
+	_, err := GetLedgerService().Apply(tx, order.MerchantID, LedgerEntry{
+		Type:    model.LedgerTypeUnfreeze,
+		Amount:  order.Fee,
+		RefType: model.LedgerRefOrder,
+		RefID:   order.ID,
+		RefNo:   order.TradeNo,
+		Remark:  "订单未支付，退还预冻结手续费",
+	})
+	return err
 }
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// defaultWithdrawPolicy 未配置任何提现规则时使用的内置规则
+var defaultWithdrawPolicy = model.WithdrawPolicy{
+	MinAmount: 50,
+	FeeFixed:  1,
+}
+
+// WithdrawQuota 商户在某条链上的生效提现规则及已用额度
+type WithdrawQuota struct {
+	Chain      string               `json:"chain"`
+	Currencies []string             `json:"currencies"` // 可选打款货币
+	Policy     model.WithdrawPolicy `json:"policy"`
+	DailyUsed  float64              `json:"daily_used"`  // 今日已提现金额
+	WeeklyUsed float64              `json:"weekly_used"` // 本周已提现金额
+	DailyCount int64                `json:"daily_count"` // 今日已提现笔数
+}
+
+// EffectivePolicy 商户在某条链上生效的提现规则
+func (s *WithdrawService) EffectivePolicy(merchantID uint, chain string) model.WithdrawPolicy {
+	var policies []model.WithdrawPolicy
+	model.GetDB().Where("merchant_id IN ? AND chain IN ?", []uint{0, merchantID}, []string{"", chain}).Find(&policies)
+
+	// 商户规则优先，其次链规则
+	best, bestRank := defaultWithdrawPolicy, -1
+	for _, p := range policies {
+		rank := 0
+		if p.MerchantID != 0 {
+			rank += 2
+		}
+		if p.Chain != "" {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = p, rank
+		}
+	}
+	return best
+}
+
+// CalcWithdrawFee 按规则计算手续费: 固定手续费 + 金额 × 百分比，保留两位小数
+func CalcWithdrawFee(policy model.WithdrawPolicy, amount float64) float64 {
+	fee := decimal.NewFromFloat(policy.FeeFixed).Add(
+		decimal.NewFromFloat(amount).Mul(decimal.NewFromFloat(policy.FeePercent)).Div(decimal.NewFromInt(100)),
+	)
+	f, _ := fee.Round(2).Float64()
+	return f
+}
+
+// GetWithdrawQuota 商户在某条链上的生效提现规则及今日/本周已用额度，提交提现前展示
+func (s *WithdrawService) GetWithdrawQuota(merchantID uint, chain string) (*WithdrawQuota, error) {
+	policy := s.EffectivePolicy(merchantID, chain)
+	quota := &WithdrawQuota{Chain: chain, Currencies: PayoutCurrencies(chain), Policy: policy}
+
+	now := time.Now()
+	db := model.GetDB()
+	if err := s.withdrawnQuery(db, merchantID, policy, dayStart(now)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&quota.DailyUsed).Error; err != nil {
+		return nil, err
+	}
+	if err := s.withdrawnQuery(db, merchantID, policy, weekStart(now)).
+		Select("COALESCE(SUM(amount), 0)").Scan(&quota.WeeklyUsed).Error; err != nil {
+		return nil, err
+	}
+	if err := s.withdrawnQuery(db, merchantID, policy, dayStart(now)).Count(&quota.DailyCount).Error; err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// checkWithdrawPolicy 校验单笔金额和累计额度，返回手续费
+// 需在锁定商户记录的事务中调用，避免并发申请同时通过累计额度检查
+func (s *WithdrawService) checkWithdrawPolicy(tx *gorm.DB, merchantID uint, policy model.WithdrawPolicy, amount float64) (float64, error) {
+	if amount < policy.MinAmount {
+		return 0, fmt.Errorf("最低提现金额为 %s USD", formatUSD(policy.MinAmount))
+	}
+	if policy.MaxAmount > 0 && amount > policy.MaxAmount {
+		return 0, fmt.Errorf("单笔最高提现金额为 %s USD", formatUSD(policy.MaxAmount))
+	}
+	fee := CalcWithdrawFee(policy, amount)
+	if amount-fee <= 0 {
+		return 0, errors.New("提现金额不足以支付手续费")
+	}
+
+	now := time.Now()
+	if policy.DailyCount > 0 {
+		var count int64
+		if err := s.withdrawnQuery(tx, merchantID, policy, dayStart(now)).Count(&count).Error; err != nil {
+			return 0, err
+		}
+		if count >= int64(policy.DailyCount) {
+			return 0, fmt.Errorf("每日最多提现 %d 笔", policy.DailyCount)
+		}
+	}
+	if policy.DailyLimit > 0 {
+		var used float64
+		if err := s.withdrawnQuery(tx, merchantID, policy, dayStart(now)).
+			Select("COALESCE(SUM(amount), 0)").Scan(&used).Error; err != nil {
+			return 0, err
+		}
+		if used+amount > policy.DailyLimit {
+			return 0, fmt.Errorf("超出每日提现额度 %s USD，今日已提现 %s USD", formatUSD(policy.DailyLimit), formatUSD(used))
+		}
+	}
+	if policy.WeeklyLimit > 0 {
+		var used float64
+		if err := s.withdrawnQuery(tx, merchantID, policy, weekStart(now)).
+			Select("COALESCE(SUM(amount), 0)").Scan(&used).Error; err != nil {
+			return 0, err
+		}
+		if used+amount > policy.WeeklyLimit {
+			return 0, fmt.Errorf("超出每周提现额度 %s USD，本周已提现 %s USD", formatUSD(policy.WeeklyLimit), formatUSD(used))
+		}
+	}
+	return fee, nil
+}
+
+// withdrawnQuery 计入累计额度的提现: 自 since 起申请且未被拒绝；链规则只统计该链的提现
+func (s *WithdrawService) withdrawnQuery(db *gorm.DB, merchantID uint, policy model.WithdrawPolicy, since time.Time) *gorm.DB {
+	query := db.Model(&model.Withdrawal{}).
+		Where("merchant_id = ? AND status <> ? AND created_at >= ?", merchantID, model.WithdrawStatusRejected, since)
+	if policy.Chain != "" {
+		query = query.Where("pay_method = ?", policy.Chain)
+	}
+	return query
+}
+
+// ListPolicies 提现规则列表，merchantID 不为空时只返回该商户的规则
+func (s *WithdrawService) ListPolicies(merchantID *uint) ([]model.WithdrawPolicy, error) {
+	query := model.GetDB().Model(&model.WithdrawPolicy{})
+	if merchantID != nil {
+		query = query.Where("merchant_id = ?", *merchantID)
+	}
+	var policies []model.WithdrawPolicy
+	err := query.Order("merchant_id ASC, chain ASC").Find(&policies).Error
+	return policies, err
+}
+
+// SavePolicy 创建或更新提现规则(ID 为 0 时创建)
+func (s *WithdrawService) SavePolicy(policy *model.WithdrawPolicy) error {
+	if policy.MinAmount < 0 || policy.MaxAmount < 0 || policy.FeeFixed < 0 || policy.FeePercent < 0 ||
+		policy.DailyLimit < 0 || policy.WeeklyLimit < 0 || policy.DailyCount < 0 {
+		return errors.New("金额、比例和笔数不能为负数")
+	}
+	if policy.FeePercent >= 100 {
+		return errors.New("手续费比例必须小于 100%")
+	}
+	if policy.MaxAmount > 0 && policy.MaxAmount < policy.MinAmount {
+		return errors.New("单笔最高金额不能小于最低金额")
+	}
+	if policy.Chain != "" && !util.IsValidChain(policy.Chain) {
+		return errors.New("不支持的链")
+	}
+	if policy.MerchantID != 0 {
+		var count int64
+		model.GetDB().Model(&model.Merchant{}).Where("id = ?", policy.MerchantID).Count(&count)
+		if count == 0 {
+			return errors.New("商户不存在")
+		}
+	}
+
+	var count int64
+	model.GetDB().Model(&model.WithdrawPolicy{}).
+		Where("merchant_id = ? AND chain = ? AND id <> ?", policy.MerchantID, policy.Chain, policy.ID).Count(&count)
+	if count > 0 {
+		return errors.New("该商户在此链上已有提现规则")
+	}
+
+	if policy.ID == 0 {
+		return model.GetDB().Create(policy).Error
+	}
+	return model.GetDB().Save(policy).Error
+}
+
+// DeletePolicy 删除提现规则，删除后回退到更通用的规则
+func (s *WithdrawService) DeletePolicy(id uint) error {
+	result := model.GetDB().Delete(&model.WithdrawPolicy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("提现规则不存在")
+	}
+	return nil
+}
+
+// dayStart 当天零点(服务器时区)
+func dayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// weekStart 本周一零点(服务器时区)
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return dayStart(t).AddDate(0, 0, -offset)
+}
+
+// formatUSD 金额展示，去掉多余的小数位
+func formatUSD(amount float64) string {
+	return decimal.NewFromFloat(amount).Round(2).String()
+}
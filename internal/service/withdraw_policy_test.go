@@ -0,0 +1,180 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ezpay/internal/model"
+)
+
+func TestEffectivePolicyPrecedence(t *testing.T) {
+	db := setupTestDB(t)
+	s := GetWithdrawService()
+	const merchantID = 7
+
+	// 依次添加更具体的规则，每次都应由最具体的一条生效
+	steps := []struct {
+		policy model.WithdrawPolicy
+		want   float64 // 生效规则的最低金额
+	}{
+		{policy: model.WithdrawPolicy{MerchantID: 8, Chain: "trc20", MinAmount: 99}, want: defaultWithdrawPolicy.MinAmount},
+		{policy: model.WithdrawPolicy{MinAmount: 10}, want: 10},
+		{policy: model.WithdrawPolicy{Chain: "trc20", MinAmount: 20}, want: 20},
+		{policy: model.WithdrawPolicy{MerchantID: merchantID, MinAmount: 30}, want: 30},
+		{policy: model.WithdrawPolicy{MerchantID: merchantID, Chain: "trc20", MinAmount: 40}, want: 40},
+	}
+	for _, step := range steps {
+		if err := db.Create(&step.policy).Error; err != nil {
+			t.Fatalf("create policy: %v", err)
+		}
+		if got := s.EffectivePolicy(merchantID, "trc20"); got.MinAmount != step.want {
+			t.Errorf("after adding merchant=%d chain=%q: min amount = %v, want %v",
+				step.policy.MerchantID, step.policy.Chain, got.MinAmount, step.want)
+		}
+	}
+
+	// 其他链只匹配商户通用规则
+	if got := s.EffectivePolicy(merchantID, "bep20"); got.MinAmount != 30 {
+		t.Errorf("bep20 min amount = %v, want the merchant-wide 30", got.MinAmount)
+	}
+}
+
+func TestCheckWithdrawPolicy(t *testing.T) {
+	now := time.Now()
+	lastWeek := weekStart(now).Add(-time.Hour)
+	thisWeek := weekStart(now)
+	tests := []struct {
+		name    string
+		policy  model.WithdrawPolicy
+		history []model.Withdrawal
+		amount  float64
+		wantFee float64
+		wantErr string
+	}{
+		{
+			name:    "fee",
+			policy:  model.WithdrawPolicy{FeeFixed: 1, FeePercent: 0.5},
+			amount:  100,
+			wantFee: 1.5,
+		},
+		{
+			name:    "below minimum",
+			policy:  model.WithdrawPolicy{MinAmount: 50},
+			amount:  49.99,
+			wantErr: "最低提现金额为 50 USD",
+		},
+		{
+			name:    "above maximum",
+			policy:  model.WithdrawPolicy{MaxAmount: 500},
+			amount:  500.01,
+			wantErr: "单笔最高提现金额为 500 USD",
+		},
+		{
+			name:    "fee equals amount",
+			policy:  model.WithdrawPolicy{FeeFixed: 5},
+			amount:  5,
+			wantErr: "不足以支付手续费",
+		},
+		{
+			name:    "fee exceeds amount",
+			policy:  model.WithdrawPolicy{FeeFixed: 5},
+			amount:  4,
+			wantErr: "不足以支付手续费",
+		},
+		{
+			name:   "daily limit excludes rejected",
+			policy: model.WithdrawPolicy{DailyLimit: 100},
+			history: []model.Withdrawal{
+				{Amount: 60, Status: model.WithdrawStatusPaid},
+				{Amount: 500, Status: model.WithdrawStatusRejected},
+			},
+			amount: 40,
+		},
+		{
+			name:   "daily limit exceeded",
+			policy: model.WithdrawPolicy{DailyLimit: 100},
+			history: []model.Withdrawal{
+				{Amount: 60, Status: model.WithdrawStatusPending},
+			},
+			amount:  40.01,
+			wantErr: "超出每日提现额度 100 USD，今日已提现 60 USD",
+		},
+		{
+			name:   "chain daily limit counts only that chain",
+			policy: model.WithdrawPolicy{Chain: "trc20", DailyLimit: 100},
+			history: []model.Withdrawal{
+				{Amount: 90, PayMethod: "bep20", Status: model.WithdrawStatusPaid},
+			},
+			amount: 100,
+		},
+		{
+			name:   "weekly limit excludes rejected and last week",
+			policy: model.WithdrawPolicy{WeeklyLimit: 100},
+			history: []model.Withdrawal{
+				{Amount: 50, Status: model.WithdrawStatusApproved, CreatedAt: thisWeek},
+				{Amount: 80, Status: model.WithdrawStatusRejected, CreatedAt: thisWeek},
+				{Amount: 80, Status: model.WithdrawStatusPaid, CreatedAt: lastWeek},
+			},
+			amount: 50,
+		},
+		{
+			name:   "weekly limit exceeded",
+			policy: model.WithdrawPolicy{WeeklyLimit: 100},
+			history: []model.Withdrawal{
+				{Amount: 50, Status: model.WithdrawStatusApproved, CreatedAt: thisWeek},
+			},
+			amount:  51,
+			wantErr: "超出每周提现额度 100 USD，本周已提现 50 USD",
+		},
+		{
+			name:   "daily count excludes rejected",
+			policy: model.WithdrawPolicy{DailyCount: 2},
+			history: []model.Withdrawal{
+				{Amount: 10, Status: model.WithdrawStatusPaid},
+				{Amount: 10, Status: model.WithdrawStatusRejected},
+			},
+			amount: 10,
+		},
+		{
+			name:   "daily count reached",
+			policy: model.WithdrawPolicy{DailyCount: 2},
+			history: []model.Withdrawal{
+				{Amount: 10, Status: model.WithdrawStatusPaid},
+				{Amount: 10, Status: model.WithdrawStatusPending},
+			},
+			amount:  10,
+			wantErr: "每日最多提现 2 笔",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+			db.Create(&merchant)
+			for _, w := range tt.history {
+				w.MerchantID, w.RealAmount, w.Account = merchant.ID, w.Amount, "TAddress"
+				if w.PayMethod == "" {
+					w.PayMethod = "trc20"
+				}
+				if err := db.Create(&w).Error; err != nil {
+					t.Fatalf("create withdrawal: %v", err)
+				}
+			}
+
+			fee, err := GetWithdrawService().checkWithdrawPolicy(db, merchant.ID, tt.policy, tt.amount)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkWithdrawPolicy: %v", err)
+			}
+			if fee != tt.wantFee {
+				t.Errorf("fee = %v, want %v", fee, tt.wantFee)
+			}
+		})
+	}
+}
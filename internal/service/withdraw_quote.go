@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ezpay/internal/model"
+	"ezpay/internal/util"
+
+	"github.com/shopspring/decimal"
+)
+
+// WithdrawQuote 提现报价: 扣除手续费后的 USD 金额按卖出汇率折算为打款货币
+type WithdrawQuote struct {
+	Amount         float64   `json:"amount"`          // 提现金额（USD）
+	Fee            float64   `json:"fee"`             // 手续费（USD）
+	RealAmount     float64   `json:"real_amount"`     // 扣除手续费后金额（USD）
+	PayoutCurrency string    `json:"payout_currency"` // 打款货币
+	PayoutAmount   float64   `json:"payout_amount"`   // 打款金额
+	PayoutRate     float64   `json:"payout_rate"`     // 卖出汇率: 1 USD 兑换的打款货币数量
+	QuotedAt       time.Time `json:"quoted_at"`
+	ExpiresAt      time.Time `json:"expires_at"` // 锁定截止时间，此后审核按当前汇率重新报价
+}
+
+// PayoutCurrencies 提现地址所在链可选的打款货币，第一个为默认
+// TRON 地址可收 TRX 或 USDT，登记为 TRX 链的提现地址默认打款 TRX，其他链只打款 USDT；
+// 热钱包自动打款的链只提供能自动发送的代币(TRX 等原生币不支持自动打款)
+func PayoutCurrencies(chain string) []string {
+	var currencies []string
+	switch {
+	case chain == "trx":
+		currencies = []string{"TRX", "USDT"}
+	case util.IsTronChain(chain):
+		currencies = []string{"USDT", "TRX"}
+	default:
+		currencies = []string{"USDT"}
+	}
+
+	payout := GetPayoutService()
+	if !payout.Enabled(chain) {
+		return currencies
+	}
+	sendable := make([]string, 0, len(currencies))
+	for _, c := range currencies {
+		if payout.CanSend(chain, c) {
+			sendable = append(sendable, c)
+		}
+	}
+	return sendable
+}
+
+// QuoteWithdrawal 按商户提现规则和当前卖出汇率报价，提交提现前展示
+func (s *WithdrawService) QuoteWithdrawal(merchantID, addressID uint, amount float64, currency string) (*WithdrawQuote, error) {
+	var address model.WithdrawAddress
+	if err := model.GetDB().Where("id = ? AND merchant_id = ?", addressID, merchantID).First(&address).Error; err != nil {
+		return nil, errors.New("提现地址不存在")
+	}
+	currency, err := s.payoutCurrency(address.Chain, currency)
+	if err != nil {
+		return nil, err
+	}
+	return s.quote(s.EffectivePolicy(merchantID, address.Chain), amount, currency)
+}
+
+// quote 计算手续费并按当前卖出汇率折算打款金额
+func (s *WithdrawService) quote(policy model.WithdrawPolicy, amount float64, currency string) (*WithdrawQuote, error) {
+	fee := CalcWithdrawFee(policy, amount)
+	realAmount, _ := decimal.NewFromFloat(amount).Sub(decimal.NewFromFloat(fee)).Round(2).Float64()
+	if realAmount <= 0 {
+		return nil, errors.New("提现金额不足以支付手续费")
+	}
+
+	payoutAmount, payoutRate, err := s.convertPayout(realAmount, currency)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &WithdrawQuote{
+		Amount:         amount,
+		Fee:            fee,
+		RealAmount:     realAmount,
+		PayoutCurrency: currency,
+		PayoutAmount:   payoutAmount,
+		PayoutRate:     payoutRate,
+		QuotedAt:       now,
+		ExpiresAt:      now.Add(s.quoteTTL()),
+	}, nil
+}
+
+// convertPayout 使用卖出汇率将 USD 金额折算为打款货币
+func (s *WithdrawService) convertPayout(realAmount float64, currency string) (float64, float64, error) {
+	result, err := GetRateService().ConvertFromSettlementCurrency(decimal.NewFromFloat(realAmount), currency)
+	if err != nil {
+		return 0, 0, fmt.Errorf("计算打款金额失败: %w", err)
+	}
+	if !result.Amount.IsPositive() {
+		return 0, 0, errors.New("计算打款金额失败: 汇率无效")
+	}
+	payoutAmount, _ := result.Amount.Float64()
+	payoutRate, _ := result.Rate.Round(4).Float64()
+	return payoutAmount, payoutRate, nil
+}
+
+// payoutCurrency 校验打款货币，未指定时使用链的默认货币
+func (s *WithdrawService) payoutCurrency(chain, currency string) (string, error) {
+	currencies := PayoutCurrencies(chain)
+	if len(currencies) == 0 {
+		return "", errors.New("该链暂无可用的打款币种")
+	}
+	if currency == "" {
+		return currencies[0], nil
+	}
+	for _, c := range currencies {
+		if c == currency {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("该提现地址不支持 %s 打款", currency)
+}
+
+// quoteTTL 报价锁定时间，0 表示审核时总是重新报价
+func (s *WithdrawService) quoteTTL() time.Duration {
+	minutes, err := strconv.Atoi(GetRateService().GetConfigValue(model.ConfigKeyWithdrawQuoteTTL, "30"))
+	if err != nil || minutes < 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
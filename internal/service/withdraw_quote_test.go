@@ -0,0 +1,74 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"ezpay/internal/model"
+)
+
+func TestPayoutCurrencies(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&model.Token{Chain: "trc20", Symbol: "USDT", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6, Enabled: true})
+
+	if got, want := PayoutCurrencies("trc20"), []string{"USDT", "TRX"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("manual payout: PayoutCurrencies(trc20) = %v, want %v", got, want)
+	}
+	if got, want := PayoutCurrencies("trx"), []string{"TRX", "USDT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PayoutCurrencies(trx) = %v, want %v", got, want)
+	}
+	if got, want := PayoutCurrencies("erc20"), []string{"USDT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PayoutCurrencies(erc20) = %v, want %v", got, want)
+	}
+
+	withPayoutSender(t, "trc20", &stubSender{})
+	if got, want := PayoutCurrencies("trc20"), []string{"USDT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("auto payout: PayoutCurrencies(trc20) = %v, want %v", got, want)
+	}
+
+	s := GetWithdrawService()
+	if _, err := s.payoutCurrency("trc20", "TRX"); err == nil {
+		t.Error("auto payout: payoutCurrency(trc20, TRX) accepted a currency the hot wallet cannot send")
+	}
+	if c, err := s.payoutCurrency("trc20", ""); err != nil || c != "USDT" {
+		t.Errorf("auto payout: default currency = %q, %v, want USDT", c, err)
+	}
+
+	// 代币停用后自动打款的链没有可用币种
+	db.Model(&model.Token{}).Where("chain = ?", "trc20").Update("enabled", false)
+	GetTokenService().Invalidate()
+	if _, err := s.payoutCurrency("trc20", ""); err == nil {
+		t.Error("payoutCurrency with no sendable token returned no error")
+	}
+}
+
+func TestSendBatchSkipsUnsendableCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	db.Create(&model.Token{Chain: "trc20", Symbol: "USDT", Contract: "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t", Decimals: 6, Enabled: true})
+	sender := &stubSender{}
+	listener := withPayoutSender(t, "trc20", sender)
+
+	// 自动打款上线前审核通过的 TRX 提现
+	trx := model.Withdrawal{MerchantID: 1, Amount: 10, RealAmount: 10, PayoutAmount: 30, PayoutCurrency: "TRX",
+		PayMethod: "trc20", Account: "TReceiver1", Status: model.WithdrawStatusApproved}
+	usdt := model.Withdrawal{MerchantID: 1, Amount: 10, RealAmount: 10, PayoutAmount: 10, PayoutCurrency: "USDT",
+		PayMethod: "trc20", Account: "TReceiver2", Status: model.WithdrawStatusApproved}
+	db.Create(&trx)
+	db.Create(&usdt)
+
+	GetPayoutService().sendBatch(listener, sender)
+
+	var got model.Withdrawal
+	db.First(&got, trx.ID)
+	if got.Status != model.WithdrawStatusApproved || got.PayoutError != "" || got.PayoutBatchID != 0 {
+		t.Errorf("TRX withdrawal touched by payout engine: status=%d error=%q batch=%d", got.Status, got.PayoutError, got.PayoutBatchID)
+	}
+	var sent model.Withdrawal
+	db.First(&sent, usdt.ID)
+	if sent.Status != model.WithdrawStatusPaying || sent.PayoutTxHash == "" {
+		t.Errorf("USDT withdrawal not sent: status=%d tx=%q", sent.Status, sent.PayoutTxHash)
+	}
+	if len(sender.built) != 1 || len(sender.built[0]) != 1 {
+		t.Errorf("built %v, want one batch with the USDT transfer only", sender.built)
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"ezpay/internal/model"
+)
+
+func TestCreateWithdrawAddressValidation(t *testing.T) {
+	db := setupTestDB(t)
+	merchant := model.Merchant{PID: "M1001", Name: "test", Key: "key", Status: 1}
+	db.Create(&merchant)
+
+	tests := []struct {
+		name    string
+		chain   string
+		address string
+		wantErr bool
+	}{
+		{name: "trc20", chain: "trc20", address: " TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t "},
+		{name: "trx", chain: "trx", address: "TLa2f6VPqDgRE67v1736s7bJ8Ray5wYjU7"},
+		{name: "evm", chain: "bep20", address: "0x55d398326f99059fF775485246999027B3197955"},
+		{name: "unknown chain", chain: "dogecoin", address: "D8vFz4p1L37jdg47HXKtSHA5uYLYxbGgPD", wantErr: true},
+		{name: "fiat", chain: "alipay", address: "https://qr.alipay.com/abc", wantErr: true},
+		{name: "wrong format", chain: "trc20", address: "0x55d398326f99059fF775485246999027B3197955", wantErr: true},
+		{name: "empty", chain: "polygon", address: "", wantErr: true},
+	}
+	s := GetWithdrawService()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := s.CreateWithdrawAddress(merchant.ID, tt.chain, tt.address, "", 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("address %q on %s accepted", tt.address, tt.chain)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateWithdrawAddress: %v", err)
+			}
+			if address.Status != model.WithdrawAddressPending {
+				t.Errorf("status = %d, want pending", address.Status)
+			}
+		})
+	}
+}
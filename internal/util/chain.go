@@ -0,0 +1,97 @@
+package util
+
+import "sync"
+
+// 链扫描器类型，决定使用哪个扫描器实现
+const (
+	ChainTypeTron   = "tron"   // TRON 原生币(TronGrid)
+	ChainTypeTRC20  = "trc20"  // TRON TRC20 代币(TronGrid)
+	ChainTypeEVM    = "evm"    // EVM 兼容链(JSON-RPC)
+	ChainTypeSolana = "solana" // Solana SPL 代币(JSON-RPC)
+	ChainTypeTON    = "ton"    // TON Jetton(toncenter v3 API)
+	ChainTypeUTXO   = "utxo"   // UTXO 链原生币 BTC/LTC(Esplora API)
+)
+
+// ChainInfo 链元数据
+type ChainInfo struct {
+	ID           string // 链标识(配置键、订单 chain 字段): trc20, erc20, linea ...
+	Name         string // 显示名称
+	Type         string // 扫描器类型: tron, trc20, evm, solana, ton, utxo
+	NativeSymbol string // 原生币符号，为空表示该链不收原生币
+}
+
+// builtinChains 内置链，配置文件可覆盖或新增(blockchain.<id>.type/name/native_symbol)
+var builtinChains = []ChainInfo{
+	{ID: "trx", Name: "TRX (Tron)", Type: ChainTypeTron, NativeSymbol: "TRX"},
+	{ID: "trc20", Name: "TRC20 (Tron)", Type: ChainTypeTRC20},
+	{ID: "erc20", Name: "ERC20 (Ethereum)", Type: ChainTypeEVM, NativeSymbol: "ETH"},
+	{ID: "bep20", Name: "BEP20 (BSC)", Type: ChainTypeEVM, NativeSymbol: "BNB"},
+	{ID: "polygon", Name: "Polygon", Type: ChainTypeEVM, NativeSymbol: "POL"},
+	{ID: "optimism", Name: "Optimism", Type: ChainTypeEVM, NativeSymbol: "ETH"},
+	{ID: "arbitrum", Name: "Arbitrum", Type: ChainTypeEVM, NativeSymbol: "ETH"},
+	{ID: "avalanche", Name: "Avalanche", Type: ChainTypeEVM, NativeSymbol: "AVAX"},
+	{ID: "base", Name: "Base", Type: ChainTypeEVM, NativeSymbol: "ETH"},
+	{ID: "solana", Name: "Solana", Type: ChainTypeSolana},
+	{ID: "ton", Name: "TON", Type: ChainTypeTON},
+	{ID: "btc", Name: "Bitcoin", Type: ChainTypeUTXO, NativeSymbol: "BTC"},
+	{ID: "ltc", Name: "Litecoin", Type: ChainTypeUTXO, NativeSymbol: "LTC"},
+}
+
+var (
+	chainMu    sync.RWMutex
+	chainIndex = make(map[string]ChainInfo)
+	chainOrder []string
+)
+
+func init() {
+	for _, info := range builtinChains {
+		RegisterChain(info)
+	}
+}
+
+// RegisterChain 登记链(已登记时覆盖元数据，保持原有顺序)
+func RegisterChain(info ChainInfo) {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+	if _, ok := chainIndex[info.ID]; !ok {
+		chainOrder = append(chainOrder, info.ID)
+	}
+	chainIndex[info.ID] = info
+}
+
+// GetChain 获取链元数据
+func GetChain(chain string) (ChainInfo, bool) {
+	chainMu.RLock()
+	defer chainMu.RUnlock()
+	info, ok := chainIndex[chain]
+	return info, ok
+}
+
+// Chains 全部登记的链(按登记顺序，内置链在前)
+func Chains() []ChainInfo {
+	chainMu.RLock()
+	defer chainMu.RUnlock()
+	chains := make([]ChainInfo, 0, len(chainOrder))
+	for _, id := range chainOrder {
+		chains = append(chains, chainIndex[id])
+	}
+	return chains
+}
+
+// IsTronChain 是否为 TRON 网络(TRX/TRC20)
+func IsTronChain(chain string) bool {
+	info, ok := GetChain(chain)
+	return ok && (info.Type == ChainTypeTron || info.Type == ChainTypeTRC20)
+}
+
+// IsUTXOChain 是否为 UTXO 链(BTC/LTC)
+func IsUTXOChain(chain string) bool {
+	info, ok := GetChain(chain)
+	return ok && info.Type == ChainTypeUTXO
+}
+
+// IsEVMChain 是否为 EVM 兼容链
+func IsEVMChain(chain string) bool {
+	info, ok := GetChain(chain)
+	return ok && info.Type == ChainTypeEVM
+}
@@ -30,62 +30,92 @@ func GetClientIP(r *http.Request) string {
 	return ip
 }
 
-// GetPaymentTypeChain 根据支付类型获取链名
-func GetPaymentTypeChain(payType string) string {
+// chainAliases 支付类型中的链名别名
+var chainAliases = map[string]string{
+	"trc20":     "trc20",
+	"tron":      "trc20",
+	"erc20":     "erc20",
+	"eth":       "erc20",
+	"bep20":     "bep20",
+	"bsc":       "bep20",
+	"polygon":   "polygon",
+	"optimism":  "optimism",
+	"op":        "optimism",
+	"arbitrum":  "arbitrum",
+	"arb":       "arbitrum",
+	"avalanche": "avalanche",
+	"avax":      "avalanche",
+	"base":      "base",
+	"solana":    "solana",
+	"sol":       "solana",
+	"ton":       "ton",
+	"btc":       "btc",
+	"bitcoin":   "btc",
+	"ltc":       "ltc",
+	"litecoin":  "ltc",
+}
+
+// ParsePaymentType 解析支付类型为代币符号和链名
+// 例如: usdt_trc20 -> (USDT, trc20), usdc_base -> (USDC, base), eth_arbitrum -> (ETH, arbitrum), trx -> (TRX, trx), btc -> (BTC, btc)
+// 只写链名时代币默认为 USDT，只写原生币时为其主链，法币收款代币为空
+func ParsePaymentType(payType string) (token, chain string) {
 	switch payType {
 	case "trx", "trx_native":
-		return "trx"
-	case "usdt_trc20", "usdt_tron", "trc20":
-		return "trc20"
-	case "usdt_erc20", "usdt_eth", "erc20":
-		return "erc20"
-	case "usdt_bep20", "usdt_bsc", "bep20":
-		return "bep20"
-	case "usdt_polygon", "polygon":
-		return "polygon"
-	case "usdt_optimism", "optimism", "op":
-		return "optimism"
-	case "usdt_arbitrum", "arbitrum", "arb":
-		return "arbitrum"
-	case "usdt_avalanche", "avalanche", "avax":
-		return "avalanche"
-	case "usdt_base", "base":
-		return "base"
+		return "TRX", "trx"
+	case "eth":
+		return "ETH", "erc20"
+	case "bnb":
+		return "BNB", "bep20"
+	case "pol", "matic":
+		return "POL", "polygon"
+	case "btc", "bitcoin":
+		return "BTC", "btc"
+	case "ltc", "litecoin":
+		return "LTC", "ltc"
 	case "wechat", "wxpay", "1":
-		return "wechat"
+		return "", "wechat"
 	case "alipay", "2":
-		return "alipay"
-	default:
-		return payType
+		return "", "alipay"
+	case "trc20", "erc20", "bep20", "polygon", "optimism", "op", "arbitrum", "arb", "avalanche", "avax", "base", "solana", "ton":
+		// 只写链名(兼容旧参数)
+		return "USDT", chainAliases[payType]
+	}
+
+	if idx := strings.Index(payType, "_"); idx > 0 {
+		if chain, ok := chainAliases[payType[idx+1:]]; ok {
+			return strings.ToUpper(payType[:idx]), chain
+		}
+		// 配置文件新增的链，如 usdt_linea
+		if _, ok := GetChain(payType[idx+1:]); ok {
+			return strings.ToUpper(payType[:idx]), payType[idx+1:]
+		}
 	}
+	return "", payType
+}
+
+// GetPaymentTypeChain 根据支付类型获取链名
+func GetPaymentTypeChain(payType string) string {
+	_, chain := ParsePaymentType(payType)
+	return chain
 }
 
-// NormalizePaymentType 标准化支付类型
+// NormalizePaymentType 标准化支付类型，如 usdt_trc20、usdc_base
 func NormalizePaymentType(payType string) string {
-	chain := GetPaymentTypeChain(payType)
-	// 微信/支付宝/TRX不需要加usdt_前缀
-	if chain == "wechat" || chain == "alipay" || chain == "trx" {
+	token, chain := ParsePaymentType(payType)
+	// 微信/支付宝/TRX/BTC/LTC 等以原生币命名的链不需要加币种前缀
+	if chain == "wechat" || chain == "alipay" || strings.ToLower(token) == chain || token == "" {
 		return chain
 	}
-	return "usdt_" + chain
+	return strings.ToLower(token) + "_" + chain
 }
 
-// IsValidChain 检查链是否有效
+// IsValidChain 检查链是否有效(已登记的区块链或法币收款方式)
 func IsValidChain(chain string) bool {
-	validChains := map[string]bool{
-		"trx":       true,
-		"trc20":     true,
-		"erc20":     true,
-		"bep20":     true,
-		"polygon":   true,
-		"optimism":  true,
-		"arbitrum":  true,
-		"avalanche": true,
-		"base":      true,
-		"wechat":    true,
-		"alipay":    true,
+	if IsFiatChain(chain) {
+		return true
 	}
-	return validChains[chain]
+	_, ok := GetChain(chain)
+	return ok
 }
 
 // IsFiatChain 检查是否为法币收款方式(微信/支付宝)
@@ -1,7 +1,9 @@
 package util
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"log"
 	"net/url"
@@ -175,6 +177,13 @@ func MD5(s string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// HMACSHA256 计算 HMAC-SHA256 签名(小写十六进制)
+func HMACSHA256(data, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // BuildQueryString 构建查询字符串
 func BuildQueryString(params map[string]string) string {
 	values := url.Values{}
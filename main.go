@@ -44,6 +44,16 @@ func main() {
 		log.Fatalf("Failed to init database: %v", err)
 	}
 
+	// 命令行补扫: ezpay rescan -chain <链> -from <起始> -to <结束>
+	if len(os.Args) > 1 && os.Args[1] == "rescan" {
+		os.Exit(runRescan(cfg, os.Args[2:]))
+	}
+
+	// 命令行管理管理员账号: ezpay admin <list|create|disable|enable|reset-password>
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdmin(os.Args[2:]))
+	}
+
 	// 初始化服务
 	initServices(cfg)
 
@@ -113,6 +123,11 @@ func initServices(cfg *config.Config) {
 	service.GetBlockchainService().Init(cfg)
 	service.GetBlockchainService().SetWalletCacheTTL(cfg.Order.WalletCacheTTL)
 
+	// 加载热钱包(启用自动打款时)，keystore 或密码错误时拒绝启动
+	if err := service.GetPayoutService().Init(cfg); err != nil {
+		log.Fatalf("Failed to init payout hot wallet: %v", err)
+	}
+
 	// 初始化汇率服务
 	rateService := service.GetRateService()
 	rateService.SetCacheSeconds(cfg.Rate.CacheSeconds)
@@ -153,6 +168,9 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		// 检查订单状态 (轮询)
 		paymentAPI.GET("/api/check_order", epayHandler.CheckOrder)
 
+		// 订单退款
+		paymentAPI.POST("/api/refund", epayHandler.Refund)
+
 		// ============ V免签兼容接口 ============
 		paymentAPI.GET("/createOrder", vmqHandler.CreateOrder)
 		paymentAPI.GET("/appHeart", vmqHandler.AppHeart)
@@ -197,6 +215,8 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		adminAPI.GET("/orders/:trade_no", adminHandler.GetOrder)
 		adminAPI.POST("/orders/:trade_no/paid", adminHandler.MarkOrderPaid)
 		adminAPI.POST("/orders/:trade_no/notify", adminHandler.RetryNotify)
+		adminAPI.GET("/orders/:trade_no/notify-tasks", adminHandler.ListOrderNotifyTasks)
+		adminAPI.POST("/orders/:trade_no/refund", adminHandler.RefundOrder)
 		adminAPI.POST("/orders/test", adminHandler.CreateTestOrder)
 		adminAPI.POST("/orders/clean", adminHandler.CleanInvalidOrders)
 
@@ -207,12 +227,20 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		adminAPI.GET("/merchants/:id/key", adminHandler.GetMerchantKey)
 		adminAPI.POST("/merchants/:id/reset-key", adminHandler.ResetMerchantKey)
 		adminAPI.POST("/merchants/:id/balance", adminHandler.AdjustMerchantBalance)
+		adminAPI.GET("/merchants/:id/ledger", adminHandler.ListMerchantLedger)
+		adminAPI.POST("/merchants/:id/withdrawals", adminHandler.CreateMerchantWithdrawal)
+		adminAPI.POST("/merchants/:id/withdraw-addresses", adminHandler.CreateMerchantWithdrawAddress)
+		adminAPI.GET("/ledger", adminHandler.ListMerchantLedger)
 
 		// 钱包管理
 		adminAPI.GET("/wallets", adminHandler.ListWallets)
 		adminAPI.POST("/wallets", adminHandler.CreateWallet)
 		adminAPI.PUT("/wallets/:id", adminHandler.UpdateWallet)
 		adminAPI.DELETE("/wallets/:id", adminHandler.DeleteWallet)
+		adminAPI.GET("/hd-wallets", adminHandler.ListHDWallets)
+		adminAPI.POST("/hd-wallets", adminHandler.CreateHDWallet)
+		adminAPI.PUT("/hd-wallets/:id", adminHandler.UpdateHDWallet)
+		adminAPI.DELETE("/hd-wallets/:id", adminHandler.DeleteHDWallet)
 		adminAPI.POST("/upload/qrcode", adminHandler.UploadQRCode)
 
 		// 汇率管理
@@ -232,6 +260,9 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 
 		// 交易日志
 		adminAPI.GET("/transactions", adminHandler.GetTransactionLogs)
+		adminAPI.GET("/transactions/unmatched", adminHandler.ListUnmatchedTransfers)
+		adminAPI.GET("/transactions/:id/candidates", adminHandler.ListTransferCandidates)
+		adminAPI.POST("/transactions/:id/assign", adminHandler.AssignTransfer)
 
 		// API调用日志
 		adminAPI.GET("/api-logs", adminHandler.GetAPILogs)
@@ -246,6 +277,9 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		// 修改密码
 		adminAPI.POST("/password", adminHandler.ChangePassword)
 
+		// 管理员列表(账号通过命令行 ezpay admin 管理)
+		adminAPI.GET("/admins", adminHandler.ListAdmins)
+
 		// 测试机器人通知
 		adminAPI.POST("/test-bot", func(c *gin.Context) {
 			if err := service.GetBotService().SendTestMessage(); err != nil {
@@ -280,12 +314,36 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		adminAPI.POST("/chains/:chain/enable", adminHandler.EnableChain)
 		adminAPI.POST("/chains/:chain/disable", adminHandler.DisableChain)
 		adminAPI.POST("/chains/batch", adminHandler.BatchUpdateChains)
+		adminAPI.POST("/chains/:chain/rescan", adminHandler.StartRescan)
+		adminAPI.GET("/rescan-jobs", adminHandler.ListRescanJobs)
+		adminAPI.GET("/rescan-jobs/:id", adminHandler.GetRescanJob)
+		adminAPI.POST("/rescan-jobs/:id/cancel", adminHandler.CancelRescanJob)
+		adminAPI.GET("/tokens", adminHandler.ListTokens)
+		adminAPI.POST("/tokens", adminHandler.CreateToken)
+		adminAPI.PUT("/tokens/:id", adminHandler.UpdateToken)
+		adminAPI.DELETE("/tokens/:id", adminHandler.DeleteToken)
 
 		// 提现管理
 		adminAPI.GET("/withdrawals", adminHandler.ListWithdrawals)
 		adminAPI.POST("/withdrawals/:id/approve", adminHandler.ApproveWithdrawal)
 		adminAPI.POST("/withdrawals/:id/reject", adminHandler.RejectWithdrawal)
 		adminAPI.POST("/withdrawals/:id/complete", adminHandler.CompleteWithdrawal)
+		adminAPI.POST("/withdrawals/:id/retry-payout", adminHandler.RetryWithdrawalPayout)
+		adminAPI.GET("/payout-batches", adminHandler.ListPayoutBatches)
+		adminAPI.GET("/payout-batches/:id", adminHandler.GetPayoutBatch)
+		adminAPI.GET("/withdraw-policies", adminHandler.ListWithdrawPolicies)
+		adminAPI.POST("/withdraw-policies", adminHandler.CreateWithdrawPolicy)
+		adminAPI.PUT("/withdraw-policies/:id", adminHandler.UpdateWithdrawPolicy)
+		adminAPI.DELETE("/withdraw-policies/:id", adminHandler.DeleteWithdrawPolicy)
+
+		// 退款管理
+		adminAPI.GET("/refunds", adminHandler.ListRefunds)
+		adminAPI.POST("/refunds/:id/payout", adminHandler.CompleteRefundPayout)
+
+		// 余额对账
+		adminAPI.GET("/reconciliation", adminHandler.ListReconciliations)
+		adminAPI.POST("/reconciliation/run", adminHandler.RunReconciliation)
+		adminAPI.POST("/reconciliation/:id/resolve", adminHandler.ResolveReconciliation)
 
 		// 提现地址审核
 		adminAPI.GET("/withdraw-addresses", adminHandler.ListWithdrawAddresses)
@@ -328,8 +386,13 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		// 订单管理
 		merchantAPI.GET("/orders", merchantHandler.ListOrders)
 		merchantAPI.GET("/orders/:trade_no", merchantHandler.GetOrder)
+		merchantAPI.GET("/orders/:trade_no/notify-tasks", merchantHandler.ListOrderNotifyTasks)
+		merchantAPI.GET("/orders/:trade_no/notifications", merchantHandler.ListOrderNotifications)
+		merchantAPI.POST("/orders/:trade_no/notify", merchantHandler.ResendNotify)
 		merchantAPI.POST("/orders/:trade_no/confirm", merchantHandler.ConfirmPayment)
 		merchantAPI.POST("/orders/:trade_no/cancel", merchantHandler.CancelOrder)
+		merchantAPI.POST("/orders/:trade_no/refund", merchantHandler.RefundOrder)
+		merchantAPI.GET("/refunds", merchantHandler.ListRefunds)
 		merchantAPI.POST("/orders/test", merchantHandler.CreateTestOrder)
 
 		// 钱包管理
@@ -337,6 +400,10 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		merchantAPI.POST("/wallets", merchantHandler.CreateWallet)
 		merchantAPI.PUT("/wallets/:id", merchantHandler.UpdateWallet)
 		merchantAPI.DELETE("/wallets/:id", merchantHandler.DeleteWallet)
+		merchantAPI.GET("/hd-wallets", merchantHandler.ListHDWallets)
+		merchantAPI.POST("/hd-wallets", merchantHandler.CreateHDWallet)
+		merchantAPI.PUT("/hd-wallets/:id", merchantHandler.UpdateHDWallet)
+		merchantAPI.DELETE("/hd-wallets/:id", merchantHandler.DeleteHDWallet)
 		merchantAPI.POST("/upload/qrcode", merchantHandler.UploadQRCode)
 
 		// 链状态 (只读)
@@ -344,9 +411,12 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 
 		// 提现管理
 		merchantAPI.GET("/balance", merchantHandler.GetBalance)
+		merchantAPI.GET("/balance/ledger", merchantHandler.ListBalanceLedger)
 		merchantAPI.GET("/recharge-addresses", merchantHandler.GetRechargeAddresses)
 		merchantAPI.GET("/withdrawals", merchantHandler.ListWithdrawals)
 		merchantAPI.POST("/withdrawals", merchantHandler.CreateWithdrawal)
+		merchantAPI.GET("/withdraw-quota", merchantHandler.GetWithdrawQuota)
+		merchantAPI.GET("/withdraw-quote", merchantHandler.GetWithdrawQuote)
 
 		// 提现地址管理
 		merchantAPI.GET("/withdraw-addresses", merchantHandler.ListWithdrawAddresses)
@@ -365,6 +435,15 @@ func registerRoutes(r *gin.Engine, cfg *config.Config) {
 		merchantAPI.GET("/notify-settings", merchantHandler.GetNotifySettings)
 		merchantAPI.PUT("/notify-settings", merchantHandler.UpdateNotifySettings)
 
+		// 收款容差策略
+		merchantAPI.GET("/payment-policy", merchantHandler.GetPaymentPolicy)
+		merchantAPI.PUT("/payment-policy", merchantHandler.UpdatePaymentPolicy)
+
+		// Webhook 事件订阅
+		merchantAPI.GET("/webhook-settings", merchantHandler.GetWebhookSettings)
+		merchantAPI.PUT("/webhook-settings", merchantHandler.UpdateWebhookSettings)
+		merchantAPI.GET("/webhook-events", merchantHandler.ListWebhookEvents)
+
 		// 监控客户端配置
 		merchantAPI.GET("/monitor-config", merchantHandler.GetMonitorConfig)
 	}
@@ -446,12 +525,24 @@ func startBackgroundServices(cfg *config.Config) {
 	// 启动区块链监控
 	service.GetBlockchainService().Start()
 
+	// 上次未结束的补扫任务标记为中断
+	service.GetRescanService().MarkInterrupted()
+
 	// 启动订单过期处理
 	service.GetOrderService().StartExpireWorker()
 
+	// 启动每日余额对账
+	service.GetReconcileService().StartReconcileWorker()
+
 	// 启动通知重试
 	service.GetNotifyService().StartNotifyWorker()
 
+	// 启动事务外发消息分发（结算后的 Telegram 通知等）
+	service.GetOutboxService().StartOutboxWorker()
+
+	// 启动热钱包自动打款
+	service.GetPayoutService().StartPayoutWorker()
+
 	// 启动汇率自动更新（根据配置决定是否启用）
 	if cfg.Rate.AutoUpdateEnabled {
 		rateUpdater := service.NewRateUpdater()
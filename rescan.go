@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"ezpay/config"
+	"ezpay/internal/model"
+	"ezpay/internal/service"
+)
+
+// runRescan 命令行补扫，按区块范围重新扫描链上转账，不启动 HTTP 服务
+//
+//	ezpay rescan -chain erc20 -from 19000000 -to 19001000
+//	ezpay rescan -chain trc20 -from "2024-05-01 10:00:00" -to "2024-05-01 12:00:00"
+func runRescan(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rescan", flag.ContinueOnError)
+	chain := fs.String("chain", "", "链标识，如 erc20、trc20、solana、btc")
+	from := fs.String("from", "", "起始区块号(TRON/TON 为时间: Unix 秒或 \"2006-01-02 15:04:05\")")
+	to := fs.String("to", "", "结束区块号或时间")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *chain == "" || *from == "" || *to == "" {
+		fs.Usage()
+		return 2
+	}
+
+	service.GetBlockchainService().Init(cfg)
+	rescanService := service.GetRescanService()
+
+	fromPos, toPos, err := rescanService.ParseRange(*chain, *from, *to)
+	if err != nil {
+		log.Printf("补扫失败: %v", err)
+		return 1
+	}
+
+	// Ctrl+C 在当前段扫描完成后停止
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	job, err := rescanService.Run(ctx, *chain, fromPos, toPos, "cli", func(job *model.RescanJob) {
+		done := job.Position - job.FromPos + 1
+		total := job.ToPos - job.FromPos + 1
+		log.Printf("[%s] 补扫进度 %d/%d (%d%%)，新发现转账 %d，匹配订单 %d",
+			job.Chain, job.Position, job.ToPos, done*100/total, job.Found, job.Matched)
+	})
+	if err != nil {
+		log.Printf("补扫失败: %v", err)
+		return 1
+	}
+	if job.Status == model.RescanJobCancelled {
+		log.Printf("补扫任务 #%d 已取消，已扫描到 %d", job.ID, job.Position)
+		return 1
+	}
+
+	log.Printf("补扫任务 #%d 完成: %s %d-%d，新发现转账 %d，匹配订单 %d",
+		job.ID, job.Unit, job.FromPos, job.ToPos, job.Found, job.Matched)
+	return 0
+}